@@ -0,0 +1,205 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"272-backend/config"
+	"272-backend/library"
+	"272-backend/pkg"
+	"272-backend/pkg/analytics"
+	"272-backend/pkg/bsl"
+	"272-backend/pkg/profiles"
+	"272-backend/pkg/ranking"
+	"272-backend/pkg/ratelimit"
+	"272-backend/pkg/storage"
+	"272-backend/pkg/surveys"
+	"272-backend/pkg/upload"
+	"272-backend/routes"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ShutdownTimeout bounds how long Run waits for in-flight requests to drain.
+const ShutdownTimeout = 10 * time.Second
+
+// App owns the HTTP server and every connection it was built from.
+type App struct {
+	Config *config.Config
+	Fiber  *fiber.App
+	Mongo  *mongo.Client
+	Redis  *pkg.RedisInstance
+	Repos  *library.Repositories
+	// Surveys runs survey jobs in the background until Shutdown.
+	Surveys *surveys.Runner
+	// Profiles refreshes portal profiles in the background until Shutdown.
+	Profiles *profiles.Refresher
+	// Ranker refreshes the hot rank of suggestions until Shutdown.
+	Ranker *ranking.Ranker
+}
+
+// New opens Mongo and Redis, builds the repositories and registers every route
+// group. Connections opened before a failure are closed again.
+func New(ctx context.Context, cfg *config.Config) (*App, error) {
+	grades := library.DefaultGradeScale()
+	if cfg.GradeScale != "" {
+		var err error
+		if grades, err = library.ParseGradeScale(cfg.GradeScale, cfg.GradePassPoints); err != nil {
+			return nil, err
+		}
+	}
+	// release undoes what was set up, in reverse, unless New succeeds.
+	var release []func()
+	ok := false
+	defer func() {
+		if ok {
+			return
+		}
+		for i := len(release) - 1; i >= 0; i-- {
+			release[i]()
+		}
+	}()
+	client, db, err := pkg.NewMongo(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	release = append(release, func() { _ = client.Disconnect(context.Background()) })
+	if err := library.EnsureMongoIndexes(ctx, db); err != nil {
+		return nil, err
+	}
+	redis, err := pkg.NewRedis(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	release = append(release, func() { _ = redis.Close() })
+	vault, err := pkg.NewCredentialVault(redis, cfg)
+	if err != nil {
+		return nil, err
+	}
+	anonymizer, err := library.NewAnonymizer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	files, err := storage.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	a := &App{
+		Config: cfg,
+		Fiber:  pkg.NewFiber(cfg),
+		Mongo:  client,
+		Redis:  redis,
+		Repos:  library.NewMongoRepositories(db),
+	}
+	stats := analytics.NewCache(a.Repos.Stats, redis.Client, cfg.StatsCacheTTL)
+	a.Repos.Stats = stats
+	a.Repos.Suggestions = stats.Suggestions(a.Repos.Suggestions)
+	a.Repos.Events = stats.Events(a.Repos.Events)
+	if err := a.Repos.Roles.EnsureRoles(ctx, library.DefaultRoles()); err != nil {
+		return nil, err
+	}
+	for _, votes := range []interface{ CountVotes(context.Context) error }{a.Repos.Suggestions, a.Repos.Projects} {
+		if err := votes.CountVotes(ctx); err != nil {
+			return nil, err
+		}
+	}
+	for _, markdown := range []interface{ RenderMarkdown(context.Context) error }{a.Repos.Projects, a.Repos.Events} {
+		if err := markdown.RenderMarkdown(ctx); err != nil {
+			return nil, err
+		}
+	}
+	a.Ranker = ranking.NewRanker(a.Repos.Suggestions, cfg.RankingInterval)
+	if err := a.Ranker.Start(ctx); err != nil {
+		return nil, err
+	}
+	release = append(release, func() { _ = a.Ranker.Stop(context.Background()) })
+	portal := bsl.NewFromConfig(cfg)
+	a.Surveys = surveys.NewRunner(a.Repos.SurveyJobs, portal, surveys.Options{
+		Workers:    cfg.SurveyWorkers,
+		JobTimeout: cfg.SurveyJobTimeout,
+	})
+	if err := a.Surveys.Start(ctx); err != nil {
+		return nil, err
+	}
+	a.Profiles = profiles.NewRefresher(a.Repos.Users, a.Repos.Departments, portal, vault, profiles.Options{
+		MaxAge:        cfg.ProfileMaxAge,
+		SweepInterval: cfg.ProfileSweepInterval,
+	})
+	a.Profiles.Start()
+	routes.Register(a.Fiber, routes.Deps{
+		Config:     cfg,
+		BSL:        portal,
+		Grades:     grades,
+		Surveys:    a.Surveys,
+		Profiles:   a.Profiles,
+		JWT:        pkg.NewJWT(cfg.JWTSecretKey).WithUsers(a.Repos.Users),
+		Redis:      redis,
+		Vault:      vault,
+		Anonymizer: anonymizer,
+		Repos:      a.Repos,
+		Limiter:    ratelimit.NewLimiter(redis.Client),
+		Lockout: ratelimit.NewLockout(redis.Client, ratelimit.LockoutOptions{
+			Threshold: cfg.LoginLockoutThreshold,
+			Base:      cfg.LoginLockoutBase,
+			Max:       cfg.LoginLockoutMax,
+		}),
+		Uploader: upload.NewUploader(files, a.Repos.Attachments, int64(cfg.AttachmentMaxSizeMB)<<20),
+	})
+	ok = true
+	return a, nil
+}
+
+// Run serves until the listener fails or the process receives SIGINT or
+// SIGTERM, then shuts down gracefully.
+func (a *App) Run() error {
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- a.Fiber.Listen(a.Config.Port)
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	select {
+	case err := <-listenErr:
+		_ = a.Shutdown(context.Background())
+		return err
+	case sig := <-stop:
+		log.Printf("Received %s, shutting down...", sig)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	return a.Shutdown(ctx)
+}
+
+// Shutdown drains Fiber, the survey jobs, profile refreshes and ranking, then
+// closes the Mongo and Redis clients.
+func (a *App) Shutdown(ctx context.Context) error {
+	var errs []error
+	if err := a.Fiber.ShutdownWithContext(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := a.Surveys.Stop(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := a.Profiles.Stop(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := a.Ranker.Stop(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := a.Mongo.Disconnect(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := a.Redis.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,15 @@
+// Command apidocs regenerates the docs package from the handler annotations.
+// Run it from the module root, through go generate.
+package main
+
+import (
+	"log"
+
+	"272-backend/pkg/openapi/docgen"
+)
+
+func main() {
+	if err := docgen.Build(".", "docs", "go", "json", "yaml"); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,524 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds every setting the API needs. Each field is read from the
+// variable named by its env tag; config files use the lower-cased name
+// (MONGO_URI -> mongo_uri).
+type Config struct {
+	MongoURI        string `env:"MONGO_URI" required:"true" secret:"true"`
+	MongoDBName     string `env:"MONGO_DBNAME" required:"true"`
+	RedisURI        string `env:"REDIS_URI" required:"true" secret:"true"`
+	RedirectURI     string `env:"REDIRECT_URI"`
+	JWTSecretKey    string `env:"JWT_SECRET_KEY" required:"true" secret:"true"`
+	Port            string `env:"PORT" default:":3000"`
+	BSLURI          string `env:"BSL_URI" required:"true"`
+	IMAPStudentHost string `env:"IMAP_S_HOST" required:"true"`
+	IMAPTeacherHost string `env:"IMAP_T_HOST" required:"true"`
+	IMAPPort        int    `env:"IMAP_PORT" default:"993"`
+
+	// The scraper drives a real browser, so a single call can take a while.
+	BSLTimeout          time.Duration `env:"BSL_TIMEOUT" default:"30s"`
+	BSLMaxRetries       int           `env:"BSL_MAX_RETRIES" default:"2"`
+	BSLBreakerThreshold int           `env:"BSL_BREAKER_THRESHOLD" default:"5"`
+	BSLBreakerCooldown  time.Duration `env:"BSL_BREAKER_COOLDOWN" default:"30s"`
+
+	// GradeScale overrides the letter grade table, e.g. "AA=4.0,...,EX=pass".
+	GradeScale      string  `env:"GRADE_SCALE"`
+	GradePassPoints float64 `env:"GRADE_PASS_POINTS" default:"1.0"`
+
+	SurveyWorkers    int           `env:"SURVEY_WORKERS" default:"2"`
+	SurveyJobTimeout time.Duration `env:"SURVEY_JOB_TIMEOUT" default:"10m"`
+
+	// Profiles older than ProfileMaxAge are refetched from BSL in the
+	// background. Every ProfileSweepInterval, 0 to turn it off, stale
+	// profiles of users with a remembered password are refetched too.
+	ProfileMaxAge        time.Duration `env:"PROFILE_MAX_AGE" default:"24h"`
+	ProfileSweepInterval time.Duration `env:"PROFILE_SWEEP_INTERVAL" default:"1h"`
+
+	// Dashboard statistics are cached in Redis for StatsCacheTTL, 0 to turn
+	// the cache off. Writes invalidate them earlier.
+	StatsCacheTTL time.Duration `env:"STATS_CACHE_TTL" default:"5m"`
+
+	// The hot rank of suggestions decays with age, so it is refreshed every
+	// RankingInterval besides on every vote; 0 turns the refreshes off.
+	RankingInterval time.Duration `env:"RANKING_INTERVAL" default:"10m"`
+
+	// Rate limits, written as requests per window such as 10/1m, or off.
+	// RateLimitAPI applies per client IP to every route, RateLimitLogin per
+	// IP to logging in and RateLimitSuggestions per user to posting
+	// suggestions.
+	RateLimitAPI         Rate `env:"RATE_LIMIT_API" default:"600/1m"`
+	RateLimitLogin       Rate `env:"RATE_LIMIT_LOGIN" default:"10/1m"`
+	RateLimitSuggestions Rate `env:"RATE_LIMIT_SUGGESTIONS" default:"10/10m"`
+	// After LoginLockoutThreshold failed logins in a row an account is
+	// locked for LoginLockoutBase, doubling with every further failure up to
+	// LoginLockoutMax. A threshold of 0 turns the lockout off.
+	LoginLockoutThreshold int           `env:"LOGIN_LOCKOUT_THRESHOLD" default:"5"`
+	LoginLockoutBase      time.Duration `env:"LOGIN_LOCKOUT_BASE" default:"1m"`
+	LoginLockoutMax       time.Duration `env:"LOGIN_LOCKOUT_MAX" default:"30m"`
+	// Behind a reverse proxy, client addresses are read from ProxyHeader,
+	// such as X-Forwarded-For, on requests from TrustedProxies, a comma
+	// separated list of addresses and CIDR ranges. Requests from anywhere
+	// else count against their own address. The proxy must overwrite the
+	// header, not append to the one the client sent.
+	ProxyHeader    string   `env:"PROXY_HEADER"`
+	TrustedProxies []string `env:"TRUSTED_PROXIES"`
+
+	// TLSCAFile is a PEM bundle trusted, on top of the system roots, for the
+	// IMAP servers and BSL.
+	TLSCAFile string `env:"TLS_CA_FILE"`
+	// CredentialVaultKey is a base64 AES key (16, 24 or 32 bytes) that lets
+	// users keep their portal password in Redis for CredentialVaultTTL.
+	// The vault is off when it is empty.
+	CredentialVaultKey string        `env:"CREDENTIAL_VAULT_KEY" secret:"true"`
+	CredentialVaultTTL time.Duration `env:"CREDENTIAL_VAULT_TTL" default:"15m"`
+	// AnonymityKey is a base64 key of at least 32 bytes from which the
+	// pseudonyms and sealed names of anonymous authors are derived. It falls
+	// back to JWTSecretKey; set it before ever rotating that key, or
+	// anonymous authors lose track of their suggestions.
+	AnonymityKey string `env:"ANONYMITY_KEY" secret:"true"`
+
+	// Attachments are kept in StorageDriver: "local" files under StorageDir,
+	// or "s3", a bucket of any S3-compatible service at S3Endpoint.
+	StorageDriver string `env:"STORAGE_DRIVER" default:"local"`
+	StorageDir    string `env:"STORAGE_DIR" default:"uploads"`
+	S3Endpoint    string `env:"S3_ENDPOINT"`
+	S3Region      string `env:"S3_REGION"`
+	S3Bucket      string `env:"S3_BUCKET"`
+	S3AccessKey   string `env:"S3_ACCESS_KEY" secret:"true"`
+	S3SecretKey   string `env:"S3_SECRET_KEY" secret:"true"`
+	// AttachmentMaxSizeMB bounds a single upload, at most 32.
+	AttachmentMaxSizeMB int `env:"ATTACHMENT_MAX_SIZE_MB" default:"10"`
+
+	rootCAs *x509.CertPool
+}
+
+// Options tells Load where to look for settings. Precedence from lowest to
+// highest is: defaults, ConfigFile, EnvFile, process environment.
+type Options struct {
+	// EnvFile is a dotenv file, ".env" when empty. A missing file is ignored.
+	EnvFile string
+	// ConfigFile is a YAML (.yaml, .yml) or TOML (.toml) file, $CONFIG_FILE
+	// when empty. It is optional unless named explicitly.
+	ConfigFile string
+	// Environ replaces os.Environ, mostly for tests.
+	Environ []string
+}
+
+// Problem describes one missing or invalid setting.
+type Problem struct {
+	Key    string
+	Reason string
+}
+
+// ValidationError lists every problem found while loading, not just the first.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		parts = append(parts, p.Key+": "+p.Reason)
+	}
+	return "invalid configuration: " + strings.Join(parts, "; ")
+}
+
+func (e *ValidationError) add(key, format string, args ...interface{}) {
+	e.Problems = append(e.Problems, Problem{Key: key, Reason: fmt.Sprintf(format, args...)})
+}
+
+func (e *ValidationError) has(key string) bool {
+	for _, p := range e.Problems {
+		if p.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Load builds a Config from the sources described by opts and validates it.
+func Load(opts Options) (*Config, error) {
+	environ := opts.Environ
+	if environ == nil {
+		environ = os.Environ()
+	}
+	env := map[string]string{}
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+
+	values := map[string]string{}
+	configFile, explicit := opts.ConfigFile, opts.ConfigFile != ""
+	if configFile == "" {
+		configFile, explicit = env["CONFIG_FILE"], env["CONFIG_FILE"] != ""
+	}
+	if configFile != "" {
+		fileValues, err := readConfigFile(configFile)
+		if err != nil && (explicit || !errors.Is(err, os.ErrNotExist)) {
+			return nil, err
+		}
+		for k, v := range fileValues {
+			values[strings.ToUpper(k)] = v
+		}
+	}
+
+	envFile := opts.EnvFile
+	if envFile == "" {
+		envFile = ".env"
+	}
+	dotenv, err := godotenv.Read(envFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading %s: %w", envFile, err)
+	}
+	for k, v := range dotenv {
+		values[k] = v
+	}
+	for k, v := range env {
+		values[k] = v
+	}
+
+	cfg := &Config{}
+	problems := &ValidationError{}
+	rv := reflect.ValueOf(cfg).Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		key := field.Tag.Get("env")
+		if key == "" {
+			continue
+		}
+		raw, ok := values[key]
+		if !ok || raw == "" {
+			raw, ok = field.Tag.Lookup("default")
+		}
+		if !ok || raw == "" {
+			if field.Tag.Get("required") == "true" {
+				problems.add(key, "is required")
+			}
+			continue
+		}
+		if field.Type == reflect.TypeOf(Rate{}) {
+			rate, err := ParseRate(raw)
+			if err != nil {
+				problems.add(key, "%v", err)
+				continue
+			}
+			rv.Field(i).Set(reflect.ValueOf(rate))
+			continue
+		}
+		if field.Type == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(raw)
+			if err != nil {
+				problems.add(key, "must be a duration such as 30s, got %q", raw)
+				continue
+			}
+			rv.Field(i).SetInt(int64(d))
+			continue
+		}
+		switch rv.Field(i).Kind() {
+		case reflect.String:
+			rv.Field(i).SetString(raw)
+		case reflect.Int:
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				problems.add(key, "must be an integer, got %q", raw)
+				continue
+			}
+			rv.Field(i).SetInt(int64(n))
+		case reflect.Float64:
+			f, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				problems.add(key, "must be a number, got %q", raw)
+				continue
+			}
+			rv.Field(i).SetFloat(f)
+		case reflect.Slice:
+			var list []string
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			rv.Field(i).Set(reflect.ValueOf(list))
+		}
+	}
+	cfg.validate(problems)
+	if len(problems.Problems) > 0 {
+		return nil, problems
+	}
+	return cfg, nil
+}
+
+func (c *Config) validate(problems *ValidationError) {
+	if c.Port != "" && !strings.Contains(c.Port, ":") {
+		c.Port = ":" + c.Port
+	}
+	if _, port, _ := strings.Cut(c.Port, ":"); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+			problems.add("PORT", "must look like :3000, got %q", c.Port)
+		}
+	}
+	if !problems.has("IMAP_PORT") && (c.IMAPPort < 1 || c.IMAPPort > 65535) {
+		problems.add("IMAP_PORT", "must be between 1 and 65535")
+	}
+	if !problems.has("BSL_TIMEOUT") && c.BSLTimeout <= 0 {
+		problems.add("BSL_TIMEOUT", "must be positive")
+	}
+	if !problems.has("BSL_MAX_RETRIES") && c.BSLMaxRetries < 0 {
+		problems.add("BSL_MAX_RETRIES", "must not be negative")
+	}
+	if !problems.has("PROFILE_MAX_AGE") && c.ProfileMaxAge <= 0 {
+		problems.add("PROFILE_MAX_AGE", "must be positive")
+	}
+	if !problems.has("PROFILE_SWEEP_INTERVAL") && c.ProfileSweepInterval < 0 {
+		problems.add("PROFILE_SWEEP_INTERVAL", "must not be negative")
+	}
+	if !problems.has("STATS_CACHE_TTL") && c.StatsCacheTTL < 0 {
+		problems.add("STATS_CACHE_TTL", "must not be negative")
+	}
+	if !problems.has("LOGIN_LOCKOUT_THRESHOLD") && c.LoginLockoutThreshold < 0 {
+		problems.add("LOGIN_LOCKOUT_THRESHOLD", "must not be negative")
+	}
+	if !problems.has("LOGIN_LOCKOUT_BASE") && c.LoginLockoutBase <= 0 {
+		problems.add("LOGIN_LOCKOUT_BASE", "must be positive")
+	}
+	if !problems.has("LOGIN_LOCKOUT_MAX") && c.LoginLockoutMax < c.LoginLockoutBase {
+		problems.add("LOGIN_LOCKOUT_MAX", "must not be shorter than LOGIN_LOCKOUT_BASE")
+	}
+	for _, proxy := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			problems.add("TRUSTED_PROXIES", "must list addresses and CIDR ranges, got %q", proxy)
+		}
+	}
+	if c.ProxyHeader != "" && len(c.TrustedProxies) == 0 {
+		problems.add("PROXY_HEADER", "is only read from TRUSTED_PROXIES, which is empty")
+	}
+	if c.TLSCAFile != "" {
+		if pool, err := loadCABundle(c.TLSCAFile); err != nil {
+			problems.add("TLS_CA_FILE", "%v", err)
+		} else {
+			c.rootCAs = pool
+		}
+	}
+	if c.CredentialVaultKey != "" {
+		if key, err := base64.StdEncoding.DecodeString(c.CredentialVaultKey); err != nil {
+			problems.add("CREDENTIAL_VAULT_KEY", "must be base64 encoded")
+		} else if n := len(key); n != 16 && n != 24 && n != 32 {
+			problems.add("CREDENTIAL_VAULT_KEY", "must decode to 16, 24 or 32 bytes, got %d", n)
+		}
+	}
+	if c.AnonymityKey != "" {
+		if key, err := base64.StdEncoding.DecodeString(c.AnonymityKey); err != nil {
+			problems.add("ANONYMITY_KEY", "must be base64 encoded")
+		} else if len(key) < 32 {
+			problems.add("ANONYMITY_KEY", "must decode to at least 32 bytes, got %d", len(key))
+		}
+	}
+	switch c.StorageDriver {
+	case "local":
+		if c.StorageDir == "" {
+			problems.add("STORAGE_DIR", "is required by the local storage driver")
+		}
+	case "s3":
+		for _, setting := range []struct{ key, value string }{
+			{"S3_ENDPOINT", c.S3Endpoint},
+			{"S3_BUCKET", c.S3Bucket},
+			{"S3_ACCESS_KEY", c.S3AccessKey},
+			{"S3_SECRET_KEY", c.S3SecretKey},
+		} {
+			if setting.value == "" {
+				problems.add(setting.key, "is required by the s3 storage driver")
+			}
+		}
+		checkURL(problems, "S3_ENDPOINT", c.S3Endpoint, "http", "https")
+	default:
+		problems.add("STORAGE_DRIVER", "must be local or s3, got %q", c.StorageDriver)
+	}
+	if !problems.has("ATTACHMENT_MAX_SIZE_MB") && (c.AttachmentMaxSizeMB < 1 || c.AttachmentMaxSizeMB > 32) {
+		problems.add("ATTACHMENT_MAX_SIZE_MB", "must be between 1 and 32")
+	}
+	checkURL(problems, "MONGO_URI", c.MongoURI, "mongodb", "mongodb+srv")
+	checkURL(problems, "REDIS_URI", c.RedisURI, "redis", "rediss", "unix")
+	checkURL(problems, "BSL_URI", c.BSLURI, "http", "https")
+	if c.RedirectURI != "" {
+		checkURL(problems, "REDIRECT_URI", c.RedirectURI, "http", "https")
+	}
+}
+
+// Rate is a number of requests allowed per sliding window. The zero Rate
+// allows everything.
+type Rate struct {
+	Limit  int
+	Window time.Duration
+}
+
+// ParseRate reads a rate written as 10/1m, or off.
+func ParseRate(s string) (Rate, error) {
+	if strings.EqualFold(strings.TrimSpace(s), "off") {
+		return Rate{}, nil
+	}
+	limit, window, ok := strings.Cut(s, "/")
+	n, err := strconv.Atoi(strings.TrimSpace(limit))
+	if !ok || err != nil || n < 1 {
+		return Rate{}, fmt.Errorf("must be a rate such as 10/1m or off, got %q", s)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(window))
+	if err != nil || d <= 0 {
+		return Rate{}, fmt.Errorf("must be a rate such as 10/1m or off, got %q", s)
+	}
+	return Rate{Limit: n, Window: d}, nil
+}
+
+// Enabled reports whether r limits anything.
+func (r Rate) Enabled() bool {
+	return r.Limit > 0
+}
+
+func checkURL(problems *ValidationError, key, raw string, schemes ...string) {
+	if raw == "" {
+		return
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		problems.add(key, "is not a valid URL")
+		return
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return
+		}
+	}
+	problems.add(key, "must use one of the schemes %s", strings.Join(schemes, ", "))
+}
+
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	raw := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format, use .yaml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	values := make(map[string]string, len(raw))
+	for k, v := range raw {
+		values[k] = configValue(v)
+	}
+	return values, nil
+}
+
+// configValue writes a value of a config file the way the environment would
+// hold it: lists, such as trusted_proxies, separated by commas.
+func configValue(v interface{}) string {
+	list, ok := v.([]interface{})
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	items := make([]string, len(list))
+	for i, item := range list {
+		items[i] = fmt.Sprint(item)
+	}
+	return strings.Join(items, ",")
+}
+
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read CA bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s holds no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+// TLSConfig returns the settings for connections to the IMAP servers and BSL:
+// certificates are always verified, against TLS_CA_FILE when it is set.
+func (c *Config) TLSConfig() *tls.Config {
+	return &tls.Config{
+		RootCAs:    c.rootCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+}
+
+// IMAPPortString returns IMAPPort ready to be joined with a host name.
+func (c Config) IMAPPortString() string {
+	return strconv.Itoa(c.IMAPPort)
+}
+
+// Redacted returns every setting keyed by its variable name with secret
+// values masked, so it is safe to log.
+func (c Config) Redacted() map[string]string {
+	out := map[string]string{}
+	rv := reflect.ValueOf(c)
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.Tag.Get("env") == "" {
+			continue
+		}
+		value := fmt.Sprint(rv.Field(i).Interface())
+		if list, ok := rv.Field(i).Interface().([]string); ok {
+			value = strings.Join(list, ",")
+		}
+		if field.Tag.Get("secret") == "true" && value != "" {
+			value = "********"
+		}
+		out[field.Tag.Get("env")] = value
+	}
+	return out
+}
+
+// String implements fmt.Stringer without leaking secrets.
+func (c Config) String() string {
+	rt := reflect.TypeOf(c)
+	redacted := c.Redacted()
+	parts := make([]string, 0, rt.NumField())
+	for i := 0; i < rt.NumField(); i++ {
+		key := rt.Field(i).Tag.Get("env")
+		if key == "" {
+			continue
+		}
+		parts = append(parts, key+"="+redacted[key])
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+// GoString keeps %#v from printing secrets as well.
+func (c Config) GoString() string {
+	return "config.Config" + c.String()
+}
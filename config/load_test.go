@@ -0,0 +1,183 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// required holds a valid value for every required setting.
+var required = []string{
+	"MONGO_URI=mongodb://mongo:27017",
+	"MONGO_DBNAME=probee",
+	"REDIS_URI=redis://redis:6379",
+	"JWT_SECRET_KEY=jwt-secret",
+	"BSL_URI=http://bsl:5000",
+	"IMAP_S_HOST=imap.student.example.edu",
+	"IMAP_T_HOST=imap.example.edu",
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// load reads the settings of environ on top of required, leaving out files.
+func load(t *testing.T, environ ...string) (*Config, error) {
+	t.Helper()
+	return Load(Options{
+		EnvFile: filepath.Join(t.TempDir(), ".env"),
+		Environ: append(append([]string{}, required...), environ...),
+	})
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	configFile := writeFile(t, "config.yaml", "mongo_uri: mongodb://file:27017\nport: 4000\nbsl_timeout: 10s\nsurvey_workers: 4\nmongo_dbname: from-file\n")
+	envFile := writeFile(t, ".env", "SURVEY_WORKERS=6\nMONGO_DBNAME=from-dotenv\n")
+	cfg, err := Load(Options{
+		EnvFile:    envFile,
+		ConfigFile: configFile,
+		Environ:    append([]string{"MONGO_DBNAME=from-env"}, required[2:]...),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		key       string
+		got, want interface{}
+	}{
+		{"MONGO_URI", cfg.MongoURI, "mongodb://file:27017"},
+		{"PORT", cfg.Port, ":4000"},
+		{"BSL_TIMEOUT", cfg.BSLTimeout, 10 * time.Second},
+		{"SURVEY_WORKERS", cfg.SurveyWorkers, 6},
+		{"MONGO_DBNAME", cfg.MongoDBName, "from-env"},
+		{"IMAP_PORT", cfg.IMAPPort, 993},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s = %v, want %v", tc.key, tc.got, tc.want)
+		}
+	}
+
+	toml := writeFile(t, "config.toml", "port = \"5000\"\n")
+	if cfg, err := Load(Options{EnvFile: envFile, ConfigFile: toml, Environ: required}); err != nil || cfg.Port != ":5000" {
+		t.Fatalf("TOML config file: %v, %v", cfg, err)
+	}
+	for name, content := range map[string]string{
+		"proxies.yaml": "trusted_proxies: [10.0.0.1, 10.0.0.0/8]\n",
+		"proxies.toml": "trusted_proxies = [\"10.0.0.1\", \"10.0.0.0/8\"]\n",
+	} {
+		cfg, err := Load(Options{EnvFile: envFile, ConfigFile: writeFile(t, name, content), Environ: required})
+		if err != nil || strings.Join(cfg.TrustedProxies, " ") != "10.0.0.1 10.0.0.0/8" {
+			t.Fatalf("list in %s: %v, %v", name, cfg, err)
+		}
+	}
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	if _, err := Load(Options{EnvFile: envFile, ConfigFile: missing, Environ: required}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("missing config file: %v", err)
+	}
+	if _, err := Load(Options{EnvFile: envFile, Environ: append([]string{"CONFIG_FILE=" + missing}, required...)}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("missing $CONFIG_FILE: %v", err)
+	}
+	if _, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env"), Environ: required}); err != nil {
+		t.Fatalf("without any file: %v", err)
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := load(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		key       string
+		got, want interface{}
+	}{
+		{"PORT", cfg.Port, ":3000"},
+		{"IMAP_PORT", cfg.IMAPPort, 993},
+		{"BSL_TIMEOUT", cfg.BSLTimeout, 30 * time.Second},
+		{"GRADE_PASS_POINTS", cfg.GradePassPoints, 1.0},
+		{"RATE_LIMIT_API", cfg.RateLimitAPI, Rate{Limit: 600, Window: time.Minute}},
+		{"STORAGE_DRIVER", cfg.StorageDriver, "local"},
+		{"PROXY_HEADER", cfg.ProxyHeader, ""},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s = %v, want %v", tc.key, tc.got, tc.want)
+		}
+	}
+	if cfg.TrustedProxies != nil {
+		t.Errorf("TRUSTED_PROXIES = %v, want none", cfg.TrustedProxies)
+	}
+
+	cfg, err = load(t, "PORT=8080", "RATE_LIMIT_LOGIN=off", "PROXY_HEADER=X-Forwarded-For", "TRUSTED_PROXIES=10.0.0.1, 192.168.0.0/16,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != ":8080" || cfg.RateLimitLogin.Enabled() || fmt.Sprint(cfg.TrustedProxies) != "[10.0.0.1 192.168.0.0/16]" {
+		t.Fatalf("overridden settings: %v", cfg)
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	_, err := Load(Options{
+		EnvFile: filepath.Join(t.TempDir(), ".env"),
+		Environ: []string{
+			"MONGO_URI=postgres://db", "IMAP_PORT=imap", "BSL_TIMEOUT=soon",
+			"RATE_LIMIT_API=many", "STORAGE_DRIVER=ftp", "TRUSTED_PROXIES=proxy.local",
+			"CREDENTIAL_VAULT_KEY=short",
+		},
+	})
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Load() = %v, want a ValidationError", err)
+	}
+	want := []string{
+		"MONGO_URI", "MONGO_DBNAME", "REDIS_URI", "JWT_SECRET_KEY", "BSL_URI", "IMAP_S_HOST", "IMAP_T_HOST",
+		"IMAP_PORT", "BSL_TIMEOUT", "RATE_LIMIT_API", "STORAGE_DRIVER", "TRUSTED_PROXIES", "CREDENTIAL_VAULT_KEY",
+	}
+	for _, key := range want {
+		if !invalid.has(key) {
+			t.Errorf("no problem reported for %s", key)
+		}
+	}
+	if len(invalid.Problems) != len(want) {
+		t.Errorf("got %d problems, want %d: %v", len(invalid.Problems), len(want), err)
+	}
+	if !strings.Contains(err.Error(), "IMAP_PORT: must be an integer") {
+		t.Errorf("error does not explain IMAP_PORT: %v", err)
+	}
+
+	if _, err := load(t, "PROXY_HEADER=X-Forwarded-For"); err == nil || !strings.Contains(err.Error(), "PROXY_HEADER") {
+		t.Errorf("proxy header without trusted proxies: %v", err)
+	}
+}
+
+func TestConfigRedaction(t *testing.T) {
+	cfg, err := load(t, "S3_ACCESS_KEY=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets := []string{"mongodb://mongo:27017", "redis://redis:6379", "jwt-secret"}
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		out := fmt.Sprintf(format, cfg)
+		for _, secret := range secrets {
+			if strings.Contains(out, secret) {
+				t.Errorf("%s prints %q: %s", format, secret, out)
+			}
+		}
+		if !strings.Contains(out, "MONGO_DBNAME=probee") {
+			t.Errorf("%s hides a setting that is not secret: %s", format, out)
+		}
+	}
+	redacted := cfg.Redacted()
+	if redacted["JWT_SECRET_KEY"] != "********" || redacted["S3_ACCESS_KEY"] != "" || redacted["IMAP_PORT"] != "993" {
+		t.Fatalf("Redacted() = %v", redacted)
+	}
+}
@@ -0,0 +1,184 @@
+package library
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"272-backend/config"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Anonymity levels of a suggestion.
+const (
+	AnonymityNone = ""
+	// AnonymityStudents hides the author from other students; admins still
+	// see them.
+	AnonymityStudents = "students"
+	// AnonymityEveryone hides the author from admins too. Only a pseudonym of
+	// the author is stored in the clear, without their department, and only
+	// Deanonymize reveals who it is.
+	AnonymityEveryone = "everyone"
+)
+
+const pseudonymPrefix = "anon:"
+
+var (
+	errAnonymityUnavailable = Unavailable("ANONYMITY_UNAVAILABLE", "Anonymous suggestions are not available")
+	errNotAnonymous         = Conflict("SUGGESTION_NOT_ANONYMOUS", "The author of this suggestion is not hidden")
+	errAuthorUnreadable     = Unavailable("AUTHOR_UNREADABLE", "The author of this suggestion cannot be revealed")
+)
+
+// Anonymizer hides the authors of anonymous suggestions. A pseudonym is a
+// keyed HMAC of the username: the same author always gets the same one, so
+// they still find and edit their suggestions, yet nobody without the key can
+// tell who it is. Next to it the username is sealed with AES-GCM for audited
+// de-anonymization.
+//
+// A nil *Anonymizer refuses anonymous suggestions.
+type Anonymizer struct {
+	pseudonymKey []byte
+	aead         cipher.AEAD
+}
+
+// NewAnonymizer derives its keys from ANONYMITY_KEY, or JWT_SECRET_KEY when
+// that is not set.
+func NewAnonymizer(cfg *config.Config) (*Anonymizer, error) {
+	key := []byte(cfg.JWTSecretKey)
+	if cfg.AnonymityKey != "" {
+		var err error
+		if key, err = base64.StdEncoding.DecodeString(cfg.AnonymityKey); err != nil {
+			return nil, err
+		}
+	}
+	return newAnonymizer(key)
+}
+
+func newAnonymizer(key []byte) (*Anonymizer, error) {
+	block, err := aes.NewCipher(deriveKey(key, "seal"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Anonymizer{pseudonymKey: deriveKey(key, "pseudonym"), aead: aead}, nil
+}
+
+// deriveKey gives every use of the key one of its own.
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("272-backend anonymity " + purpose))
+	return mac.Sum(nil)
+}
+
+// Pseudonym returns the pseudonym of username, empty for a nil Anonymizer.
+func (a *Anonymizer) Pseudonym(username string) string {
+	if a == nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, a.pseudonymKey)
+	mac.Write([]byte(username))
+	return pseudonymPrefix + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Anonymize hides the author of s, a new suggestion whose AuthorID is still
+// the username, at the given level.
+func (a *Anonymizer) Anonymize(s *Suggestion, level string) error {
+	s.Anonymity = level
+	if level != AnonymityEveryone {
+		return nil
+	}
+	if a == nil {
+		return errAnonymityUnavailable
+	}
+	pseudonym := a.Pseudonym(s.AuthorID)
+	nonce := make([]byte, a.aead.NonceSize(), a.aead.NonceSize()+len(s.AuthorID)+a.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	s.SealedAuthor = a.aead.Seal(nonce, nonce, []byte(s.AuthorID), []byte(pseudonym))
+	s.AuthorID, s.Department = pseudonym, 0
+	return nil
+}
+
+// author reveals the username behind s.
+func (a *Anonymizer) author(s *Suggestion) (string, error) {
+	if s.Anonymity != AnonymityEveryone {
+		return s.AuthorID, nil
+	}
+	if a == nil || len(s.SealedAuthor) < a.aead.NonceSize() {
+		return "", errAuthorUnreadable
+	}
+	nonce, sealed := s.SealedAuthor[:a.aead.NonceSize()], s.SealedAuthor[a.aead.NonceSize():]
+	author, err := a.aead.Open(nil, nonce, sealed, []byte(s.AuthorID))
+	if err != nil {
+		return "", errAuthorUnreadable.Wrap(err)
+	}
+	return string(author), nil
+}
+
+// Deanonymization is an entry of the audit log of revealed authors.
+type Deanonymization struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Suggestion primitive.ObjectID `json:"suggestion" bson:"suggestion"`
+	Actor      string             `json:"actor" bson:"actor"`
+	Reason     string             `json:"reason" bson:"reason"`
+	Author     string             `json:"author" bson:"author"`
+	At         primitive.DateTime `json:"at" bson:"at"`
+}
+
+// Deanonymize reveals the author of the anonymous suggestion s to actor. The
+// author is only returned once the reason is in the audit log.
+func (a *Anonymizer) Deanonymize(ctx context.Context, suggestions SuggestionRepository, s *Suggestion, actor, reason string) (Deanonymization, error) {
+	if s.Anonymity == AnonymityNone {
+		return Deanonymization{}, errNotAnonymous
+	}
+	author, err := a.author(s)
+	if err != nil {
+		return Deanonymization{}, err
+	}
+	d := Deanonymization{Suggestion: s.ID, Actor: actor, Reason: reason, Author: author}
+	if err := suggestions.LogDeanonymization(ctx, &d); err != nil {
+		return Deanonymization{}, err
+	}
+	return d, nil
+}
+
+// Viewer is the user a suggestion is shown to.
+type Viewer struct {
+	Username string
+	// Pseudonym stands for Username on suggestions hidden from everyone.
+	Pseudonym string
+	Admin     bool
+}
+
+// Viewer describes username, an admin or not, to whom suggestions are shown.
+func (a *Anonymizer) Viewer(username string, admin bool) Viewer {
+	return Viewer{Username: username, Pseudonym: a.Pseudonym(username), Admin: admin}
+}
+
+// Authors are the author IDs the viewer's own suggestions carry.
+func (v Viewer) Authors() []string {
+	if v.Pseudonym == "" {
+		return []string{v.Username}
+	}
+	return []string{v.Username, v.Pseudonym}
+}
+
+// Authored reports whether the viewer wrote s.
+func (v Viewer) Authored(s *Suggestion) bool {
+	return s.AuthorID != "" && (s.AuthorID == v.Username || s.AuthorID == v.Pseudonym)
+}
+
+// CanSee reports whether the viewer may see s at all: approved suggestions
+// are public, the others are seen by their author and admins only.
+func (v Viewer) CanSee(s *Suggestion) bool {
+	return s.Status == "approved" || v.Admin || v.Authored(s)
+}
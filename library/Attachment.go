@@ -0,0 +1,138 @@
+package library
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// What attachments belong to, named after the collections of their parents.
+const (
+	AttachedToSuggestion = "suggestions"
+	AttachedToProject    = "projects"
+	AttachedToEvent      = "events"
+)
+
+var (
+	errAttachmentNotFound = NotFound("ATTACHMENT_NOT_FOUND", "Attachment not found")
+	errUnknownParent      = Validation("INVALID_ATTACHMENT_PARENT", "Files can be attached to suggestions, projects and events only")
+)
+
+// Attachment is a file uploaded to a suggestion, project or event. The file
+// itself is in storage under Key, and its thumbnail, for images, under
+// ThumbnailKey.
+type Attachment struct {
+	ID primitive.ObjectID `json:"id" bson:"_id"`
+	// Kind is what the attachment belongs to, see AttachedToSuggestion.
+	Kind   string             `json:"kind" bson:"kind"`
+	Parent primitive.ObjectID `json:"parent" bson:"parent"`
+	Name   string             `json:"name" bson:"name"`
+	// ContentType is sniffed from the file, not taken from the upload.
+	ContentType string             `json:"content_type" bson:"content_type"`
+	Size        int64              `json:"size" bson:"size"`
+	Thumbnail   bool               `json:"thumbnail" bson:"thumbnail"`
+	UploadedBy  string             `json:"uploaded_by" bson:"uploaded_by"`
+	UploadedAt  primitive.DateTime `json:"uploaded_at" bson:"uploaded_at"`
+}
+
+func (a *Attachment) Key() string {
+	return a.Kind + "/" + a.Parent.Hex() + "/" + a.ID.Hex()
+}
+
+func (a *Attachment) ThumbnailKey() string {
+	return a.Key() + ".thumbnail"
+}
+
+// AttachmentRef lists an attachment on its parent. The file is downloaded
+// from /attachments/{id}, the thumbnail from /attachments/{id}/thumbnail.
+type AttachmentRef struct {
+	ID          primitive.ObjectID `json:"id" bson:"id"`
+	Name        string             `json:"name" bson:"name"`
+	ContentType string             `json:"content_type" bson:"content_type"`
+	Size        int64              `json:"size" bson:"size"`
+	Thumbnail   bool               `json:"thumbnail" bson:"thumbnail"`
+}
+
+func (a *Attachment) Ref() AttachmentRef {
+	return AttachmentRef{ID: a.ID, Name: a.Name, ContentType: a.ContentType, Size: a.Size, Thumbnail: a.Thumbnail}
+}
+
+// prepareInsert stamps a new attachment. Its ID may already be set, since
+// the file is stored under it before the attachment is recorded.
+func (a *Attachment) prepareInsert() error {
+	switch a.Kind {
+	case AttachedToSuggestion, AttachedToProject, AttachedToEvent:
+	default:
+		return errUnknownParent
+	}
+	if a.ID.IsZero() {
+		a.ID = primitive.NewObjectID()
+	}
+	a.UploadedAt = primitive.NewDateTimeFromTime(time.Now())
+	return nil
+}
+
+// parentNotFound is the not found error of the parent kind of a.
+func (a *Attachment) parentNotFound() *Error {
+	switch a.Kind {
+	case AttachedToProject:
+		return errProjectNotFound
+	case AttachedToEvent:
+		return errEventNotFound
+	}
+	return errSuggestionNotFound
+}
+
+// mongoAttachmentRepository keeps attachments in the "attachments" collection
+// and their references on the documents of their parents.
+type mongoAttachmentRepository struct {
+	attachments *mongo.Collection
+	db          *mongo.Database
+}
+
+func NewMongoAttachmentRepository(db *mongo.Database) AttachmentRepository {
+	return &mongoAttachmentRepository{attachments: db.Collection("attachments"), db: db}
+}
+
+func (r *mongoAttachmentRepository) AddAttachment(ctx context.Context, a *Attachment) error {
+	if err := a.prepareInsert(); err != nil {
+		return err
+	}
+	if _, err := r.attachments.InsertOne(ctx, a); err != nil {
+		return err
+	}
+	res, err := r.db.Collection(a.Kind).UpdateOne(ctx, bson.M{"_id": a.Parent}, bson.M{"$push": bson.M{"attachments": a.Ref()}})
+	if err == nil && res.MatchedCount == 0 {
+		err = a.parentNotFound()
+	}
+	if err != nil {
+		_, _ = r.attachments.DeleteOne(ctx, bson.M{"_id": a.ID})
+		return err
+	}
+	return nil
+}
+
+func (r *mongoAttachmentRepository) GetAttachment(ctx context.Context, id primitive.ObjectID) (Attachment, error) {
+	var a Attachment
+	if err := r.attachments.FindOne(ctx, bson.M{"_id": id}).Decode(&a); err != nil {
+		return a, notFound(err, errAttachmentNotFound)
+	}
+	return a, nil
+}
+
+func (r *mongoAttachmentRepository) RemoveAttachment(ctx context.Context, a *Attachment) error {
+	if _, err := r.db.Collection(a.Kind).UpdateOne(ctx, bson.M{"_id": a.Parent}, bson.M{"$pull": bson.M{"attachments": bson.M{"id": a.ID}}}); err != nil {
+		return err
+	}
+	res, err := r.attachments.DeleteOne(ctx, bson.M{"_id": a.ID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return errAttachmentNotFound
+	}
+	return nil
+}
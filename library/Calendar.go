@@ -1,46 +1,80 @@
 package library
 
 import (
-	"272-backend/pkg"
 	"context"
-	"errors"
+	"slices"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var Events *mongo.Collection
-
-func init() {
-	Events = pkg.Mongo.Collection("events")
-}
-
 type Event struct {
 	ID          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
 	Title       string             `json:"title" bson:"title"`
 	Description string             `json:"description" bson:"description"`
-	StartTime   primitive.DateTime `json:"start_time" bson:"start_time"`
-	EndTime     primitive.DateTime `json:"end_time" bson:"end_time"`
-	Location    string             `json:"location" bson:"location"`
-	OrganizerID string             `json:"organizer_id" bson:"organizer_id"`
-	Author      string             `json:"author" bson:"author"`
-	CreatedAt   primitive.DateTime `json:"created_at" bson:"created_at"`
-	Tags        []string           `json:"tags" bson:"tags"`
-	Status      string             `json:"status" bson:"status"`
-	Type        string             `json:"type" bson:"type"`
-}
-
-func (e *Event) CreateEvent() error {
+	// DescriptionHTML is Description rendered from Markdown and sanitized,
+	// and Mentions the users it mentions; see Markdown.
+	DescriptionHTML string             `json:"description_html" bson:"description_html"`
+	Mentions        []string           `json:"mentions,omitempty" bson:"mentions"`
+	StartTime       primitive.DateTime `json:"start_time" bson:"start_time"`
+	EndTime         primitive.DateTime `json:"end_time" bson:"end_time"`
+	Location        string             `json:"location" bson:"location"`
+	OrganizerID     string             `json:"organizer_id" bson:"organizer_id"`
+	Author          string             `json:"author" bson:"author"`
+	CreatedAt       primitive.DateTime `json:"created_at" bson:"created_at"`
+	Tags            []string           `json:"tags" bson:"tags"`
+	Status          string             `json:"status" bson:"status"`
+	Type            string             `json:"type" bson:"type"`
+	// ImportKey identifies an event created by an import, see EventRow.
+	ImportKey string `json:"import_key,omitempty" bson:"import_key,omitempty"`
+	// Attachments are the files uploaded to the event, such as its poster.
+	Attachments []AttachmentRef `json:"attachments,omitempty" bson:"attachments,omitempty"`
+}
+
+// mongoEventRepository keeps events in the "events" collection.
+type mongoEventRepository struct {
+	events *mongo.Collection
+}
+
+func NewMongoEventRepository(db *mongo.Database) EventRepository {
+	return &mongoEventRepository{events: db.Collection("events")}
+}
+
+// VisibleTo reports whether username, a RoleHaysevAdmin or not, may see e:
+// approved events are public, the others are seen by their organizer and
+// the admins of events only.
+func (e *Event) VisibleTo(username string, eventAdmin bool) bool {
+	return e.Status == "approved" || eventAdmin || e.OrganizerID == username
+}
+
+func (r *mongoEventRepository) RenderMarkdown(ctx context.Context) error {
+	return renderStored(ctx, r.events, "description")
+}
+
+// SetDescription sets the description of e from Markdown and adds its tags
+// to those of e.
+func (e *Event) SetDescription(m Markdown) {
+	e.Description, e.DescriptionHTML, e.Mentions = m.Source, m.HTML, m.Mentions
+	for _, tag := range m.Tags {
+		if !slices.Contains(e.Tags, tag) {
+			e.Tags = append(e.Tags, tag)
+		}
+	}
+}
+
+// prepareInsert validates a new event and stamps it as pending.
+func (e *Event) prepareInsert() error {
 	if e.Title == "" {
-		return errors.New("INVALID_EVENT")
+		return Validation("INVALID_EVENT", "Event title is required", FieldError{Field: "title", Code: "required", Message: "title is required"})
 	}
 	if e.OrganizerID == "" {
-		return errors.New("INVALID_ORGANIZER")
+		return Validation("INVALID_ORGANIZER", "Event organizer is required", FieldError{Field: "organizer_id", Code: "required", Message: "organizer_id is required"})
 	}
 	if e.Author == "" {
-		return errors.New("INVALID_ORGANIZER_NAME")
+		return Validation("INVALID_ORGANIZER_NAME", "Event organizer name is required", FieldError{Field: "author", Code: "required", Message: "author is required"})
 	}
 	e.Status = "pending"
 	date, err := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
@@ -49,74 +83,155 @@ func (e *Event) CreateEvent() error {
 	}
 	e.CreatedAt = primitive.NewDateTimeFromTime(date)
 	if e.StartTime.Time().IsZero() {
-		return errors.New("INVALID_START_TIME")
+		return Validation("INVALID_START_TIME", "Event start time is required", FieldError{Field: "start_time", Code: "required", Message: "start_time is required"})
 	}
 	if e.Type == "" {
-		return errors.New("INVALID_EVENT_TYPE")
+		return Validation("INVALID_EVENT_TYPE", "Event type is required", FieldError{Field: "type", Code: "required", Message: "type is required"})
 	}
-	doc, err := Events.InsertOne(context.Background(), e)
+	return nil
+}
+
+func (r *mongoEventRepository) CreateEvent(ctx context.Context, e *Event) error {
+	if err := e.prepareInsert(); err != nil {
+		return err
+	}
+	doc, err := r.events.InsertOne(ctx, e)
 	if err != nil {
 		return err
 	}
 	e.ID = doc.InsertedID.(primitive.ObjectID)
-	if err := Events.FindOne(context.Background(), bson.D{{Key: "_id", Value: e.ID}}).Decode(&e); err != nil {
-		return err
+	if err := r.events.FindOne(ctx, bson.D{{Key: "_id", Value: e.ID}}).Decode(&e); err != nil {
+		return notFound(err, errEventNotFound)
 	}
 	return nil
 }
 
-func (u *User) GetEvents() ([]Event, error) {
-	cursor, err := Events.Find(context.Background(), bson.D{{Key: "organizer_id", Value: u.Username}})
+// prepareImport validates an imported event.
+func (e *Event) prepareImport() error {
+	if e.ImportKey == "" {
+		return Validation("INVALID_EVENT", "Event import key is required", FieldError{Field: "key", Code: "required", Message: "key is required"})
+	}
+	if e.Title == "" {
+		return Validation("INVALID_EVENT", "Event title is required", FieldError{Field: "title", Code: "required", Message: "title is required"})
+	}
+	if e.StartTime.Time().IsZero() {
+		return Validation("INVALID_START_TIME", "Event start time is required", FieldError{Field: "start_time", Code: "required", Message: "start_time is required"})
+	}
+	if e.OrganizerID == "" {
+		return Validation("INVALID_ORGANIZER", "Event organizer is required", FieldError{Field: "organizer_id", Code: "required", Message: "organizer_id is required"})
+	}
+	return nil
+}
+
+// imported copies the fields an import sets from e to stored.
+func (e *Event) imported(stored *Event) {
+	stored.ImportKey = e.ImportKey
+	stored.Title = e.Title
+	stored.Description = e.Description
+	stored.DescriptionHTML = e.DescriptionHTML
+	stored.StartTime = e.StartTime
+	stored.EndTime = e.EndTime
+	stored.Location = e.Location
+	stored.Type = e.Type
+	stored.Tags = e.Tags
+	stored.OrganizerID = e.OrganizerID
+	stored.Author = e.Author
+}
+
+func (r *mongoEventRepository) ImportEvent(ctx context.Context, e *Event) (UpsertResult, error) {
+	if err := e.prepareImport(); err != nil {
+		return UpsertUnchanged, err
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"title":            e.Title,
+			"description":      e.Description,
+			"description_html": e.DescriptionHTML,
+			"start_time":       e.StartTime,
+			"end_time":         e.EndTime,
+			"location":         e.Location,
+			"type":             e.Type,
+			"tags":             e.Tags,
+			"organizer_id":     e.OrganizerID,
+			"author":           e.Author,
+		},
+		"$setOnInsert": bson.M{
+			"status":     "approved",
+			"created_at": primitive.NewDateTimeFromTime(time.Now()),
+		},
+	}
+	res, err := r.events.UpdateOne(ctx, bson.M{"import_key": e.ImportKey}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return UpsertUnchanged, err
+	}
+	result := UpsertUnchanged
+	if res.UpsertedCount > 0 {
+		result = UpsertCreated
+	} else if res.ModifiedCount > 0 {
+		result = UpsertUpdated
+	}
+	return result, notFound(r.events.FindOne(ctx, bson.M{"import_key": e.ImportKey}).Decode(e), errEventNotFound)
+}
+
+func (r *mongoEventRepository) GetEvents(ctx context.Context, u *User) ([]Event, error) {
+	cursor, err := r.events.Find(ctx, bson.D{{Key: "organizer_id", Value: u.Username}})
 	if err != nil {
 		return nil, err
 	}
 	var events []Event
-	if err := cursor.All(context.Background(), &events); err != nil {
+	if err := cursor.All(ctx, &events); err != nil {
 		return nil, err
 	}
 	return events, nil
 }
 
-func (e *Event) ApproveEvent() error {
-	_id, err := Events.UpdateOne(context.Background(), bson.D{{Key: "_id", Value: e.ID}}, bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: "approved"}}}})
+func (r *mongoEventRepository) ApproveEvent(ctx context.Context, e *Event) error {
+	_id, err := r.events.UpdateOne(ctx, bson.D{{Key: "_id", Value: e.ID}}, bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: "approved"}}}})
 	if err != nil {
 		return err
 	} else if _id.MatchedCount == 0 {
-		return errors.New("EVENT_NOT_FOUND")
+		return errEventNotFound
 	}
-	if err := Events.FindOne(context.Background(), bson.D{{Key: "_id", Value: e.ID}}).Decode(&e); err != nil {
-		return err
+	if err := r.events.FindOne(ctx, bson.D{{Key: "_id", Value: e.ID}}).Decode(&e); err != nil {
+		return notFound(err, errEventNotFound)
 	}
 	return nil
 }
 
-func (e *Event) RemoveEvent() error {
-	if err := Events.FindOne(context.Background(), bson.D{{Key: "_id", Value: e.ID}}).Decode(&e); err != nil {
-		return err
+func (r *mongoEventRepository) RemoveEvent(ctx context.Context, e *Event) error {
+	if err := r.events.FindOne(ctx, bson.D{{Key: "_id", Value: e.ID}}).Decode(&e); err != nil {
+		return notFound(err, errEventNotFound)
 	}
-	_, err := Events.DeleteOne(context.Background(), bson.D{{Key: "_id", Value: e.ID}})
+	_, err := r.events.DeleteOne(ctx, bson.D{{Key: "_id", Value: e.ID}})
 	return err
 }
 
-func GetAllEvents() ([]Event, error) {
-	cursor, err := Events.Find(context.Background(), bson.D{{Key: "status", Value: "approved"}})
+func (r *mongoEventRepository) GetEvent(ctx context.Context, e *Event) error {
+	if err := r.events.FindOne(ctx, bson.D{{Key: "_id", Value: e.ID}}).Decode(&e); err != nil {
+		return notFound(err, errEventNotFound)
+	}
+	return nil
+}
+
+func (r *mongoEventRepository) GetAllEvents(ctx context.Context) ([]Event, error) {
+	cursor, err := r.events.Find(ctx, bson.D{{Key: "status", Value: "approved"}})
 	if err != nil {
 		return nil, err
 	}
 	var events []Event
-	if err := cursor.All(context.Background(), &events); err != nil {
+	if err := cursor.All(ctx, &events); err != nil {
 		return nil, err
 	}
 	return events, nil
 }
 
-func GetPendingEvents() ([]Event, error) {
-	cursor, err := Events.Find(context.Background(), bson.D{{}})
+func (r *mongoEventRepository) GetPendingEvents(ctx context.Context) ([]Event, error) {
+	cursor, err := r.events.Find(ctx, bson.D{{}})
 	if err != nil {
 		return nil, err
 	}
 	var events []Event
-	if err := cursor.All(context.Background(), &events); err != nil {
+	if err := cursor.All(ctx, &events); err != nil {
 		return nil, err
 	}
 	return events, nil
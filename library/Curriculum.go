@@ -0,0 +1,316 @@
+package library
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Course is a catalogue entry shared by every curriculum that lists it. Its
+// ID is the portal's course_id.
+type Course struct {
+	ID         string `json:"id,omitempty" bson:"_id,omitempty"`
+	Code       string `json:"code" bson:"code"`
+	CourseID   string `json:"course_id" bson:"course_id"`
+	CourseCode string `json:"course_code" bson:"course_code"`
+	CourseName string `json:"course_name" bson:"course_name"`
+	Credit     string `json:"credit" bson:"credit"`
+}
+
+// CirriculumIndex places a course in a curriculum.
+type CirriculumIndex struct {
+	CourseID string `json:"course_id" bson:"course_id"`
+	Semester int    `json:"semester" bson:"semester"`
+	Year     int    `json:"year" bson:"year"`
+}
+
+// Cirriculum is the course plan of a department, named as on the portal.
+type Cirriculum struct {
+	ID             primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Department     int                `json:"department" bson:"department"`
+	CirriculumName string             `json:"cirriculum_name" bson:"cirriculum_name"`
+	Index          []CirriculumIndex  `json:"index" bson:"index"`
+}
+
+// UserCourse is a user's standing in one course of their curriculum.
+type UserCourse struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID    string             `json:"user_id" bson:"user_id"`
+	CourseID  string             `json:"course_id" bson:"course_id"`
+	Grade     string             `json:"grade" bson:"grade"`
+	Semester  int                `json:"semester" bson:"semester"`
+	Year      int                `json:"year" bson:"year"`
+	UpdatedAt primitive.DateTime `json:"updated_at" bson:"updated_at"`
+}
+
+// CourseData is one row of a user's curriculum: the course joined with the
+// user's grade in it.
+type CourseData struct {
+	ID         string `json:"id,omitempty" bson:"_id,omitempty"`
+	Code       string `json:"code" bson:"code"`
+	CourseID   string `json:"course_id" bson:"course_id"`
+	CourseCode string `json:"course_code" bson:"course_code"`
+	CourseName string `json:"course_name" bson:"course_name"`
+	Credits    string `json:"credits" bson:"credits"`
+	Grade      string `json:"grade" bson:"grade"`
+	Department int    `json:"department" bson:"department"`
+	Semester   int    `json:"semester" bson:"semester"`
+	Year       int    `json:"year" bson:"year"`
+}
+
+// GradeChange is a grade that differs from the one stored by the last sync.
+type GradeChange struct {
+	CourseID   string `json:"course_id"`
+	CourseCode string `json:"course_code"`
+	CourseName string `json:"course_name"`
+	OldGrade   string `json:"old_grade"`
+	NewGrade   string `json:"new_grade"`
+}
+
+// CurriculumSync reports what a sync changed and the resulting curriculum.
+type CurriculumSync struct {
+	Added        int           `json:"added"`
+	Updated      int           `json:"updated"`
+	Removed      int           `json:"removed"`
+	GradeChanges []GradeChange `json:"grade_changes"`
+	Courses      []CourseData  `json:"courses"`
+}
+
+// CirriculumName is the name the curriculum of u is filed under.
+func (u *User) CirriculumName() string {
+	if u.Cirriculum != "" {
+		return u.Cirriculum
+	}
+	return u.DepartmentName
+}
+
+// courseKey is the ID a fetched row is stored under. A few portal rows, such
+// as elective slots, come without a course_id.
+func courseKey(row CourseData) string {
+	if row.CourseID != "" {
+		return row.CourseID
+	}
+	return row.CourseCode
+}
+
+// curriculumDiff is the work a sync has to do on top of what is stored.
+type curriculumDiff struct {
+	courses    []Course
+	cirriculum Cirriculum
+	upserts    []UserCourse
+	removed    []string
+	result     CurriculumSync
+}
+
+// diffCurriculum compares freshly fetched rows with the stored user courses
+// so a sync only writes what changed.
+func diffCurriculum(u *User, stored []UserCourse, rows []CourseData) curriculumDiff {
+	byCourse := make(map[string]UserCourse, len(stored))
+	for _, uc := range stored {
+		byCourse[uc.CourseID] = uc
+	}
+	now := primitive.NewDateTimeFromTime(time.Now())
+	d := curriculumDiff{
+		cirriculum: Cirriculum{Department: u.Department, CirriculumName: u.CirriculumName(), Index: []CirriculumIndex{}},
+		result:     CurriculumSync{GradeChanges: []GradeChange{}},
+	}
+	seen := map[string]bool{}
+	for _, row := range rows {
+		id := courseKey(row)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		d.courses = append(d.courses, Course{
+			ID:         id,
+			Code:       row.Code,
+			CourseID:   row.CourseID,
+			CourseCode: row.CourseCode,
+			CourseName: row.CourseName,
+			Credit:     row.Credits,
+		})
+		d.cirriculum.Index = append(d.cirriculum.Index, CirriculumIndex{CourseID: id, Semester: row.Semester, Year: row.Year})
+
+		old, ok := byCourse[id]
+		if ok && old.Grade == row.Grade && old.Semester == row.Semester && old.Year == row.Year {
+			continue
+		}
+		if !ok {
+			d.result.Added++
+		} else {
+			d.result.Updated++
+			if old.Grade != row.Grade {
+				d.result.GradeChanges = append(d.result.GradeChanges, GradeChange{
+					CourseID:   id,
+					CourseCode: row.CourseCode,
+					CourseName: row.CourseName,
+					OldGrade:   old.Grade,
+					NewGrade:   row.Grade,
+				})
+			}
+		}
+		d.upserts = append(d.upserts, UserCourse{
+			ID:        old.ID,
+			UserID:    u.Username,
+			CourseID:  id,
+			Grade:     row.Grade,
+			Semester:  row.Semester,
+			Year:      row.Year,
+			UpdatedAt: now,
+		})
+	}
+	for _, uc := range stored {
+		if !seen[uc.CourseID] {
+			d.removed = append(d.removed, uc.CourseID)
+		}
+	}
+	d.result.Removed = len(d.removed)
+	return d
+}
+
+// joinCurriculum builds the rows of a user's curriculum ordered by year,
+// semester and course code.
+func joinCurriculum(u *User, userCourses []UserCourse, courses map[string]Course) []CourseData {
+	out := make([]CourseData, 0, len(userCourses))
+	for _, uc := range userCourses {
+		c := courses[uc.CourseID]
+		out = append(out, CourseData{
+			ID:         uc.CourseID,
+			Code:       c.Code,
+			CourseID:   c.CourseID,
+			CourseCode: c.CourseCode,
+			CourseName: c.CourseName,
+			Credits:    c.Credit,
+			Grade:      uc.Grade,
+			Department: u.Department,
+			Semester:   uc.Semester,
+			Year:       uc.Year,
+		})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Year != out[j].Year {
+			return out[i].Year < out[j].Year
+		}
+		if out[i].Semester != out[j].Semester {
+			return out[i].Semester < out[j].Semester
+		}
+		return out[i].CourseCode < out[j].CourseCode
+	})
+	return out
+}
+
+// mongoCurriculumRepository keeps the catalogue in "courses", department
+// plans in "curricula" and grades in "user_courses".
+type mongoCurriculumRepository struct {
+	courses     *mongo.Collection
+	curricula   *mongo.Collection
+	userCourses *mongo.Collection
+}
+
+func NewMongoCurriculumRepository(db *mongo.Database) CurriculumRepository {
+	return &mongoCurriculumRepository{
+		courses:     db.Collection("courses"),
+		curricula:   db.Collection("curricula"),
+		userCourses: db.Collection("user_courses"),
+	}
+}
+
+func (r *mongoCurriculumRepository) storedUserCourses(ctx context.Context, userID string) ([]UserCourse, error) {
+	cursor, err := r.userCourses.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	stored := []UserCourse{}
+	if err := cursor.All(ctx, &stored); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+func (r *mongoCurriculumRepository) Sync(ctx context.Context, u *User, rows []CourseData) (CurriculumSync, error) {
+	stored, err := r.storedUserCourses(ctx, u.Username)
+	if err != nil {
+		return CurriculumSync{}, err
+	}
+	d := diffCurriculum(u, stored, rows)
+
+	if len(d.courses) > 0 {
+		models := make([]mongo.WriteModel, 0, len(d.courses))
+		for _, c := range d.courses {
+			models = append(models, mongo.NewReplaceOneModel().
+				SetFilter(bson.M{"_id": c.ID}).
+				SetReplacement(c).
+				SetUpsert(true))
+		}
+		if _, err := r.courses.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			return CurriculumSync{}, err
+		}
+	}
+	if _, err := r.curricula.UpdateOne(ctx,
+		bson.M{"department": d.cirriculum.Department, "cirriculum_name": d.cirriculum.CirriculumName},
+		bson.M{"$set": bson.M{"index": d.cirriculum.Index}},
+		options.Update().SetUpsert(true),
+	); err != nil {
+		return CurriculumSync{}, err
+	}
+	if len(d.upserts) > 0 {
+		models := make([]mongo.WriteModel, 0, len(d.upserts))
+		for _, uc := range d.upserts {
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"user_id": uc.UserID, "course_id": uc.CourseID}).
+				SetUpdate(bson.M{"$set": bson.M{
+					"grade":      uc.Grade,
+					"semester":   uc.Semester,
+					"year":       uc.Year,
+					"updated_at": uc.UpdatedAt,
+				}}).
+				SetUpsert(true))
+		}
+		if _, err := r.userCourses.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			return CurriculumSync{}, err
+		}
+	}
+	if len(d.removed) > 0 {
+		if _, err := r.userCourses.DeleteMany(ctx, bson.M{"user_id": u.Username, "course_id": bson.M{"$in": d.removed}}); err != nil {
+			return CurriculumSync{}, err
+		}
+	}
+
+	d.result.Courses, err = r.GetUserCurriculum(ctx, u)
+	return d.result, err
+}
+
+func (r *mongoCurriculumRepository) GetUserCurriculum(ctx context.Context, u *User) ([]CourseData, error) {
+	stored, err := r.storedUserCourses(ctx, u.Username)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(stored))
+	for _, uc := range stored {
+		ids = append(ids, uc.CourseID)
+	}
+	cursor, err := r.courses.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	var courses []Course
+	if err := cursor.All(ctx, &courses); err != nil {
+		return nil, err
+	}
+	byID := make(map[string]Course, len(courses))
+	for _, c := range courses {
+		byID[c.ID] = c
+	}
+	return joinCurriculum(u, stored, byID), nil
+}
+
+func (r *mongoCurriculumRepository) GetCirriculum(ctx context.Context, department int, name string) (Cirriculum, error) {
+	var c Cirriculum
+	err := r.curricula.FindOne(ctx, bson.M{"department": department, "cirriculum_name": name}).Decode(&c)
+	return c, notFound(err, errCirriculumNotFound)
+}
@@ -0,0 +1,241 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Where the department of a user came from. Mappings an admin made are never
+// replaced by the automatic ones.
+const (
+	DepartmentFromStudentNumber = "student_number"
+	DepartmentFromPortal        = "portal"
+	DepartmentFromAdmin         = "admin"
+)
+
+// Faculty groups departments.
+type Faculty struct {
+	Code   int    `json:"code" bson:"_id" validate:"min=1"`
+	NameTR string `json:"name_tr" bson:"name_tr" validate:"required,max=200"`
+	NameEN string `json:"name_en" bson:"name_en" validate:"max=200"`
+}
+
+// Department is a department of a faculty. Its code is the one embedded in
+// student numbers. Aliases are further names the portal reports for it, e.g.
+// for staff whose username carries no code.
+type Department struct {
+	Code    int      `json:"code" bson:"_id" validate:"min=1"`
+	Faculty int      `json:"faculty" bson:"faculty" validate:"min=1"`
+	NameTR  string   `json:"name_tr" bson:"name_tr" validate:"required,max=200"`
+	NameEN  string   `json:"name_en" bson:"name_en" validate:"max=200"`
+	Aliases []string `json:"aliases" bson:"aliases" validate:"max=20,dive,max=200"`
+}
+
+// FacultyTree is a faculty with its departments, ordered by code.
+type FacultyTree struct {
+	Faculty
+	Departments []Department `json:"departments"`
+}
+
+// StudentNumber is the structure of a student username such as c2011011025:
+// the entry year, the five digit department code and a sequence number.
+type StudentNumber struct {
+	Year       int
+	Department int
+	Sequence   int
+}
+
+var studentNumberPattern = regexp.MustCompile(`^c?(\d{2})(\d{5})(\d{3})$`)
+
+// ParseStudentNumber splits a student username, with or without the leading
+// c and the mail domain. Anything else, staff usernames included, is not ok.
+func ParseStudentNumber(username string) (StudentNumber, bool) {
+	username, _, _ = strings.Cut(strings.ToLower(strings.TrimSpace(username)), "@")
+	m := studentNumberPattern.FindStringSubmatch(username)
+	if m == nil {
+		return StudentNumber{}, false
+	}
+	year, _ := strconv.Atoi(m[1])
+	department, _ := strconv.Atoi(m[2])
+	sequence, _ := strconv.Atoi(m[3])
+	return StudentNumber{Year: year, Department: department, Sequence: sequence}, true
+}
+
+// Username returns the username login stores for n.
+func (n StudentNumber) Username() string {
+	return fmt.Sprintf("c%02d%05d%03d", n.Year, n.Department, n.Sequence)
+}
+
+// GetDepartmentID returns the department code in a student username, or 0
+// when username is not a student number.
+func GetDepartmentID(username string) int {
+	n, _ := ParseStudentNumber(username)
+	return n.Department
+}
+
+var foldTurkish = strings.NewReplacer("ç", "c", "ğ", "g", "ı", "i", "ö", "o", "ş", "s", "ü", "u", "â", "a", "î", "i", "û", "u")
+
+// departmentNoise are words the portal adds or leaves out at will.
+var departmentNoise = map[string]bool{"bolumu": true, "bolum": true, "department": true, "dept": true, "of": true, "programi": true}
+
+// normalizeDepartmentName folds case, Turkish letters, punctuation and noise
+// words, so "Bilgisayar Mühendisliği Bölümü" and "bilgisayar muhendisligi"
+// compare equal.
+func normalizeDepartmentName(name string) string {
+	name = foldTurkish.Replace(strings.ToLowerSpecial(unicode.TurkishCase, name))
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	kept := words[:0]
+	for _, w := range words {
+		if !departmentNoise[w] {
+			kept = append(kept, w)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+// DepartmentMap resolves users to registered departments.
+type DepartmentMap struct {
+	byCode map[int]Department
+	byName map[string]Department
+}
+
+func NewDepartmentMap(departments []Department) *DepartmentMap {
+	m := &DepartmentMap{byCode: map[int]Department{}, byName: map[string]Department{}}
+	for _, d := range departments {
+		m.byCode[d.Code] = d
+		for _, name := range append([]string{d.NameTR, d.NameEN}, d.Aliases...) {
+			if key := normalizeDepartmentName(name); key != "" {
+				m.byName[key] = d
+			}
+		}
+	}
+	return m
+}
+
+// Resolve finds the department of u: the code in a student number when it is
+// registered, else the department name reported by the portal, else the
+// unregistered code of a student number. ok is false when nothing matched.
+func (m *DepartmentMap) Resolve(u *User) (code, faculty int, source string, ok bool) {
+	number, isStudent := ParseStudentNumber(u.Username)
+	if d, found := m.byCode[number.Department]; isStudent && found {
+		return d.Code, d.Faculty, DepartmentFromStudentNumber, true
+	}
+	for _, name := range []string{u.DepartmentName, u.Department_alt} {
+		if d, found := m.byName[normalizeDepartmentName(name)]; found && name != "" {
+			return d.Code, d.Faculty, DepartmentFromPortal, true
+		}
+	}
+	if isStudent {
+		return number.Department, 0, DepartmentFromStudentNumber, true
+	}
+	return 0, 0, "", false
+}
+
+// Assign maps u to its department and stores the result when it changed,
+// which it reports. Mappings made by an admin are kept.
+func (m *DepartmentMap) Assign(ctx context.Context, users UserRepository, u *User) (bool, error) {
+	if u.DepartmentSource == DepartmentFromAdmin {
+		return false, nil
+	}
+	code, faculty, source, ok := m.Resolve(u)
+	if !ok || (code == u.Department && faculty == u.FacultyCode && source == u.DepartmentSource) {
+		return false, nil
+	}
+	return true, users.SetDepartment(ctx, u, code, faculty, source)
+}
+
+// AssignDepartment maps u against the current registry, see Assign.
+func AssignDepartment(ctx context.Context, departments DepartmentRepository, users UserRepository, u *User) error {
+	all, err := departments.GetDepartments(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = NewDepartmentMap(all).Assign(ctx, users, u)
+	return err
+}
+
+// BuildFacultyTree nests departments under their faculties. Departments of
+// an unregistered faculty are left out.
+func BuildFacultyTree(faculties []Faculty, departments []Department) []FacultyTree {
+	tree := make([]FacultyTree, 0, len(faculties))
+	index := map[int]int{}
+	sort.Slice(faculties, func(i, j int) bool { return faculties[i].Code < faculties[j].Code })
+	for i, f := range faculties {
+		index[f.Code] = i
+		tree = append(tree, FacultyTree{Faculty: f, Departments: []Department{}})
+	}
+	sort.Slice(departments, func(i, j int) bool { return departments[i].Code < departments[j].Code })
+	for _, d := range departments {
+		if i, ok := index[d.Faculty]; ok {
+			tree[i].Departments = append(tree[i].Departments, d)
+		}
+	}
+	return tree
+}
+
+// mongoDepartmentRepository keeps the registry in "faculties" and
+// "departments".
+type mongoDepartmentRepository struct {
+	faculties   *mongo.Collection
+	departments *mongo.Collection
+}
+
+func NewMongoDepartmentRepository(db *mongo.Database) DepartmentRepository {
+	return &mongoDepartmentRepository{
+		faculties:   db.Collection("faculties"),
+		departments: db.Collection("departments"),
+	}
+}
+
+func (r *mongoDepartmentRepository) PutFaculty(ctx context.Context, f *Faculty) error {
+	_, err := r.faculties.ReplaceOne(ctx, bson.M{"_id": f.Code}, f, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *mongoDepartmentRepository) GetFaculties(ctx context.Context) ([]Faculty, error) {
+	cursor, err := r.faculties.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	faculties := []Faculty{}
+	err = cursor.All(ctx, &faculties)
+	return faculties, err
+}
+
+func (r *mongoDepartmentRepository) PutDepartment(ctx context.Context, d *Department) error {
+	if err := r.faculties.FindOne(ctx, bson.M{"_id": d.Faculty}).Err(); err != nil {
+		return notFound(err, errFacultyNotFound)
+	}
+	if d.Aliases == nil {
+		d.Aliases = []string{}
+	}
+	_, err := r.departments.ReplaceOne(ctx, bson.M{"_id": d.Code}, d, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *mongoDepartmentRepository) GetDepartment(ctx context.Context, code int) (Department, error) {
+	var d Department
+	err := r.departments.FindOne(ctx, bson.M{"_id": code}).Decode(&d)
+	return d, notFound(err, errDepartmentNotFound)
+}
+
+func (r *mongoDepartmentRepository) GetDepartments(ctx context.Context) ([]Department, error) {
+	cursor, err := r.departments.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	departments := []Department{}
+	err = cursor.All(ctx, &departments)
+	return departments, err
+}
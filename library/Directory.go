@@ -0,0 +1,255 @@
+package library
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Who besides the user sees a profile field.
+const (
+	VisibilityPublic     = "public"
+	VisibilityDepartment = "department"
+	VisibilityPrivate    = "private"
+)
+
+// Privacy sets the visibility of each profile field fetched from the portal.
+// Username, user type, department and faculty follow from the student number
+// and are always visible. Empty fields keep the defaults of DefaultPrivacy.
+type Privacy struct {
+	FullName   string `json:"full_name,omitempty" bson:"full_name,omitempty" validate:"omitempty,oneof=public department private"`
+	Year       string `json:"year,omitempty" bson:"year,omitempty" validate:"omitempty,oneof=public department private"`
+	Cirriculum string `json:"cirriculum,omitempty" bson:"cirriculum,omitempty" validate:"omitempty,oneof=public department private"`
+	Advisor    string `json:"advisor,omitempty" bson:"advisor,omitempty" validate:"omitempty,oneof=public department private"`
+	Rank       string `json:"rank,omitempty" bson:"rank,omitempty" validate:"omitempty,oneof=public department private"`
+}
+
+// DefaultPrivacy applies to every field a user has not set.
+var DefaultPrivacy = Privacy{
+	FullName:   VisibilityPublic,
+	Year:       VisibilityDepartment,
+	Cirriculum: VisibilityDepartment,
+	Advisor:    VisibilityDepartment,
+	Rank:       VisibilityPrivate,
+}
+
+// Merge returns p with the fields set in changes replaced.
+func (p Privacy) Merge(changes Privacy) Privacy {
+	set := func(field *string, value string) {
+		if value != "" {
+			*field = value
+		}
+	}
+	set(&p.FullName, changes.FullName)
+	set(&p.Year, changes.Year)
+	set(&p.Cirriculum, changes.Cirriculum)
+	set(&p.Advisor, changes.Advisor)
+	set(&p.Rank, changes.Rank)
+	return p
+}
+
+// Effective returns p with DefaultPrivacy filled in.
+func (p Privacy) Effective() Privacy {
+	return DefaultPrivacy.Merge(p)
+}
+
+// HasRole reports whether u holds role.
+func (u *User) HasRole(role string) bool {
+	return hasRole(u.Roles, role)
+}
+
+// visibleTo reports whether viewer may see a field of u kept at visibility.
+// Users see all of their own profile and admins see every profile. A zero
+// Department is unknown, never the department of anyone.
+func (u *User) visibleTo(viewer *User, visibility string) bool {
+	switch {
+	case viewer.Username == u.Username, viewer.HasRole(RoleAdmin):
+		return true
+	case visibility == VisibilityPublic:
+		return true
+	case visibility == VisibilityDepartment:
+		return viewer.Department != 0 && viewer.Department == u.Department
+	}
+	return false
+}
+
+// UserProfile is what a user sees of another user. Fields hidden by the
+// owner's privacy settings are left out.
+type UserProfile struct {
+	Username       string `json:"id"`
+	UserType       string `json:"user_type"`
+	Department     int    `json:"department"`
+	DepartmentName string `json:"department_name,omitempty"`
+	Faculty        string `json:"faculty,omitempty"`
+	FullName       string `json:"full_name,omitempty"`
+	Year           string `json:"year,omitempty"`
+	Cirriculum     string `json:"cirriculum,omitempty"`
+	Advisor        string `json:"advisor,omitempty"`
+	Rank           string `json:"rank,omitempty"`
+}
+
+// ProfileFor returns the profile of u as viewer may see it.
+func (u *User) ProfileFor(viewer *User) UserProfile {
+	privacy := u.Privacy.Effective()
+	show := func(value, visibility string) string {
+		if u.visibleTo(viewer, visibility) {
+			return value
+		}
+		return ""
+	}
+	return UserProfile{
+		Username:       u.Username,
+		UserType:       u.UserType,
+		Department:     u.Department,
+		DepartmentName: u.DepartmentName,
+		Faculty:        u.Faculty,
+		FullName:       show(u.FullName, privacy.FullName),
+		Year:           show(u.Year, privacy.Year),
+		Cirriculum:     show(u.Cirriculum, privacy.Cirriculum),
+		Advisor:        show(u.Advisor, privacy.Advisor),
+		Rank:           show(u.Rank, privacy.Rank),
+	}
+}
+
+// ProfilesFor turns a page of users into the profiles viewer may see.
+func ProfilesFor(users Page[User], viewer *User) Page[UserProfile] {
+	page := Page[UserProfile]{
+		Items:   make([]UserProfile, 0, len(users.Items)),
+		Page:    users.Page,
+		PerPage: users.PerPage,
+		Total:   users.Total,
+	}
+	for i := range users.Items {
+		page.Items = append(page.Items, users.Items[i].ProfileFor(viewer))
+	}
+	return page
+}
+
+// UserQuery searches the user directory. Query matches part of a full name,
+// but only of users whose name Viewer may see.
+type UserQuery struct {
+	PageQuery
+	Query      string `json:"q" query:"q" validate:"max=100"`
+	Department int    `json:"department" query:"department" validate:"min=0"`
+	Faculty    string `json:"faculty" query:"faculty" validate:"max=120"`
+	// FacultyCode filters on the registered faculty, see AssignDepartment.
+	FacultyCode int    `json:"faculty_code" query:"faculty_code" validate:"min=0"`
+	UserType    string `json:"user_type" query:"user_type" validate:"omitempty,oneof=student teacher"`
+	Viewer      *User  `json:"-" query:"-" validate:"-"`
+}
+
+// matches is the in-memory twin of mongoFilter.
+func (q *UserQuery) matches(u User) bool {
+	if q.Department != 0 && u.Department != q.Department {
+		return false
+	}
+	if q.Faculty != "" && !strings.EqualFold(u.Faculty, q.Faculty) {
+		return false
+	}
+	if q.FacultyCode != 0 && u.FacultyCode != q.FacultyCode {
+		return false
+	}
+	if q.UserType != "" && u.UserType != q.UserType {
+		return false
+	}
+	if q.Query != "" {
+		if !u.visibleTo(q.Viewer, u.Privacy.Effective().FullName) {
+			return false
+		}
+		return strings.Contains(strings.ToLower(u.FullName), strings.ToLower(q.Query))
+	}
+	return true
+}
+
+func (q *UserQuery) mongoFilter() bson.M {
+	filter := bson.M{}
+	if q.Department != 0 {
+		filter["department"] = q.Department
+	}
+	if q.Faculty != "" {
+		filter["faculty"] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(q.Faculty) + "$", Options: "i"}
+	}
+	if q.FacultyCode != 0 {
+		filter["faculty_code"] = q.FacultyCode
+	}
+	if q.UserType != "" {
+		filter["user_type"] = q.UserType
+	}
+	if q.Query != "" {
+		filter["full_name"] = primitive.Regex{Pattern: regexp.QuoteMeta(q.Query), Options: "i"}
+		if !q.Viewer.HasRole(RoleAdmin) {
+			filter["$or"] = visibleFilter("privacy.full_name", DefaultPrivacy.FullName, q.Viewer)
+		}
+	}
+	return filter
+}
+
+// visibleFilter matches the users whose field at path viewer may see, where
+// a missing setting means fallback. A viewer of unknown department sees no
+// field kept to a department.
+func visibleFilter(path, fallback string, viewer *User) bson.A {
+	or := bson.A{
+		bson.M{"_id": viewer.Username},
+		bson.M{path: VisibilityPublic},
+	}
+	if fallback == VisibilityPublic {
+		or = append(or, bson.M{path: nil})
+	}
+	if viewer.Department != 0 {
+		or = append(or, bson.M{path: VisibilityDepartment, "department": viewer.Department})
+		if fallback == VisibilityDepartment {
+			or = append(or, bson.M{path: nil, "department": viewer.Department})
+		}
+	}
+	return or
+}
+
+func (r *mongoUserRepository) SearchUsers(ctx context.Context, q UserQuery) (Page[User], error) {
+	q.normalize()
+	page := Page[User]{Items: []User{}, Page: q.Page, PerPage: q.PerPage}
+	filter := q.mongoFilter()
+	total, err := r.users.CountDocuments(ctx, filter)
+	if err != nil {
+		return page, err
+	}
+	page.Total = total
+	cursor, err := r.users.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetSkip(int64(q.skip())).
+		SetLimit(int64(q.PerPage)))
+	if err != nil {
+		return page, err
+	}
+	err = cursor.All(ctx, &page.Items)
+	return page, err
+}
+
+func (r *mongoUserRepository) UpdatePrivacy(ctx context.Context, u *User, p Privacy) error {
+	res, err := r.users.UpdateOne(ctx, bson.M{"_id": u.Username}, bson.M{"$set": bson.M{"privacy": p}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errUserNotFound.Wrap(mongo.ErrNoDocuments)
+	}
+	return notFound(r.users.FindOne(ctx, bson.M{"_id": u.Username}).Decode(u), errUserNotFound)
+}
+
+func (r *mongoUserRepository) StaleProfiles(ctx context.Context, before time.Time, limit int) ([]User, error) {
+	cursor, err := r.users.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"profile_synced_at": bson.M{"$lt": primitive.NewDateTimeFromTime(before)}},
+		bson.M{"profile_synced_at": nil},
+	}}, options.Find().SetSort(bson.D{{Key: "profile_synced_at", Value: 1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	users := []User{}
+	err = cursor.All(ctx, &users)
+	return users, err
+}
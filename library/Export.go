@@ -0,0 +1,254 @@
+package library
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ExportQuery selects the records of an export. From and To are inclusive
+// dates matched against when a record was made: Date for suggestions and
+// projects, CreatedAt for events. Status does not apply to projects.
+type ExportQuery struct {
+	From   string `json:"from" query:"from" validate:"omitempty,datetime=2006-01-02"`
+	To     string `json:"to" query:"to" validate:"omitempty,datetime=2006-01-02"`
+	Status string `json:"status" query:"status" validate:"omitempty,oneof=pending approved rejected"`
+}
+
+// Check reports an invalid window before an export starts streaming.
+func (q ExportQuery) Check() error {
+	_, _, err := q.bounds()
+	return err
+}
+
+// bounds returns the window of q, zero where it is open.
+func (q ExportQuery) bounds() (from, to time.Time, err error) {
+	if q.From != "" {
+		if from, err = time.Parse(time.DateOnly, q.From); err != nil {
+			return from, to, errInvalidWindow.Wrap(err)
+		}
+	}
+	if q.To != "" {
+		if to, err = time.Parse(time.DateOnly, q.To); err != nil {
+			return from, to, errInvalidWindow.Wrap(err)
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return from, to, errInvalidWindow
+	}
+	return from, to, nil
+}
+
+// dateFilter matches the RFC 3339 Date strings of suggestions and projects
+// in the window of q.
+func (q ExportQuery) dateFilter() (bson.M, error) {
+	from, to, err := q.bounds()
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.M{}
+	if !from.IsZero() {
+		filter["$gte"] = from.Format(time.RFC3339)
+	}
+	if !to.IsZero() {
+		filter["$lt"] = to.Format(time.RFC3339)
+	}
+	return filter, nil
+}
+
+// containsDate is dateFilter for the memory repositories.
+func (q ExportQuery) containsDate(date string) bool {
+	from, to, _ := q.bounds()
+	return (from.IsZero() || date >= from.Format(time.RFC3339)) && (to.IsZero() || date < to.Format(time.RFC3339))
+}
+
+func (q ExportQuery) containsTime(t time.Time) bool {
+	from, to, _ := q.bounds()
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
+
+// SuggestionExport is a suggestion with its scores and the moderation
+// decision taken on it.
+type SuggestionExport struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	Title      string             `json:"title" bson:"title"`
+	Content    string             `json:"content" bson:"content"`
+	Author     string             `json:"author" bson:"author"`
+	Department int                `json:"department" bson:"department"`
+	Date       string             `json:"date" bson:"date"`
+	Status     string             `json:"status" bson:"status"`
+	Tags       []string           `json:"tags" bson:"tags"`
+	Upvotes    int                `json:"upvotes" bson:"upvote_count"`
+	Downvotes  int                `json:"downvotes" bson:"downvote_count"`
+	Score      int                `json:"score" bson:"score"`
+	Stars      float64            `json:"stars" bson:"star_average"`
+	Ratings    int                `json:"ratings" bson:"star_count"`
+	// DecidedBy and DecidedAt come from the approval or the rejection.
+	DecidedBy       string `json:"decided_by,omitempty" bson:"decided_by"`
+	DecidedAt       string `json:"decided_at,omitempty" bson:"decided_at"`
+	RejectionReason string `json:"rejection_reason,omitempty" bson:"rejection_reason"`
+}
+
+// ProjectExport is a project with its scores.
+type ProjectExport struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	Title     string             `json:"title" bson:"title"`
+	Author    string             `json:"author" bson:"author"`
+	Advisor   string             `json:"advisor" bson:"advisor"`
+	Date      string             `json:"date" bson:"date"`
+	Team      []string           `json:"team" bson:"team"`
+	Tags      []string           `json:"tags" bson:"tags"`
+	Upvotes   int                `json:"upvotes" bson:"upvote_count"`
+	Downvotes int                `json:"downvotes" bson:"downvote_count"`
+	Score     int                `json:"score" bson:"score"`
+	Stars     float64            `json:"stars" bson:"star_average"`
+	Ratings   int                `json:"ratings" bson:"star_count"`
+}
+
+func newProjectExport(p Project) ProjectExport {
+	e := ProjectExport{
+		ID:        p.ID,
+		Title:     p.Title,
+		Author:    p.AuthorID,
+		Advisor:   p.AdvisorID,
+		Date:      p.Date,
+		Team:      []string{},
+		Tags:      p.Tags,
+		Upvotes:   p.UpvoteCount,
+		Downvotes: p.DownvoteCount,
+		Score:     p.Score,
+		Ratings:   len(p.Stars),
+	}
+	for _, member := range p.Team {
+		e.Team = append(e.Team, member.UserID)
+	}
+	for _, s := range p.Stars {
+		e.Stars += s.Star / float64(len(p.Stars))
+	}
+	return e
+}
+
+// mongoExportRepository reads exports with cursors, so only the document at
+// hand is held in memory.
+type mongoExportRepository struct {
+	suggestions *mongo.Collection
+	rejections  *mongo.Collection
+	approvals   *mongo.Collection
+	events      *mongo.Collection
+	projects    *mongo.Collection
+}
+
+func NewMongoExportRepository(db *mongo.Database) ExportRepository {
+	return &mongoExportRepository{
+		suggestions: db.Collection("suggestions"),
+		rejections:  db.Collection("rejections"),
+		approvals:   db.Collection("approvals"),
+		events:      db.Collection("events"),
+		projects:    db.Collection("projects"),
+	}
+}
+
+// each decodes the documents of cursor one at a time into fn.
+func each[T any](ctx context.Context, cursor *mongo.Cursor, fn func(T) error) error {
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc T
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// scores adds the star fields of SuggestionExport and ProjectExport; the vote
+// counters are stored.
+var scores = bson.M{"$addFields": bson.M{
+	"star_count":   bson.M{"$size": bson.M{"$ifNull": bson.A{"$stars", bson.A{}}}},
+	"star_average": bson.M{"$ifNull": bson.A{bson.M{"$avg": "$stars.star"}, 0}},
+}}
+
+func (r *mongoExportRepository) EachSuggestion(ctx context.Context, q ExportQuery, fn func(SuggestionExport) error) error {
+	dates, err := q.dateFilter()
+	if err != nil {
+		return err
+	}
+	match := bson.M{}
+	if len(dates) > 0 {
+		match["date"] = dates
+	}
+	if q.Status != "" {
+		match["status"] = q.Status
+	}
+	first := func(field string) bson.M {
+		return bson.M{"$first": field}
+	}
+	cursor, err := r.suggestions.Aggregate(ctx, bson.A{
+		bson.M{"$match": match},
+		bson.M{"$sort": bson.M{"_id": 1}},
+		bson.M{"$lookup": bson.M{"from": r.approvals.Name(), "localField": "_id", "foreignField": "_id", "as": "approval"}},
+		bson.M{"$lookup": bson.M{"from": r.rejections.Name(), "localField": "_id", "foreignField": "_id", "as": "rejection"}},
+		scores,
+		bson.M{"$addFields": bson.M{
+			"department":       mongoDepartmentID,
+			"decided_by":       bson.M{"$ifNull": bson.A{first("$rejection.executor"), first("$approval.executor"), ""}},
+			"decided_at":       bson.M{"$ifNull": bson.A{first("$rejection.date"), first("$approval.date"), ""}},
+			"rejection_reason": bson.M{"$ifNull": bson.A{first("$rejection.reason"), ""}},
+		}},
+		bson.M{"$project": bson.M{"approval": 0, "rejection": 0, "upvotes": 0, "downvotes": 0, "stars": 0}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	return each(ctx, cursor, fn)
+}
+
+func (r *mongoExportRepository) EachEvent(ctx context.Context, q ExportQuery, fn func(Event) error) error {
+	from, to, err := q.bounds()
+	if err != nil {
+		return err
+	}
+	filter, created := bson.M{}, bson.M{}
+	if !from.IsZero() {
+		created["$gte"] = primitive.NewDateTimeFromTime(from)
+	}
+	if !to.IsZero() {
+		created["$lt"] = primitive.NewDateTimeFromTime(to)
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+	if q.Status != "" {
+		filter["status"] = q.Status
+	}
+	cursor, err := r.events.Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	return each(ctx, cursor, fn)
+}
+
+func (r *mongoExportRepository) EachProject(ctx context.Context, q ExportQuery, fn func(ProjectExport) error) error {
+	dates, err := q.dateFilter()
+	if err != nil {
+		return err
+	}
+	filter := bson.M{}
+	if len(dates) > 0 {
+		filter["date"] = dates
+	}
+	cursor, err := r.projects.Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	return each(ctx, cursor, func(p Project) error {
+		return fn(newProjectExport(p))
+	})
+}
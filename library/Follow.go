@@ -0,0 +1,247 @@
+package library
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The kinds of Subject: suggestions, projects, events and tags are followed,
+// users are mentioned.
+const (
+	SubjectSuggestion = "suggestions"
+	SubjectProject    = "projects"
+	SubjectEvent      = "events"
+	SubjectTag        = "tags"
+	SubjectUser       = "users"
+)
+
+// Activity types.
+const (
+	// ActivityApproved is a suggestion or event being approved.
+	ActivityApproved = "approved"
+	ActivityRejected = "rejected"
+	// ActivityProject is a suggestion becoming a project.
+	ActivityProject = "project"
+)
+
+var (
+	errNotFollowing  = NotFound("FOLLOW_NOT_FOUND", "You are not following this")
+	errNotFollowable = Validation("INVALID_FOLLOW", "Only suggestions, projects, events and tags can be followed")
+	errInvalidTag    = Validation("INVALID_TAG", "Tags start with a letter and have at most 32 letters, digits, dashes and underscores")
+)
+
+// Subject is what activity is about and what users follow, written as
+// kind:id, such as "suggestions:65f0c1d2e3f4a5b6c7d8e9f0" or "tags:garden".
+type Subject string
+
+func NewSubject(kind, id string) Subject {
+	return Subject(kind + ":" + id)
+}
+
+// Follow is a user following a suggestion, project, event or tag.
+type Follow struct {
+	User string `json:"-" bson:"user"`
+	// Kind is what is followed, see SubjectSuggestion; Target is its ID, or
+	// the tag.
+	Kind   string             `json:"kind" bson:"kind"`
+	Target string             `json:"target" bson:"target"`
+	Since  primitive.DateTime `json:"since" bson:"since"`
+}
+
+func (f *Follow) Subject() Subject {
+	return NewSubject(f.Kind, f.Target)
+}
+
+// prepare checks what f follows and lowers the case of tags.
+func (f *Follow) prepare() error {
+	switch f.Kind {
+	case SubjectSuggestion, SubjectProject, SubjectEvent:
+		if !primitive.IsValidObjectID(f.Target) {
+			return Validation("INVALID_ID", "Invalid target", FieldError{Field: "target", Code: "objectid", Message: "target must be a 24 character hex ObjectID"})
+		}
+	case SubjectTag:
+		f.Target = strings.ToLower(f.Target)
+		if tagName([]byte(f.Target)) != f.Target || f.Target == "" {
+			return errInvalidTag
+		}
+	default:
+		return errNotFollowable
+	}
+	return nil
+}
+
+// Activity is something that happened to a suggestion, project or event,
+// shown in the feeds of whoever follows one of its subjects.
+type Activity struct {
+	ID   primitive.ObjectID `json:"id" bson:"_id"`
+	Type string             `json:"type" bson:"type" enums:"approved,rejected,project"`
+	// Kind and Target are what happened to, see SubjectSuggestion.
+	Kind   string             `json:"kind" bson:"kind"`
+	Target primitive.ObjectID `json:"target" bson:"target"`
+	Title  string             `json:"title" bson:"title"`
+	// Subjects are followed by those who see the activity: its target, the
+	// tags of the target and the users its text mentions.
+	Subjects []Subject          `json:"-" bson:"subjects"`
+	At       primitive.DateTime `json:"at" bson:"at"`
+}
+
+// subjects are the target, tags and mentions of public activity.
+func subjects(target Subject, tags, mentions []string) []Subject {
+	all := []Subject{target}
+	for _, tag := range tags {
+		all = append(all, NewSubject(SubjectTag, tag))
+	}
+	for _, username := range mentions {
+		all = append(all, NewSubject(SubjectUser, username))
+	}
+	return all
+}
+
+// Activity is the activity of type typ on s. Only the followers of s hear
+// of a suggestion being rejected; everyone else never saw it.
+func (s *Suggestion) Activity(typ string) Activity {
+	a := Activity{Type: typ, Kind: SubjectSuggestion, Target: s.ID, Title: s.Title}
+	a.Subjects = []Subject{NewSubject(SubjectSuggestion, s.ID.Hex())}
+	if typ != ActivityRejected {
+		a.Subjects = subjects(a.Subjects[0], s.Tags, s.Mentions)
+	}
+	return a
+}
+
+// Activity is the activity of type typ on p. Projects keep the ID of their
+// suggestion, so the followers of the suggestion hear of the project too.
+func (p *Project) Activity(typ string) Activity {
+	a := Activity{Type: typ, Kind: SubjectProject, Target: p.ID, Title: p.Title}
+	a.Subjects = append(subjects(NewSubject(SubjectProject, p.ID.Hex()), p.Tags, p.Mentions), NewSubject(SubjectSuggestion, p.ID.Hex()))
+	return a
+}
+
+func (e *Event) Activity(typ string) Activity {
+	a := Activity{Type: typ, Kind: SubjectEvent, Target: e.ID, Title: e.Title}
+	a.Subjects = subjects(NewSubject(SubjectEvent, e.ID.Hex()), e.Tags, e.Mentions)
+	return a
+}
+
+func (a *Activity) prepareInsert() {
+	a.ID = primitive.NewObjectID()
+	a.At = primitive.NewDateTimeFromTime(time.Now())
+}
+
+// feedSubjects are the subjects whose activity is in the feed of user.
+func feedSubjects(user string, follows []Follow) []Subject {
+	all := []Subject{NewSubject(SubjectUser, user)}
+	for _, f := range follows {
+		all = append(all, f.Subject())
+	}
+	return all
+}
+
+// mongoFollowRepository keeps follows in the "follows" collection and
+// activity in the "activity" collection.
+type mongoFollowRepository struct {
+	follows  *mongo.Collection
+	activity *mongo.Collection
+}
+
+func NewMongoFollowRepository(db *mongo.Database) FollowRepository {
+	return &mongoFollowRepository{follows: db.Collection("follows"), activity: db.Collection("activity")}
+}
+
+func (r *mongoFollowRepository) Follow(ctx context.Context, f *Follow) error {
+	if err := f.prepare(); err != nil {
+		return err
+	}
+	key := bson.M{"user": f.User, "kind": f.Kind, "target": f.Target}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	update := bson.M{"$setOnInsert": bson.M{"since": primitive.NewDateTimeFromTime(time.Now())}}
+	return r.follows.FindOneAndUpdate(ctx, key, update, opts).Decode(f)
+}
+
+func (r *mongoFollowRepository) Unfollow(ctx context.Context, f *Follow) error {
+	if err := f.prepare(); err != nil {
+		return err
+	}
+	res, err := r.follows.DeleteOne(ctx, bson.M{"user": f.User, "kind": f.Kind, "target": f.Target})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return errNotFollowing
+	}
+	return nil
+}
+
+func (r *mongoFollowRepository) GetFollows(ctx context.Context, user string, q PageQuery) (Page[Follow], error) {
+	q.normalize()
+	page := Page[Follow]{Items: []Follow{}, Page: q.Page, PerPage: q.PerPage}
+	total, err := r.follows.CountDocuments(ctx, bson.M{"user": user})
+	if err != nil {
+		return page, err
+	}
+	page.Total = total
+	cursor, err := r.follows.Find(ctx, bson.M{"user": user}, options.Find().
+		SetSort(bson.D{{Key: "since", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(q.skip())).
+		SetLimit(int64(q.PerPage)))
+	if err != nil {
+		return page, err
+	}
+	err = cursor.All(ctx, &page.Items)
+	return page, err
+}
+
+func (r *mongoFollowRepository) CopyFollowers(ctx context.Context, from, to Follow) error {
+	cursor, err := r.follows.Find(ctx, bson.M{"kind": from.Kind, "target": from.Target})
+	if err != nil {
+		return err
+	}
+	var followers []Follow
+	if err := cursor.All(ctx, &followers); err != nil {
+		return err
+	}
+	for _, f := range followers {
+		to.User = f.User
+		if err := r.Follow(ctx, &to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *mongoFollowRepository) Publish(ctx context.Context, a *Activity) error {
+	a.prepareInsert()
+	_, err := r.activity.InsertOne(ctx, a)
+	return err
+}
+
+func (r *mongoFollowRepository) Feed(ctx context.Context, user string, q PageQuery) (Page[Activity], error) {
+	q.normalize()
+	page := Page[Activity]{Items: []Activity{}, Page: q.Page, PerPage: q.PerPage}
+	cursor, err := r.follows.Find(ctx, bson.M{"user": user})
+	if err != nil {
+		return page, err
+	}
+	var follows []Follow
+	if err := cursor.All(ctx, &follows); err != nil {
+		return page, err
+	}
+	filter := bson.M{"subjects": bson.M{"$in": feedSubjects(user, follows)}}
+	if page.Total, err = r.activity.CountDocuments(ctx, filter); err != nil {
+		return page, err
+	}
+	cursor, err = r.activity.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(q.skip())).
+		SetLimit(int64(q.PerPage)))
+	if err != nil {
+		return page, err
+	}
+	err = cursor.All(ctx, &page.Items)
+	return page, err
+}
@@ -0,0 +1,337 @@
+package library
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxImportRows bounds a single import file.
+const maxImportRows = 5000
+
+// UpsertResult tells what an idempotent write did.
+type UpsertResult int
+
+const (
+	UpsertUnchanged UpsertResult = iota
+	UpsertCreated
+	UpsertUpdated
+)
+
+// ImportRowError is a problem with one row of an import file. Row is the
+// line the row starts on, the header being line 1.
+type ImportRowError struct {
+	Row int `json:"row"`
+	FieldError
+}
+
+// ImportReport summarizes an import. Rows are only written when every row is
+// valid and it is not a dry run; Applied tells whether they were.
+type ImportReport struct {
+	DryRun    bool             `json:"dry_run"`
+	Applied   bool             `json:"applied"`
+	Rows      int              `json:"rows"`
+	Created   int              `json:"created"`
+	Updated   int              `json:"updated"`
+	Unchanged int              `json:"unchanged"`
+	Failed    int              `json:"failed"`
+	Errors    []ImportRowError `json:"errors"`
+}
+
+func (r *ImportReport) count(result UpsertResult) {
+	switch result {
+	case UpsertCreated:
+		r.Created++
+	case UpsertUpdated:
+		r.Updated++
+	default:
+		r.Unchanged++
+	}
+}
+
+// fail records err against row. Field errors are listed one by one.
+func (r *ImportReport) fail(row int, err error) {
+	r.Failed++
+	var e *Error
+	if !errors.As(err, &e) {
+		r.Errors = append(r.Errors, ImportRowError{Row: row, FieldError: FieldError{Code: "ROW_FAILED", Message: err.Error()}})
+		return
+	}
+	if len(e.Fields) == 0 {
+		r.Errors = append(r.Errors, ImportRowError{Row: row, FieldError: FieldError{Code: e.Code, Message: e.Message}})
+	}
+	for _, field := range e.Fields {
+		r.Errors = append(r.Errors, ImportRowError{Row: row, FieldError: field})
+	}
+}
+
+// ImportRow is a decoded row of an import file.
+type ImportRow[T any] struct {
+	Line  int
+	Value T
+}
+
+// ReadImport decodes a CSV file whose header names the json fields of T, all
+// of them strings. Columns may come in any order; unknown columns and
+// missing required ones reject the whole file.
+func ReadImport[T any](r io.Reader) ([]ImportRow[T], error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	fields := map[string]int{}
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[name] = i
+	}
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, Validation("INVALID_CSV", "The file is empty")
+	}
+	if err != nil {
+		return nil, Validation("INVALID_CSV", "The file is not valid CSV").Wrap(err)
+	}
+	columns := make([]int, len(header))
+	seen := map[string]bool{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		field, ok := fields[name]
+		if !ok || seen[name] {
+			return nil, Validation("INVALID_CSV", "The header has an unknown or repeated column",
+				FieldError{Field: name, Code: "header", Message: fmt.Sprintf("column %q is unknown or repeated", name)})
+		}
+		seen[name] = true
+		columns[i] = field
+	}
+	for name, field := range fields {
+		if strings.Contains(t.Field(field).Tag.Get("validate"), "required") && !seen[name] {
+			return nil, Validation("INVALID_CSV", "The header misses a required column",
+				FieldError{Field: name, Code: "header", Message: fmt.Sprintf("column %q is required", name)})
+		}
+	}
+	var rows []ImportRow[T]
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, Validation("INVALID_CSV", "The file is not valid CSV").Wrap(err)
+		}
+		if len(rows) == maxImportRows {
+			return nil, Validation("TOO_MANY_ROWS", fmt.Sprintf("A file has at most %d rows", maxImportRows))
+		}
+		line, _ := reader.FieldPos(0)
+		row := ImportRow[T]{Line: line}
+		v := reflect.ValueOf(&row.Value).Elem()
+		for i, cell := range record {
+			v.Field(columns[i]).SetString(strings.TrimSpace(cell))
+		}
+		rows = append(rows, row)
+	}
+}
+
+// splitList splits a comma separated cell, the way exports join lists.
+func splitList(cell string) []string {
+	list := []string{}
+	for _, item := range strings.Split(cell, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// EventRow is a row of an event import. Key identifies the event across
+// imports; without it the title and start time do, so an event whose title
+// changes is imported again as a new one.
+type EventRow struct {
+	Key         string `json:"key" validate:"max=100"`
+	Title       string `json:"title" validate:"required,max=120"`
+	Description string `json:"description" validate:"max=2000"`
+	StartTime   string `json:"start_time" validate:"required,datetime=2006-01-02T15:04:05Z07:00"`
+	EndTime     string `json:"end_time" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	Location    string `json:"location" validate:"max=200"`
+	Type        string `json:"type" validate:"required,max=40"`
+	// Tags are separated by commas.
+	Tags string `json:"tags" validate:"max=500"`
+}
+
+// event builds the event of row, organized by organizer. Mentions in the
+// description are not linked, so an import does not look up users row by
+// row.
+func (row EventRow) event(ctx context.Context, organizer User) (Event, error) {
+	if err := Validate(row); err != nil {
+		return Event{}, err
+	}
+	description, err := ParseMarkdown(ctx, nil, "description", row.Description)
+	if err != nil {
+		return Event{}, err
+	}
+	start, _ := time.Parse(time.RFC3339, row.StartTime)
+	e := Event{
+		ImportKey:   row.Key,
+		Title:       row.Title,
+		StartTime:   primitive.NewDateTimeFromTime(start),
+		Location:    row.Location,
+		Type:        row.Type,
+		Tags:        splitList(row.Tags),
+		OrganizerID: organizer.Username,
+		Author:      organizer.FullName,
+	}
+	e.SetDescription(description)
+	if e.Author == "" {
+		e.Author = organizer.Username
+	}
+	if e.ImportKey == "" {
+		e.ImportKey = strings.ToLower(row.Title) + "@" + start.UTC().Format(time.RFC3339)
+	}
+	if row.EndTime != "" {
+		end, _ := time.Parse(time.RFC3339, row.EndTime)
+		if !end.After(start) {
+			return e, Validation("VALIDATION_FAILED", "Request validation failed",
+				FieldError{Field: "end_time", Code: "gtfield", Message: "end_time must be after start_time"})
+		}
+		e.EndTime = primitive.NewDateTimeFromTime(end)
+	}
+	return e, nil
+}
+
+// ImportEvents upserts rows as approved events of organizer. Rows matching an
+// earlier import by key are updated in place, so importing a file twice
+// changes nothing.
+func ImportEvents(ctx context.Context, events EventRepository, organizer User, rows []ImportRow[EventRow], dryRun bool) (ImportReport, error) {
+	report := ImportReport{DryRun: dryRun, Rows: len(rows), Errors: []ImportRowError{}}
+	parsed := make([]Event, len(rows))
+	keys := map[string]int{}
+	for i, row := range rows {
+		e, err := row.Value.event(ctx, organizer)
+		if err == nil {
+			if first, ok := keys[e.ImportKey]; ok {
+				err = Validation("DUPLICATE_ROW", "Duplicate row", FieldError{Field: "key", Code: "unique", Message: fmt.Sprintf("the event of row %d is repeated", first)})
+			} else {
+				keys[e.ImportKey] = row.Line
+			}
+		}
+		if err != nil {
+			report.fail(row.Line, err)
+		}
+		parsed[i] = e
+	}
+	if dryRun || report.Failed > 0 {
+		return report, nil
+	}
+	report.Applied = true
+	for i := range parsed {
+		result, err := events.ImportEvent(ctx, &parsed[i])
+		if errors.Is(err, ErrValidation) || errors.Is(err, ErrConflict) {
+			report.fail(rows[i].Line, err)
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+		report.count(result)
+	}
+	return report, nil
+}
+
+// UserRow is a row of a user import, for users who have not logged in yet.
+type UserRow struct {
+	Username string `json:"username" validate:"required,max=64"`
+	UserType string `json:"user_type" validate:"required,oneof=student teacher"`
+	FullName string `json:"full_name" validate:"max=120"`
+	// Roles are registered role names separated by commas.
+	Roles string `json:"roles" validate:"max=500"`
+}
+
+// user builds the user of row. Student usernames are stored the way login
+// stores them, as c followed by the student number.
+func (row UserRow) user(registered map[string]bool) (User, error) {
+	if err := Validate(row); err != nil {
+		return User{}, err
+	}
+	u := User{Username: row.Username, UserType: row.UserType, FullName: row.FullName, Roles: splitList(row.Roles)}
+	if u.UserType == "student" {
+		n, ok := ParseStudentNumber(u.Username)
+		if !ok {
+			return u, Validation("VALIDATION_FAILED", "Request validation failed",
+				FieldError{Field: "username", Code: "student_number", Message: "username must be a student number"})
+		}
+		u.Username = n.Username()
+	}
+	var fields []FieldError
+	for _, role := range u.Roles {
+		if !registered[role] {
+			fields = append(fields, FieldError{Field: "roles", Code: "registered", Message: fmt.Sprintf("role %q is not registered", role)})
+		}
+	}
+	if len(fields) > 0 {
+		return u, Validation("INVALID_ROLES", "Some roles are not registered", fields...)
+	}
+	return u, nil
+}
+
+// ImportUsers creates the users of rows before their first login on behalf
+// of the admin actor. Users who exist keep their data; a full name in the
+// row replaces theirs and the roles of the row are granted through
+// ChangeRoles, so they are logged as granted by actor. No role is ever
+// revoked.
+func ImportUsers(ctx context.Context, users UserRepository, roles RoleRepository, actor string, rows []ImportRow[UserRow], dryRun bool) (ImportReport, error) {
+	report := ImportReport{DryRun: dryRun, Rows: len(rows), Errors: []ImportRowError{}}
+	known, err := roles.GetRoles(ctx)
+	if err != nil {
+		return report, err
+	}
+	registered := map[string]bool{}
+	for _, role := range known {
+		registered[role.Name] = true
+	}
+	parsed := make([]User, len(rows))
+	usernames := map[string]int{}
+	for i, row := range rows {
+		u, err := row.Value.user(registered)
+		if err == nil {
+			if first, ok := usernames[u.Username]; ok {
+				err = Validation("DUPLICATE_ROW", "Duplicate row", FieldError{Field: "username", Code: "unique", Message: fmt.Sprintf("the user of row %d is repeated", first)})
+			} else {
+				usernames[u.Username] = row.Line
+			}
+		}
+		if err != nil {
+			report.fail(row.Line, err)
+		}
+		parsed[i] = u
+	}
+	if dryRun || report.Failed > 0 {
+		return report, nil
+	}
+	report.Applied = true
+	for i := range parsed {
+		grant := parsed[i].Roles
+		parsed[i].Roles = nil
+		result, err := users.ImportUser(ctx, &parsed[i])
+		if err == nil && len(grant) > 0 {
+			held := len(parsed[i].Roles)
+			parsed[i], err = ChangeRoles(ctx, roles, users, actor, parsed[i].Username, RoleUpdate{Grant: grant})
+			if err == nil && result == UpsertUnchanged && len(parsed[i].Roles) != held {
+				result = UpsertUpdated
+			}
+		}
+		if errors.Is(err, ErrValidation) || errors.Is(err, ErrConflict) {
+			report.fail(rows[i].Line, err)
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+		report.count(result)
+	}
+	return report, nil
+}
@@ -0,0 +1,306 @@
+package library
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Limits on user-written Markdown besides the length its request allows:
+// deeply nested or heavily formatted text is slow to render and unreadable.
+const (
+	maxMarkdownNodes = 2000
+	maxMarkdownDepth = 16
+	maxMentions      = 20
+	maxTagLength     = 32
+	maxMentionLength = 64
+)
+
+// Markdown is text written by a user: its source, the sanitized HTML it
+// renders to, the users it @mentions and the #tags it uses. Mentions link to
+// the user, tags to the approved suggestions with the tag.
+type Markdown struct {
+	Source string
+	HTML   string
+	// Mentions are the usernames of the mentioned users who exist.
+	Mentions []string
+	// Tags are lower case, in the order they first appear.
+	Tags []string
+}
+
+// ParseMarkdown checks the complexity of the Markdown source of field and
+// renders it. Mentions are looked up in users; with no users none are linked.
+func ParseMarkdown(ctx context.Context, users UserRepository, field, source string) (Markdown, error) {
+	m := Markdown{Source: source, Tags: []string{}}
+	src := []byte(source)
+	doc := markdown.Parser().Parse(text.NewReader(src))
+	if nodes, depth := measure(doc, 0); nodes > maxMarkdownNodes || depth > maxMarkdownDepth {
+		return m, Validation("CONTENT_TOO_COMPLEX", "The text has too much formatting",
+			FieldError{Field: field, Code: "complexity", Message: field + " has too much formatting or nesting"})
+	}
+
+	var refs []*reference
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if ref, ok := n.(*reference); ok && entering {
+			refs = append(refs, ref)
+		}
+		return ast.WalkContinue, nil
+	})
+	mentioned := map[string]bool{}
+	for _, ref := range refs {
+		if insideLink(ref) {
+			continue
+		}
+		if ref.mark == '#' {
+			if tag := strings.ToLower(ref.name); !slices.Contains(m.Tags, tag) {
+				m.Tags = append(m.Tags, tag)
+			}
+			ref.linked = true
+			continue
+		}
+		known, seen := mentioned[ref.name]
+		if !seen {
+			if len(mentioned) == maxMentions {
+				return m, Validation("TOO_MANY_MENTIONS", "The text mentions too many users",
+					FieldError{Field: field, Code: "mentions", Message: fmt.Sprintf("%s may mention at most %d users", field, maxMentions)})
+			}
+			var err error
+			if known, err = exists(ctx, users, ref.name); err != nil {
+				return m, err
+			}
+			mentioned[ref.name] = known
+			if known {
+				m.Mentions = append(m.Mentions, ref.name)
+			}
+		}
+		ref.linked = known
+	}
+
+	var err error
+	m.HTML, err = render(src, doc)
+	return m, err
+}
+
+// RenderMarkdown renders text stored before it was parsed as Markdown. Tags
+// are linked but mentions are not, since nobody has checked them.
+func RenderMarkdown(source string) string {
+	src := []byte(source)
+	doc := markdown.Parser().Parse(text.NewReader(src))
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if ref, ok := n.(*reference); ok && entering {
+			ref.linked = ref.mark == '#' && !insideLink(ref)
+		}
+		return ast.WalkContinue, nil
+	})
+	html, _ := render(src, doc)
+	return html
+}
+
+func render(src []byte, doc ast.Node) (string, error) {
+	var out bytes.Buffer
+	if err := markdown.Renderer().Render(&out, src, doc); err != nil {
+		return "", err
+	}
+	return sanitizer.Sanitize(out.String()), nil
+}
+
+func exists(ctx context.Context, users UserRepository, username string) (bool, error) {
+	if users == nil {
+		return false, nil
+	}
+	_, err := users.GetUser(ctx, username)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// measure counts the nodes under n and how deep they nest.
+func measure(n ast.Node, depth int) (nodes, maxDepth int) {
+	nodes, maxDepth = 1, depth
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		count, d := measure(c, depth+1)
+		nodes += count
+		maxDepth = max(maxDepth, d)
+	}
+	return nodes, maxDepth
+}
+
+// insideLink reports whether n is part of the text of a link. Links cannot
+// nest, so mentions and tags there are plain text.
+func insideLink(n ast.Node) bool {
+	for p := n.Parent(); p != nil; p = p.Parent() {
+		if p.Kind() == ast.KindLink || p.Kind() == ast.KindAutoLink {
+			return true
+		}
+	}
+	return false
+}
+
+// markdown renders GitHub flavoured Markdown, leaving raw HTML and unsafe
+// links out, with single line breaks kept as they were typed.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.Table, extension.Strikethrough, extension.Linkify),
+	goldmark.WithParserOptions(parser.WithInlineParsers(util.Prioritized(referenceParser{}, 500))),
+	goldmark.WithRendererOptions(
+		html.WithHardWraps(),
+		renderer.WithNodeRenderers(util.Prioritized(referenceRenderer{}, 500)),
+	),
+)
+
+// sanitizer is the last line of defence should the renderer ever let markup
+// through: it keeps the formatting Markdown produces and nothing that runs.
+var sanitizer = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^(mention|tag)$`)).OnElements("a")
+	return p
+}()
+
+var kindReference = ast.NewNodeKind("Reference")
+
+// reference is an @mention or a #tag.
+type reference struct {
+	ast.BaseInline
+	mark   byte
+	name   string
+	linked bool
+}
+
+func (n *reference) Kind() ast.NodeKind {
+	return kindReference
+}
+
+func (n *reference) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Mark": string(n.mark), "Name": n.name}, nil)
+}
+
+// referenceParser reads @username and #tag where a word starts, so e-mail
+// addresses and URL fragments are left alone. Tags start with a letter, so
+// "#1" is not one.
+type referenceParser struct{}
+
+func (referenceParser) Trigger() []byte {
+	return []byte{'@', '#'}
+}
+
+func (referenceParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	if prev := block.PrecendingCharacter(); isNameRune(prev) || prev == '&' {
+		return nil
+	}
+	line, _ := block.PeekLine()
+	mark, rest := line[0], line[1:]
+	var name string
+	if mark == '@' {
+		name = mentionName(rest)
+	} else {
+		name = tagName(rest)
+	}
+	if name == "" {
+		return nil
+	}
+	block.Advance(1 + len(name))
+	return &reference{mark: mark, name: name}
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// mentionName is the username at the start of b: letters, digits, dots,
+// dashes and underscores, without the punctuation that may end a sentence.
+func mentionName(b []byte) string {
+	end := 0
+	for end < len(b) && b[end] < utf8.RuneSelf && (isNameRune(rune(b[end])) || b[end] == '.' || b[end] == '-') {
+		end++
+	}
+	name := strings.TrimRight(string(b[:end]), ".-")
+	if len(name) > maxMentionLength {
+		return ""
+	}
+	return name
+}
+
+// tagName is the tag at the start of b, or "" if it is too long to be one.
+func tagName(b []byte) string {
+	end, runes := 0, 0
+	for end < len(b) {
+		r, size := utf8.DecodeRune(b[end:])
+		if !(isNameRune(r) || r == '-') || (runes == 0 && !unicode.IsLetter(r)) {
+			break
+		}
+		end += size
+		runes++
+	}
+	name := strings.TrimRight(string(b[:end]), "-")
+	if utf8.RuneCountInString(name) > maxTagLength {
+		return ""
+	}
+	return name
+}
+
+type referenceRenderer struct{}
+
+func (referenceRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindReference, renderReference)
+}
+
+func renderReference(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*reference)
+	label := util.EscapeHTML([]byte(string(n.mark) + n.name))
+	if !n.linked {
+		_, err := w.Write(label)
+		return ast.WalkContinue, err
+	}
+	href, class := "/users/"+url.PathEscape(n.name), "mention"
+	if n.mark == '#' {
+		href, class = "/suggestions?tag="+url.QueryEscape(strings.ToLower(n.name)), "tag"
+	}
+	_, err := fmt.Fprintf(w, `<a href="%s" class="%s">%s</a>`, util.EscapeHTML([]byte(href)), class, label)
+	return ast.WalkContinue, err
+}
+
+// renderStored fills in field_html of the documents in c stored with field
+// but without its HTML, as RenderMarkdown renders it.
+func renderStored(ctx context.Context, c *mongo.Collection, field string) error {
+	html := field + "_html"
+	missing := bson.M{"$in": bson.A{"", nil}}
+	cursor, err := c.Find(ctx, bson.M{field: bson.M{"$nin": bson.A{"", nil}}, html: missing}, options.Find().SetProjection(bson.M{field: 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		source, _ := doc[field].(string)
+		if _, err := c.UpdateOne(ctx, bson.M{"_id": doc["_id"], html: missing}, bson.M{"$set": bson.M{html: RenderMarkdown(source)}}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
@@ -1,29 +1,25 @@
 package library
 
 import (
-	"272-backend/pkg"
 	"context"
-	"errors"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var Projects *mongo.Collection
-
-func init() {
-	Projects = pkg.Mongo.Collection("projects")
-}
-
 type Project struct {
-	ID       primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	Title    string             `json:"title" bson:"title"`
-	Content  string             `json:"content" bson:"content"`
-	AuthorID string             `json:"author" bson:"author"`
-	Date     string             `json:"date" bson:"date"`
-	Team     []struct {
+	ID      primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Title   string             `json:"title" bson:"title"`
+	Content string             `json:"content" bson:"content"`
+	// ContentHTML and Mentions are kept from the suggestion, see Markdown.
+	ContentHTML string   `json:"content_html" bson:"content_html"`
+	Mentions    []string `json:"mentions,omitempty" bson:"mentions"`
+	AuthorID    string   `json:"author" bson:"author"`
+	Date        string   `json:"date" bson:"date"`
+	Team        []struct {
 		UserID   string `json:"userID" bson:"userID"`
 		Role     string `json:"role" bson:"role"`
 		JoinedAt string `json:"joinedAt" bson:"joinedAt"`
@@ -34,20 +30,39 @@ type Project struct {
 		Star   float64 `json:"star" bson:"star"`
 		Date   string  `json:"date" bson:"date"`
 	} `json:"stars" bson:"stars"`
-	Tags    []string `json:"tags" bson:"tags"`
-	Upvotes []string `json:"upvotes" bson:"upvotes"`
+	Tags  []string `json:"tags" bson:"tags"`
+	Votes `bson:",inline"`
+	// Attachments are the files uploaded to the project.
+	Attachments []AttachmentRef `json:"attachments,omitempty" bson:"attachments,omitempty"`
+}
+
+// mongoProjectRepository keeps projects in the "projects" collection.
+type mongoProjectRepository struct {
+	projects *mongo.Collection
 }
 
-func (p *Project) CreateFrom(s Suggestion) error {
+func NewMongoProjectRepository(db *mongo.Database) ProjectRepository {
+	return &mongoProjectRepository{projects: db.Collection("projects")}
+}
+
+// fromSuggestion fills p from an approved suggestion, keeping its ID and
+// rendering the content of suggestions stored before it was Markdown. The
+// author of an anonymous suggestion stays hidden: its project starts without
+// an author and a team.
+func (p *Project) fromSuggestion(s Suggestion) error {
 	if s.Status != "approved" {
-		return errors.New("SUGGESTION_NOT_APPROVED")
+		return Conflict("SUGGESTION_NOT_APPROVED", "Only approved suggestions can become projects")
 	}
 	if p.AdvisorID == "" {
-		return errors.New("ADVISOR_NOT_ASSIGNED")
+		return Validation("ADVISOR_NOT_ASSIGNED", "A project needs an advisor", FieldError{Field: "advisor", Code: "required", Message: "advisor is required"})
 	}
 	p.ID = s.ID
 	p.Title = s.Title
 	p.Content = s.Content
+	if p.ContentHTML = s.ContentHTML; p.ContentHTML == "" {
+		p.ContentHTML = RenderMarkdown(s.Content)
+	}
+	p.Mentions = s.Mentions
 	p.AuthorID = s.AuthorID
 	p.Date = time.Now().UTC().Format(time.RFC3339)
 	p.Team = []struct {
@@ -61,50 +76,62 @@ func (p *Project) CreateFrom(s Suggestion) error {
 			JoinedAt: p.Date,
 		},
 	}
+	if s.Anonymity != AnonymityNone {
+		p.AuthorID = ""
+		p.Team = p.Team[:0]
+	}
 	p.Stars = s.Stars
 	p.Tags = s.Tags
-	p.Upvotes = []string{}
-	if err := p.insertToDB(); err != nil {
-		return err
-	}
+	p.Votes.reset()
 	return nil
 }
 
-func (p *Project) insertToDB() error {
-	res, err := Projects.InsertOne(context.TODO(), p)
-	if err != nil {
+func (r *mongoProjectRepository) RenderMarkdown(ctx context.Context) error {
+	return renderStored(ctx, r.projects, "content")
+}
+
+func (r *mongoProjectRepository) CreateFrom(ctx context.Context, p *Project, s Suggestion) error {
+	if err := p.fromSuggestion(s); err != nil {
 		return err
 	}
-	if err := Projects.FindOne(context.TODO(), bson.M{"_id": res.InsertedID}).Decode(&p); err != nil {
+	if err := r.insertToDB(ctx, p); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (p *Project) GiveUpvote(userID string) error {
-	for _, upvote := range p.Upvotes {
-		if upvote == userID {
-			return nil
-		}
-	}
-	update := bson.M{
-		"$addToSet": bson.M{
-			"upvotes": userID,
-		},
-	}
-	query := bson.M{
-		"_id": p.ID,
+func (r *mongoProjectRepository) insertToDB(ctx context.Context, p *Project) error {
+	res, err := r.projects.InsertOne(ctx, p)
+	if err != nil {
+		return conflict(err, errProjectExists)
 	}
-	if _, err := Projects.UpdateOne(context.TODO(), query, update); err != nil {
-		return err
+	if err := r.projects.FindOne(ctx, bson.M{"_id": res.InsertedID}).Decode(&p); err != nil {
+		return notFound(err, errProjectNotFound)
 	}
-	if err := Projects.FindOne(context.TODO(), bson.M{"_id": p.ID}).Decode(&p); err != nil {
-		return err
+	return nil
+}
+
+func (r *mongoProjectRepository) Vote(ctx context.Context, p *Project, userID string, kind VoteKind) error {
+	return r.vote(ctx, p, voteUpdate(userID, kind, false))
+}
+
+func (r *mongoProjectRepository) Unvote(ctx context.Context, p *Project, userID string, kind VoteKind) error {
+	return r.vote(ctx, p, voteUpdate(userID, kind, true))
+}
+
+func (r *mongoProjectRepository) vote(ctx context.Context, p *Project, update mongo.Pipeline) error {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := r.projects.FindOneAndUpdate(ctx, bson.M{"_id": p.ID}, update, opts).Decode(p); err != nil {
+		return notFound(err, errProjectNotFound)
 	}
 	return nil
 }
 
-func (p *Project) AddStar(userID string, star float64) error {
+func (r *mongoProjectRepository) CountVotes(ctx context.Context) error {
+	return countVotes(ctx, r.projects)
+}
+
+func (r *mongoProjectRepository) AddStar(ctx context.Context, p *Project, userID string, star float64) error {
 	starObj := struct {
 		UserID string  `json:"userID" bson:"userID"`
 		Star   float64 `json:"star" bson:"star"`
@@ -122,32 +149,32 @@ func (p *Project) AddStar(userID string, star float64) error {
 	query := bson.M{
 		"_id": p.ID,
 	}
-	if _, err := Projects.UpdateOne(context.TODO(), query, update); err != nil {
+	if _, err := r.projects.UpdateOne(ctx, query, update); err != nil {
 		return err
 	}
-	if err := Projects.FindOne(context.TODO(), bson.M{"_id": p.ID}).Decode(&p); err != nil {
-		return err
+	if err := r.projects.FindOne(ctx, bson.M{"_id": p.ID}).Decode(&p); err != nil {
+		return notFound(err, errProjectNotFound)
 	}
 	return nil
 }
 
-func (p *Project) GetProject() error {
+func (r *mongoProjectRepository) GetProject(ctx context.Context, p *Project) error {
 	query := bson.M{
 		"_id": p.ID,
 	}
-	if err := Projects.FindOne(context.TODO(), query).Decode(&p); err != nil {
-		return err
+	if err := r.projects.FindOne(ctx, query).Decode(&p); err != nil {
+		return notFound(err, errProjectNotFound)
 	}
 	return nil
 }
 
-func GetAllProjects() ([]Project, error) {
+func (r *mongoProjectRepository) GetAllProjects(ctx context.Context) ([]Project, error) {
 	projects := []Project{}
-	cursor, err := Projects.Find(context.TODO(), bson.M{})
+	cursor, err := r.projects.Find(ctx, bson.M{})
 	if err != nil {
 		return projects, err
 	}
-	if err := cursor.All(context.TODO(), &projects); err != nil {
+	if err := cursor.All(ctx, &projects); err != nil {
 		return projects, err
 	}
 	return projects, nil
@@ -0,0 +1,197 @@
+package library
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Orders of the suggestion listing.
+const (
+	// SortHot ranks by Suggestion.Hot, votes and stars decayed by age.
+	SortHot = "hot"
+	// SortTop ranks by net score.
+	SortTop = "top"
+	// SortNew lists the newest first.
+	SortNew = "new"
+)
+
+// Windows of the suggestion listing, by when a suggestion was made.
+const (
+	WindowAll      = "all"
+	WindowWeek     = "week"
+	WindowMonth    = "month"
+	WindowSemester = "semester"
+)
+
+const (
+	// hotGravity is how fast the hot rank of a suggestion decays with age;
+	// Hacker News uses 1.8, a campus moves slower.
+	hotGravity = 1.5
+	// hotOffset hours keep brand new suggestions from dividing by zero and
+	// towering over everything for their first minutes.
+	hotOffset = 2.0
+)
+
+// RankingQuery selects and orders the approved suggestions.
+type RankingQuery struct {
+	// Sort is hot by default.
+	Sort string `json:"sort" query:"sort" validate:"omitempty,oneof=hot top new"`
+	// Window keeps suggestions made this week, month or semester; all by
+	// default.
+	Window string `json:"window" query:"window" validate:"omitempty,oneof=all week month semester"`
+	// Tag keeps the suggestions with the tag, as #tags in content link to.
+	Tag string `json:"tag" query:"tag" validate:"max=32"`
+}
+
+// Since is when the window of q starts, zero for all time.
+func (q RankingQuery) Since(now time.Time) time.Time {
+	now = now.UTC()
+	switch q.Window {
+	case WindowWeek:
+		return now.AddDate(0, 0, -7)
+	case WindowMonth:
+		return now.AddDate(0, -1, 0)
+	case WindowSemester:
+		return semesterStart(now)
+	}
+	return time.Time{}
+}
+
+// semesterStart is the first day of the semester now falls in: the fall
+// semester runs from September through January, the spring semester and the
+// summer school after it from February through August.
+func semesterStart(now time.Time) time.Time {
+	year, month := now.Year(), now.Month()
+	switch {
+	case month >= time.September:
+		return time.Date(year, time.September, 1, 0, 0, 0, 0, time.UTC)
+	case month >= time.February:
+		return time.Date(year, time.February, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(year-1, time.September, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// starPoints weighs a star rating from -1 for one star to +1 for five; a
+// vote counts one either way.
+func starPoints(star float64) float64 {
+	return (star - 3) / 2
+}
+
+// hot is the rank of points earned age ago, decaying the older they get.
+func hot(points float64, age time.Duration) float64 {
+	hours := math.Max(age.Hours(), 0)
+	return points / math.Pow(hours+hotOffset, hotGravity)
+}
+
+// rank recomputes Hot as of now. Each star decays from when it was given;
+// votes are kept as bare voter sets, so the score decays from when the
+// suggestion was made, as do stars without a date. It is what hotRank does
+// in Mongo.
+func (s *Suggestion) rank(now time.Time) {
+	made, err := time.Parse(time.RFC3339, s.Date)
+	if err != nil {
+		made = now
+	}
+	s.Hot = hot(float64(s.Score), now.Sub(made))
+	for _, star := range s.Stars {
+		given, err := time.Parse(time.RFC3339, star.Date)
+		if err != nil {
+			given = made
+		}
+		s.Hot += hot(starPoints(star.Star), now.Sub(given))
+	}
+}
+
+// hotDecay is the Mongo expression of the divisor hot applies to points
+// earned at date, falling back to made when date is missing or malformed.
+func hotDecay(date, made interface{}) bson.M {
+	hours := bson.M{"$max": bson.A{0, bson.M{"$divide": bson.A{
+		bson.M{"$subtract": bson.A{"$$NOW", bson.M{"$dateFromString": bson.M{
+			"dateString": date,
+			"onError":    made,
+			"onNull":     made,
+		}}}},
+		float64(time.Hour / time.Millisecond),
+	}}}}
+	return bson.M{"$pow": bson.A{bson.M{"$add": bson.A{hours, hotOffset}}, hotGravity}}
+}
+
+// hotRank recomputes the hot field of suggestions as of $$NOW, so that a
+// vote or star and the rank it earns are written together.
+var hotRank = bson.D{{Key: "$set", Value: bson.M{
+	"hot": bson.M{"$let": bson.M{
+		"vars": bson.M{"made": bson.M{"$dateFromString": bson.M{
+			"dateString": "$date",
+			"onError":    "$$NOW",
+			"onNull":     "$$NOW",
+		}}},
+		"in": bson.M{"$add": bson.A{
+			bson.M{"$divide": bson.A{bson.M{"$ifNull": bson.A{"$score", 0}}, hotDecay("$date", "$$made")}},
+			bson.M{"$sum": bson.M{"$map": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$stars", bson.A{}}},
+				"in": bson.M{"$divide": bson.A{
+					bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{"$$this.star", 3}}, 2}},
+					hotDecay("$$this.date", "$$made"),
+				}},
+			}}},
+		}},
+	}},
+}}}
+
+// ranked appends the hot rank to a suggestion update pipeline.
+func ranked(update mongo.Pipeline) mongo.Pipeline {
+	return append(update, hotRank)
+}
+
+// rankingFilter and rankingSort select and order approved suggestions in Mongo
+// the way sortRanked does in memory.
+func rankingFilter(q RankingQuery, now time.Time) bson.M {
+	filter := bson.M{"status": "approved"}
+	if since := q.Since(now); !since.IsZero() {
+		filter["date"] = bson.M{"$gte": since.Format(time.RFC3339)}
+	}
+	if q.Tag != "" {
+		filter["tags"] = strings.ToLower(q.Tag)
+	}
+	return filter
+}
+
+func rankingSort(q RankingQuery) bson.D {
+	switch q.Sort {
+	case SortTop:
+		return bson.D{{Key: "score", Value: -1}, {Key: "date", Value: -1}, {Key: "_id", Value: -1}}
+	case SortNew:
+		return bson.D{{Key: "date", Value: -1}, {Key: "_id", Value: -1}}
+	}
+	return bson.D{{Key: "hot", Value: -1}, {Key: "date", Value: -1}, {Key: "_id", Value: -1}}
+}
+
+// sortRanked orders suggestions, all in the window of q, as q asks.
+func sortRanked(suggestions []Suggestion, q RankingQuery) {
+	newer := func(a, b *Suggestion) bool {
+		if a.Date != b.Date {
+			return a.Date > b.Date
+		}
+		return a.ID.Hex() > b.ID.Hex()
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		a, b := &suggestions[i], &suggestions[j]
+		switch q.Sort {
+		case SortTop:
+			if a.Score != b.Score {
+				return a.Score > b.Score
+			}
+		case SortNew:
+		default:
+			if a.Hot != b.Hot {
+				return a.Hot > b.Hot
+			}
+		}
+		return newer(a, b)
+	})
+}
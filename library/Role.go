@@ -0,0 +1,265 @@
+package library
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Roles the API checks for. Every user also holds their user type, student
+// or teacher, as a role; those follow from the account and are never granted
+// or revoked.
+const (
+	RoleAdmin       = "admin"
+	RoleHaysevAdmin = "haysev_admin"
+)
+
+// Role is a role admins may grant. Only registered roles can be granted, so
+// a typo cannot hand out a role nothing checks for.
+type Role struct {
+	Name        string `json:"name" bson:"_id"`
+	Description string `json:"description" bson:"description" validate:"max=500"`
+}
+
+// DefaultRoles are registered at startup when missing.
+func DefaultRoles() []Role {
+	return []Role{
+		{Name: RoleAdmin, Description: "Moderates suggestions and manages departments and roles"},
+		{Name: RoleHaysevAdmin, Description: "Approves and removes calendar events"},
+	}
+}
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,63}$`)
+
+// validate checks the name of a role before it is registered.
+func (r *Role) validate() error {
+	if !roleNamePattern.MatchString(r.Name) {
+		return Validation("INVALID_ROLE_NAME", "Invalid role name",
+			FieldError{Field: "name", Code: "pattern", Message: "name must be 2 to 64 lower case letters, digits or underscores"})
+	}
+	if r.Name == "student" || r.Name == "teacher" {
+		return errRoleReserved
+	}
+	return nil
+}
+
+// RoleChange is an entry of the audit log of role changes. Granted and
+// Revoked hold only what actually changed; Roles is what Target held after.
+type RoleChange struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Actor   string             `json:"actor" bson:"actor"`
+	Target  string             `json:"target" bson:"target"`
+	Granted []string           `json:"granted" bson:"granted"`
+	Revoked []string           `json:"revoked" bson:"revoked"`
+	Roles   []string           `json:"roles" bson:"roles"`
+	At      primitive.DateTime `json:"at" bson:"at"`
+}
+
+// RoleChangeQuery selects a page of the audit log.
+type RoleChangeQuery struct {
+	PageQuery
+	Target string `json:"target" query:"target" validate:"max=254"`
+	Actor  string `json:"actor" query:"actor" validate:"max=254"`
+}
+
+func (q RoleChangeQuery) matches(c RoleChange) bool {
+	return (q.Target == "" || c.Target == q.Target) && (q.Actor == "" || c.Actor == q.Actor)
+}
+
+func (q RoleChangeQuery) mongoFilter() bson.M {
+	filter := bson.M{}
+	if q.Target != "" {
+		filter["target"] = q.Target
+	}
+	if q.Actor != "" {
+		filter["actor"] = q.Actor
+	}
+	return filter
+}
+
+// RoleUpdate grants and revokes roles in one go. Granting a role the user
+// holds or revoking one they do not is not an error.
+type RoleUpdate struct {
+	Grant  []string `json:"grant" validate:"max=20,dive,required"`
+	Revoke []string `json:"revoke" validate:"max=20,dive,required"`
+}
+
+// check makes sure every role in u is registered and none is both granted
+// and revoked.
+func (u RoleUpdate) check(ctx context.Context, roles RoleRepository) error {
+	var fields []FieldError
+	for _, list := range []struct {
+		field string
+		names []string
+	}{{"grant", u.Grant}, {"revoke", u.Revoke}} {
+		for _, name := range list.names {
+			if _, err := roles.GetRole(ctx, name); err != nil {
+				if ErrorCode(err) != errRoleNotFound.Code {
+					return err
+				}
+				fields = append(fields, FieldError{Field: list.field, Code: "unknown_role", Message: name + " is not a registered role"})
+			}
+		}
+	}
+	for _, name := range u.Grant {
+		if hasRole(u.Revoke, name) {
+			fields = append(fields, FieldError{Field: "revoke", Code: "excluded_with", Message: name + " is both granted and revoked"})
+		}
+	}
+	if len(fields) > 0 {
+		return Validation("INVALID_ROLES", "Invalid role change", fields...)
+	}
+	return nil
+}
+
+// ChangeRoles applies update to the user target on behalf of actor and logs
+// what changed. Admins cannot revoke their own admin role, so the last admin
+// cannot lock everyone out by accident.
+func ChangeRoles(ctx context.Context, roles RoleRepository, users UserRepository, actor, target string, update RoleUpdate) (User, error) {
+	if err := update.check(ctx, roles); err != nil {
+		return User{}, err
+	}
+	if actor == target && hasRole(update.Revoke, RoleAdmin) {
+		return User{}, errSelfRevoke
+	}
+	u, err := users.GetUser(ctx, target)
+	if err != nil {
+		return u, err
+	}
+	before := append([]string(nil), u.Roles...)
+	if len(update.Grant) > 0 {
+		if err := users.GrantRoles(ctx, &u, update.Grant); err != nil {
+			return u, err
+		}
+	}
+	if len(update.Revoke) > 0 {
+		if err := users.RevokeRoles(ctx, &u, update.Revoke); err != nil {
+			return u, err
+		}
+	}
+	change := RoleChange{
+		Actor:   actor,
+		Target:  target,
+		Granted: removeRoles(u.Roles, before...),
+		Revoked: removeRoles(before, u.Roles...),
+		Roles:   u.Roles,
+	}
+	if len(change.Granted) == 0 && len(change.Revoked) == 0 {
+		return u, nil
+	}
+	return u, roles.LogChange(ctx, &change)
+}
+
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// addRoles appends the roles have is missing, keeping its order.
+func addRoles(have []string, roles ...string) []string {
+	for _, r := range roles {
+		if !hasRole(have, r) {
+			have = append(have, r)
+		}
+	}
+	return have
+}
+
+// removeRoles returns have without roles, as a new slice.
+func removeRoles(have []string, roles ...string) []string {
+	kept := []string{}
+	for _, r := range have {
+		if !hasRole(roles, r) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// mongoRoleRepository keeps roles in "roles" and the audit log in
+// "role_changes".
+type mongoRoleRepository struct {
+	roles   *mongo.Collection
+	changes *mongo.Collection
+}
+
+func NewMongoRoleRepository(db *mongo.Database) RoleRepository {
+	return &mongoRoleRepository{
+		roles:   db.Collection("roles"),
+		changes: db.Collection("role_changes"),
+	}
+}
+
+func (r *mongoRoleRepository) PutRole(ctx context.Context, role *Role) error {
+	if err := role.validate(); err != nil {
+		return err
+	}
+	_, err := r.roles.ReplaceOne(ctx, bson.M{"_id": role.Name}, role, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *mongoRoleRepository) GetRole(ctx context.Context, name string) (Role, error) {
+	var role Role
+	err := r.roles.FindOne(ctx, bson.M{"_id": name}).Decode(&role)
+	return role, notFound(err, errRoleNotFound)
+}
+
+func (r *mongoRoleRepository) GetRoles(ctx context.Context) ([]Role, error) {
+	cursor, err := r.roles.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	roles := []Role{}
+	err = cursor.All(ctx, &roles)
+	return roles, err
+}
+
+func (r *mongoRoleRepository) EnsureRoles(ctx context.Context, roles []Role) error {
+	for _, role := range roles {
+		if err := role.validate(); err != nil {
+			return err
+		}
+		if _, err := r.roles.UpdateOne(ctx, bson.M{"_id": role.Name},
+			bson.M{"$setOnInsert": bson.M{"description": role.Description}},
+			options.Update().SetUpsert(true)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *mongoRoleRepository) LogChange(ctx context.Context, c *RoleChange) error {
+	c.ID = primitive.NewObjectID()
+	c.At = primitive.NewDateTimeFromTime(time.Now())
+	_, err := r.changes.InsertOne(ctx, c)
+	return err
+}
+
+func (r *mongoRoleRepository) GetChanges(ctx context.Context, q RoleChangeQuery) (Page[RoleChange], error) {
+	q.normalize()
+	page := Page[RoleChange]{Items: []RoleChange{}, Page: q.Page, PerPage: q.PerPage}
+	filter := q.mongoFilter()
+	total, err := r.changes.CountDocuments(ctx, filter)
+	if err != nil {
+		return page, err
+	}
+	page.Total = total
+	cursor, err := r.changes.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetSkip(int64(q.skip())).
+		SetLimit(int64(q.PerPage)))
+	if err != nil {
+		return page, err
+	}
+	err = cursor.All(ctx, &page.Items)
+	return page, err
+}
@@ -0,0 +1,458 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Periods a timeline can be bucketed by.
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+const (
+	defaultStatsDays  = 30
+	defaultStatsLimit = 10
+	maxTimelinePoints = 400
+)
+
+// StatsQuery selects the window statistics are computed over. From and To
+// are inclusive dates; the window is the last 30 days up to today when they
+// are left out. Suggestions fall in the window by their Date, events by
+// their CreatedAt.
+type StatsQuery struct {
+	From     string `json:"from" query:"from" validate:"omitempty,datetime=2006-01-02"`
+	To       string `json:"to" query:"to" validate:"omitempty,datetime=2006-01-02"`
+	Interval string `json:"interval" query:"interval" validate:"omitempty,oneof=day week month"`
+	// By orders TopSuggestions, upvotes when empty.
+	By    string `json:"by" query:"by" validate:"omitempty,oneof=upvotes stars"`
+	Limit int    `json:"limit" query:"limit" validate:"min=0,max=100"`
+}
+
+// statsWindow is a resolved StatsQuery: from inclusive, to exclusive, UTC.
+type statsWindow struct {
+	from, to time.Time
+	interval string
+	by       string
+	limit    int
+}
+
+var errInvalidWindow = Validation("INVALID_WINDOW", "The window is invalid",
+	FieldError{Field: "from", Code: "ltefield", Message: "from must not be after to"})
+
+func (q StatsQuery) window(now time.Time) (statsWindow, error) {
+	w := statsWindow{interval: q.Interval, by: q.By, limit: q.Limit}
+	today := now.UTC().Truncate(24 * time.Hour)
+	w.to = today.AddDate(0, 0, 1)
+	if q.To != "" {
+		to, err := time.Parse(time.DateOnly, q.To)
+		if err != nil {
+			return w, errInvalidWindow.Wrap(err)
+		}
+		w.to = to.AddDate(0, 0, 1)
+	}
+	w.from = w.to.AddDate(0, 0, -defaultStatsDays)
+	if q.From != "" {
+		from, err := time.Parse(time.DateOnly, q.From)
+		if err != nil {
+			return w, errInvalidWindow.Wrap(err)
+		}
+		w.from = from
+	}
+	if !w.from.Before(w.to) {
+		return w, errInvalidWindow
+	}
+	if w.interval == "" {
+		w.interval = IntervalDay
+	}
+	if w.by == "" {
+		w.by = "upvotes"
+	}
+	if w.limit < 1 {
+		w.limit = defaultStatsLimit
+	}
+	return w, nil
+}
+
+// dates returns the bounds of w in the format suggestions store dates in,
+// which compares like the times it stands for.
+func (w statsWindow) dates() (string, string) {
+	return w.from.Format(time.RFC3339), w.to.Format(time.RFC3339)
+}
+
+func (w statsWindow) contains(date string) bool {
+	from, to := w.dates()
+	return date >= from && date < to
+}
+
+// period returns the name of the timeline bucket t falls in.
+func (w statsWindow) period(t time.Time) string {
+	switch w.interval {
+	case IntervalMonth:
+		return t.Format("2006-01")
+	case IntervalWeek:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	}
+	return t.Format(time.DateOnly)
+}
+
+// periods lists every bucket of w in order, so a timeline has no gaps.
+func (w statsWindow) periods() ([]string, error) {
+	var periods []string
+	for t := w.from; t.Before(w.to); t = t.AddDate(0, 0, 1) {
+		if p := w.period(t); len(periods) == 0 || periods[len(periods)-1] != p {
+			periods = append(periods, p)
+		}
+		if len(periods) > maxTimelinePoints {
+			return nil, Validation("WINDOW_TOO_LARGE", "The window has too many periods for the interval",
+				FieldError{Field: "interval", Code: "max", Message: fmt.Sprintf("a timeline has at most %d points", maxTimelinePoints)})
+		}
+	}
+	return periods, nil
+}
+
+// TimelinePoint counts the suggestions made in a period by their current
+// status.
+type TimelinePoint struct {
+	Period string         `json:"period"`
+	Total  int            `json:"total"`
+	Counts map[string]int `json:"counts"`
+}
+
+// buildTimeline lays counts out over every period of w.
+func buildTimeline(w statsWindow, counts map[string]map[string]int) ([]TimelinePoint, error) {
+	periods, err := w.periods()
+	if err != nil {
+		return nil, err
+	}
+	timeline := make([]TimelinePoint, len(periods))
+	for i, p := range periods {
+		timeline[i] = TimelinePoint{Period: p, Counts: map[string]int{}}
+		for status, n := range counts[p] {
+			timeline[i].Counts[status] = n
+			timeline[i].Total += n
+		}
+	}
+	return timeline, nil
+}
+
+// DecisionTime summarizes how long suggestions waited for one kind of
+// decision.
+type DecisionTime struct {
+	Decisions   int     `json:"decisions"`
+	MedianHours float64 `json:"median_hours"`
+}
+
+// DecisionStats covers the suggestions made in the window.
+type DecisionStats struct {
+	Approved DecisionTime `json:"approved"`
+	Rejected DecisionTime `json:"rejected"`
+	Pending  int          `json:"pending"`
+}
+
+// newDecisionTime takes the waits in hours, sorted.
+func newDecisionTime(hours []float64) DecisionTime {
+	d := DecisionTime{Decisions: len(hours)}
+	if n := len(hours); n > 0 {
+		d.MedianHours = hours[n/2]
+		if n%2 == 0 {
+			d.MedianHours = (hours[n/2-1] + hours[n/2]) / 2
+		}
+	}
+	return d
+}
+
+// DepartmentCount counts the suggestions of a department.
+type DepartmentCount struct {
+	Department int `json:"department" bson:"_id"`
+	Count      int `json:"count" bson:"count"`
+	Approved   int `json:"approved" bson:"approved"`
+}
+
+// AuthorCount counts the suggestions of an author.
+type AuthorCount struct {
+	Author   string `json:"author" bson:"_id"`
+	Count    int    `json:"count" bson:"count"`
+	Approved int    `json:"approved" bson:"approved"`
+}
+
+// TopSuggestion is a suggestion with its scores.
+type TopSuggestion struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id"`
+	Title   string             `json:"title" bson:"title"`
+	Author  string             `json:"author" bson:"author"`
+	Date    string             `json:"date" bson:"date"`
+	Status  string             `json:"status" bson:"status"`
+	Upvotes int                `json:"upvotes" bson:"upvote_count"`
+	Stars   float64            `json:"stars" bson:"star_average"`
+	Ratings int                `json:"ratings" bson:"star_count"`
+}
+
+// KeyCount counts the documents sharing a key.
+type KeyCount struct {
+	Key   string `json:"key" bson:"_id"`
+	Count int    `json:"count" bson:"count"`
+}
+
+// EventStats covers the events created in the window.
+type EventStats struct {
+	Total       int        `json:"total"`
+	ByType      []KeyCount `json:"by_type"`
+	ByOrganizer []KeyCount `json:"by_organizer"`
+}
+
+// sortCounts orders counts by count, then key, and keeps the first limit.
+func sortCounts(counts map[string]int, limit int) []KeyCount {
+	out := make([]KeyCount, 0, len(counts))
+	for k, n := range counts {
+		out = append(out, KeyCount{Key: k, Count: n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Key < out[j].Key
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// mongoStatsRepository computes statistics with aggregation pipelines over
+// the collections of the suggestion and event repositories.
+type mongoStatsRepository struct {
+	suggestions *mongo.Collection
+	approvals   *mongo.Collection
+	rejections  *mongo.Collection
+	events      *mongo.Collection
+}
+
+func NewMongoStatsRepository(db *mongo.Database) StatsRepository {
+	return &mongoStatsRepository{
+		suggestions: db.Collection("suggestions"),
+		approvals:   db.Collection("approvals"),
+		rejections:  db.Collection("rejections"),
+		events:      db.Collection("events"),
+	}
+}
+
+func aggregate[T any](ctx context.Context, c *mongo.Collection, pipeline bson.A) ([]T, error) {
+	cursor, err := c.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	out := []T{}
+	err = cursor.All(ctx, &out)
+	return out, err
+}
+
+// matchWindow selects the suggestions made in w.
+func matchWindow(w statsWindow) bson.M {
+	from, to := w.dates()
+	return bson.M{"$match": bson.M{"date": bson.M{"$gte": from, "$lt": to}}}
+}
+
+var mongoPeriodFormats = map[string]string{
+	IntervalDay:   "%Y-%m-%d",
+	IntervalWeek:  "%G-W%V",
+	IntervalMonth: "%Y-%m",
+}
+
+func (r *mongoStatsRepository) SuggestionTimeline(ctx context.Context, q StatsQuery) ([]TimelinePoint, error) {
+	w, err := q.window(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	rows, err := aggregate[struct {
+		ID struct {
+			Period string `bson:"period"`
+			Status string `bson:"status"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}](ctx, r.suggestions, bson.A{
+		matchWindow(w),
+		bson.M{"$group": bson.M{
+			"_id": bson.M{
+				"period": bson.M{"$dateToString": bson.M{
+					"format": mongoPeriodFormats[w.interval],
+					"date":   bson.M{"$dateFromString": bson.M{"dateString": "$date"}},
+				}},
+				"status": "$status",
+			},
+			"count": bson.M{"$sum": 1},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]map[string]int{}
+	for _, row := range rows {
+		if counts[row.ID.Period] == nil {
+			counts[row.ID.Period] = map[string]int{}
+		}
+		counts[row.ID.Period][row.ID.Status] = row.Count
+	}
+	return buildTimeline(w, counts)
+}
+
+// decisionHours returns how long the suggestions made in w waited for the
+// decisions in c, in hours, sorted.
+func (r *mongoStatsRepository) decisionHours(ctx context.Context, c *mongo.Collection, w statsWindow) ([]float64, error) {
+	from, to := w.dates()
+	rows, err := aggregate[struct {
+		Hours []float64 `bson:"hours"`
+	}](ctx, c, bson.A{
+		bson.M{"$lookup": bson.M{"from": r.suggestions.Name(), "localField": "_id", "foreignField": "_id", "as": "suggestion"}},
+		bson.M{"$unwind": "$suggestion"},
+		bson.M{"$match": bson.M{"suggestion.date": bson.M{"$gte": from, "$lt": to}}},
+		bson.M{"$project": bson.M{"hours": bson.M{"$divide": bson.A{
+			bson.M{"$subtract": bson.A{
+				bson.M{"$dateFromString": bson.M{"dateString": "$date"}},
+				bson.M{"$dateFromString": bson.M{"dateString": "$suggestion.date"}},
+			}},
+			float64(time.Hour / time.Millisecond),
+		}}}},
+		bson.M{"$sort": bson.M{"hours": 1}},
+		bson.M{"$group": bson.M{"_id": nil, "hours": bson.M{"$push": "$hours"}}},
+	})
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return rows[0].Hours, nil
+}
+
+func (r *mongoStatsRepository) DecisionTimes(ctx context.Context, q StatsQuery) (DecisionStats, error) {
+	var stats DecisionStats
+	w, err := q.window(time.Now())
+	if err != nil {
+		return stats, err
+	}
+	approved, err := r.decisionHours(ctx, r.approvals, w)
+	if err != nil {
+		return stats, err
+	}
+	rejected, err := r.decisionHours(ctx, r.rejections, w)
+	if err != nil {
+		return stats, err
+	}
+	from, to := w.dates()
+	pending, err := r.suggestions.CountDocuments(ctx, bson.M{"date": bson.M{"$gte": from, "$lt": to}, "status": "pending"})
+	if err != nil {
+		return stats, err
+	}
+	stats.Approved, stats.Rejected, stats.Pending = newDecisionTime(approved), newDecisionTime(rejected), int(pending)
+	return stats, nil
+}
+
+// mongoDepartmentID mirrors Suggestion.DepartmentID: none when the author is
+// hidden from everyone, the stored department, else the code in a student
+// number author.
+var mongoDepartmentID = bson.M{"$cond": bson.A{
+	bson.M{"$eq": bson.A{"$anonymity", AnonymityEveryone}},
+	0,
+	bson.M{"$ifNull": bson.A{"$department", bson.M{"$cond": bson.A{
+		bson.M{"$regexMatch": bson.M{"input": "$author", "regex": studentNumberPattern.String()}},
+		bson.M{"$toInt": bson.M{"$substrCP": bson.A{"$author", bson.M{"$subtract": bson.A{bson.M{"$strLenCP": "$author"}, 8}}, 5}}},
+		0,
+	}}}},
+}}
+
+// countBy groups the suggestions made in w by key, most suggestions first.
+func countBy[T any](ctx context.Context, c *mongo.Collection, w statsWindow, key interface{}, skip interface{}) ([]T, error) {
+	return aggregate[T](ctx, c, bson.A{
+		matchWindow(w),
+		bson.M{"$group": bson.M{
+			"_id":      key,
+			"count":    bson.M{"$sum": 1},
+			"approved": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", "approved"}}, 1, 0}}},
+		}},
+		bson.M{"$match": bson.M{"_id": bson.M{"$ne": skip}}},
+		bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+		bson.M{"$limit": w.limit},
+	})
+}
+
+func (r *mongoStatsRepository) TopDepartments(ctx context.Context, q StatsQuery) ([]DepartmentCount, error) {
+	w, err := q.window(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return countBy[DepartmentCount](ctx, r.suggestions, w, mongoDepartmentID, 0)
+}
+
+func (r *mongoStatsRepository) TopAuthors(ctx context.Context, q StatsQuery) ([]AuthorCount, error) {
+	w, err := q.window(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return countBy[AuthorCount](ctx, r.suggestions, w, "$author", "")
+}
+
+func (r *mongoStatsRepository) TopSuggestions(ctx context.Context, q StatsQuery) ([]TopSuggestion, error) {
+	w, err := q.window(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	order := bson.D{{Key: "upvote_count", Value: -1}, {Key: "star_average", Value: -1}, {Key: "_id", Value: -1}}
+	if w.by == "stars" {
+		order = bson.D{{Key: "star_average", Value: -1}, {Key: "star_count", Value: -1}, {Key: "_id", Value: -1}}
+	}
+	return aggregate[TopSuggestion](ctx, r.suggestions, bson.A{
+		matchWindow(w),
+		bson.M{"$addFields": bson.M{
+			"star_count":   bson.M{"$size": bson.M{"$ifNull": bson.A{"$stars", bson.A{}}}},
+			"star_average": bson.M{"$ifNull": bson.A{bson.M{"$avg": "$stars.star"}, 0}},
+		}},
+		bson.M{"$sort": order},
+		bson.M{"$limit": w.limit},
+	})
+}
+
+func (r *mongoStatsRepository) EventStats(ctx context.Context, q StatsQuery) (EventStats, error) {
+	stats := EventStats{ByType: []KeyCount{}, ByOrganizer: []KeyCount{}}
+	w, err := q.window(time.Now())
+	if err != nil {
+		return stats, err
+	}
+	top := func(field string) bson.A {
+		return bson.A{
+			bson.M{"$group": bson.M{"_id": field, "count": bson.M{"$sum": 1}}},
+			bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+			bson.M{"$limit": w.limit},
+		}
+	}
+	rows, err := aggregate[struct {
+		Total       []struct{ Count int } `bson:"total"`
+		ByType      []KeyCount            `bson:"by_type"`
+		ByOrganizer []KeyCount            `bson:"by_organizer"`
+	}](ctx, r.events, bson.A{
+		bson.M{"$match": bson.M{"created_at": bson.M{
+			"$gte": primitive.NewDateTimeFromTime(w.from),
+			"$lt":  primitive.NewDateTimeFromTime(w.to),
+		}}},
+		bson.M{"$facet": bson.M{
+			"total":        bson.A{bson.M{"$count": "count"}},
+			"by_type":      top("$type"),
+			"by_organizer": top("$organizer_id"),
+		}},
+	})
+	if err != nil || len(rows) == 0 {
+		return stats, err
+	}
+	if len(rows[0].Total) > 0 {
+		stats.Total = rows[0].Total[0].Count
+	}
+	stats.ByType = append(stats.ByType, rows[0].ByType...)
+	stats.ByOrganizer = append(stats.ByOrganizer, rows[0].ByOrganizer...)
+	return stats, nil
+}
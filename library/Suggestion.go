@@ -1,39 +1,30 @@
 package library
 
 import (
-	"272-backend/pkg"
 	"context"
-	"log"
-	"strconv"
-	"strings"
+	"errors"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var (
-	Suggestions *mongo.Collection
-	Rejections  *mongo.Collection
-	Approvals   *mongo.Collection
-	Reports     *mongo.Collection
-)
-
-func init() {
-	Suggestions = pkg.Mongo.Collection("suggestions")
-	Rejections = pkg.Mongo.Collection("rejections")
-	Approvals = pkg.Mongo.Collection("approvals")
-	Reports = pkg.Mongo.Collection("reports")
-}
-
 type Suggestion struct {
-	ID       primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	Title    string             `json:"title" bson:"title"`
-	Content  string             `json:"content" bson:"content"`
-	AuthorID string             `json:"author" bson:"author"`
-	Upvotes  []string           `json:"upvotes" bson:"upvotes"`
-	Stars    []struct {
+	ID      primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Title   string             `json:"title" bson:"title"`
+	Content string             `json:"content" bson:"content"`
+	// ContentHTML is Content rendered from Markdown and sanitized, and
+	// Mentions the users it mentions; see Markdown.
+	ContentHTML string   `json:"content_html" bson:"content_html"`
+	Mentions    []string `json:"mentions,omitempty" bson:"mentions"`
+	AuthorID    string   `json:"author" bson:"author"`
+	Votes       `bson:",inline"`
+	// Hot ranks the suggestion in the hot listing; it decays with age, so
+	// Rank refreshes it now and then besides every vote and star.
+	Hot   float64 `json:"hot" bson:"hot"`
+	Stars []struct {
 		UserID string  `json:"userID" bson:"userID"`
 		Star   float64 `json:"star" bson:"star"`
 		Date   string  `json:"date" bson:"date"`
@@ -41,125 +32,159 @@ type Suggestion struct {
 	Date   string   `json:"date" bson:"date"`
 	Tags   []string `json:"tags" bson:"tags"`
 	Status string   `json:"status" bson:"status"`
+	// Attachments are the files uploaded to the suggestion.
+	Attachments []AttachmentRef `json:"attachments,omitempty" bson:"attachments,omitempty"`
+	// Department of the author, see DepartmentID.
+	Department int `json:"department,omitempty" bson:"department,omitempty"`
+	// Anonymity hides the author, see Anonymizer. AuthorID is a pseudonym
+	// when it is AnonymityEveryone, and SealedAuthor the sealed username.
+	Anonymity    string `json:"anonymity,omitempty" bson:"anonymity,omitempty"`
+	SealedAuthor []byte `json:"-" bson:"sealed_author,omitempty"`
 }
 
-func (s *Suggestion) WithID(id string) error {
+// mongoSuggestionRepository keeps suggestions and the moderation decisions
+// taken on them in their own collections.
+type mongoSuggestionRepository struct {
+	suggestions *mongo.Collection
+	rejections  *mongo.Collection
+	approvals   *mongo.Collection
+	reports     *mongo.Collection
+	// deanonymizations is the audit log of revealed authors.
+	deanonymizations *mongo.Collection
+}
+
+func NewMongoSuggestionRepository(db *mongo.Database) SuggestionRepository {
+	return &mongoSuggestionRepository{
+		suggestions:      db.Collection("suggestions"),
+		rejections:       db.Collection("rejections"),
+		approvals:        db.Collection("approvals"),
+		reports:          db.Collection("reports"),
+		deanonymizations: db.Collection("deanonymizations"),
+	}
+}
+
+func (r *mongoSuggestionRepository) WithID(ctx context.Context, s *Suggestion, id string) error {
 	objID, _ := primitive.ObjectIDFromHex(id)
-	if err := Suggestions.FindOne(context.TODO(), bson.M{"_id": objID}).Decode(&s); err != nil {
-		return err
+	if err := r.suggestions.FindOne(ctx, bson.M{"_id": objID}).Decode(&s); err != nil {
+		return notFound(err, errSuggestionNotFound)
 	}
 	return nil
 }
 
-func (s *Suggestion) InsertToDB() error {
+// SetContent sets the content of s from Markdown, tags included.
+func (s *Suggestion) SetContent(m Markdown) {
+	s.Content, s.ContentHTML, s.Mentions, s.Tags = m.Source, m.HTML, m.Mentions, m.Tags
+}
+
+// prepareInsert resets everything a new suggestion must start without. Its
+// tags come from its content.
+func (s *Suggestion) prepareInsert() {
 	s.Date = time.Now().UTC().Format(time.RFC3339)
 	s.Status = "pending"
-	s.Upvotes = []string{}
+	s.Votes.reset()
 	s.Stars = []struct {
 		UserID string  `json:"userID" bson:"userID"`
 		Star   float64 `json:"star" bson:"star"`
 		Date   string  `json:"date" bson:"date"`
 	}{}
-	s.Tags = []string{}
-	res, err := Suggestions.InsertOne(context.TODO(), s)
+	if s.Tags == nil {
+		s.Tags = []string{}
+	}
+	s.rank(time.Now())
+}
+
+func (r *mongoSuggestionRepository) InsertToDB(ctx context.Context, s *Suggestion) error {
+	s.prepareInsert()
+	res, err := r.suggestions.InsertOne(ctx, s)
 	if err != nil {
 		return err
 	}
-	if err := Suggestions.FindOne(context.TODO(), bson.M{"_id": res.InsertedID}).Decode(&s); err != nil {
-		return err
+	if err := r.suggestions.FindOne(ctx, bson.M{"_id": res.InsertedID}).Decode(&s); err != nil {
+		return notFound(err, errSuggestionNotFound)
 	}
 	return nil
 }
 
-func (s *Suggestion) GiveUpvote(userID string) error {
-	for _, upvote := range s.Upvotes {
-		if upvote == userID {
-			return nil
-		}
-	}
-	update := bson.M{
-		"$addToSet": bson.M{
-			"upvotes": userID,
+func (r *mongoSuggestionRepository) Edit(ctx context.Context, s *Suggestion, title string, content Markdown) error {
+	res, err := r.suggestions.UpdateOne(ctx, bson.M{"_id": s.ID, "status": "pending"}, bson.M{
+		"$set": bson.M{
+			"title":        title,
+			"content":      content.Source,
+			"content_html": content.HTML,
+			"mentions":     content.Mentions,
+			"tags":         content.Tags,
 		},
-	}
-	query := bson.M{
-		"_id": s.ID,
-	}
-	if _, err := Suggestions.UpdateOne(context.TODO(), query, update); err != nil {
+	})
+	if err != nil {
 		return err
 	}
-	if err := Suggestions.FindOne(context.TODO(), bson.M{"_id": s.ID}).Decode(&s); err != nil {
-		return err
+	if err := r.suggestions.FindOne(ctx, bson.M{"_id": s.ID}).Decode(&s); err != nil {
+		return notFound(err, errSuggestionNotFound)
+	}
+	if res.MatchedCount == 0 {
+		return errNotEditable
 	}
 	return nil
 }
 
-func (s *Suggestion) GiveStar(userID string, star int) error {
-	query := bson.M{
-		"_id": s.ID,
-		"stars": bson.M{
-			"$elemMatch": bson.M{
-				"userID": userID,
-			},
-		},
+func (r *mongoSuggestionRepository) Vote(ctx context.Context, s *Suggestion, userID string, kind VoteKind) error {
+	return r.update(ctx, s, ranked(voteUpdate(userID, kind, false)))
+}
+
+func (r *mongoSuggestionRepository) Unvote(ctx context.Context, s *Suggestion, userID string, kind VoteKind) error {
+	return r.update(ctx, s, ranked(voteUpdate(userID, kind, true)))
+}
+
+// update applies the pipeline to s and refreshes it.
+func (r *mongoSuggestionRepository) update(ctx context.Context, s *Suggestion, update mongo.Pipeline) error {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := r.suggestions.FindOneAndUpdate(ctx, bson.M{"_id": s.ID}, update, opts).Decode(s); err != nil {
+		return notFound(err, errSuggestionNotFound)
 	}
-	if err := Suggestions.FindOne(context.TODO(), query).Decode(&s); err == nil {
-		/* log.Println("User already starred") */
-		stars := []struct {
-			UserID string  `json:"userID" bson:"userID"`
-			Star   float64 `json:"star" bson:"star"`
-			Date   string  `json:"date" bson:"date"`
-		}{}
-		for _, st := range s.Stars {
-			/* log.Println(st.UserID) */
-			if st.UserID == userID {
-				st.Star = float64(star)
-				st.Date = time.Now().UTC().Format(time.RFC3339)
-				stars = append(stars, st)
-			} else {
-				stars = append(stars, st)
-			}
-		}
-		/* log.Println("ctrl") */
-		update := bson.M{
-			"$set": bson.M{
-				"stars": stars,
-			},
-		}
-		query := bson.M{
-			"_id": s.ID,
-		}
-		if _, err := Suggestions.UpdateOne(context.TODO(), query, update); err != nil {
-			log.Println(err.Error())
-			return err
-		}
-		if err := Suggestions.FindOne(context.TODO(), bson.M{"_id": s.ID}).Decode(&s); err != nil {
-			log.Println(err.Error())
-			return err
-		}
-		return nil
-	} else {
-		/* log.Println("User has not starred") */
-		update := bson.M{
-			"$addToSet": bson.M{
-				"stars": bson.M{
-					"userID": userID,
-					"star":   float64(star),
-					"date":   time.Now().UTC().Format(time.RFC3339),
-				},
-			},
-		}
-		query := bson.M{
-			"_id": s.ID,
-		}
-		if _, err := Suggestions.UpdateOne(context.TODO(), query, update); err != nil {
-			return err
-		}
-		if err := Suggestions.FindOne(context.TODO(), bson.M{"_id": s.ID}).Decode(&s); err != nil {
-			return err
-		}
-		return nil
+	return nil
+}
+
+func (r *mongoSuggestionRepository) GetVoters(ctx context.Context, id primitive.ObjectID, q VoterQuery) (Page[Voter], error) {
+	var votes Votes
+	opts := options.FindOne().SetProjection(bson.M{"upvotes": 1, "downvotes": 1})
+	if err := r.suggestions.FindOne(ctx, bson.M{"_id": id}, opts).Decode(&votes); err != nil {
+		return Page[Voter]{}, notFound(err, errSuggestionNotFound)
 	}
+	return votes.voters(q), nil
+}
+
+func (r *mongoSuggestionRepository) CountVotes(ctx context.Context) error {
+	return countVotes(ctx, r.suggestions)
+}
+
+func (r *mongoSuggestionRepository) GiveStar(ctx context.Context, s *Suggestion, userID string, star int) error {
+	return r.update(ctx, s, ranked(starUpdate(userID, float64(star), time.Now().UTC().Format(time.RFC3339))))
+}
+
+// starUpdate replaces the star of userID, or adds it, in one update pipeline
+// so stars given at once are all kept. It is what the memory GiveStar does.
+func starUpdate(userID string, star float64, date string) mongo.Pipeline {
+	stars := bson.M{"$ifNull": bson.A{"$stars", bson.A{}}}
+	given := bson.M{"userID": userID, "star": star, "date": date}
+	return mongo.Pipeline{{{Key: "$set", Value: bson.M{"stars": bson.M{"$cond": bson.A{
+		bson.M{"$in": bson.A{userID, bson.M{"$map": bson.M{"input": stars, "in": "$$this.userID"}}}},
+		bson.M{"$map": bson.M{"input": stars, "in": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$$this.userID", userID}},
+			given,
+			"$$this",
+		}}}},
+		bson.M{"$concatArrays": bson.A{stars, bson.A{given}}},
+	}}}}}}
+}
+
+// rank recomputes the hot rank of the suggestions matching filter.
+func (r *mongoSuggestionRepository) rank(ctx context.Context, filter bson.M) error {
+	_, err := r.suggestions.UpdateMany(ctx, filter, mongo.Pipeline{hotRank})
+	return err
+}
+
+func (r *mongoSuggestionRepository) Rank(ctx context.Context) error {
+	return r.rank(ctx, bson.M{"status": "approved"})
 }
 
 type Rejection struct {
@@ -169,31 +194,35 @@ type Rejection struct {
 	Date       string             `json:"date" bson:"date"`
 }
 
-func (s *Suggestion) Reject(executorID string, reason string) error {
+// decide records decision, whose ID is that of s, in decisions, or fails
+// with decided when there already is one, and sets the status of s. The
+// decision is deleted again when s cannot be updated, so a wrong ID leaves
+// nothing behind to collide with a retry.
+func (r *mongoSuggestionRepository) decide(ctx context.Context, s *Suggestion, decisions *mongo.Collection, decision interface{}, status string, decided *Error) error {
+	if _, err := decisions.InsertOne(ctx, decision); err != nil {
+		return conflict(err, decided)
+	}
+	res, err := r.suggestions.UpdateOne(ctx, bson.M{"_id": s.ID}, bson.M{"$set": bson.M{"status": status}})
+	if err == nil && res.MatchedCount == 0 {
+		err = errSuggestionNotFound.Wrap(mongo.ErrNoDocuments)
+	}
+	if err != nil {
+		if _, deleteErr := decisions.DeleteOne(ctx, bson.M{"_id": s.ID}); deleteErr != nil {
+			return errors.Join(err, deleteErr)
+		}
+		return err
+	}
+	return notFound(r.suggestions.FindOne(ctx, bson.M{"_id": s.ID}).Decode(s), errSuggestionNotFound)
+}
+
+func (r *mongoSuggestionRepository) Reject(ctx context.Context, s *Suggestion, executorID string, reason string) error {
 	rejection := Rejection{
 		ID:         s.ID,
 		Reason:     reason,
 		ExecutorID: executorID,
 		Date:       time.Now().UTC().Format(time.RFC3339),
 	}
-	if _, err := Rejections.InsertOne(context.TODO(), rejection); err != nil {
-		return err
-	}
-	update := bson.M{
-		"$set": bson.M{
-			"status": "rejected",
-		},
-	}
-	query := bson.M{
-		"_id": s.ID,
-	}
-	if _, err := Suggestions.UpdateOne(context.TODO(), query, update); err != nil {
-		return err
-	}
-	if err := Suggestions.FindOne(context.TODO(), bson.M{"_id": s.ID}).Decode(&s); err != nil {
-		return err
-	}
-	return nil
+	return r.decide(ctx, s, r.rejections, rejection, "rejected", errAlreadyRejected)
 }
 
 type Approval struct {
@@ -202,31 +231,13 @@ type Approval struct {
 	Date       string             `json:"date" bson:"date"`
 }
 
-func (s *Suggestion) Approve(executorID string) error {
+func (r *mongoSuggestionRepository) Approve(ctx context.Context, s *Suggestion, executorID string) error {
 	approval := Approval{
 		ID:         s.ID,
 		ExecutorID: executorID,
 		Date:       time.Now().UTC().Format(time.RFC3339),
 	}
-	if _, err := Approvals.InsertOne(context.TODO(), approval); err != nil {
-		return err
-	}
-	update := bson.M{
-		"$set": bson.M{
-			"status": "approved",
-		},
-	}
-	query := bson.M{
-		"_id": s.ID,
-	}
-	res, err := Suggestions.UpdateOne(context.TODO(), query, update)
-	if err != nil {
-		return err
-	}
-	if err := Suggestions.FindOne(context.TODO(), bson.M{"_id": res.UpsertedID}).Decode(&s); err != nil {
-		return err
-	}
-	return nil
+	return r.decide(ctx, s, r.approvals, approval, "approved", errAlreadyApproved)
 }
 
 type Report struct {
@@ -235,31 +246,13 @@ type Report struct {
 	Date       string             `json:"date" bson:"date"`
 }
 
-func (s *Suggestion) Report(executorID string) error {
+func (r *mongoSuggestionRepository) Report(ctx context.Context, s *Suggestion, executorID string) error {
 	report := Report{
 		ID:         s.ID,
 		ExecutorID: executorID,
 		Date:       time.Now().UTC().Format(time.RFC3339),
 	}
-	if _, err := Reports.InsertOne(context.TODO(), report); err != nil {
-		return err
-	}
-	update := bson.M{
-		"$set": bson.M{
-			"status": "reported",
-		},
-	}
-	query := bson.M{
-		"_id": s.ID,
-	}
-	res, err := Suggestions.UpdateOne(context.TODO(), query, update)
-	if err != nil {
-		return err
-	}
-	if err := Suggestions.FindOne(context.TODO(), bson.M{"_id": res.UpsertedID}).Decode(&s); err != nil {
-		return err
-	}
-	return nil
+	return r.decide(ctx, s, r.reports, report, "reported", errAlreadyReported)
 }
 
 func (s *Suggestion) CalculateAverageStars() float64 {
@@ -276,72 +269,128 @@ func (s *Suggestion) CalculateAverageStars() float64 {
 	return average
 }
 
-func GetRejectedSuggestions() ([]Suggestion, error) {
+func (r *mongoSuggestionRepository) GetRejectedSuggestions(ctx context.Context) ([]Suggestion, error) {
 	var suggestions []Suggestion
-	cursor, err := Suggestions.Find(context.TODO(), bson.M{"status": "rejected"})
+	cursor, err := r.suggestions.Find(ctx, bson.M{"status": "rejected"})
 	if err != nil {
 		return []Suggestion{}, err
 	}
-	if err := cursor.All(context.TODO(), &suggestions); err != nil {
+	if err := cursor.All(ctx, &suggestions); err != nil {
 		return []Suggestion{}, err
 	}
 	return suggestions, nil
 }
 
-func GetApprovedSuggestions() ([]Suggestion, error) {
+func (r *mongoSuggestionRepository) GetApprovedSuggestions(ctx context.Context) ([]Suggestion, error) {
 	var suggestions []Suggestion
-	cursor, err := Suggestions.Find(context.TODO(), bson.M{"status": "approved"})
+	cursor, err := r.suggestions.Find(ctx, bson.M{"status": "approved"})
 	if err != nil {
 		return []Suggestion{}, err
 	}
-	if err := cursor.All(context.TODO(), &suggestions); err != nil {
+	if err := cursor.All(ctx, &suggestions); err != nil {
 		return []Suggestion{}, err
 	}
 	return suggestions, nil
 }
 
-func GetAllSuggestions() ([]Suggestion, error) {
+func (r *mongoSuggestionRepository) GetRankedSuggestions(ctx context.Context, q RankingQuery) ([]Suggestion, error) {
+	suggestions := []Suggestion{}
+	cursor, err := r.suggestions.Find(ctx, rankingFilter(q, time.Now()), options.Find().SetSort(rankingSort(q)))
+	if err != nil {
+		return suggestions, err
+	}
+	err = cursor.All(ctx, &suggestions)
+	return suggestions, err
+}
+
+func (r *mongoSuggestionRepository) GetAllSuggestions(ctx context.Context) ([]Suggestion, error) {
 	var suggestions []Suggestion
-	cursor, err := Suggestions.Find(context.TODO(), bson.M{})
+	cursor, err := r.suggestions.Find(ctx, bson.M{})
 	if err != nil {
 		return []Suggestion{}, err
 	}
-	if err := cursor.All(context.TODO(), &suggestions); err != nil {
+	if err := cursor.All(ctx, &suggestions); err != nil {
 		return []Suggestion{}, err
 	}
 	return suggestions, nil
 }
 
-func GetPendingSuggestions() ([]Suggestion, error) {
+func (r *mongoSuggestionRepository) GetPendingSuggestions(ctx context.Context) ([]Suggestion, error) {
 	var suggestions []Suggestion
-	cursor, err := Suggestions.Find(context.TODO(), bson.M{"status": "pending"})
+	cursor, err := r.suggestions.Find(ctx, bson.M{"status": "pending"})
 	if err != nil {
 		return []Suggestion{}, err
 	}
-	if err := cursor.All(context.TODO(), &suggestions); err != nil {
+	if err := cursor.All(ctx, &suggestions); err != nil {
 		return []Suggestion{}, err
 	}
 	return suggestions, nil
 }
 
-func GetReportedSuggestions() ([]Suggestion, error) {
+func (r *mongoSuggestionRepository) GetReportedSuggestions(ctx context.Context) ([]Suggestion, error) {
 	var suggestions []Suggestion
-	cursor, err := Suggestions.Find(context.TODO(), bson.M{"status": "reported"})
+	cursor, err := r.suggestions.Find(ctx, bson.M{"status": "reported"})
 	if err != nil {
 		return []Suggestion{}, err
 	}
-	if err := cursor.All(context.TODO(), &suggestions); err != nil {
+	if err := cursor.All(ctx, &suggestions); err != nil {
 		return []Suggestion{}, err
 	}
 	return suggestions, nil
 }
 
+func (r *mongoSuggestionRepository) GetAuthorSuggestions(ctx context.Context, authors []string) ([]Suggestion, error) {
+	suggestions := []Suggestion{}
+	cursor, err := r.suggestions.Find(ctx, bson.M{"author": bson.M{"$in": authors}}, options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}))
+	if err != nil {
+		return suggestions, err
+	}
+	err = cursor.All(ctx, &suggestions)
+	return suggestions, err
+}
+
+func (r *mongoSuggestionRepository) LogDeanonymization(ctx context.Context, d *Deanonymization) error {
+	d.ID = primitive.NewObjectID()
+	d.At = primitive.NewDateTimeFromTime(time.Now())
+	_, err := r.deanonymizations.InsertOne(ctx, d)
+	return err
+}
+
+func (r *mongoSuggestionRepository) GetDeanonymizations(ctx context.Context, q PageQuery) (Page[Deanonymization], error) {
+	q.normalize()
+	page := Page[Deanonymization]{Items: []Deanonymization{}, Page: q.Page, PerPage: q.PerPage}
+	total, err := r.deanonymizations.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return page, err
+	}
+	page.Total = total
+	cursor, err := r.deanonymizations.Find(ctx, bson.M{}, options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetSkip(int64(q.skip())).
+		SetLimit(int64(q.PerPage)))
+	if err != nil {
+		return page, err
+	}
+	err = cursor.All(ctx, &page.Items)
+	return page, err
+}
+
 type SuggestionResponse struct {
-	ID         string   `json:"id"`
-	Title      string   `json:"title"`
-	Content    string   `json:"content"`
-	Author     string   `json:"author"`
-	Upvotes    int      `json:"upvotes"`
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	// ContentHTML is the sanitized HTML Content renders to as Markdown.
+	ContentHTML string `json:"content_html"`
+	// Mentions are the usernames of the users Content mentions.
+	Mentions  []string `json:"mentions"`
+	Author    string   `json:"author"`
+	Upvotes   int      `json:"upvotes"`
+	Downvotes int      `json:"downvotes"`
+	Score     int      `json:"score"`
+	// Hot is the rank of the suggestion in the hot listing.
+	Hot float64 `json:"hot"`
+	// Vote is 1 when the viewer upvoted, -1 when they downvoted.
+	Vote       int      `json:"vote"`
 	Stars      float64  `json:"stars"`
 	Date       string   `json:"date"`
 	Tags       []string `json:"tags"`
@@ -349,40 +398,80 @@ type SuggestionResponse struct {
 	Starred    float64  `json:"starred"`
 	Voted      bool     `json:"voted"`
 	Department int      `json:"department"`
+	Anonymity  string   `json:"anonymity,omitempty"`
+	// Mine tells the author their own suggestions, anonymous ones included.
+	Mine        bool            `json:"mine"`
+	Attachments []AttachmentRef `json:"attachments"`
 }
 
-func (s *Suggestion) ToResponse(userID string) SuggestionResponse {
+// ToResponse shows s to v. The author of an anonymous suggestion, and their
+// department, are left out for students other than the author; admins see
+// the pseudonym of one hidden from everyone.
+func (s *Suggestion) ToResponse(v Viewer) SuggestionResponse {
 	starred := 0.00
 	voted := false
 	for _, stars := range s.Stars {
-		if stars.UserID == userID {
+		if stars.UserID == v.Username {
 			starred = stars.Star
 			voted = true
 			break
 		}
 	}
+	mine := v.Authored(s)
+	author := s.AuthorID
+	if mine {
+		author = v.Username
+	} else if s.Anonymity != AnonymityNone && !v.Admin {
+		author = ""
+	}
+	department := s.DepartmentID()
+	if author == "" {
+		// The department narrows an anonymous author down too far.
+		department = 0
+	}
 	response := SuggestionResponse{
 		ID:         s.ID.Hex(),
 		Title:      s.Title,
 		Content:    s.Content,
-		Author:     s.AuthorID,
-		Upvotes:    len(s.Upvotes),
+		Author:     author,
+		Upvotes:    s.UpvoteCount,
+		Downvotes:  s.DownvoteCount,
+		Score:      s.Score,
+		Hot:        s.Hot,
+		Vote:       s.VoteOf(v.Username),
 		Stars:      s.CalculateAverageStars(),
 		Date:       s.Date,
 		Tags:       s.Tags,
 		Status:     s.Status,
 		Starred:    starred,
 		Voted:      voted,
-		Department: GetDepartmentID(s.AuthorID),
+		Department: department,
+		Anonymity:  s.Anonymity,
+		Mine:       mine,
+	}
+	if response.ContentHTML = s.ContentHTML; response.ContentHTML == "" {
+		response.ContentHTML = RenderMarkdown(s.Content)
+	}
+	if response.Mentions = s.Mentions; response.Mentions == nil {
+		response.Mentions = []string{}
+	}
+	response.Attachments = s.Attachments
+	if response.Attachments == nil {
+		response.Attachments = []AttachmentRef{}
 	}
 	return response
 }
-func GetDepartmentID(username string) int {
-	chars := strings.Split(username[3:], "")
-	id_slice := []string{}
-	for i := 0; i < len(chars)-3; i++ {
-		id_slice = append(id_slice, chars[i])
-	}
-	department, _ := strconv.Atoi(strings.Join(id_slice, ""))
-	return department
+
+// DepartmentID is the department of the author when the suggestion was made.
+// Suggestions from before departments were stored fall back to the author's
+// student number, unless the author is hidden. Suggestions hidden from
+// everyone have none, even if one was stored before it was left out.
+func (s *Suggestion) DepartmentID() int {
+	if s.Anonymity == AnonymityEveryone {
+		return 0
+	}
+	if s.Department != 0 || s.Anonymity != AnonymityNone {
+		return s.Department
+	}
+	return GetDepartmentID(s.AuthorID)
 }
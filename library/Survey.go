@@ -0,0 +1,130 @@
+package library
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// SurveyItem is the outcome of filling in the survey of one course.
+type SurveyItem struct {
+	Course      string             `json:"course" bson:"course"`
+	Status      string             `json:"status" bson:"status"`
+	Message     string             `json:"message,omitempty" bson:"message,omitempty"`
+	CompletedAt primitive.DateTime `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+}
+
+// SurveyJob is a background run that fills in every pending course survey of
+// a user. The portal password it needs is never stored with it.
+type SurveyJob struct {
+	ID             primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID         string             `json:"user_id" bson:"user_id"`
+	IdempotencyKey string             `json:"idempotency_key,omitempty" bson:"idempotency_key,omitempty"`
+	Status         string             `json:"status" bson:"status"`
+	Items          []SurveyItem       `json:"items" bson:"items"`
+	Error          string             `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt      primitive.DateTime `json:"created_at" bson:"created_at"`
+	StartedAt      primitive.DateTime `json:"started_at,omitempty" bson:"started_at,omitempty"`
+	FinishedAt     primitive.DateTime `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+}
+
+// Active reports whether the job has not finished yet.
+func (j *SurveyJob) Active() bool {
+	return j.Status == JobQueued || j.Status == JobRunning
+}
+
+// prepareInsert stamps a new job as queued.
+func (j *SurveyJob) prepareInsert() error {
+	if j.UserID == "" {
+		return Validation("INVALID_USER", "Survey job needs a user")
+	}
+	if j.ID.IsZero() {
+		j.ID = primitive.NewObjectID()
+	}
+	j.Status = JobQueued
+	j.Items = []SurveyItem{}
+	j.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	return nil
+}
+
+// mongoSurveyJobRepository keeps jobs in the "survey_jobs" collection.
+type mongoSurveyJobRepository struct {
+	jobs *mongo.Collection
+}
+
+func NewMongoSurveyJobRepository(db *mongo.Database) SurveyJobRepository {
+	return &mongoSurveyJobRepository{jobs: db.Collection("survey_jobs")}
+}
+
+func (r *mongoSurveyJobRepository) CreateJob(ctx context.Context, j *SurveyJob) error {
+	if err := j.prepareInsert(); err != nil {
+		return err
+	}
+	_, err := r.jobs.InsertOne(ctx, j)
+	return conflict(err, errSurveyJobExists)
+}
+
+func (r *mongoSurveyJobRepository) GetJob(ctx context.Context, id primitive.ObjectID) (SurveyJob, error) {
+	var j SurveyJob
+	err := r.jobs.FindOne(ctx, bson.M{"_id": id}).Decode(&j)
+	return j, notFound(err, errSurveyJobNotFound)
+}
+
+func (r *mongoSurveyJobRepository) FindJob(ctx context.Context, userID, idempotencyKey string) (SurveyJob, error) {
+	filter := bson.M{"user_id": userID, "status": bson.M{"$in": bson.A{JobQueued, JobRunning}}}
+	if idempotencyKey != "" {
+		filter = bson.M{"user_id": userID, "idempotency_key": idempotencyKey}
+	}
+	var j SurveyJob
+	err := r.jobs.FindOne(ctx, filter).Decode(&j)
+	return j, notFound(err, errSurveyJobNotFound)
+}
+
+func (r *mongoSurveyJobRepository) UpdateJob(ctx context.Context, j *SurveyJob) error {
+	res, err := r.jobs.ReplaceOne(ctx, bson.M{"_id": j.ID}, j)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errSurveyJobNotFound.Wrap(mongo.ErrNoDocuments)
+	}
+	return nil
+}
+
+func (r *mongoSurveyJobRepository) GetJobs(ctx context.Context, userID string) ([]SurveyJob, error) {
+	cursor, err := r.jobs.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	jobs := []SurveyJob{}
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (r *mongoSurveyJobRepository) FailUnfinished(ctx context.Context, reason string) (int, error) {
+	res, err := r.jobs.UpdateMany(ctx,
+		bson.M{"status": bson.M{"$in": bson.A{JobQueued, JobRunning}}},
+		bson.M{"$set": bson.M{
+			"status":      JobFailed,
+			"error":       reason,
+			"finished_at": primitive.NewDateTimeFromTime(time.Now()),
+		}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.ModifiedCount), nil
+}
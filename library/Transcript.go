@@ -0,0 +1,265 @@
+package library
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Grade describes one letter of a grade table.
+type Grade struct {
+	Letter string  `json:"letter"`
+	Points float64 `json:"points"`
+	// InGPA is false for letters such as EX (exempt) that earn credits
+	// without affecting the average.
+	InGPA  bool `json:"in_gpa"`
+	Passed bool `json:"passed"`
+}
+
+// GradeScale maps letter grades to what they are worth.
+type GradeScale map[string]Grade
+
+// DefaultGradeScale is the four point Turkish scale, where DD is the lowest
+// passing grade and DZ (failed through absence) counts as FF.
+func DefaultGradeScale() GradeScale {
+	scale, _ := ParseGradeScale("AA=4.0,BA=3.5,BB=3.0,CB=2.5,CC=2.0,DC=1.5,DD=1.0,FD=0.5,FF=0,DZ=0,EX=pass,P=pass,NP=fail", 1.0)
+	return scale
+}
+
+// ParseGradeScale reads a table such as "AA=4.0,BA=3.5,...,EX=pass". A
+// numeric value counts towards the GPA and passes from passPoints up; "pass"
+// and "fail" letters only decide whether the credits are earned.
+func ParseGradeScale(spec string, passPoints float64) (GradeScale, error) {
+	scale := GradeScale{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		letter, value, ok := strings.Cut(entry, "=")
+		letter = strings.ToUpper(strings.TrimSpace(letter))
+		value = strings.ToLower(strings.TrimSpace(value))
+		if !ok || letter == "" {
+			return nil, fmt.Errorf("grade scale: %q is not LETTER=VALUE", entry)
+		}
+		switch value {
+		case "pass":
+			scale[letter] = Grade{Letter: letter, Passed: true}
+		case "fail":
+			scale[letter] = Grade{Letter: letter}
+		default:
+			points, err := strconv.ParseFloat(value, 64)
+			if err != nil || points < 0 {
+				return nil, fmt.Errorf("grade scale: %s has invalid points %q", letter, value)
+			}
+			scale[letter] = Grade{Letter: letter, Points: points, InGPA: true, Passed: points >= passPoints}
+		}
+	}
+	if len(scale) == 0 {
+		return nil, fmt.Errorf("grade scale: no grades defined")
+	}
+	return scale, nil
+}
+
+// lookup returns the grade for a letter as the portal prints it. Blank and
+// unknown letters, such as a course still in progress, are not graded.
+func (s GradeScale) lookup(letter string) (Grade, bool) {
+	g, ok := s[strings.ToUpper(strings.TrimSpace(letter))]
+	return g, ok
+}
+
+// parseCredits reads credits as the portal prints them, "3", "3.0" or "3,5".
+func parseCredits(raw string) float64 {
+	credits, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(raw), ",", ".", 1), 64)
+	if err != nil || credits < 0 {
+		return 0
+	}
+	return credits
+}
+
+func round2(x float64) float64 {
+	return math.Round(x*100) / 100
+}
+
+// SemesterGPA sums up the graded courses of one semester.
+type SemesterGPA struct {
+	Year             int     `json:"year"`
+	Semester         int     `json:"semester"`
+	AttemptedCredits float64 `json:"attempted_credits"`
+	EarnedCredits    float64 `json:"earned_credits"`
+	GPA              float64 `json:"gpa"`
+	CumulativeGPA    float64 `json:"cumulative_gpa"`
+}
+
+// RemainingSemester lists the curriculum courses of a semester that have not
+// been passed yet.
+type RemainingSemester struct {
+	Year     int          `json:"year"`
+	Semester int          `json:"semester"`
+	Credits  float64      `json:"credits"`
+	Courses  []CourseData `json:"courses"`
+}
+
+// Transcript is the GPA and graduation progress of a user.
+type Transcript struct {
+	GPA              float64             `json:"gpa"`
+	AttemptedCredits float64             `json:"attempted_credits"`
+	EarnedCredits    float64             `json:"earned_credits"`
+	RequiredCredits  float64             `json:"required_credits"`
+	Progress         float64             `json:"progress"`
+	Semesters        []SemesterGPA       `json:"semesters"`
+	Remaining        []RemainingSemester `json:"remaining"`
+}
+
+// Transcript computes semester and cumulative GPAs over courses. plan, when
+// known, decides which courses are required; otherwise every course is.
+func (s GradeScale) Transcript(courses []CourseData, plan *Cirriculum) Transcript {
+	byID := make(map[string]CourseData, len(courses))
+	for _, c := range courses {
+		byID[courseKey(c)] = c
+	}
+
+	type term struct{ year, semester int }
+	terms := map[term]*SemesterGPA{}
+	points := map[term]float64{}
+	t := Transcript{Semesters: []SemesterGPA{}, Remaining: []RemainingSemester{}}
+	passed := map[string]bool{}
+	for _, c := range courses {
+		g, ok := s.lookup(c.Grade)
+		if !ok {
+			continue
+		}
+		credits := parseCredits(c.Credits)
+		key := term{c.Year, c.Semester}
+		sem := terms[key]
+		if sem == nil {
+			sem = &SemesterGPA{Year: c.Year, Semester: c.Semester}
+			terms[key] = sem
+		}
+		if g.InGPA {
+			sem.AttemptedCredits += credits
+			points[key] += credits * g.Points
+		}
+		if g.Passed {
+			sem.EarnedCredits += credits
+			passed[courseKey(c)] = true
+		}
+	}
+
+	keys := make([]term, 0, len(terms))
+	for k := range terms {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].year != keys[j].year {
+			return keys[i].year < keys[j].year
+		}
+		return keys[i].semester < keys[j].semester
+	})
+	var totalPoints float64
+	for _, k := range keys {
+		sem := terms[k]
+		if sem.AttemptedCredits > 0 {
+			sem.GPA = round2(points[k] / sem.AttemptedCredits)
+		}
+		totalPoints += points[k]
+		t.AttemptedCredits += sem.AttemptedCredits
+		t.EarnedCredits += sem.EarnedCredits
+		if t.AttemptedCredits > 0 {
+			sem.CumulativeGPA = round2(totalPoints / t.AttemptedCredits)
+		}
+		t.Semesters = append(t.Semesters, *sem)
+	}
+	if t.AttemptedCredits > 0 {
+		t.GPA = round2(totalPoints / t.AttemptedCredits)
+	}
+
+	required := courses
+	if plan != nil && len(plan.Index) > 0 {
+		required = make([]CourseData, 0, len(plan.Index))
+		for _, idx := range plan.Index {
+			c, ok := byID[idx.CourseID]
+			if !ok {
+				c = CourseData{ID: idx.CourseID, CourseID: idx.CourseID}
+			}
+			c.Year, c.Semester = idx.Year, idx.Semester
+			required = append(required, c)
+		}
+	}
+	remaining := map[term]*RemainingSemester{}
+	for _, c := range required {
+		credits := parseCredits(c.Credits)
+		t.RequiredCredits += credits
+		if passed[courseKey(c)] {
+			continue
+		}
+		key := term{c.Year, c.Semester}
+		r := remaining[key]
+		if r == nil {
+			r = &RemainingSemester{Year: c.Year, Semester: c.Semester}
+			remaining[key] = r
+		}
+		r.Credits += credits
+		r.Courses = append(r.Courses, c)
+	}
+	for _, r := range remaining {
+		t.Remaining = append(t.Remaining, *r)
+	}
+	sort.Slice(t.Remaining, func(i, j int) bool {
+		if t.Remaining[i].Year != t.Remaining[j].Year {
+			return t.Remaining[i].Year < t.Remaining[j].Year
+		}
+		return t.Remaining[i].Semester < t.Remaining[j].Semester
+	})
+	if t.RequiredCredits > 0 {
+		t.Progress = round2(math.Min(t.EarnedCredits/t.RequiredCredits, 1))
+	}
+	return t
+}
+
+// HypotheticalGrade is a grade to assume for a course in a what-if projection.
+type HypotheticalGrade struct {
+	CourseID string `json:"course_id" validate:"required,max=64"`
+	Grade    string `json:"grade" validate:"required,max=4"`
+}
+
+// WhatIf is a transcript computed with some grades replaced.
+type WhatIf struct {
+	CurrentGPA   float64    `json:"current_gpa"`
+	ProjectedGPA float64    `json:"projected_gpa"`
+	Transcript   Transcript `json:"transcript"`
+}
+
+// WhatIf projects the transcript as if the given grades had been received.
+// Every hypothetical course must be part of courses and every letter must be
+// in the scale.
+func (s GradeScale) WhatIf(courses []CourseData, plan *Cirriculum, grades []HypotheticalGrade) (WhatIf, error) {
+	index := make(map[string]int, len(courses))
+	for i, c := range courses {
+		index[courseKey(c)] = i
+	}
+	projected := make([]CourseData, len(courses))
+	copy(projected, courses)
+	var problems []FieldError
+	for i, h := range grades {
+		field := fmt.Sprintf("grades[%d]", i)
+		at, ok := index[h.CourseID]
+		if !ok {
+			problems = append(problems, FieldError{Field: field + ".course_id", Code: "unknown", Message: h.CourseID + " is not in your curriculum"})
+			continue
+		}
+		if _, ok := s.lookup(h.Grade); !ok {
+			problems = append(problems, FieldError{Field: field + ".grade", Code: "oneof", Message: h.Grade + " is not a known grade"})
+			continue
+		}
+		projected[at].Grade = strings.ToUpper(strings.TrimSpace(h.Grade))
+	}
+	if len(problems) > 0 {
+		return WhatIf{}, Validation("VALIDATION_FAILED", "Request validation failed", problems...)
+	}
+	current := s.Transcript(courses, plan)
+	t := s.Transcript(projected, plan)
+	return WhatIf{CurrentGPA: current.GPA, ProjectedGPA: t.GPA, Transcript: t}, nil
+}
@@ -0,0 +1,152 @@
+package library
+
+import (
+	"context"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// VoteKind is either way of voting on a suggestion or project.
+type VoteKind string
+
+const (
+	Upvote   VoteKind = "upvote"
+	Downvote VoteKind = "downvote"
+)
+
+// Votes are the voter sets of a suggestion or project. Every vote rewrites
+// the counters in the same atomic update as the sets, so listings, rankings
+// and statistics read the counters instead of loading the sets.
+type Votes struct {
+	Upvotes       []string `json:"upvotes" bson:"upvotes"`
+	Downvotes     []string `json:"downvotes" bson:"downvotes"`
+	UpvoteCount   int      `json:"upvote_count" bson:"upvote_count"`
+	DownvoteCount int      `json:"downvote_count" bson:"downvote_count"`
+	// Score is UpvoteCount minus DownvoteCount.
+	Score int `json:"score" bson:"score"`
+}
+
+// VoteOf returns 1 when userID upvoted, -1 when they downvoted and 0
+// otherwise.
+func (v *Votes) VoteOf(userID string) int {
+	for _, voter := range v.Upvotes {
+		if voter == userID {
+			return 1
+		}
+	}
+	for _, voter := range v.Downvotes {
+		if voter == userID {
+			return -1
+		}
+	}
+	return 0
+}
+
+func (v *Votes) reset() {
+	v.Upvotes, v.Downvotes = []string{}, []string{}
+	v.count()
+}
+
+func (v *Votes) count() {
+	v.UpvoteCount, v.DownvoteCount = len(v.Upvotes), len(v.Downvotes)
+	v.Score = v.UpvoteCount - v.DownvoteCount
+}
+
+// cast records the vote of kind by userID, replacing their other vote, or
+// retracts it. It is what voteUpdate does in Mongo.
+func (v *Votes) cast(userID string, kind VoteKind, retract bool) {
+	cast, other := &v.Upvotes, &v.Downvotes
+	if kind == Downvote {
+		cast, other = other, cast
+	}
+	*cast = removeFromSet(*cast, userID)
+	if !retract {
+		*cast = addToSet(*cast, userID)
+		*other = removeFromSet(*other, userID)
+	}
+	v.count()
+}
+
+func removeFromSet(set []string, value string) []string {
+	out := []string{}
+	for _, v := range set {
+		if v != value {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// voteUpdate is cast as an update pipeline, so the sets and their counters
+// change in one write however many votes race.
+func voteUpdate(userID string, kind VoteKind, retract bool) mongo.Pipeline {
+	field, other := "upvotes", "downvotes"
+	if kind == Downvote {
+		field, other = other, field
+	}
+	set := func(name string) bson.M {
+		return bson.M{"$ifNull": bson.A{"$" + name, bson.A{}}}
+	}
+	without := func(name string) bson.M {
+		return bson.M{"$setDifference": bson.A{set(name), bson.A{userID}}}
+	}
+	change := bson.M{field: without(field)}
+	if !retract {
+		change[field] = bson.M{"$setUnion": bson.A{set(field), bson.A{userID}}}
+		change[other] = without(other)
+	}
+	return mongo.Pipeline{
+		{{Key: "$set", Value: change}},
+		{{Key: "$set", Value: voteCounters}},
+	}
+}
+
+// voteCounters recomputes the counters of Votes from the sets.
+var voteCounters = bson.M{
+	"upvote_count":   bson.M{"$size": bson.M{"$ifNull": bson.A{"$upvotes", bson.A{}}}},
+	"downvote_count": bson.M{"$size": bson.M{"$ifNull": bson.A{"$downvotes", bson.A{}}}},
+	"score": bson.M{"$subtract": bson.A{
+		bson.M{"$size": bson.M{"$ifNull": bson.A{"$upvotes", bson.A{}}}},
+		bson.M{"$size": bson.M{"$ifNull": bson.A{"$downvotes", bson.A{}}}},
+	}},
+}
+
+// countVotes fills in the counters of the documents in c stored before
+// there were any.
+func countVotes(ctx context.Context, c *mongo.Collection) error {
+	_, err := c.UpdateMany(ctx, bson.M{"score": bson.M{"$exists": false}}, mongo.Pipeline{{{Key: "$set", Value: voteCounters}}})
+	return err
+}
+
+// Voter is a user who voted, and how.
+type Voter struct {
+	Username string   `json:"username"`
+	Vote     VoteKind `json:"vote"`
+}
+
+// VoterQuery selects a page of the voters of a suggestion.
+type VoterQuery struct {
+	PageQuery
+	// Vote keeps only upvotes or downvotes.
+	Vote VoteKind `json:"vote" query:"vote" validate:"omitempty,oneof=upvote downvote"`
+}
+
+// voters lists the voters of v that q selects, ordered by username.
+func (v *Votes) voters(q VoterQuery) Page[Voter] {
+	all := []Voter{}
+	for _, list := range []struct {
+		kind  VoteKind
+		names []string
+	}{{Upvote, v.Upvotes}, {Downvote, v.Downvotes}} {
+		if q.Vote != "" && q.Vote != list.kind {
+			continue
+		}
+		for _, name := range list.names {
+			all = append(all, Voter{Username: name, Vote: list.kind})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Username < all[j].Username })
+	return paginate(all, q.PageQuery)
+}
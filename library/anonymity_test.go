@@ -0,0 +1,60 @@
+package library
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAnonymizer(t *testing.T) {
+	ctx := context.Background()
+	anonymizer, err := newAnonymizer([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := newAnonymizer([]byte("another-secret"))
+	if p := anonymizer.Pseudonym("c2011011025"); p != anonymizer.Pseudonym("c2011011025") || p == anonymizer.Pseudonym("c2011011026") || p == other.Pseudonym("c2011011025") {
+		t.Fatalf("pseudonym %q is not one per user and key", p)
+	}
+
+	suggestions := NewMemorySuggestionRepository()
+	hidden := Suggestion{Title: "Grading", Content: "Unfair", AuthorID: "c2011011025", Department: 11011}
+	if err := anonymizer.Anonymize(&hidden, AnonymityEveryone); err != nil {
+		t.Fatal(err)
+	}
+	if err := suggestions.InsertToDB(ctx, &hidden); err != nil {
+		t.Fatal(err)
+	}
+	if hidden.AuthorID != anonymizer.Pseudonym("c2011011025") || len(hidden.SealedAuthor) == 0 || hidden.Department != 0 {
+		t.Fatalf("anonymized suggestion = %+v", hidden)
+	}
+	if _, err := other.Deanonymize(ctx, suggestions, &hidden, "admin", "wrong key"); ErrorCode(err) != "AUTHOR_UNREADABLE" {
+		t.Fatalf("de-anonymization under another key: %v", err)
+	}
+	d, err := anonymizer.Deanonymize(ctx, suggestions, &hidden, "admin", "threats")
+	if err != nil || d.Author != "c2011011025" || d.Suggestion != hidden.ID {
+		t.Fatalf("de-anonymization = %+v, %v", d, err)
+	}
+
+	public := Suggestion{AuthorID: "c2011011025"}
+	if err := anonymizer.Anonymize(&public, AnonymityNone); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := anonymizer.Deanonymize(ctx, suggestions, &public, "admin", "curious"); ErrorCode(err) != "SUGGESTION_NOT_ANONYMOUS" {
+		t.Fatalf("de-anonymizing a public suggestion: %v", err)
+	}
+	if log, _ := suggestions.GetDeanonymizations(ctx, PageQuery{}); log.Total != 1 {
+		t.Fatalf("audit log holds %d entries, want only the successful one", log.Total)
+	}
+
+	// Suggestions stored with the department before it was left out show
+	// none, to admins too.
+	legacy := Suggestion{AuthorID: anonymizer.Pseudonym("c2011011025"), Anonymity: AnonymityEveryone, Department: 11011}
+	if r := legacy.ToResponse(anonymizer.Viewer("t1000000001", true)); legacy.DepartmentID() != 0 || r.Department != 0 {
+		t.Fatalf("department of a suggestion hidden from everyone = %d, shown %d", legacy.DepartmentID(), r.Department)
+	}
+
+	var none *Anonymizer
+	if err := none.Anonymize(&Suggestion{AuthorID: "c2011011025"}, AnonymityEveryone); ErrorCode(err) != "ANONYMITY_UNAVAILABLE" {
+		t.Fatalf("nil anonymizer: %v", err)
+	}
+}
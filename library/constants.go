@@ -1,19 +1,41 @@
 package library
 
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// ErrorPayload is the body of every error response. Error holds a stable code
+// such as SUGGESTION_NOT_FOUND that clients can switch on.
 type ErrorPayload struct {
-	Message string `json:"message"`
-	Error   string `json:"error"`
+	Message   string       `json:"message"`
+	Error     string       `json:"error"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
 }
 
 type CreateSuggestionParams struct {
-	Title   string `json:"title"`
-	Content string `json:"content"`
+	Title   string `json:"title" validate:"required,min=3,max=120"`
+	Content string `json:"content" validate:"required,max=5000"`
+	// Anonymity hides the author from other students, or from admins too.
+	Anonymity string `json:"anonymity" validate:"omitempty,oneof=students everyone" enums:"students,everyone"`
+}
+
+type EditSuggestionParams struct {
+	Title   string `json:"title" validate:"required,min=3,max=120"`
+	Content string `json:"content" validate:"required,max=5000"`
 }
 
 type StarSuggestionParams struct {
-	Star int `json:"star"`
+	Star int `json:"star" validate:"min=1,max=5"`
 }
 
 type WithReasonParams struct {
-	Reason string `json:"reason"`
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// ParseID parses the hex ObjectID given in the request input named field.
+func ParseID(field, hex string) (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return id, Validation("INVALID_ID", "Invalid "+field, FieldError{Field: field, Code: "objectid", Message: field + " must be a 24 character hex ObjectID"})
+	}
+	return id, nil
 }
@@ -0,0 +1,97 @@
+package library
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseStudentNumber(t *testing.T) {
+	tests := []struct {
+		username string
+		want     StudentNumber
+		ok       bool
+	}{
+		{"c2011011025", StudentNumber{Year: 20, Department: 11011, Sequence: 25}, true},
+		{"2011011025", StudentNumber{Year: 20, Department: 11011, Sequence: 25}, true},
+		{"C2011011025@student.example.edu.tr", StudentNumber{Year: 20, Department: 11011, Sequence: 25}, true},
+		{"ahmet.yilmaz", StudentNumber{}, false},
+		{"c20", StudentNumber{}, false},
+		{"", StudentNumber{}, false},
+		{"c20110110251", StudentNumber{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseStudentNumber(tt.username)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseStudentNumber(%q) = %+v, %v, want %+v, %v", tt.username, got, ok, tt.want, tt.ok)
+		}
+	}
+	if id := (&User{Username: "ab"}).GetDepartmentID(); id != 0 {
+		t.Errorf("GetDepartmentID of a short username = %d, want 0", id)
+	}
+}
+
+func TestDepartmentMapResolve(t *testing.T) {
+	m := NewDepartmentMap([]Department{
+		{Code: 11011, Faculty: 11, NameTR: "Bilgisayar Mühendisliği", NameEN: "Computer Engineering"},
+		{Code: 11012, Faculty: 11, NameTR: "Elektrik-Elektronik Mühendisliği", Aliases: []string{"EEE"}},
+	})
+	tests := []struct {
+		name   string
+		user   User
+		code   int
+		source string
+		ok     bool
+	}{
+		{"registered student number", User{Username: "c2011011025"}, 11011, DepartmentFromStudentNumber, true},
+		{"teacher by Turkish name", User{Username: "ahmet.yilmaz", DepartmentName: "BİLGİSAYAR MÜHENDİSLİĞİ BÖLÜMÜ"}, 11011, DepartmentFromPortal, true},
+		{"teacher by alias", User{Username: "ayse.kaya", Department_alt: "eee"}, 11012, DepartmentFromPortal, true},
+		{"unregistered code beats nothing", User{Username: "c2099999001"}, 99999, DepartmentFromStudentNumber, true},
+		{"unregistered code loses to name", User{Username: "c2099999001", DepartmentName: "Department of Computer Engineering"}, 11011, DepartmentFromPortal, true},
+		{"unknown teacher", User{Username: "mehmet", DepartmentName: "Rektörlük"}, 0, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, source, ok := m.Resolve(&tt.user)
+			if code != tt.code || source != tt.source || ok != tt.ok {
+				t.Fatalf("Resolve() = %d, %q, %v, want %d, %q, %v", code, source, ok, tt.code, tt.source, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAssignDepartmentKeepsAdminPins(t *testing.T) {
+	ctx := context.Background()
+	repos := NewMemoryRepositories()
+	if err := repos.Departments.PutFaculty(ctx, &Faculty{Code: 11, NameTR: "Mühendislik Fakültesi"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Departments.PutDepartment(ctx, &Department{Code: 11011, Faculty: 11, NameTR: "Bilgisayar Mühendisliği"}); err != nil {
+		t.Fatal(err)
+	}
+	teacher := User{Username: "ahmet.yilmaz", UserType: "teacher"}
+	if err := repos.Users.InsertToDB(ctx, &teacher); err != nil {
+		t.Fatal(err)
+	}
+	if teacher.Department != 0 || teacher.DepartmentSource != "" {
+		t.Fatalf("teacher inserted with department %d from %q", teacher.Department, teacher.DepartmentSource)
+	}
+	if err := repos.Users.UpdateProfile(ctx, &teacher, PersonalInfo{DepartmentName: "Bilgisayar Mühendisliği"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AssignDepartment(ctx, repos.Departments, repos.Users, &teacher); err != nil {
+		t.Fatal(err)
+	}
+	if teacher.Department != 11011 || teacher.FacultyCode != 11 || teacher.DepartmentSource != DepartmentFromPortal {
+		t.Fatalf("after AssignDepartment: %+v", teacher)
+	}
+
+	if err := repos.Users.SetDepartment(ctx, &teacher, 12001, 12, DepartmentFromAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if err := AssignDepartment(ctx, repos.Departments, repos.Users, &teacher); err != nil {
+		t.Fatal(err)
+	}
+	if teacher.Department != 12001 {
+		t.Fatalf("AssignDepartment replaced an admin pin: %+v", teacher)
+	}
+}
@@ -0,0 +1,54 @@
+package library
+
+import "testing"
+
+func TestProfileFor(t *testing.T) {
+	owner := User{
+		Username: "c2011011025", UserType: "student", Department: 11011,
+		FullName: "Ada Lovelace", Year: "3", Advisor: "Dr. Babbage", Rank: "1",
+		Privacy: Privacy{Advisor: VisibilityPrivate},
+	}
+	classmate := User{Username: "c2011011026", Department: 11011}
+	stranger := User{Username: "c2012011001", Department: 12011}
+	admin := User{Username: "t1000000001", Department: 1000000, Roles: []string{"teacher", "admin"}}
+
+	tests := []struct {
+		name                          string
+		viewer                        *User
+		fullName, year, advisor, rank string
+	}{
+		{"self", &owner, "Ada Lovelace", "3", "Dr. Babbage", "1"},
+		{"same department", &classmate, "Ada Lovelace", "3", "", ""},
+		{"other department", &stranger, "Ada Lovelace", "", "", ""},
+		{"admin", &admin, "Ada Lovelace", "3", "Dr. Babbage", "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := owner.ProfileFor(tt.viewer)
+			if p.FullName != tt.fullName || p.Year != tt.year || p.Advisor != tt.advisor || p.Rank != tt.rank {
+				t.Fatalf("got %+v", p)
+			}
+			if p.Username != owner.Username || p.Department != owner.Department {
+				t.Fatalf("always visible fields missing: %+v", p)
+			}
+		})
+	}
+}
+
+func TestProfileForUnknownDepartment(t *testing.T) {
+	owner := User{Username: "t1000000001", FullName: "Grace Hopper", Year: "3", Privacy: Privacy{FullName: VisibilityDepartment}}
+	viewer := User{Username: "t1000000002"}
+	if p := owner.ProfileFor(&viewer); p.FullName != "" || p.Year != "" {
+		t.Fatalf("users of unknown department see each other's department fields: %+v", p)
+	}
+}
+
+func TestPrivacyMerge(t *testing.T) {
+	p := Privacy{FullName: VisibilityPrivate}.Merge(Privacy{Rank: VisibilityPublic})
+	if p.FullName != VisibilityPrivate || p.Rank != VisibilityPublic || p.Year != "" {
+		t.Fatalf("Merge() = %+v", p)
+	}
+	if e := p.Effective(); e.Year != DefaultPrivacy.Year || e.FullName != VisibilityPrivate {
+		t.Fatalf("Effective() = %+v", e)
+	}
+}
@@ -0,0 +1,170 @@
+package library
+
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrorKind classifies domain errors so the HTTP layer can pick a status code
+// without knowing every code.
+type ErrorKind string
+
+const (
+	KindNotFound     ErrorKind = "not_found"
+	KindValidation   ErrorKind = "validation"
+	KindConflict     ErrorKind = "conflict"
+	KindForbidden    ErrorKind = "forbidden"
+	KindUnauthorized ErrorKind = "unauthorized"
+	KindUnavailable  ErrorKind = "unavailable"
+	KindRateLimited  ErrorKind = "rate_limited"
+	KindTooLarge     ErrorKind = "too_large"
+	KindUnsupported  ErrorKind = "unsupported"
+)
+
+// FieldError points at one invalid input field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is a domain error with a stable, machine readable Code such as
+// SUGGESTION_NOT_FOUND. Message is safe to show to users; Err keeps the
+// underlying cause for logs and errors.Is.
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Err.Error()
+	}
+	return e.Code
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches another *Error by Code, or by Kind when the target has no Code,
+// so errors.Is(err, ErrNotFound) holds for every not found error.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	if t.Code == "" {
+		return t.Kind == e.Kind
+	}
+	return t.Code == e.Code
+}
+
+var (
+	ErrNotFound     = &Error{Kind: KindNotFound}
+	ErrValidation   = &Error{Kind: KindValidation}
+	ErrConflict     = &Error{Kind: KindConflict}
+	ErrForbidden    = &Error{Kind: KindForbidden}
+	ErrUnauthorized = &Error{Kind: KindUnauthorized}
+	ErrUnavailable  = &Error{Kind: KindUnavailable}
+	ErrRateLimited  = &Error{Kind: KindRateLimited}
+	ErrTooLarge     = &Error{Kind: KindTooLarge}
+	ErrUnsupported  = &Error{Kind: KindUnsupported}
+)
+
+func NotFound(code, message string) *Error {
+	return &Error{Kind: KindNotFound, Code: code, Message: message}
+}
+
+func Validation(code, message string, fields ...FieldError) *Error {
+	return &Error{Kind: KindValidation, Code: code, Message: message, Fields: fields}
+}
+
+func Conflict(code, message string) *Error {
+	return &Error{Kind: KindConflict, Code: code, Message: message}
+}
+
+func Forbidden(code, message string) *Error {
+	return &Error{Kind: KindForbidden, Code: code, Message: message}
+}
+
+func Unauthorized(code, message string) *Error {
+	return &Error{Kind: KindUnauthorized, Code: code, Message: message}
+}
+
+func Unavailable(code, message string) *Error {
+	return &Error{Kind: KindUnavailable, Code: code, Message: message}
+}
+
+func RateLimited(code, message string) *Error {
+	return &Error{Kind: KindRateLimited, Code: code, Message: message}
+}
+
+func TooLarge(code, message string) *Error {
+	return &Error{Kind: KindTooLarge, Code: code, Message: message}
+}
+
+// Unsupported is an error about content of a type that is not accepted.
+func Unsupported(code, message string) *Error {
+	return &Error{Kind: KindUnsupported, Code: code, Message: message}
+}
+
+// Wrap returns a copy of e carrying err as its cause.
+func (e *Error) Wrap(err error) *Error {
+	wrapped := *e
+	wrapped.Err = err
+	return &wrapped
+}
+
+// ErrorCode returns the stable code of err, or "" when it is not an *Error.
+func ErrorCode(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
+
+// notFound turns a missing document into the given not found error and
+// passes every other error through.
+func notFound(err error, e *Error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return e.Wrap(err)
+	}
+	return err
+}
+
+// conflict turns a duplicate key error into the given conflict error and
+// passes every other error through.
+func conflict(err error, e *Error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return e.Wrap(err)
+	}
+	return err
+}
+
+var (
+	errUserNotFound       = NotFound("USER_NOT_FOUND", "User not found")
+	errUserExists         = Conflict("USER_EXISTS", "User already exists")
+	errUserTypeMismatch   = Conflict("USER_TYPE_MISMATCH", "The user exists with another user type")
+	errSuggestionNotFound = NotFound("SUGGESTION_NOT_FOUND", "Suggestion not found")
+	errAlreadyRejected    = Conflict("SUGGESTION_ALREADY_REJECTED", "Suggestion has already been rejected")
+	errAlreadyApproved    = Conflict("SUGGESTION_ALREADY_APPROVED", "Suggestion has already been approved")
+	errAlreadyReported    = Conflict("SUGGESTION_ALREADY_REPORTED", "Suggestion has already been reported")
+	errNotEditable        = Conflict("SUGGESTION_NOT_EDITABLE", "Only pending suggestions can be edited")
+	errProjectNotFound    = NotFound("PROJECT_NOT_FOUND", "Project not found")
+	errProjectExists      = Conflict("PROJECT_EXISTS", "A project already exists for this suggestion")
+	errEventNotFound      = NotFound("EVENT_NOT_FOUND", "Event not found")
+	errCirriculumNotFound = NotFound("CURRICULUM_NOT_FOUND", "Curriculum not found")
+	errSurveyJobNotFound  = NotFound("JOB_NOT_FOUND", "Job not found")
+	errSurveyJobExists    = Conflict("JOB_EXISTS", "A job with this idempotency key already exists")
+	errDepartmentNotFound = NotFound("DEPARTMENT_NOT_FOUND", "Department not found")
+	errFacultyNotFound    = NotFound("FACULTY_NOT_FOUND", "Faculty not found")
+	errRoleNotFound       = NotFound("ROLE_NOT_FOUND", "Role not found")
+	errRoleReserved       = Validation("ROLE_RESERVED", "Student and teacher follow from the account and cannot be registered as roles")
+	errSelfRevoke         = Forbidden("ROLE_SELF_REVOKE", "You cannot revoke your own admin role")
+)
@@ -0,0 +1,132 @@
+package library
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestReadImport(t *testing.T) {
+	rows, err := ReadImport[EventRow](strings.NewReader("\ufeffTitle,start_time,type\n" +
+		"\"Career day,\n2024\",2024-03-01T10:00:00+03:00,fair\n" +
+		"Talk, 2024-03-02T10:00:00Z ,talk\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Line != 2 || rows[0].Value.Title != "Career day,\n2024" || rows[1].Line != 4 || rows[1].Value.StartTime != "2024-03-02T10:00:00Z" {
+		t.Fatalf("rows = %+v", rows)
+	}
+	for name, file := range map[string]string{
+		"empty":          "",
+		"unknown column": "title,start_time,type,colour\n",
+		"missing type":   "title,start_time\n",
+		"ragged":         "title,start_time,type\nTalk\n",
+	} {
+		if _, err := ReadImport[EventRow](strings.NewReader(file)); ErrorCode(err) != "INVALID_CSV" {
+			t.Errorf("%s: got %v, want INVALID_CSV", name, err)
+		}
+	}
+}
+
+func TestImportEvents(t *testing.T) {
+	ctx := context.Background()
+	events := NewMemoryEventRepository()
+	organizer := User{Username: "t1000000001", FullName: "Ayşe Yılmaz"}
+	read := func(file string) []ImportRow[EventRow] {
+		t.Helper()
+		rows, err := ReadImport[EventRow](strings.NewReader("key,title,start_time,end_time,type,tags\n" + file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+	file := "fair,Career day,2024-03-01T10:00:00+03:00,,fair,\"career, jobs\"\n" +
+		",Talk,2024-03-02T10:00:00Z,2024-03-02T11:00:00Z,talk,\n"
+
+	bad := read(file + ",Workshop,yesterday,,workshop,\n,Talk,2024-03-02T10:00:00Z,2024-03-02T09:00:00Z,talk,\nfair,Fair again,2024-04-01T10:00:00Z,,fair,\n")
+	report, err := ImportEvents(ctx, events, organizer, bad, false)
+	if err != nil || report.Applied || report.Failed != 3 || len(report.Errors) != 3 {
+		t.Fatalf("invalid rows: %+v, %v", report, err)
+	}
+	if e := report.Errors[0]; e.Row != 4 || e.Field != "start_time" {
+		t.Fatalf("first error = %+v", e)
+	}
+	if e := report.Errors[2]; e.Row != 6 || e.Code != "unique" {
+		t.Fatalf("duplicate key error = %+v", e)
+	}
+	if all, _ := events.GetPendingEvents(ctx); len(all) != 0 {
+		t.Fatalf("invalid import wrote %d events", len(all))
+	}
+
+	if report, err := ImportEvents(ctx, events, organizer, read(file), true); err != nil || report.Applied || report.Failed != 0 || report.Created != 0 {
+		t.Fatalf("dry run: %+v, %v", report, err)
+	}
+	if report, err := ImportEvents(ctx, events, organizer, read(file), false); err != nil || !report.Applied || report.Created != 2 {
+		t.Fatalf("import: %+v, %v", report, err)
+	}
+	if report, err := ImportEvents(ctx, events, organizer, read(file), false); err != nil || report.Unchanged != 2 || report.Created != 0 {
+		t.Fatalf("same import again: %+v, %v", report, err)
+	}
+	changed := strings.Replace(file, "Career day", "Career days", 1)
+	if report, err := ImportEvents(ctx, events, organizer, read(changed), false); err != nil || report.Updated != 1 || report.Unchanged != 1 {
+		t.Fatalf("renamed keyed event: %+v, %v", report, err)
+	}
+	all, _ := events.GetAllEvents(ctx)
+	if len(all) != 2 || all[0].Title != "Career days" || all[0].Status != "approved" || all[0].Author != "Ayşe Yılmaz" || len(all[0].Tags) != 2 {
+		t.Fatalf("events = %+v", all)
+	}
+}
+
+func TestImportUsers(t *testing.T) {
+	ctx := context.Background()
+	users, roles := NewMemoryUserRepository(), NewMemoryRoleRepository()
+	if err := roles.EnsureRoles(ctx, DefaultRoles()); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.InsertToDB(ctx, &User{Username: "t1000000001", UserType: "teacher", FullName: "Ayşe Yılmaz"}); err != nil {
+		t.Fatal(err)
+	}
+	read := func(file string) []ImportRow[UserRow] {
+		t.Helper()
+		rows, err := ReadImport[UserRow](strings.NewReader("username,user_type,full_name,roles\n" + file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+
+	report, err := ImportUsers(ctx, users, roles, "t1000000002", read("2011011025@ogr.example.edu,student,,root\nmehmet,student,,\n"), true)
+	if err != nil || report.Failed != 2 || report.Errors[0].Code != "registered" || report.Errors[1].Field != "username" {
+		t.Fatalf("invalid rows: %+v, %v", report, err)
+	}
+
+	file := "2011011025@ogr.example.edu,student,Can Demir,\"admin\"\nt1000000001,teacher,,haysev_admin\n"
+	if report, err := ImportUsers(ctx, users, roles, "t1000000002", read(file), false); err != nil || report.Created != 1 || report.Updated != 1 {
+		t.Fatalf("import: %+v, %v", report, err)
+	}
+	if report, err := ImportUsers(ctx, users, roles, "t1000000002", read(file), false); err != nil || report.Unchanged != 2 {
+		t.Fatalf("same import again: %+v, %v", report, err)
+	}
+	log, err := roles.GetChanges(ctx, RoleChangeQuery{Actor: "t1000000002"})
+	if err != nil || log.Total != 2 {
+		t.Fatalf("role changes of the import = %+v, %v, want one per user", log, err)
+	}
+	for _, c := range log.Items {
+		if want := map[string]string{"c2011011025": RoleAdmin, "t1000000001": RoleHaysevAdmin}[c.Target]; len(c.Granted) != 1 || c.Granted[0] != want {
+			t.Fatalf("role change %+v, want %s granted", c, want)
+		}
+	}
+	student, err := users.GetUser(ctx, "c2011011025")
+	if err != nil || student.FullName != "Can Demir" || !student.HasRole(RoleAdmin) || !student.HasRole("student") || student.Department != 11011 {
+		t.Fatalf("imported student = %+v, %v", student, err)
+	}
+	teacher, err := users.GetUser(ctx, "t1000000001")
+	if err != nil || teacher.FullName != "Ayşe Yılmaz" || !teacher.HasRole(RoleHaysevAdmin) {
+		t.Fatalf("existing teacher = %+v, %v", teacher, err)
+	}
+
+	report, err = ImportUsers(ctx, users, roles, "t1000000002", read("c2011011025,teacher,,\n"), false)
+	if err != nil || report.Failed != 1 || report.Errors[0].Code != "USER_TYPE_MISMATCH" {
+		t.Fatalf("student imported as a teacher: %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,69 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseMarkdown(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserRepository()
+	if err := users.InsertToDB(ctx, &User{Username: "c2011011025", UserType: "student"}); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := ParseMarkdown(ctx, users, "content", "Benches for the **garden**, ask @c2011011025 or @ghost.\n"+
+		"See #Garden and #garden-benches, not #1, ada@example.com or `#code`.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<strong>garden</strong>`,
+		`<a href="/users/c2011011025" class="mention" rel="nofollow">@c2011011025</a> or @ghost.<br>`,
+		`<a href="/suggestions?tag=garden" class="tag" rel="nofollow">#Garden</a>`,
+		`<a href="/suggestions?tag=garden-benches" class="tag" rel="nofollow">#garden-benches</a>`,
+		`not #1, <a href="mailto:ada@example.com" rel="nofollow">ada@example.com</a>`,
+		`<code>#code</code>`,
+	} {
+		if !strings.Contains(m.HTML, want) {
+			t.Errorf("rendered %s\nwithout %s", m.HTML, want)
+		}
+	}
+	if !slices.Equal(m.Mentions, []string{"c2011011025"}) || !slices.Equal(m.Tags, []string{"garden", "garden-benches"}) {
+		t.Errorf("mentions %v and tags %v", m.Mentions, m.Tags)
+	}
+
+	m, err = ParseMarkdown(ctx, users, "content", `<script>alert(1)</script><img src=x onerror=alert(1)> [click](javascript:alert(1)) [#inside @c2011011025](/x)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, banned := range []string{"<script", "<img", "onerror", "javascript:", `class="tag"`, `class="mention"`} {
+		if strings.Contains(m.HTML, banned) {
+			t.Errorf("rendered %s\nwith %s", m.HTML, banned)
+		}
+	}
+	if len(m.Mentions) != 0 || len(m.Tags) != 0 {
+		t.Errorf("mentions %v and tags %v in link text", m.Mentions, m.Tags)
+	}
+
+	if _, err := ParseMarkdown(ctx, users, "content", strings.Repeat(">", 40)+" deep"); ErrorCode(err) != "CONTENT_TOO_COMPLEX" {
+		t.Errorf("deeply nested quote: %v", err)
+	}
+	if _, err := ParseMarkdown(ctx, users, "content", strings.Repeat("*a* ", 1500)); ErrorCode(err) != "CONTENT_TOO_COMPLEX" {
+		t.Errorf("heavily formatted text: %v", err)
+	}
+	var crowd strings.Builder
+	for i := 0; i <= maxMentions; i++ {
+		crowd.WriteString("@user" + strings.Repeat("x", i) + " ")
+	}
+	if _, err := ParseMarkdown(ctx, users, "content", crowd.String()); !errors.Is(err, ErrValidation) || ErrorCode(err) != "TOO_MANY_MENTIONS" {
+		t.Errorf("too many mentions: %v", err)
+	}
+
+	if html := RenderMarkdown("Old @c2011011025 #notes"); strings.Contains(html, "mention") || !strings.Contains(html, `class="tag"`) {
+		t.Errorf("stored text rendered %s", html)
+	}
+}
@@ -0,0 +1,1496 @@
+package library
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memoryCollection keeps BSON encoded documents in insertion order, so reads
+// decode exactly what Mongo would hand back and callers never share slices
+// with the store.
+type memoryCollection[T any] struct {
+	mu   sync.RWMutex
+	keys []string
+	docs map[string][]byte
+	// unique, when set, returns the key of doc in a unique partial index;
+	// documents it returns "" for are left out of the index.
+	unique func(doc T) string
+}
+
+func newMemoryCollection[T any]() *memoryCollection[T] {
+	return &memoryCollection[T]{docs: map[string][]byte{}}
+}
+
+// newUniqueMemoryCollection returns a collection that refuses to insert a
+// document whose unique key another document already has.
+func newUniqueMemoryCollection[T any](unique func(doc T) string) *memoryCollection[T] {
+	c := newMemoryCollection[T]()
+	c.unique = unique
+	return c
+}
+
+func duplicateKeyError() error {
+	return mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000 duplicate key error"}}}
+}
+
+func (c *memoryCollection[T]) insert(key string, doc T) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.docs[key]; ok {
+		return duplicateKeyError()
+	}
+	if c.unique != nil && c.unique(doc) != "" {
+		for _, raw := range c.docs {
+			var other T
+			if err := bson.Unmarshal(raw, &other); err != nil {
+				return err
+			}
+			if c.unique(other) == c.unique(doc) {
+				return duplicateKeyError()
+			}
+		}
+	}
+	c.keys = append(c.keys, key)
+	c.docs[key] = raw
+	return nil
+}
+
+// get decodes the stored document into out, leaving fields it does not carry
+// untouched like Decode does.
+func (c *memoryCollection[T]) get(key string, out *T) error {
+	c.mu.RLock()
+	raw, ok := c.docs[key]
+	c.mu.RUnlock()
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	return bson.Unmarshal(raw, out)
+}
+
+// update applies fn to the stored document atomically. It reports whether
+// the document existed; a missing document is not an error, as with UpdateOne.
+func (c *memoryCollection[T]) update(key string, fn func(doc *T)) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	raw, ok := c.docs[key]
+	if !ok {
+		return false, nil
+	}
+	var doc T
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return true, err
+	}
+	fn(&doc)
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return true, err
+	}
+	c.docs[key] = raw
+	return true, nil
+}
+
+func (c *memoryCollection[T]) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.docs[key]; !ok {
+		return
+	}
+	delete(c.docs, key)
+	for i, k := range c.keys {
+		if k == key {
+			c.keys = append(c.keys[:i], c.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+func (c *memoryCollection[T]) find(match func(doc T) bool) ([]T, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := []T{}
+	for _, key := range c.keys {
+		var doc T
+		if err := bson.Unmarshal(c.docs[key], &doc); err != nil {
+			return out, err
+		}
+		if match == nil || match(doc) {
+			out = append(out, doc)
+		}
+	}
+	return out, nil
+}
+
+type memoryUserRepository struct {
+	users *memoryCollection[User]
+}
+
+func NewMemoryUserRepository() UserRepository {
+	return &memoryUserRepository{users: newMemoryCollection[User]()}
+}
+
+func (r *memoryUserRepository) InsertToDB(ctx context.Context, u *User) error {
+	if err := u.prepareInsert(); err != nil {
+		return err
+	}
+	if err := r.users.insert(u.Username, *u); err != nil {
+		return conflict(err, errUserExists)
+	}
+	return notFound(r.users.get(u.Username, u), errUserNotFound)
+}
+
+func (r *memoryUserRepository) ImportUser(ctx context.Context, u *User) (UpsertResult, error) {
+	if err := u.prepareInsert(); err != nil {
+		return UpsertUnchanged, err
+	}
+	result, mismatch := UpsertUnchanged, false
+	found, err := r.users.update(u.Username, func(doc *User) {
+		if doc.UserType != u.UserType {
+			mismatch = true
+			return
+		}
+		before := *doc
+		if u.FullName != "" {
+			doc.FullName = u.FullName
+		}
+		doc.Roles = addRoles(doc.Roles, u.Roles...)
+		if changed(before, *doc) {
+			result = UpsertUpdated
+		}
+	})
+	if err != nil {
+		return result, err
+	}
+	if mismatch {
+		return result, errUserTypeMismatch
+	}
+	if !found {
+		if err := r.users.insert(u.Username, *u); err != nil {
+			return result, conflict(err, errUserTypeMismatch)
+		}
+		result = UpsertCreated
+	}
+	return result, notFound(r.users.get(u.Username, u), errUserNotFound)
+}
+
+func (r *memoryUserRepository) GrantRoles(ctx context.Context, u *User, roles []string) error {
+	return r.updateRoles(u, func(doc *User) { doc.Roles = addRoles(doc.Roles, roles...) })
+}
+
+func (r *memoryUserRepository) RevokeRoles(ctx context.Context, u *User, roles []string) error {
+	return r.updateRoles(u, func(doc *User) { doc.Roles = removeRoles(doc.Roles, roles...) })
+}
+
+func (r *memoryUserRepository) updateRoles(u *User, fn func(doc *User)) error {
+	found, err := r.users.update(u.Username, fn)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errUserNotFound.Wrap(mongo.ErrNoDocuments)
+	}
+	return notFound(r.users.get(u.Username, u), errUserNotFound)
+}
+
+func (r *memoryUserRepository) FindUser(ctx context.Context, u *User) error {
+	var doc User
+	if err := r.users.get(u.Username, &doc); err != nil {
+		return notFound(err, errUserNotFound)
+	}
+	if doc.UserType != u.UserType {
+		return errUserNotFound.Wrap(mongo.ErrNoDocuments)
+	}
+	return notFound(r.users.get(u.Username, u), errUserNotFound)
+}
+
+func (r *memoryUserRepository) UpdateProfile(ctx context.Context, u *User, info PersonalInfo) error {
+	if _, err := r.users.update(u.Username, func(doc *User) {
+		doc.FullName = info.FullName
+		doc.Year = info.Year
+		doc.Department_alt = info.Department_alt
+		doc.DepartmentName = info.DepartmentName
+		doc.Faculty = info.Faculty
+		doc.Advisor = info.Advisor
+		doc.Cirriculum = info.Cirriculum
+		doc.Rank = info.Rank
+		doc.ProfileSyncedAt = primitive.NewDateTimeFromTime(time.Now())
+	}); err != nil {
+		return err
+	}
+	return notFound(r.users.get(u.Username, u), errUserNotFound)
+}
+
+func (r *memoryUserRepository) SetDepartment(ctx context.Context, u *User, department, faculty int, source string) error {
+	found, err := r.users.update(u.Username, func(doc *User) {
+		doc.Department = department
+		doc.FacultyCode = faculty
+		doc.DepartmentSource = source
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errUserNotFound.Wrap(mongo.ErrNoDocuments)
+	}
+	return notFound(r.users.get(u.Username, u), errUserNotFound)
+}
+
+func (r *memoryUserRepository) GetUser(ctx context.Context, id string) (User, error) {
+	var user User
+	err := r.users.get(id, &user)
+	return user, notFound(err, errUserNotFound)
+}
+
+func (r *memoryUserRepository) SearchUsers(ctx context.Context, q UserQuery) (Page[User], error) {
+	users, err := r.users.find(q.matches)
+	if err != nil {
+		return Page[User]{}, err
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return paginate(users, q.PageQuery), nil
+}
+
+func (r *memoryUserRepository) UpdatePrivacy(ctx context.Context, u *User, p Privacy) error {
+	found, err := r.users.update(u.Username, func(doc *User) {
+		doc.Privacy = p
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errUserNotFound.Wrap(mongo.ErrNoDocuments)
+	}
+	return notFound(r.users.get(u.Username, u), errUserNotFound)
+}
+
+func (r *memoryUserRepository) StaleProfiles(ctx context.Context, before time.Time, limit int) ([]User, error) {
+	users, err := r.users.find(func(u User) bool {
+		return u.ProfileSyncedAt.Time().Before(before)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(users, func(i, j int) bool { return users[i].ProfileSyncedAt < users[j].ProfileSyncedAt })
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+type memorySuggestionRepository struct {
+	suggestions *memoryCollection[Suggestion]
+	rejections  *memoryCollection[Rejection]
+	approvals   *memoryCollection[Approval]
+	reports     *memoryCollection[Report]
+	// deanonymizations is the audit log of revealed authors.
+	deanonymizations *memoryCollection[Deanonymization]
+}
+
+func NewMemorySuggestionRepository() SuggestionRepository {
+	return &memorySuggestionRepository{
+		suggestions:      newMemoryCollection[Suggestion](),
+		rejections:       newMemoryCollection[Rejection](),
+		approvals:        newMemoryCollection[Approval](),
+		reports:          newMemoryCollection[Report](),
+		deanonymizations: newMemoryCollection[Deanonymization](),
+	}
+}
+
+func (r *memorySuggestionRepository) WithID(ctx context.Context, s *Suggestion, id string) error {
+	objID, _ := primitive.ObjectIDFromHex(id)
+	return notFound(r.suggestions.get(objID.Hex(), s), errSuggestionNotFound)
+}
+
+func (r *memorySuggestionRepository) InsertToDB(ctx context.Context, s *Suggestion) error {
+	s.prepareInsert()
+	if s.ID.IsZero() {
+		s.ID = primitive.NewObjectID()
+	}
+	if err := r.suggestions.insert(s.ID.Hex(), *s); err != nil {
+		return err
+	}
+	return notFound(r.suggestions.get(s.ID.Hex(), s), errSuggestionNotFound)
+}
+
+func (r *memorySuggestionRepository) Edit(ctx context.Context, s *Suggestion, title string, content Markdown) error {
+	editable := false
+	if _, err := r.suggestions.update(s.ID.Hex(), func(doc *Suggestion) {
+		if doc.Status == "pending" {
+			doc.Title = title
+			doc.SetContent(content)
+			editable = true
+		}
+	}); err != nil {
+		return err
+	}
+	if err := notFound(r.suggestions.get(s.ID.Hex(), s), errSuggestionNotFound); err != nil {
+		return err
+	}
+	if !editable {
+		return errNotEditable
+	}
+	return nil
+}
+
+func (r *memorySuggestionRepository) Vote(ctx context.Context, s *Suggestion, userID string, kind VoteKind) error {
+	return r.vote(s, userID, kind, false)
+}
+
+func (r *memorySuggestionRepository) Unvote(ctx context.Context, s *Suggestion, userID string, kind VoteKind) error {
+	return r.vote(s, userID, kind, true)
+}
+
+func (r *memorySuggestionRepository) vote(s *Suggestion, userID string, kind VoteKind, retract bool) error {
+	if _, err := r.suggestions.update(s.ID.Hex(), func(doc *Suggestion) {
+		doc.cast(userID, kind, retract)
+		doc.rank(time.Now())
+	}); err != nil {
+		return err
+	}
+	return notFound(r.suggestions.get(s.ID.Hex(), s), errSuggestionNotFound)
+}
+
+func (r *memorySuggestionRepository) GetVoters(ctx context.Context, id primitive.ObjectID, q VoterQuery) (Page[Voter], error) {
+	var s Suggestion
+	if err := r.suggestions.get(id.Hex(), &s); err != nil {
+		return Page[Voter]{}, notFound(err, errSuggestionNotFound)
+	}
+	return s.voters(q), nil
+}
+
+func (r *memorySuggestionRepository) CountVotes(ctx context.Context) error {
+	return countMemoryVotes(r.suggestions, func(s *Suggestion) *Votes { return &s.Votes })
+}
+
+func (r *memorySuggestionRepository) GiveStar(ctx context.Context, s *Suggestion, userID string, star int) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := r.suggestions.update(s.ID.Hex(), func(doc *Suggestion) {
+		defer doc.rank(time.Now())
+		for i := range doc.Stars {
+			if doc.Stars[i].UserID == userID {
+				doc.Stars[i].Star = float64(star)
+				doc.Stars[i].Date = now
+				return
+			}
+		}
+		doc.Stars = append(doc.Stars, struct {
+			UserID string  `json:"userID" bson:"userID"`
+			Star   float64 `json:"star" bson:"star"`
+			Date   string  `json:"date" bson:"date"`
+		}{UserID: userID, Star: float64(star), Date: now})
+	}); err != nil {
+		return err
+	}
+	return notFound(r.suggestions.get(s.ID.Hex(), s), errSuggestionNotFound)
+}
+
+// decide sets the status of s once its decision is recorded, dropping the
+// decision again with undo when s does not exist.
+func (r *memorySuggestionRepository) decide(s *Suggestion, status string, undo func()) error {
+	if err := r.setStatus(s, status); err != nil {
+		undo()
+		return err
+	}
+	return nil
+}
+
+func (r *memorySuggestionRepository) setStatus(s *Suggestion, status string) error {
+	if _, err := r.suggestions.update(s.ID.Hex(), func(doc *Suggestion) {
+		doc.Status = status
+	}); err != nil {
+		return err
+	}
+	return notFound(r.suggestions.get(s.ID.Hex(), s), errSuggestionNotFound)
+}
+
+func (r *memorySuggestionRepository) Reject(ctx context.Context, s *Suggestion, executorID string, reason string) error {
+	rejection := Rejection{
+		ID:         s.ID,
+		Reason:     reason,
+		ExecutorID: executorID,
+		Date:       time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := r.rejections.insert(s.ID.Hex(), rejection); err != nil {
+		return conflict(err, errAlreadyRejected)
+	}
+	return r.decide(s, "rejected", func() { r.rejections.delete(s.ID.Hex()) })
+}
+
+func (r *memorySuggestionRepository) Approve(ctx context.Context, s *Suggestion, executorID string) error {
+	approval := Approval{
+		ID:         s.ID,
+		ExecutorID: executorID,
+		Date:       time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := r.approvals.insert(s.ID.Hex(), approval); err != nil {
+		return conflict(err, errAlreadyApproved)
+	}
+	return r.decide(s, "approved", func() { r.approvals.delete(s.ID.Hex()) })
+}
+
+func (r *memorySuggestionRepository) Report(ctx context.Context, s *Suggestion, executorID string) error {
+	report := Report{
+		ID:         s.ID,
+		ExecutorID: executorID,
+		Date:       time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := r.reports.insert(s.ID.Hex(), report); err != nil {
+		return conflict(err, errAlreadyReported)
+	}
+	return r.decide(s, "reported", func() { r.reports.delete(s.ID.Hex()) })
+}
+
+func (r *memorySuggestionRepository) withStatus(status string) ([]Suggestion, error) {
+	return r.suggestions.find(func(s Suggestion) bool {
+		return status == "" || s.Status == status
+	})
+}
+
+func (r *memorySuggestionRepository) GetRejectedSuggestions(ctx context.Context) ([]Suggestion, error) {
+	return r.withStatus("rejected")
+}
+
+func (r *memorySuggestionRepository) GetApprovedSuggestions(ctx context.Context) ([]Suggestion, error) {
+	return r.withStatus("approved")
+}
+
+func (r *memorySuggestionRepository) GetRankedSuggestions(ctx context.Context, q RankingQuery) ([]Suggestion, error) {
+	since := q.Since(time.Now())
+	suggestions, err := r.suggestions.find(func(s Suggestion) bool {
+		return s.Status == "approved" && (since.IsZero() || s.Date >= since.Format(time.RFC3339)) &&
+			(q.Tag == "" || slices.Contains(s.Tags, strings.ToLower(q.Tag)))
+	})
+	sortRanked(suggestions, q)
+	return suggestions, err
+}
+
+func (r *memorySuggestionRepository) Rank(ctx context.Context) error {
+	now := time.Now()
+	suggestions, err := r.withStatus("approved")
+	if err != nil {
+		return err
+	}
+	for _, s := range suggestions {
+		if _, err := r.suggestions.update(s.ID.Hex(), func(doc *Suggestion) { doc.rank(now) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memorySuggestionRepository) GetAllSuggestions(ctx context.Context) ([]Suggestion, error) {
+	return r.withStatus("")
+}
+
+func (r *memorySuggestionRepository) GetPendingSuggestions(ctx context.Context) ([]Suggestion, error) {
+	return r.withStatus("pending")
+}
+
+func (r *memorySuggestionRepository) GetReportedSuggestions(ctx context.Context) ([]Suggestion, error) {
+	return r.withStatus("reported")
+}
+
+func (r *memorySuggestionRepository) GetAuthorSuggestions(ctx context.Context, authors []string) ([]Suggestion, error) {
+	suggestions, err := r.suggestions.find(func(s Suggestion) bool {
+		return slices.Contains(authors, s.AuthorID)
+	})
+	for i, j := 0, len(suggestions)-1; i < j; i, j = i+1, j-1 {
+		suggestions[i], suggestions[j] = suggestions[j], suggestions[i]
+	}
+	return suggestions, err
+}
+
+func (r *memorySuggestionRepository) LogDeanonymization(ctx context.Context, d *Deanonymization) error {
+	d.ID = primitive.NewObjectID()
+	d.At = primitive.NewDateTimeFromTime(time.Now())
+	return r.deanonymizations.insert(d.ID.Hex(), *d)
+}
+
+func (r *memorySuggestionRepository) GetDeanonymizations(ctx context.Context, q PageQuery) (Page[Deanonymization], error) {
+	log, err := r.deanonymizations.find(nil)
+	if err != nil {
+		return Page[Deanonymization]{}, err
+	}
+	for i, j := 0, len(log)-1; i < j; i, j = i+1, j-1 {
+		log[i], log[j] = log[j], log[i]
+	}
+	return paginate(log, q), nil
+}
+
+type memoryProjectRepository struct {
+	projects *memoryCollection[Project]
+}
+
+func NewMemoryProjectRepository() ProjectRepository {
+	return &memoryProjectRepository{projects: newMemoryCollection[Project]()}
+}
+
+func (r *memoryProjectRepository) CreateFrom(ctx context.Context, p *Project, s Suggestion) error {
+	if err := p.fromSuggestion(s); err != nil {
+		return err
+	}
+	if err := r.projects.insert(p.ID.Hex(), *p); err != nil {
+		return conflict(err, errProjectExists)
+	}
+	return notFound(r.projects.get(p.ID.Hex(), p), errProjectNotFound)
+}
+
+func (r *memoryProjectRepository) Vote(ctx context.Context, p *Project, userID string, kind VoteKind) error {
+	return r.vote(p, userID, kind, false)
+}
+
+func (r *memoryProjectRepository) Unvote(ctx context.Context, p *Project, userID string, kind VoteKind) error {
+	return r.vote(p, userID, kind, true)
+}
+
+func (r *memoryProjectRepository) vote(p *Project, userID string, kind VoteKind, retract bool) error {
+	if _, err := r.projects.update(p.ID.Hex(), func(doc *Project) {
+		doc.cast(userID, kind, retract)
+	}); err != nil {
+		return err
+	}
+	return notFound(r.projects.get(p.ID.Hex(), p), errProjectNotFound)
+}
+
+func (r *memoryProjectRepository) CountVotes(ctx context.Context) error {
+	return countMemoryVotes(r.projects, func(p *Project) *Votes { return &p.Votes })
+}
+
+// countMemoryVotes recomputes the vote counters of every document in c.
+func countMemoryVotes[T any](c *memoryCollection[T], votes func(*T) *Votes) error {
+	c.mu.RLock()
+	keys := append([]string(nil), c.keys...)
+	c.mu.RUnlock()
+	for _, key := range keys {
+		if _, err := c.update(key, func(doc *T) { votes(doc).count() }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryProjectRepository) RenderMarkdown(ctx context.Context) error {
+	return renderMemoryMarkdown(r.projects, func(p *Project) (string, *string) { return p.Content, &p.ContentHTML })
+}
+
+// renderMemoryMarkdown fills in the HTML of every document in c whose
+// Markdown source is stored without it.
+func renderMemoryMarkdown[T any](c *memoryCollection[T], fields func(*T) (source string, html *string)) error {
+	c.mu.RLock()
+	keys := append([]string(nil), c.keys...)
+	c.mu.RUnlock()
+	for _, key := range keys {
+		if _, err := c.update(key, func(doc *T) {
+			if source, html := fields(doc); source != "" && *html == "" {
+				*html = RenderMarkdown(source)
+			}
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryProjectRepository) AddStar(ctx context.Context, p *Project, userID string, star float64) error {
+	starObj := struct {
+		UserID string  `json:"userID" bson:"userID"`
+		Star   float64 `json:"star" bson:"star"`
+		Date   string  `json:"date" bson:"date"`
+	}{
+		UserID: userID,
+		Star:   star,
+		Date:   p.Date,
+	}
+	if _, err := r.projects.update(p.ID.Hex(), func(doc *Project) {
+		for _, existing := range doc.Stars {
+			if existing == starObj {
+				return
+			}
+		}
+		doc.Stars = append(doc.Stars, starObj)
+	}); err != nil {
+		return err
+	}
+	return notFound(r.projects.get(p.ID.Hex(), p), errProjectNotFound)
+}
+
+func (r *memoryProjectRepository) GetProject(ctx context.Context, p *Project) error {
+	return notFound(r.projects.get(p.ID.Hex(), p), errProjectNotFound)
+}
+
+func (r *memoryProjectRepository) GetAllProjects(ctx context.Context) ([]Project, error) {
+	return r.projects.find(nil)
+}
+
+type memoryEventRepository struct {
+	events *memoryCollection[Event]
+}
+
+func NewMemoryEventRepository() EventRepository {
+	return &memoryEventRepository{events: newUniqueMemoryCollection(func(e Event) string { return e.ImportKey })}
+}
+
+func (r *memoryEventRepository) ImportEvent(ctx context.Context, e *Event) (UpsertResult, error) {
+	if err := e.prepareImport(); err != nil {
+		return UpsertUnchanged, err
+	}
+	found, err := r.events.find(func(doc Event) bool { return doc.ImportKey == e.ImportKey })
+	if err != nil {
+		return UpsertUnchanged, err
+	}
+	if len(found) == 0 {
+		stored := Event{ID: primitive.NewObjectID(), Status: "approved", CreatedAt: primitive.NewDateTimeFromTime(time.Now())}
+		e.imported(&stored)
+		err := r.events.insert(stored.ID.Hex(), stored)
+		if mongo.IsDuplicateKeyError(err) {
+			// A concurrent import created it first; update that one, as
+			// Mongo retries an upsert.
+			return r.ImportEvent(ctx, e)
+		}
+		if err != nil {
+			return UpsertUnchanged, err
+		}
+		return UpsertCreated, notFound(r.events.get(stored.ID.Hex(), e), errEventNotFound)
+	}
+	stored := found[0]
+	result := UpsertUnchanged
+	if _, err := r.events.update(stored.ID.Hex(), func(doc *Event) {
+		before := *doc
+		e.imported(doc)
+		if changed(before, *doc) {
+			result = UpsertUpdated
+		}
+	}); err != nil {
+		return result, err
+	}
+	return result, notFound(r.events.get(stored.ID.Hex(), e), errEventNotFound)
+}
+
+func (r *memoryEventRepository) CreateEvent(ctx context.Context, e *Event) error {
+	if err := e.prepareInsert(); err != nil {
+		return err
+	}
+	if e.ID.IsZero() {
+		e.ID = primitive.NewObjectID()
+	}
+	if err := r.events.insert(e.ID.Hex(), *e); err != nil {
+		return err
+	}
+	return notFound(r.events.get(e.ID.Hex(), e), errEventNotFound)
+}
+
+func (r *memoryEventRepository) GetEvents(ctx context.Context, u *User) ([]Event, error) {
+	return r.events.find(func(e Event) bool {
+		return e.OrganizerID == u.Username
+	})
+}
+
+func (r *memoryEventRepository) GetEvent(ctx context.Context, e *Event) error {
+	return notFound(r.events.get(e.ID.Hex(), e), errEventNotFound)
+}
+
+func (r *memoryEventRepository) ApproveEvent(ctx context.Context, e *Event) error {
+	found, err := r.events.update(e.ID.Hex(), func(doc *Event) {
+		doc.Status = "approved"
+	})
+	if err != nil {
+		return err
+	} else if !found {
+		return errEventNotFound
+	}
+	return notFound(r.events.get(e.ID.Hex(), e), errEventNotFound)
+}
+
+func (r *memoryEventRepository) RemoveEvent(ctx context.Context, e *Event) error {
+	if err := r.events.get(e.ID.Hex(), e); err != nil {
+		return notFound(err, errEventNotFound)
+	}
+	r.events.delete(e.ID.Hex())
+	return nil
+}
+
+func (r *memoryEventRepository) GetAllEvents(ctx context.Context) ([]Event, error) {
+	return r.events.find(func(e Event) bool {
+		return e.Status == "approved"
+	})
+}
+
+func (r *memoryEventRepository) GetPendingEvents(ctx context.Context) ([]Event, error) {
+	return r.events.find(nil)
+}
+
+func (r *memoryEventRepository) RenderMarkdown(ctx context.Context) error {
+	return renderMemoryMarkdown(r.events, func(e *Event) (string, *string) { return e.Description, &e.DescriptionHTML })
+}
+
+func addToSet(set []string, value string) []string {
+	for _, v := range set {
+		if v == value {
+			return set
+		}
+	}
+	return append(set, value)
+}
+
+type memoryCurriculumRepository struct {
+	courses     *memoryCollection[Course]
+	curricula   *memoryCollection[Cirriculum]
+	userCourses *memoryCollection[UserCourse]
+}
+
+func NewMemoryCurriculumRepository() CurriculumRepository {
+	return &memoryCurriculumRepository{
+		courses:     newMemoryCollection[Course](),
+		curricula:   newMemoryCollection[Cirriculum](),
+		userCourses: newMemoryCollection[UserCourse](),
+	}
+}
+
+func cirriculumKey(department int, name string) string {
+	return strconv.Itoa(department) + "/" + name
+}
+
+func (r *memoryCurriculumRepository) storedUserCourses(userID string) ([]UserCourse, error) {
+	return r.userCourses.find(func(uc UserCourse) bool {
+		return uc.UserID == userID
+	})
+}
+
+func (r *memoryCurriculumRepository) Sync(ctx context.Context, u *User, rows []CourseData) (CurriculumSync, error) {
+	stored, err := r.storedUserCourses(u.Username)
+	if err != nil {
+		return CurriculumSync{}, err
+	}
+	d := diffCurriculum(u, stored, rows)
+
+	for _, c := range d.courses {
+		found, err := r.courses.update(c.ID, func(doc *Course) { *doc = c })
+		if err != nil {
+			return CurriculumSync{}, err
+		}
+		if !found {
+			if err := r.courses.insert(c.ID, c); err != nil {
+				return CurriculumSync{}, err
+			}
+		}
+	}
+	key := cirriculumKey(d.cirriculum.Department, d.cirriculum.CirriculumName)
+	found, err := r.curricula.update(key, func(doc *Cirriculum) {
+		doc.Index = d.cirriculum.Index
+	})
+	if err != nil {
+		return CurriculumSync{}, err
+	}
+	if !found {
+		d.cirriculum.ID = primitive.NewObjectID()
+		if err := r.curricula.insert(key, d.cirriculum); err != nil {
+			return CurriculumSync{}, err
+		}
+	}
+	for _, uc := range d.upserts {
+		key := uc.UserID + "/" + uc.CourseID
+		found, err := r.userCourses.update(key, func(doc *UserCourse) {
+			doc.Grade, doc.Semester, doc.Year, doc.UpdatedAt = uc.Grade, uc.Semester, uc.Year, uc.UpdatedAt
+		})
+		if err != nil {
+			return CurriculumSync{}, err
+		}
+		if !found {
+			uc.ID = primitive.NewObjectID()
+			if err := r.userCourses.insert(key, uc); err != nil {
+				return CurriculumSync{}, err
+			}
+		}
+	}
+	for _, courseID := range d.removed {
+		r.userCourses.delete(u.Username + "/" + courseID)
+	}
+
+	d.result.Courses, err = r.GetUserCurriculum(ctx, u)
+	return d.result, err
+}
+
+func (r *memoryCurriculumRepository) GetUserCurriculum(ctx context.Context, u *User) ([]CourseData, error) {
+	stored, err := r.storedUserCourses(u.Username)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]Course, len(stored))
+	for _, uc := range stored {
+		var c Course
+		if err := r.courses.get(uc.CourseID, &c); err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		byID[uc.CourseID] = c
+	}
+	return joinCurriculum(u, stored, byID), nil
+}
+
+func (r *memoryCurriculumRepository) GetCirriculum(ctx context.Context, department int, name string) (Cirriculum, error) {
+	var c Cirriculum
+	err := r.curricula.get(cirriculumKey(department, name), &c)
+	return c, notFound(err, errCirriculumNotFound)
+}
+
+type memorySurveyJobRepository struct {
+	jobs *memoryCollection[SurveyJob]
+}
+
+func NewMemorySurveyJobRepository() SurveyJobRepository {
+	return &memorySurveyJobRepository{jobs: newUniqueMemoryCollection(func(j SurveyJob) string {
+		if j.IdempotencyKey == "" {
+			return ""
+		}
+		return j.UserID + "\x00" + j.IdempotencyKey
+	})}
+}
+
+func (r *memorySurveyJobRepository) CreateJob(ctx context.Context, j *SurveyJob) error {
+	if err := j.prepareInsert(); err != nil {
+		return err
+	}
+	return conflict(r.jobs.insert(j.ID.Hex(), *j), errSurveyJobExists)
+}
+
+func (r *memorySurveyJobRepository) GetJob(ctx context.Context, id primitive.ObjectID) (SurveyJob, error) {
+	var j SurveyJob
+	err := r.jobs.get(id.Hex(), &j)
+	return j, notFound(err, errSurveyJobNotFound)
+}
+
+func (r *memorySurveyJobRepository) FindJob(ctx context.Context, userID, idempotencyKey string) (SurveyJob, error) {
+	jobs, err := r.jobs.find(func(j SurveyJob) bool {
+		if j.UserID != userID {
+			return false
+		}
+		if idempotencyKey != "" {
+			return j.IdempotencyKey == idempotencyKey
+		}
+		return j.Active()
+	})
+	if err != nil {
+		return SurveyJob{}, err
+	}
+	if len(jobs) == 0 {
+		return SurveyJob{}, errSurveyJobNotFound.Wrap(mongo.ErrNoDocuments)
+	}
+	return jobs[0], nil
+}
+
+func (r *memorySurveyJobRepository) UpdateJob(ctx context.Context, j *SurveyJob) error {
+	found, err := r.jobs.update(j.ID.Hex(), func(doc *SurveyJob) { *doc = *j })
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errSurveyJobNotFound.Wrap(mongo.ErrNoDocuments)
+	}
+	return nil
+}
+
+func (r *memorySurveyJobRepository) GetJobs(ctx context.Context, userID string) ([]SurveyJob, error) {
+	jobs, err := r.jobs.find(func(j SurveyJob) bool {
+		return j.UserID == userID
+	})
+	for i, j := 0, len(jobs)-1; i < j; i, j = i+1, j-1 {
+		jobs[i], jobs[j] = jobs[j], jobs[i]
+	}
+	return jobs, err
+}
+
+func (r *memorySurveyJobRepository) FailUnfinished(ctx context.Context, reason string) (int, error) {
+	unfinished, err := r.jobs.find(func(j SurveyJob) bool { return j.Active() })
+	if err != nil {
+		return 0, err
+	}
+	now := primitive.NewDateTimeFromTime(time.Now())
+	for _, j := range unfinished {
+		if _, err := r.jobs.update(j.ID.Hex(), func(doc *SurveyJob) {
+			doc.Status, doc.Error, doc.FinishedAt = JobFailed, reason, now
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return len(unfinished), nil
+}
+
+type memoryDepartmentRepository struct {
+	faculties   *memoryCollection[Faculty]
+	departments *memoryCollection[Department]
+}
+
+func NewMemoryDepartmentRepository() DepartmentRepository {
+	return &memoryDepartmentRepository{
+		faculties:   newMemoryCollection[Faculty](),
+		departments: newMemoryCollection[Department](),
+	}
+}
+
+// put replaces the document under key, or inserts it.
+// changed reports whether an update turned before into a different document,
+// the way Mongo tells a modified document from a matched one.
+func changed[T any](before, after T) bool {
+	a, errA := bson.Marshal(before)
+	b, errB := bson.Marshal(after)
+	return errA != nil || errB != nil || !bytes.Equal(a, b)
+}
+
+func put[T any](c *memoryCollection[T], key string, doc T) error {
+	found, err := c.update(key, func(stored *T) { *stored = doc })
+	if err != nil || found {
+		return err
+	}
+	return c.insert(key, doc)
+}
+
+func (r *memoryDepartmentRepository) PutFaculty(ctx context.Context, f *Faculty) error {
+	return put(r.faculties, strconv.Itoa(f.Code), *f)
+}
+
+func (r *memoryDepartmentRepository) GetFaculties(ctx context.Context) ([]Faculty, error) {
+	faculties, err := r.faculties.find(nil)
+	sort.Slice(faculties, func(i, j int) bool { return faculties[i].Code < faculties[j].Code })
+	return faculties, err
+}
+
+func (r *memoryDepartmentRepository) PutDepartment(ctx context.Context, d *Department) error {
+	var f Faculty
+	if err := r.faculties.get(strconv.Itoa(d.Faculty), &f); err != nil {
+		return notFound(err, errFacultyNotFound)
+	}
+	if d.Aliases == nil {
+		d.Aliases = []string{}
+	}
+	return put(r.departments, strconv.Itoa(d.Code), *d)
+}
+
+func (r *memoryDepartmentRepository) GetDepartment(ctx context.Context, code int) (Department, error) {
+	var d Department
+	err := r.departments.get(strconv.Itoa(code), &d)
+	return d, notFound(err, errDepartmentNotFound)
+}
+
+func (r *memoryDepartmentRepository) GetDepartments(ctx context.Context) ([]Department, error) {
+	departments, err := r.departments.find(nil)
+	sort.Slice(departments, func(i, j int) bool { return departments[i].Code < departments[j].Code })
+	return departments, err
+}
+
+type memoryRoleRepository struct {
+	roles   *memoryCollection[Role]
+	changes *memoryCollection[RoleChange]
+}
+
+func NewMemoryRoleRepository() RoleRepository {
+	return &memoryRoleRepository{
+		roles:   newMemoryCollection[Role](),
+		changes: newMemoryCollection[RoleChange](),
+	}
+}
+
+func (r *memoryRoleRepository) PutRole(ctx context.Context, role *Role) error {
+	if err := role.validate(); err != nil {
+		return err
+	}
+	return put(r.roles, role.Name, *role)
+}
+
+func (r *memoryRoleRepository) GetRole(ctx context.Context, name string) (Role, error) {
+	var role Role
+	err := r.roles.get(name, &role)
+	return role, notFound(err, errRoleNotFound)
+}
+
+func (r *memoryRoleRepository) GetRoles(ctx context.Context) ([]Role, error) {
+	roles, err := r.roles.find(nil)
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, err
+}
+
+func (r *memoryRoleRepository) EnsureRoles(ctx context.Context, roles []Role) error {
+	for _, role := range roles {
+		if err := role.validate(); err != nil {
+			return err
+		}
+		if err := r.roles.insert(role.Name, role); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryRoleRepository) LogChange(ctx context.Context, c *RoleChange) error {
+	c.ID = primitive.NewObjectID()
+	c.At = primitive.NewDateTimeFromTime(time.Now())
+	return r.changes.insert(c.ID.Hex(), *c)
+}
+
+func (r *memoryRoleRepository) GetChanges(ctx context.Context, q RoleChangeQuery) (Page[RoleChange], error) {
+	changes, err := r.changes.find(q.matches)
+	if err != nil {
+		return Page[RoleChange]{}, err
+	}
+	for i, j := 0, len(changes)-1; i < j; i, j = i+1, j-1 {
+		changes[i], changes[j] = changes[j], changes[i]
+	}
+	return paginate(changes, q.PageQuery), nil
+}
+
+// memoryStatsRepository computes statistics over the memory suggestion and
+// event repositories it was built from.
+type memoryStatsRepository struct {
+	suggestions *memorySuggestionRepository
+	events      *memoryEventRepository
+}
+
+// NewMemoryStatsRepository reads the stores of suggestions and events, which
+// must be memory repositories.
+func NewMemoryStatsRepository(suggestions SuggestionRepository, events EventRepository) StatsRepository {
+	return &memoryStatsRepository{
+		suggestions: suggestions.(*memorySuggestionRepository),
+		events:      events.(*memoryEventRepository),
+	}
+}
+
+func (r *memoryStatsRepository) inWindow(w statsWindow) ([]Suggestion, error) {
+	return r.suggestions.suggestions.find(func(s Suggestion) bool { return w.contains(s.Date) })
+}
+
+func (r *memoryStatsRepository) SuggestionTimeline(ctx context.Context, q StatsQuery) ([]TimelinePoint, error) {
+	w, err := q.window(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	suggestions, err := r.inWindow(w)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]map[string]int{}
+	for _, s := range suggestions {
+		date, err := time.Parse(time.RFC3339, s.Date)
+		if err != nil {
+			return nil, err
+		}
+		p := w.period(date.UTC())
+		if counts[p] == nil {
+			counts[p] = map[string]int{}
+		}
+		counts[p][s.Status]++
+	}
+	return buildTimeline(w, counts)
+}
+
+func (r *memoryStatsRepository) DecisionTimes(ctx context.Context, q StatsQuery) (DecisionStats, error) {
+	var stats DecisionStats
+	w, err := q.window(time.Now())
+	if err != nil {
+		return stats, err
+	}
+	suggestions, err := r.inWindow(w)
+	if err != nil {
+		return stats, err
+	}
+	var approved, rejected []float64
+	for _, s := range suggestions {
+		if s.Status == "pending" {
+			stats.Pending++
+		}
+		made, err := time.Parse(time.RFC3339, s.Date)
+		if err != nil {
+			return stats, err
+		}
+		var a Approval
+		if r.suggestions.approvals.get(s.ID.Hex(), &a) == nil {
+			if decided, err := time.Parse(time.RFC3339, a.Date); err == nil {
+				approved = append(approved, decided.Sub(made).Hours())
+			}
+		}
+		var rj Rejection
+		if r.suggestions.rejections.get(s.ID.Hex(), &rj) == nil {
+			if decided, err := time.Parse(time.RFC3339, rj.Date); err == nil {
+				rejected = append(rejected, decided.Sub(made).Hours())
+			}
+		}
+	}
+	sort.Float64s(approved)
+	sort.Float64s(rejected)
+	stats.Approved, stats.Rejected = newDecisionTime(approved), newDecisionTime(rejected)
+	return stats, nil
+}
+
+// countBy counts the suggestions in w and the approved ones by key, leaving
+// out the empty key.
+func (r *memoryStatsRepository) countBy(w statsWindow, key func(s Suggestion) string) ([]KeyCount, map[string]int, error) {
+	suggestions, err := r.inWindow(w)
+	if err != nil {
+		return nil, nil, err
+	}
+	counts, approved := map[string]int{}, map[string]int{}
+	for _, s := range suggestions {
+		k := key(s)
+		if k == "" {
+			continue
+		}
+		counts[k]++
+		if s.Status == "approved" {
+			approved[k]++
+		}
+	}
+	return sortCounts(counts, w.limit), approved, nil
+}
+
+func (r *memoryStatsRepository) TopDepartments(ctx context.Context, q StatsQuery) ([]DepartmentCount, error) {
+	w, err := q.window(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	// Keys are zero padded so they sort like the numbers they stand for.
+	counts, approved, err := r.countBy(w, func(s Suggestion) string {
+		if id := s.DepartmentID(); id != 0 {
+			return fmt.Sprintf("%010d", id)
+		}
+		return ""
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]DepartmentCount, len(counts))
+	for i, c := range counts {
+		code, _ := strconv.Atoi(c.Key)
+		out[i] = DepartmentCount{Department: code, Count: c.Count, Approved: approved[c.Key]}
+	}
+	return out, nil
+}
+
+func (r *memoryStatsRepository) TopAuthors(ctx context.Context, q StatsQuery) ([]AuthorCount, error) {
+	w, err := q.window(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	counts, approved, err := r.countBy(w, func(s Suggestion) string { return s.AuthorID })
+	if err != nil {
+		return nil, err
+	}
+	out := make([]AuthorCount, len(counts))
+	for i, c := range counts {
+		out[i] = AuthorCount{Author: c.Key, Count: c.Count, Approved: approved[c.Key]}
+	}
+	return out, nil
+}
+
+func (r *memoryStatsRepository) TopSuggestions(ctx context.Context, q StatsQuery) ([]TopSuggestion, error) {
+	w, err := q.window(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	suggestions, err := r.inWindow(w)
+	if err != nil {
+		return nil, err
+	}
+	top := make([]TopSuggestion, len(suggestions))
+	for i, s := range suggestions {
+		top[i] = TopSuggestion{
+			ID:      s.ID,
+			Title:   s.Title,
+			Author:  s.AuthorID,
+			Date:    s.Date,
+			Status:  s.Status,
+			Upvotes: s.UpvoteCount,
+			Stars:   s.CalculateAverageStars(),
+			Ratings: len(s.Stars),
+		}
+	}
+	sort.Slice(top, func(i, j int) bool {
+		a, b := top[i], top[j]
+		first, second := [2]float64{float64(a.Upvotes), a.Stars}, [2]float64{float64(b.Upvotes), b.Stars}
+		if w.by == "stars" {
+			first, second = [2]float64{a.Stars, float64(a.Ratings)}, [2]float64{b.Stars, float64(b.Ratings)}
+		}
+		if first != second {
+			return first[0] > second[0] || (first[0] == second[0] && first[1] > second[1])
+		}
+		return a.ID.Hex() > b.ID.Hex()
+	})
+	if len(top) > w.limit {
+		top = top[:w.limit]
+	}
+	return top, nil
+}
+
+func (r *memoryStatsRepository) EventStats(ctx context.Context, q StatsQuery) (EventStats, error) {
+	stats := EventStats{ByType: []KeyCount{}, ByOrganizer: []KeyCount{}}
+	w, err := q.window(time.Now())
+	if err != nil {
+		return stats, err
+	}
+	events, err := r.events.events.find(func(e Event) bool {
+		created := e.CreatedAt.Time()
+		return !created.Before(w.from) && created.Before(w.to)
+	})
+	if err != nil {
+		return stats, err
+	}
+	types, organizers := map[string]int{}, map[string]int{}
+	for _, e := range events {
+		types[e.Type]++
+		organizers[e.OrganizerID]++
+	}
+	stats.Total = len(events)
+	stats.ByType = sortCounts(types, w.limit)
+	stats.ByOrganizer = sortCounts(organizers, w.limit)
+	return stats, nil
+}
+
+// memoryExportRepository reads the memory suggestion, event and project
+// repositories it was built from.
+type memoryExportRepository struct {
+	suggestions *memorySuggestionRepository
+	events      *memoryEventRepository
+	projects    *memoryProjectRepository
+}
+
+// NewMemoryExportRepository reads the given stores, which must be memory
+// repositories.
+func NewMemoryExportRepository(suggestions SuggestionRepository, events EventRepository, projects ProjectRepository) ExportRepository {
+	return &memoryExportRepository{
+		suggestions: suggestions.(*memorySuggestionRepository),
+		events:      events.(*memoryEventRepository),
+		projects:    projects.(*memoryProjectRepository),
+	}
+}
+
+func (r *memoryExportRepository) EachSuggestion(ctx context.Context, q ExportQuery, fn func(SuggestionExport) error) error {
+	if err := q.Check(); err != nil {
+		return err
+	}
+	suggestions, err := r.suggestions.suggestions.find(func(s Suggestion) bool {
+		return q.containsDate(s.Date) && (q.Status == "" || s.Status == q.Status)
+	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool { return suggestions[i].ID.Hex() < suggestions[j].ID.Hex() })
+	for _, s := range suggestions {
+		e := SuggestionExport{
+			ID:         s.ID,
+			Title:      s.Title,
+			Content:    s.Content,
+			Author:     s.AuthorID,
+			Department: s.DepartmentID(),
+			Date:       s.Date,
+			Status:     s.Status,
+			Tags:       s.Tags,
+			Upvotes:    s.UpvoteCount,
+			Downvotes:  s.DownvoteCount,
+			Score:      s.Score,
+			Ratings:    len(s.Stars),
+		}
+		for _, star := range s.Stars {
+			e.Stars += star.Star / float64(len(s.Stars))
+		}
+		var approval Approval
+		if err := r.suggestions.approvals.get(s.ID.Hex(), &approval); err == nil {
+			e.DecidedBy, e.DecidedAt = approval.ExecutorID, approval.Date
+		}
+		var rejection Rejection
+		if err := r.suggestions.rejections.get(s.ID.Hex(), &rejection); err == nil {
+			e.DecidedBy, e.DecidedAt, e.RejectionReason = rejection.ExecutorID, rejection.Date, rejection.Reason
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryExportRepository) EachEvent(ctx context.Context, q ExportQuery, fn func(Event) error) error {
+	if err := q.Check(); err != nil {
+		return err
+	}
+	events, err := r.events.events.find(func(e Event) bool {
+		return q.containsTime(e.CreatedAt.Time()) && (q.Status == "" || e.Status == q.Status)
+	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].ID.Hex() < events[j].ID.Hex() })
+	for _, e := range events {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryExportRepository) EachProject(ctx context.Context, q ExportQuery, fn func(ProjectExport) error) error {
+	if err := q.Check(); err != nil {
+		return err
+	}
+	projects, err := r.projects.projects.find(func(p Project) bool { return q.containsDate(p.Date) })
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(projects, func(i, j int) bool { return projects[i].ID.Hex() < projects[j].ID.Hex() })
+	for _, p := range projects {
+		if err := fn(newProjectExport(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type memoryAttachmentRepository struct {
+	attachments *memoryCollection[Attachment]
+	suggestions *memorySuggestionRepository
+	projects    *memoryProjectRepository
+	events      *memoryEventRepository
+}
+
+func NewMemoryAttachmentRepository(suggestions SuggestionRepository, projects ProjectRepository, events EventRepository) AttachmentRepository {
+	return &memoryAttachmentRepository{
+		attachments: newMemoryCollection[Attachment](),
+		suggestions: suggestions.(*memorySuggestionRepository),
+		projects:    projects.(*memoryProjectRepository),
+		events:      events.(*memoryEventRepository),
+	}
+}
+
+// updateParent applies fn to the attachment list of the parent of a and
+// reports whether the parent exists.
+func (r *memoryAttachmentRepository) updateParent(a *Attachment, fn func(refs []AttachmentRef) []AttachmentRef) (bool, error) {
+	key := a.Parent.Hex()
+	switch a.Kind {
+	case AttachedToProject:
+		return r.projects.projects.update(key, func(p *Project) { p.Attachments = fn(p.Attachments) })
+	case AttachedToEvent:
+		return r.events.events.update(key, func(e *Event) { e.Attachments = fn(e.Attachments) })
+	}
+	return r.suggestions.suggestions.update(key, func(s *Suggestion) { s.Attachments = fn(s.Attachments) })
+}
+
+func (r *memoryAttachmentRepository) AddAttachment(ctx context.Context, a *Attachment) error {
+	if err := a.prepareInsert(); err != nil {
+		return err
+	}
+	found, err := r.updateParent(a, func(refs []AttachmentRef) []AttachmentRef { return append(refs, a.Ref()) })
+	if err != nil {
+		return err
+	} else if !found {
+		return a.parentNotFound()
+	}
+	return r.attachments.insert(a.ID.Hex(), *a)
+}
+
+func (r *memoryAttachmentRepository) GetAttachment(ctx context.Context, id primitive.ObjectID) (Attachment, error) {
+	var a Attachment
+	return a, notFound(r.attachments.get(id.Hex(), &a), errAttachmentNotFound)
+}
+
+func (r *memoryAttachmentRepository) RemoveAttachment(ctx context.Context, a *Attachment) error {
+	if err := r.attachments.get(a.ID.Hex(), &Attachment{}); err != nil {
+		return notFound(err, errAttachmentNotFound)
+	}
+	if _, err := r.updateParent(a, func(refs []AttachmentRef) []AttachmentRef {
+		return slices.DeleteFunc(refs, func(ref AttachmentRef) bool { return ref.ID == a.ID })
+	}); err != nil {
+		return err
+	}
+	r.attachments.delete(a.ID.Hex())
+	return nil
+}
+
+type memoryFollowRepository struct {
+	follows  *memoryCollection[Follow]
+	activity *memoryCollection[Activity]
+}
+
+func NewMemoryFollowRepository() FollowRepository {
+	return &memoryFollowRepository{
+		follows:  newMemoryCollection[Follow](),
+		activity: newMemoryCollection[Activity](),
+	}
+}
+
+func followKey(f *Follow) string {
+	return f.User + "\x00" + string(f.Subject())
+}
+
+func (r *memoryFollowRepository) Follow(ctx context.Context, f *Follow) error {
+	if err := f.prepare(); err != nil {
+		return err
+	}
+	f.Since = primitive.NewDateTimeFromTime(time.Now())
+	if err := r.follows.insert(followKey(f), *f); !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	return r.follows.get(followKey(f), f)
+}
+
+func (r *memoryFollowRepository) Unfollow(ctx context.Context, f *Follow) error {
+	if err := f.prepare(); err != nil {
+		return err
+	}
+	if err := r.follows.get(followKey(f), &Follow{}); err != nil {
+		return notFound(err, errNotFollowing)
+	}
+	r.follows.delete(followKey(f))
+	return nil
+}
+
+func (r *memoryFollowRepository) GetFollows(ctx context.Context, user string, q PageQuery) (Page[Follow], error) {
+	follows, err := r.follows.find(func(f Follow) bool { return f.User == user })
+	if err != nil {
+		return Page[Follow]{}, err
+	}
+	slices.Reverse(follows)
+	return paginate(follows, q), nil
+}
+
+func (r *memoryFollowRepository) CopyFollowers(ctx context.Context, from, to Follow) error {
+	followers, err := r.follows.find(func(f Follow) bool { return f.Kind == from.Kind && f.Target == from.Target })
+	if err != nil {
+		return err
+	}
+	for _, f := range followers {
+		to.User = f.User
+		if err := r.Follow(ctx, &to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryFollowRepository) Publish(ctx context.Context, a *Activity) error {
+	a.prepareInsert()
+	return r.activity.insert(a.ID.Hex(), *a)
+}
+
+func (r *memoryFollowRepository) Feed(ctx context.Context, user string, q PageQuery) (Page[Activity], error) {
+	follows, err := r.follows.find(func(f Follow) bool { return f.User == user })
+	if err != nil {
+		return Page[Activity]{}, err
+	}
+	followed := feedSubjects(user, follows)
+	feed, err := r.activity.find(func(a Activity) bool {
+		return slices.ContainsFunc(a.Subjects, func(s Subject) bool { return slices.Contains(followed, s) })
+	})
+	if err != nil {
+		return Page[Activity]{}, err
+	}
+	slices.Reverse(feed)
+	return paginate(feed, q), nil
+}
@@ -0,0 +1,60 @@
+package library
+
+// DefaultPerPage is the page size of listings that do not ask for one.
+const DefaultPerPage = 20
+
+// MaxPage and MaxPerPage bound PageQuery, so skipping to a page cannot
+// overflow. The validate tags repeat them.
+const (
+	MaxPage    = 10000
+	MaxPerPage = 100
+)
+
+// PageQuery selects a page of a listing. Pages count from 1.
+type PageQuery struct {
+	Page    int `json:"page" query:"page" validate:"min=0,max=10000"`
+	PerPage int `json:"per_page" query:"per_page" validate:"min=0,max=100"`
+}
+
+// normalize fills in the first page and the default page size, and clamps
+// both to their bounds for callers that skipped validation.
+func (q *PageQuery) normalize() {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.Page > MaxPage {
+		q.Page = MaxPage
+	}
+	if q.PerPage < 1 {
+		q.PerPage = DefaultPerPage
+	}
+	if q.PerPage > MaxPerPage {
+		q.PerPage = MaxPerPage
+	}
+}
+
+func (q PageQuery) skip() int {
+	return (q.Page - 1) * q.PerPage
+}
+
+// Page is one page of a listing together with the size of the whole listing.
+type Page[T any] struct {
+	Items   []T   `json:"items"`
+	Page    int   `json:"page"`
+	PerPage int   `json:"per_page"`
+	Total   int64 `json:"total"`
+}
+
+// paginate cuts the page q selects out of all.
+func paginate[T any](all []T, q PageQuery) Page[T] {
+	q.normalize()
+	page := Page[T]{Items: []T{}, Page: q.Page, PerPage: q.PerPage, Total: int64(len(all))}
+	if start := q.skip(); start < len(all) {
+		end := start + q.PerPage
+		if end > len(all) {
+			end = len(all)
+		}
+		page.Items = append(page.Items, all[start:end]...)
+	}
+	return page
+}
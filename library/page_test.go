@@ -0,0 +1,20 @@
+package library
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestPaginateBounds(t *testing.T) {
+	all := []int{1, 2, 3, 4, 5}
+	if page := paginate(all, PageQuery{Page: 2, PerPage: 2}); len(page.Items) != 2 || page.Items[0] != 3 || page.Total != 5 {
+		t.Fatalf("second page = %+v", page)
+	}
+	if page := paginate(all, PageQuery{Page: math.MaxInt, PerPage: math.MaxInt}); len(page.Items) != 0 || page.Page != MaxPage || page.PerPage != MaxPerPage {
+		t.Fatalf("page past the bounds = %+v", page)
+	}
+	if err := Validate(&PageQuery{Page: MaxPage + 1}); !errors.Is(err, ErrValidation) {
+		t.Fatalf("Validate(page past MaxPage) = %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package library
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHotDecays(t *testing.T) {
+	if !(hot(10, time.Hour) > hot(10, 24*time.Hour)) || !(hot(10, 24*time.Hour) > hot(2, 24*time.Hour)) {
+		t.Fatal("hot rank does not fall with age or rise with points")
+	}
+	// A day old suggestion needs many more points to stay above a new one.
+	if hot(10, 24*time.Hour) > hot(2, time.Hour) {
+		t.Fatalf("day old %v above an hour old %v", hot(10, 24*time.Hour), hot(2, time.Hour))
+	}
+	if hot(-3, time.Hour) >= 0 || hot(5, -time.Hour) != hot(5, 0) {
+		t.Fatal("downvoted or future suggestions ranked wrongly")
+	}
+
+	// The score decays from the suggestion date, a star from when it was
+	// given, or from the suggestion date when it has none.
+	type star = struct {
+		UserID string  `json:"userID" bson:"userID"`
+		Star   float64 `json:"star" bson:"star"`
+		Date   string  `json:"date" bson:"date"`
+	}
+	s := Suggestion{Date: "2024-03-01T10:00:00Z", Votes: Votes{Score: 2}}
+	s.Stars = append(s.Stars, star{UserID: "c2011011026", Star: 1}, star{UserID: "c2011011027", Star: 5, Date: "2024-03-01T11:00:00Z"})
+	s.rank(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	want := hot(2, 2*time.Hour) + hot(-1, 2*time.Hour) + hot(1, time.Hour)
+	if math.Abs(s.Hot-want) > 1e-12 {
+		t.Fatalf("hot = %v, want %v", s.Hot, want)
+	}
+	if old := hot(2, 2*time.Hour) + hot(-1, 2*time.Hour) + hot(1, 2*time.Hour); !(s.Hot > old) {
+		t.Fatalf("a recent star ranks %v, no higher than an old one %v", s.Hot, old)
+	}
+}
+
+func TestRankingWindow(t *testing.T) {
+	for _, c := range []struct {
+		window string
+		now    string
+		want   string
+	}{
+		{WindowAll, "2024-03-15T10:00:00Z", "0001-01-01T00:00:00Z"},
+		{WindowWeek, "2024-03-15T10:00:00Z", "2024-03-08T10:00:00Z"},
+		{WindowMonth, "2024-03-15T10:00:00Z", "2024-02-15T10:00:00Z"},
+		{WindowSemester, "2024-03-15T10:00:00Z", "2024-02-01T00:00:00Z"},
+		{WindowSemester, "2024-07-20T10:00:00Z", "2024-02-01T00:00:00Z"},
+		{WindowSemester, "2024-10-01T10:00:00Z", "2024-09-01T00:00:00Z"},
+		{WindowSemester, "2025-01-10T10:00:00Z", "2024-09-01T00:00:00Z"},
+	} {
+		now, _ := time.Parse(time.RFC3339, c.now)
+		if got := (RankingQuery{Window: c.window}).Since(now).Format(time.RFC3339); got != c.want {
+			t.Errorf("%s window at %s starts %s, want %s", c.window, c.now, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UserRepository stores User documents keyed by username.
+type UserRepository interface {
+	InsertToDB(ctx context.Context, u *User) error
+	// ImportUser creates u or, when it exists with the same UserType, sets
+	// its FullName unless empty and adds its Roles. u is refreshed.
+	ImportUser(ctx context.Context, u *User) (UpsertResult, error)
+	// GrantRoles adds roles to u, skipping those it already holds.
+	GrantRoles(ctx context.Context, u *User, roles []string) error
+	// RevokeRoles removes roles from u, skipping those it does not hold.
+	RevokeRoles(ctx context.Context, u *User, roles []string) error
+	// FindUser fills u from the document matching its Username and UserType.
+	FindUser(ctx context.Context, u *User) error
+	// UpdateProfile stores the portal profile of u and stamps it as synced.
+	UpdateProfile(ctx context.Context, u *User, info PersonalInfo) error
+	GetUser(ctx context.Context, id string) (User, error)
+	// SearchUsers returns a page of the user directory ordered by username.
+	SearchUsers(ctx context.Context, q UserQuery) (Page[User], error)
+	UpdatePrivacy(ctx context.Context, u *User, p Privacy) error
+	// SetDepartment stores the department mapping of u.
+	SetDepartment(ctx context.Context, u *User, department, faculty int, source string) error
+	// StaleProfiles returns up to limit users whose profile was last synced
+	// before before, or never, least recently synced first.
+	StaleProfiles(ctx context.Context, before time.Time, limit int) ([]User, error)
+}
+
+// SuggestionRepository stores suggestions together with the moderation
+// decisions (approvals, rejections, reports) taken on them. Methods that take
+// a *Suggestion refresh it with the stored document.
+type SuggestionRepository interface {
+	WithID(ctx context.Context, s *Suggestion, id string) error
+	InsertToDB(ctx context.Context, s *Suggestion) error
+	// Edit replaces the title and content, with its tags, of s while it is
+	// pending.
+	Edit(ctx context.Context, s *Suggestion, title string, content Markdown) error
+	// Vote records the vote of kind by userID, replacing their other vote.
+	Vote(ctx context.Context, s *Suggestion, userID string, kind VoteKind) error
+	// Unvote retracts the vote of kind by userID, if they cast it.
+	Unvote(ctx context.Context, s *Suggestion, userID string, kind VoteKind) error
+	// GetVoters returns a page of the voters of the suggestion id, ordered
+	// by username.
+	GetVoters(ctx context.Context, id primitive.ObjectID, q VoterQuery) (Page[Voter], error)
+	// CountVotes fills in the vote counters of suggestions stored before
+	// there were any.
+	CountVotes(ctx context.Context) error
+	GiveStar(ctx context.Context, s *Suggestion, userID string, star int) error
+	Reject(ctx context.Context, s *Suggestion, executorID string, reason string) error
+	Approve(ctx context.Context, s *Suggestion, executorID string) error
+	Report(ctx context.Context, s *Suggestion, executorID string) error
+	GetRejectedSuggestions(ctx context.Context) ([]Suggestion, error)
+	GetApprovedSuggestions(ctx context.Context) ([]Suggestion, error)
+	// GetRankedSuggestions returns the approved suggestions made in the
+	// window of q, in the order q asks for.
+	GetRankedSuggestions(ctx context.Context, q RankingQuery) ([]Suggestion, error)
+	// Rank refreshes the hot rank of the approved suggestions, which decays
+	// even while nobody votes.
+	Rank(ctx context.Context) error
+	GetAllSuggestions(ctx context.Context) ([]Suggestion, error)
+	GetPendingSuggestions(ctx context.Context) ([]Suggestion, error)
+	GetReportedSuggestions(ctx context.Context) ([]Suggestion, error)
+	// GetAuthorSuggestions returns the suggestions of any of authors, newest
+	// first, whatever their status.
+	GetAuthorSuggestions(ctx context.Context, authors []string) ([]Suggestion, error)
+	LogDeanonymization(ctx context.Context, d *Deanonymization) error
+	// GetDeanonymizations returns a page of the audit log of revealed
+	// authors, newest first.
+	GetDeanonymizations(ctx context.Context, q PageQuery) (Page[Deanonymization], error)
+}
+
+// ProjectRepository stores projects grown out of approved suggestions.
+type ProjectRepository interface {
+	CreateFrom(ctx context.Context, p *Project, s Suggestion) error
+	// Vote records the vote of kind by userID, replacing their other vote.
+	Vote(ctx context.Context, p *Project, userID string, kind VoteKind) error
+	// Unvote retracts the vote of kind by userID, if they cast it.
+	Unvote(ctx context.Context, p *Project, userID string, kind VoteKind) error
+	// CountVotes fills in the vote counters of projects stored before there
+	// were any.
+	CountVotes(ctx context.Context) error
+	AddStar(ctx context.Context, p *Project, userID string, star float64) error
+	GetProject(ctx context.Context, p *Project) error
+	GetAllProjects(ctx context.Context) ([]Project, error)
+	// RenderMarkdown fills in ContentHTML of projects stored without it.
+	RenderMarkdown(ctx context.Context) error
+}
+
+// EventRepository stores calendar events.
+type EventRepository interface {
+	CreateEvent(ctx context.Context, e *Event) error
+	// ImportEvent creates e as an approved event, or updates the event with
+	// its ImportKey. e is refreshed.
+	ImportEvent(ctx context.Context, e *Event) (UpsertResult, error)
+	GetEvents(ctx context.Context, u *User) ([]Event, error)
+	ApproveEvent(ctx context.Context, e *Event) error
+	RemoveEvent(ctx context.Context, e *Event) error
+	GetEvent(ctx context.Context, e *Event) error
+	GetAllEvents(ctx context.Context) ([]Event, error)
+	GetPendingEvents(ctx context.Context) ([]Event, error)
+	// RenderMarkdown fills in DescriptionHTML of events stored without it.
+	RenderMarkdown(ctx context.Context) error
+}
+
+// CurriculumRepository stores the course catalogue, the curriculum of each
+// department and every user's grades, all as fetched from the portal.
+type CurriculumRepository interface {
+	// Sync stores the rows fetched for u, writing only what changed since the
+	// last sync, and reports the differences.
+	Sync(ctx context.Context, u *User, rows []CourseData) (CurriculumSync, error)
+	GetUserCurriculum(ctx context.Context, u *User) ([]CourseData, error)
+	GetCirriculum(ctx context.Context, department int, name string) (Cirriculum, error)
+}
+
+// SurveyJobRepository stores survey auto-fill jobs and, through their items,
+// the history of completed surveys.
+type SurveyJobRepository interface {
+	CreateJob(ctx context.Context, j *SurveyJob) error
+	GetJob(ctx context.Context, id primitive.ObjectID) (SurveyJob, error)
+	// FindJob returns the job of userID created with idempotencyKey or, when
+	// the key is empty, the user's job that has not finished yet.
+	FindJob(ctx context.Context, userID, idempotencyKey string) (SurveyJob, error)
+	// UpdateJob replaces the stored job with j.
+	UpdateJob(ctx context.Context, j *SurveyJob) error
+	// GetJobs returns the jobs of userID, newest first.
+	GetJobs(ctx context.Context, userID string) ([]SurveyJob, error)
+	// FailUnfinished marks every queued or running job as failed, for jobs
+	// whose process went away together with the password they needed.
+	FailUnfinished(ctx context.Context, reason string) (int, error)
+}
+
+// DepartmentRepository stores the registry of faculties and departments.
+type DepartmentRepository interface {
+	PutFaculty(ctx context.Context, f *Faculty) error
+	GetFaculties(ctx context.Context) ([]Faculty, error)
+	// PutDepartment creates or replaces d. Its faculty must exist.
+	PutDepartment(ctx context.Context, d *Department) error
+	GetDepartment(ctx context.Context, code int) (Department, error)
+	GetDepartments(ctx context.Context) ([]Department, error)
+}
+
+// RoleRepository stores the roles admins may grant and the audit log of
+// who changed whose roles.
+type RoleRepository interface {
+	// PutRole creates or replaces r.
+	PutRole(ctx context.Context, r *Role) error
+	GetRole(ctx context.Context, name string) (Role, error)
+	GetRoles(ctx context.Context) ([]Role, error)
+	// EnsureRoles registers the roles that are not registered yet and leaves
+	// the others as they are.
+	EnsureRoles(ctx context.Context, roles []Role) error
+	LogChange(ctx context.Context, c *RoleChange) error
+	// GetChanges returns a page of the audit log, newest first.
+	GetChanges(ctx context.Context, q RoleChangeQuery) (Page[RoleChange], error)
+}
+
+// StatsRepository computes the statistics of the admin dashboard. Every
+// method covers the window q selects.
+type StatsRepository interface {
+	// SuggestionTimeline counts suggestions per period and current status.
+	SuggestionTimeline(ctx context.Context, q StatsQuery) ([]TimelinePoint, error)
+	// DecisionTimes reports the median wait from a suggestion's Date to its
+	// approval or rejection.
+	DecisionTimes(ctx context.Context, q StatsQuery) (DecisionStats, error)
+	TopDepartments(ctx context.Context, q StatsQuery) ([]DepartmentCount, error)
+	TopAuthors(ctx context.Context, q StatsQuery) ([]AuthorCount, error)
+	// TopSuggestions orders suggestions by upvotes or average stars.
+	TopSuggestions(ctx context.Context, q StatsQuery) ([]TopSuggestion, error)
+	EventStats(ctx context.Context, q StatsQuery) (EventStats, error)
+}
+
+// ExportRepository streams the records of admin exports to fn one at a time,
+// oldest first. An error from fn stops the export and is returned.
+type ExportRepository interface {
+	EachSuggestion(ctx context.Context, q ExportQuery, fn func(SuggestionExport) error) error
+	EachEvent(ctx context.Context, q ExportQuery, fn func(Event) error) error
+	EachProject(ctx context.Context, q ExportQuery, fn func(ProjectExport) error) error
+}
+
+// AttachmentRepository records uploaded files and lists them on their
+// parents; the files themselves are kept in storage.
+type AttachmentRepository interface {
+	// AddAttachment records a and lists it on its parent, which must exist.
+	AddAttachment(ctx context.Context, a *Attachment) error
+	GetAttachment(ctx context.Context, id primitive.ObjectID) (Attachment, error)
+	// RemoveAttachment forgets a and takes it off its parent.
+	RemoveAttachment(ctx context.Context, a *Attachment) error
+}
+
+// FollowRepository stores what users follow and the activity their feeds
+// show.
+type FollowRepository interface {
+	// Follow makes f.User follow f.Kind f.Target; following it again changes
+	// nothing. f is refreshed. Callers check that f.User can see the target,
+	// see Viewer.CanSee and Event.VisibleTo.
+	Follow(ctx context.Context, f *Follow) error
+	Unfollow(ctx context.Context, f *Follow) error
+	// GetFollows returns a page of what user follows, latest first.
+	GetFollows(ctx context.Context, user string, q PageQuery) (Page[Follow], error)
+	// CopyFollowers makes the followers of from.Kind from.Target follow
+	// to.Kind to.Target too.
+	CopyFollowers(ctx context.Context, from, to Follow) error
+	Publish(ctx context.Context, a *Activity) error
+	// Feed returns a page of the activity on what user follows or mentioning
+	// them, newest first.
+	Feed(ctx context.Context, user string, q PageQuery) (Page[Activity], error)
+}
+
+// Repositories groups every store the routes need.
+type Repositories struct {
+	Users       UserRepository
+	Suggestions SuggestionRepository
+	Projects    ProjectRepository
+	Events      EventRepository
+	Curricula   CurriculumRepository
+	SurveyJobs  SurveyJobRepository
+	Departments DepartmentRepository
+	Roles       RoleRepository
+	Stats       StatsRepository
+	Exports     ExportRepository
+	Attachments AttachmentRepository
+	Follows     FollowRepository
+}
+
+// NewMongoRepositories returns the stores kept in db, whose indexes
+// EnsureMongoIndexes creates.
+func NewMongoRepositories(db *mongo.Database) *Repositories {
+	return &Repositories{
+		Users:       NewMongoUserRepository(db),
+		Suggestions: NewMongoSuggestionRepository(db),
+		Projects:    NewMongoProjectRepository(db),
+		Events:      NewMongoEventRepository(db),
+		Curricula:   NewMongoCurriculumRepository(db),
+		SurveyJobs:  NewMongoSurveyJobRepository(db),
+		Departments: NewMongoDepartmentRepository(db),
+		Roles:       NewMongoRoleRepository(db),
+		Stats:       NewMongoStatsRepository(db),
+		Exports:     NewMongoExportRepository(db),
+		Attachments: NewMongoAttachmentRepository(db),
+		Follows:     NewMongoFollowRepository(db),
+	}
+}
+
+// mongoIndexes are the unique indexes the Mongo repositories rely on, so that
+// concurrent upserts and retried inserts never store a document twice.
+var mongoIndexes = []struct {
+	collection string
+	model      mongo.IndexModel
+}{
+	{"follows", mongo.IndexModel{
+		Keys:    bson.D{{Key: "user", Value: 1}, {Key: "kind", Value: 1}, {Key: "target", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}},
+	{"events", mongo.IndexModel{
+		Keys:    bson.D{{Key: "import_key", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"import_key": bson.M{"$type": "string"}}),
+	}},
+	{"survey_jobs", mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "idempotency_key", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"idempotency_key": bson.M{"$type": "string"}}),
+	}},
+}
+
+// EnsureMongoIndexes creates the indexes of the Mongo repositories in db.
+// Creating an index that exists changes nothing, so it runs on every start.
+func EnsureMongoIndexes(ctx context.Context, db *mongo.Database) error {
+	for _, index := range mongoIndexes {
+		if _, err := db.Collection(index.collection).Indexes().CreateOne(ctx, index.model); err != nil {
+			return fmt.Errorf("index on %s: %w", index.collection, err)
+		}
+	}
+	return nil
+}
+
+// NewMemoryRepositories returns empty in-memory stores, for tests and local
+// runs without MongoDB.
+func NewMemoryRepositories() *Repositories {
+	r := &Repositories{
+		Users:       NewMemoryUserRepository(),
+		Suggestions: NewMemorySuggestionRepository(),
+		Projects:    NewMemoryProjectRepository(),
+		Events:      NewMemoryEventRepository(),
+		Curricula:   NewMemoryCurriculumRepository(),
+		SurveyJobs:  NewMemorySurveyJobRepository(),
+		Departments: NewMemoryDepartmentRepository(),
+		Roles:       NewMemoryRoleRepository(),
+		Follows:     NewMemoryFollowRepository(),
+	}
+	r.Stats = NewMemoryStatsRepository(r.Suggestions, r.Events)
+	r.Exports = NewMemoryExportRepository(r.Suggestions, r.Events, r.Projects)
+	r.Attachments = NewMemoryAttachmentRepository(r.Suggestions, r.Projects, r.Events)
+	return r
+}
@@ -0,0 +1,1132 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The same contract runs against every implementation. The Mongo run needs a
+// disposable deployment in MONGO_TEST_URI and is skipped otherwise.
+
+func TestMemoryRepositories(t *testing.T) {
+	runRepositoryContract(t, func(t *testing.T) *Repositories {
+		return NewMemoryRepositories()
+	})
+}
+
+func TestMongoRepositories(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect(ctx) })
+	runRepositoryContract(t, func(t *testing.T) *Repositories {
+		db := client.Database(fmt.Sprintf("probee_test_%d", time.Now().UnixNano()))
+		t.Cleanup(func() { _ = db.Drop(ctx) })
+		if err := EnsureMongoIndexes(ctx, db); err != nil {
+			t.Fatal(err)
+		}
+		return NewMongoRepositories(db)
+	})
+}
+
+func runRepositoryContract(t *testing.T, newRepos func(t *testing.T) *Repositories) {
+	t.Run("Users", func(t *testing.T) { testUserRepository(t, newRepos(t).Users) })
+	t.Run("Suggestions", func(t *testing.T) { testSuggestionRepository(t, newRepos(t).Suggestions) })
+	t.Run("Projects", func(t *testing.T) { testProjectRepository(t, newRepos(t).Projects) })
+	t.Run("Events", func(t *testing.T) { testEventRepository(t, newRepos(t).Events) })
+	t.Run("Curricula", func(t *testing.T) { testCurriculumRepository(t, newRepos(t).Curricula) })
+	t.Run("SurveyJobs", func(t *testing.T) { testSurveyJobRepository(t, newRepos(t).SurveyJobs) })
+	t.Run("Departments", func(t *testing.T) { testDepartmentRepository(t, newRepos(t).Departments) })
+	t.Run("Roles", func(t *testing.T) { testRoleRepository(t, newRepos(t).Roles) })
+	t.Run("Stats", func(t *testing.T) { testStatsRepository(t, newRepos(t)) })
+	t.Run("Exports", func(t *testing.T) { testExportRepository(t, newRepos(t)) })
+	t.Run("Attachments", func(t *testing.T) { testAttachmentRepository(t, newRepos(t)) })
+	t.Run("Follows", func(t *testing.T) { testFollowRepository(t, newRepos(t).Follows) })
+}
+
+func testUserRepository(t *testing.T, users UserRepository) {
+	ctx := context.Background()
+
+	if err := users.InsertToDB(ctx, &User{Username: "c2011011025"}); err == nil {
+		t.Fatal("expected a user without user_type to be rejected")
+	}
+	u := User{Username: "c2011011025", UserType: "student"}
+	if err := users.InsertToDB(ctx, &u); err != nil {
+		t.Fatal(err)
+	}
+	if len(u.Roles) != 1 || u.Roles[0] != "student" {
+		t.Fatalf("roles = %v, want [student]", u.Roles)
+	}
+	if u.Department != 11011 {
+		t.Fatalf("department = %d, want 11011", u.Department)
+	}
+	if err := users.InsertToDB(ctx, &User{Username: "c2011011025", UserType: "student"}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("second insert: got %v, want a conflict", err)
+	}
+
+	if err := users.FindUser(ctx, &User{Username: "c2011011025", UserType: "teacher"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("FindUser with wrong type: got %v, want ErrNotFound", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := users.GrantRoles(ctx, &u, []string{"admin", "haysev_admin"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	found := User{Username: "c2011011025", UserType: "student"}
+	if err := users.FindUser(ctx, &found); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(found.Roles) != "[student admin haysev_admin]" {
+		t.Fatalf("roles after granting twice = %v", found.Roles)
+	}
+	if err := users.RevokeRoles(ctx, &found, []string{"haysev_admin", "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(found.Roles) != "[student admin]" {
+		t.Fatalf("roles after RevokeRoles = %v", found.Roles)
+	}
+	if err := users.GrantRoles(ctx, &User{Username: "nobody"}, []string{"admin"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GrantRoles(nobody): got %v, want ErrNotFound", err)
+	}
+
+	info := PersonalInfo{FullName: "Ada Lovelace", DepartmentName: "Computer Engineering", Year: "3"}
+	if err := users.UpdateProfile(ctx, &found, info); err != nil {
+		t.Fatal(err)
+	}
+	if found.FullName != info.FullName || found.DepartmentName != info.DepartmentName || found.Year != "3" {
+		t.Fatalf("profile not refreshed: %+v", found)
+	}
+
+	if err := users.InsertToDB(ctx, &User{Username: "t1000000001", UserType: "teacher"}); err != nil {
+		t.Fatal(err)
+	}
+	all, err := users.SearchUsers(ctx, UserQuery{Viewer: &found})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all.Total != 2 || len(all.Items) != 2 || all.Items[0].Username != "c2011011025" {
+		t.Fatalf("SearchUsers() = %+v, want both users", all)
+	}
+	paged, err := users.SearchUsers(ctx, UserQuery{PageQuery: PageQuery{Page: 2, PerPage: 1}, Viewer: &found})
+	if err != nil || paged.Total != 2 || len(paged.Items) != 1 || paged.Items[0].Username != "t1000000001" {
+		t.Fatalf("second page = %+v, %v", paged, err)
+	}
+	teacher := User{Username: "t1000000001", UserType: "teacher", Department: 1000000}
+	byName := UserQuery{Query: "lovel", Viewer: &teacher}
+	if page, err := users.SearchUsers(ctx, byName); err != nil || page.Total != 1 {
+		t.Fatalf("search by public name = %+v, %v", page, err)
+	}
+	if err := users.UpdatePrivacy(ctx, &found, Privacy{FullName: VisibilityDepartment}); err != nil {
+		t.Fatal(err)
+	}
+	if found.Privacy.FullName != VisibilityDepartment || found.FullName != "Ada Lovelace" {
+		t.Fatalf("privacy not stored: %+v", found)
+	}
+	if page, err := users.SearchUsers(ctx, byName); err != nil || page.Total != 0 {
+		t.Fatalf("search matched a hidden name: %+v, %v", page, err)
+	}
+	byName.Viewer = &found
+	if page, err := users.SearchUsers(ctx, byName); err != nil || page.Total != 1 {
+		t.Fatalf("search for own name = %+v, %v", page, err)
+	}
+	if page, err := users.SearchUsers(ctx, UserQuery{UserType: "teacher", Viewer: &found}); err != nil || page.Total != 1 {
+		t.Fatalf("search by user type = %+v, %v", page, err)
+	}
+
+	stale, err := users.StaleProfiles(ctx, time.Now().Add(-time.Hour), 10)
+	if err != nil || len(stale) != 1 || stale[0].Username != "t1000000001" {
+		t.Fatalf("StaleProfiles = %+v, %v, want only the never synced teacher", stale, err)
+	}
+	got, err := users.GetUser(ctx, "c2011011025")
+	if err != nil || got.FullName != "Ada Lovelace" {
+		t.Fatalf("GetUser = %+v, %v", got, err)
+	}
+	if _, err := users.GetUser(ctx, "nobody"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetUser(nobody): got %v, want ErrNotFound", err)
+	}
+
+	imported := User{Username: "c2012011001", UserType: "student", Roles: []string{"admin"}}
+	if result, err := users.ImportUser(ctx, &imported); err != nil || result != UpsertCreated || imported.Department != 12011 || !imported.HasRole("student") || !imported.HasRole("admin") {
+		t.Fatalf("ImportUser(new) = %v, %+v, %v", result, imported, err)
+	}
+	again := User{Username: "c2012011001", UserType: "student", Roles: []string{"admin"}}
+	if result, err := users.ImportUser(ctx, &again); err != nil || result != UpsertUnchanged {
+		t.Fatalf("ImportUser(same) = %v, %v", result, err)
+	}
+	renamed := User{Username: "c2011011025", UserType: "student", FullName: "Augusta Ada King"}
+	if result, err := users.ImportUser(ctx, &renamed); err != nil || result != UpsertUpdated || renamed.FullName != "Augusta Ada King" || renamed.DepartmentName == "" {
+		t.Fatalf("ImportUser(existing) = %v, %+v, %v", result, renamed, err)
+	}
+	if _, err := users.ImportUser(ctx, &User{Username: "c2011011025", UserType: "teacher"}); ErrorCode(err) != "USER_TYPE_MISMATCH" {
+		t.Fatalf("ImportUser(other type): got %v, want USER_TYPE_MISMATCH", err)
+	}
+
+	// Users of unknown department share no department with each other.
+	unknown, err := users.GetUser(ctx, "t1000000001")
+	if err != nil || unknown.Department != 0 {
+		t.Fatalf("GetUser(teacher) = %+v, %v, want no department", unknown, err)
+	}
+	if err := users.UpdateProfile(ctx, &unknown, PersonalInfo{FullName: "Grace Hopper"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.UpdatePrivacy(ctx, &unknown, Privacy{FullName: VisibilityDepartment}); err != nil {
+		t.Fatal(err)
+	}
+	stranger := User{Username: "t1000000002", UserType: "teacher"}
+	if page, err := users.SearchUsers(ctx, UserQuery{Query: "hopper", Viewer: &stranger}); err != nil || page.Total != 0 {
+		t.Fatalf("search matched a name kept to an unknown department: %+v, %v", page, err)
+	}
+}
+
+func testSuggestionRepository(t *testing.T, suggestions SuggestionRepository) {
+	ctx := context.Background()
+
+	s := Suggestion{Title: "More benches", Content: "The garden needs benches", AuthorID: "c2011011025", Status: "approved"}
+	if err := suggestions.InsertToDB(ctx, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.ID.IsZero() || s.Status != "pending" || s.Date == "" {
+		t.Fatalf("inserted suggestion not initialised: %+v", s)
+	}
+
+	var loaded Suggestion
+	if err := suggestions.WithID(ctx, &loaded, s.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Title != s.Title || loaded.AuthorID != s.AuthorID {
+		t.Fatalf("WithID = %+v", loaded)
+	}
+	if err := suggestions.WithID(ctx, &Suggestion{}, primitive.NewObjectID().Hex()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("WithID(unknown): got %v, want ErrNotFound", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := suggestions.Vote(ctx, &Suggestion{ID: s.ID}, "c2011011026", Upvote); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := suggestions.Vote(ctx, &s, "c2011011027", Upvote); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Upvotes) != 2 || s.UpvoteCount != 2 || s.Score != 2 {
+		t.Fatalf("votes = %+v, want two distinct voters", s.Votes)
+	}
+	if err := suggestions.Vote(ctx, &s, "c2011011027", Downvote); err != nil {
+		t.Fatal(err)
+	}
+	if err := suggestions.Vote(ctx, &s, "c2011011028", Downvote); err != nil {
+		t.Fatal(err)
+	}
+	if s.UpvoteCount != 1 || s.DownvoteCount != 2 || s.Score != -1 || s.VoteOf("c2011011027") != -1 {
+		t.Fatalf("votes after switching to a downvote = %+v", s.Votes)
+	}
+	for i := 0; i < 2; i++ {
+		if err := suggestions.Unvote(ctx, &s, "c2011011028", Upvote); err != nil {
+			t.Fatal(err)
+		}
+		if err := suggestions.Unvote(ctx, &s, "c2011011027", Downvote); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.UpvoteCount != 1 || s.DownvoteCount != 1 || s.Score != 0 || s.VoteOf("c2011011027") != 0 || s.VoteOf("c2011011028") != -1 {
+		t.Fatalf("votes after retracting = %+v", s.Votes)
+	}
+	voters, err := suggestions.GetVoters(ctx, s.ID, VoterQuery{})
+	if err != nil || voters.Total != 2 || voters.Items[0] != (Voter{Username: "c2011011026", Vote: Upvote}) || voters.Items[1].Vote != Downvote {
+		t.Fatalf("voters = %+v, %v", voters, err)
+	}
+	if voters, err := suggestions.GetVoters(ctx, s.ID, VoterQuery{Vote: Downvote}); err != nil || voters.Total != 1 || voters.Items[0].Username != "c2011011028" {
+		t.Fatalf("downvoters = %+v, %v", voters, err)
+	}
+	if _, err := suggestions.GetVoters(ctx, primitive.NewObjectID(), VoterQuery{}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("voters of an unknown suggestion: %v", err)
+	}
+	if err := suggestions.Vote(ctx, &Suggestion{ID: primitive.NewObjectID()}, "c2011011026", Upvote); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("vote on an unknown suggestion: %v", err)
+	}
+	if err := suggestions.CountVotes(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := suggestions.GiveStar(ctx, &s, "c2011011026", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := suggestions.GiveStar(ctx, &s, "c2011011026", 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := suggestions.GiveStar(ctx, &s, "c2011011027", 4); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Stars) != 2 || s.CalculateAverageStars() != 4.5 {
+		t.Fatalf("stars = %+v, want two ratings averaging 4.5", s.Stars)
+	}
+	if s.Hot <= 0 {
+		t.Fatalf("hot rank after good ratings = %v", s.Hot)
+	}
+
+	if err := suggestions.Approve(ctx, &s, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if s.Status != "approved" {
+		t.Fatalf("status after Approve = %q", s.Status)
+	}
+
+	other := Suggestion{Title: "Longer library hours", Content: "Open until midnight", AuthorID: "c2011011026"}
+	if err := suggestions.InsertToDB(ctx, &other); err != nil {
+		t.Fatal(err)
+	}
+	if err := suggestions.Reject(ctx, &other, "admin", "duplicate"); err != nil {
+		t.Fatal(err)
+	}
+	if other.Status != "rejected" {
+		t.Fatalf("status after Reject = %q", other.Status)
+	}
+	if err := suggestions.Reject(ctx, &other, "admin", "again"); ErrorCode(err) != "SUGGESTION_ALREADY_REJECTED" {
+		t.Fatalf("second rejection: got %v", err)
+	}
+	// Deciding on a missing suggestion leaves no decision behind to collide
+	// with a retry.
+	missing := Suggestion{ID: primitive.NewObjectID()}
+	for i := 0; i < 2; i++ {
+		for name, decide := range map[string]func() error{
+			"Approve": func() error { return suggestions.Approve(ctx, &missing, "admin") },
+			"Reject":  func() error { return suggestions.Reject(ctx, &missing, "admin", "spam") },
+			"Report":  func() error { return suggestions.Report(ctx, &missing, "c2011011025") },
+		} {
+			if err := decide(); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("%s(missing) attempt %d: got %v, want ErrNotFound", name, i+1, err)
+			}
+		}
+	}
+
+	third := Suggestion{Title: "Spam", Content: "Buy now", AuthorID: "c2011011027"}
+	if err := suggestions.InsertToDB(ctx, &third); err != nil {
+		t.Fatal(err)
+	}
+	if err := suggestions.Report(ctx, &third, "c2011011025"); err != nil {
+		t.Fatal(err)
+	}
+	pendingOne := Suggestion{Title: "Water fountains", Content: "On every floor", AuthorID: "c2011011025"}
+	if err := suggestions.InsertToDB(ctx, &pendingOne); err != nil {
+		t.Fatal(err)
+	}
+
+	lists := []struct {
+		name string
+		get  func(context.Context) ([]Suggestion, error)
+		want int
+	}{
+		{"approved", suggestions.GetApprovedSuggestions, 1},
+		{"rejected", suggestions.GetRejectedSuggestions, 1},
+		{"reported", suggestions.GetReportedSuggestions, 1},
+		{"pending", suggestions.GetPendingSuggestions, 1},
+		{"all", suggestions.GetAllSuggestions, 4},
+	}
+	for _, l := range lists {
+		got, err := l.get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != l.want {
+			t.Errorf("%s suggestions: got %d, want %d", l.name, len(got), l.want)
+		}
+	}
+
+	popular := Suggestion{Title: "Bike racks", Content: "By the library", AuthorID: "c2011011028"}
+	fresh := Suggestion{Title: "Lockers", Content: "In the basement", AuthorID: "c2011011028"}
+	for _, n := range []*Suggestion{&popular, &fresh} {
+		if err := suggestions.InsertToDB(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+		if err := suggestions.Approve(ctx, n, "admin"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, voter := range []string{"c2011011026", "c2011011027"} {
+		if err := suggestions.Vote(ctx, &popular, voter, Upvote); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := suggestions.Rank(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, order := range []struct {
+		q    RankingQuery
+		want []primitive.ObjectID
+	}{
+		{RankingQuery{}, []primitive.ObjectID{popular.ID, s.ID, fresh.ID}},
+		{RankingQuery{Sort: SortTop, Window: WindowWeek}, []primitive.ObjectID{popular.ID, fresh.ID, s.ID}},
+		{RankingQuery{Sort: SortNew, Window: WindowSemester}, []primitive.ObjectID{fresh.ID, popular.ID, s.ID}},
+	} {
+		ranked, err := suggestions.GetRankedSuggestions(ctx, order.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []primitive.ObjectID
+		for _, r := range ranked {
+			got = append(got, r.ID)
+		}
+		if !slices.Equal(got, order.want) {
+			t.Errorf("%+v ranking = %v, want %v", order.q, got, order.want)
+		}
+	}
+
+	if err := suggestions.Edit(ctx, &Suggestion{ID: pendingOne.ID}, "Water fountains", Markdown{Source: "On every floor, please #water", Tags: []string{"water"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := suggestions.Edit(ctx, &s, "Benches", Markdown{Source: "Anywhere"}); ErrorCode(err) != "SUGGESTION_NOT_EDITABLE" || s.Title != "More benches" {
+		t.Fatalf("editing an approved suggestion: got %v, %+v", err, s)
+	}
+	if err := suggestions.Edit(ctx, &Suggestion{ID: primitive.NewObjectID()}, "Gone", Markdown{Source: "Gone"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("editing an unknown suggestion: got %v", err)
+	}
+	mine, err := suggestions.GetAuthorSuggestions(ctx, []string{"c2011011025", "anon:none"})
+	if err != nil || len(mine) != 2 || mine[0].ID != pendingOne.ID || mine[0].Content != "On every floor, please #water" || !slices.Equal(mine[0].Tags, []string{"water"}) {
+		t.Fatalf("author's suggestions = %+v, %v", mine, err)
+	}
+
+	for _, reason := range []string{"first", "second"} {
+		if err := suggestions.LogDeanonymization(ctx, &Deanonymization{Suggestion: s.ID, Actor: "admin", Reason: reason, Author: "c2011011025"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log, err := suggestions.GetDeanonymizations(ctx, PageQuery{PerPage: 1})
+	if err != nil || log.Total != 2 || len(log.Items) != 1 || log.Items[0].Reason != "second" || log.Items[0].At == 0 {
+		t.Fatalf("audit log = %+v, %v", log, err)
+	}
+
+	var raters atomic.Int32
+	concurrently(t, 8, func() error {
+		return suggestions.GiveStar(ctx, &Suggestion{ID: s.ID}, fmt.Sprint("c20120110", 10+raters.Add(1)), 5)
+	})
+	if err := suggestions.WithID(ctx, &s, s.ID.Hex()); err != nil || len(s.Stars) != 10 {
+		t.Fatalf("concurrent stars kept %d of 10 ratings, %v", len(s.Stars), err)
+	}
+	if err := suggestions.GiveStar(ctx, &Suggestion{ID: primitive.NewObjectID()}, "c2011011026", 5); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("star on an unknown suggestion: %v", err)
+	}
+}
+
+func testProjectRepository(t *testing.T, projects ProjectRepository) {
+	ctx := context.Background()
+	s := Suggestion{ID: primitive.NewObjectID(), Title: "Bike racks", Content: "Near the gate", AuthorID: "c2011011025", Status: "pending", Tags: []string{"campus"}}
+
+	if err := projects.CreateFrom(ctx, &Project{AdvisorID: "t1000000001"}, s); ErrorCode(err) != "SUGGESTION_NOT_APPROVED" {
+		t.Fatalf("CreateFrom(pending): got %v", err)
+	}
+	s.Status = "approved"
+	if err := projects.CreateFrom(ctx, &Project{}, s); ErrorCode(err) != "ADVISOR_NOT_ASSIGNED" {
+		t.Fatalf("CreateFrom(no advisor): got %v", err)
+	}
+	p := Project{AdvisorID: "t1000000001"}
+	if err := projects.CreateFrom(ctx, &p, s); err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != s.ID || len(p.Team) != 1 || p.Team[0].Role != "leader" || p.Team[0].UserID != s.AuthorID {
+		t.Fatalf("project not built from suggestion: %+v", p)
+	}
+	if p.ContentHTML != RenderMarkdown(s.Content) {
+		t.Fatalf("project of a suggestion stored without HTML has %q", p.ContentHTML)
+	}
+	if err := projects.CreateFrom(ctx, &Project{AdvisorID: "t1000000001"}, s); !errors.Is(err, ErrConflict) {
+		t.Fatalf("second CreateFrom: got %v, want a conflict", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := projects.Vote(ctx, &Project{ID: p.ID}, "c2011011026", Upvote); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := projects.AddStar(ctx, &p, "c2011011026", 4); err != nil {
+		t.Fatal(err)
+	}
+	loaded := Project{ID: p.ID}
+	if err := projects.GetProject(ctx, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Upvotes) != 1 || loaded.Score != 1 || len(loaded.Stars) != 1 || loaded.Stars[0].Star != 4 {
+		t.Fatalf("project votes = %v stars = %+v", loaded.Upvotes, loaded.Stars)
+	}
+	if err := projects.GetProject(ctx, &Project{ID: primitive.NewObjectID()}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetProject(unknown): got %v, want ErrNotFound", err)
+	}
+	all, err := projects.GetAllProjects(ctx)
+	if err != nil || len(all) != 1 {
+		t.Fatalf("GetAllProjects = %d projects, %v", len(all), err)
+	}
+}
+
+func testEventRepository(t *testing.T, events EventRepository) {
+	ctx := context.Background()
+	start := primitive.NewDateTimeFromTime(time.Now().Add(24 * time.Hour))
+
+	invalid := []struct {
+		event Event
+		want  string
+	}{
+		{Event{}, "INVALID_EVENT"},
+		{Event{Title: "Feeding"}, "INVALID_ORGANIZER"},
+		{Event{Title: "Feeding", OrganizerID: "c2011011025"}, "INVALID_ORGANIZER_NAME"},
+		{Event{Title: "Feeding", OrganizerID: "c2011011025", Author: "Ada", StartTime: start}, "INVALID_EVENT_TYPE"},
+	}
+	for _, tc := range invalid {
+		if err := events.CreateEvent(ctx, &tc.event); ErrorCode(err) != tc.want {
+			t.Errorf("CreateEvent(%+v): got %v, want %s", tc.event, err, tc.want)
+		}
+	}
+
+	e := Event{Title: "Feeding", OrganizerID: "c2011011025", Author: "Ada", StartTime: start, Type: "haysev"}
+	if err := events.CreateEvent(ctx, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.ID.IsZero() || e.Status != "pending" || e.CreatedAt == 0 {
+		t.Fatalf("created event not initialised: %+v", e)
+	}
+	other := Event{Title: "Cleanup", OrganizerID: "c2011011026", Author: "Grace", StartTime: start, Type: "haysev"}
+	if err := events.CreateEvent(ctx, &other); err != nil {
+		t.Fatal(err)
+	}
+
+	mine, err := events.GetEvents(ctx, &User{Username: "c2011011025"})
+	if err != nil || len(mine) != 1 || mine[0].ID != e.ID {
+		t.Fatalf("GetEvents = %+v, %v", mine, err)
+	}
+	approved, err := events.GetAllEvents(ctx)
+	if err != nil || len(approved) != 0 {
+		t.Fatalf("GetAllEvents before approval = %d, %v", len(approved), err)
+	}
+
+	toApprove := Event{ID: e.ID}
+	if err := events.ApproveEvent(ctx, &toApprove); err != nil {
+		t.Fatal(err)
+	}
+	if toApprove.Status != "approved" || toApprove.Title != "Feeding" {
+		t.Fatalf("ApproveEvent = %+v", toApprove)
+	}
+	if err := events.ApproveEvent(ctx, &Event{ID: primitive.NewObjectID()}); ErrorCode(err) != "EVENT_NOT_FOUND" {
+		t.Fatalf("ApproveEvent(unknown): got %v", err)
+	}
+	approved, err = events.GetAllEvents(ctx)
+	if err != nil || len(approved) != 1 {
+		t.Fatalf("GetAllEvents after approval = %d, %v", len(approved), err)
+	}
+	all, err := events.GetPendingEvents(ctx)
+	if err != nil || len(all) != 2 {
+		t.Fatalf("GetPendingEvents = %d, %v", len(all), err)
+	}
+
+	removed := Event{ID: other.ID}
+	if err := events.RemoveEvent(ctx, &removed); err != nil {
+		t.Fatal(err)
+	}
+	if removed.Title != "Cleanup" {
+		t.Fatalf("RemoveEvent did not load the event: %+v", removed)
+	}
+	if err := events.RemoveEvent(ctx, &Event{ID: other.ID}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("RemoveEvent twice: got %v, want ErrNotFound", err)
+	}
+
+	imported := Event{ImportKey: "fair", Title: "Career day", OrganizerID: "t1000000001", Type: "fair", Tags: []string{}, StartTime: primitive.NewDateTimeFromTime(time.Now().Add(24 * time.Hour).Truncate(time.Millisecond))}
+	copied := imported
+	if result, err := events.ImportEvent(ctx, &copied); err != nil || result != UpsertCreated || copied.ID.IsZero() || copied.Status != "approved" {
+		t.Fatalf("ImportEvent(new) = %v, %+v, %v", result, copied, err)
+	}
+	id := copied.ID
+	copied = imported
+	if result, err := events.ImportEvent(ctx, &copied); err != nil || result != UpsertUnchanged || copied.ID != id {
+		t.Fatalf("ImportEvent(same) = %v, %+v, %v", result, copied, err)
+	}
+	copied = imported
+	copied.Location = "Hall A"
+	if result, err := events.ImportEvent(ctx, &copied); err != nil || result != UpsertUpdated || copied.ID != id || copied.Location != "Hall A" {
+		t.Fatalf("ImportEvent(changed) = %v, %+v, %v", result, copied, err)
+	}
+	if _, err := events.ImportEvent(ctx, &Event{Title: "No key"}); !errors.Is(err, ErrValidation) {
+		t.Fatalf("ImportEvent(no key): got %v, want a validation error", err)
+	}
+
+	concurrently(t, 8, func() error {
+		e := imported
+		e.ImportKey = "expo"
+		_, err := events.ImportEvent(ctx, &e)
+		return err
+	})
+	approved, err = events.GetAllEvents(ctx)
+	expos := 0
+	for _, e := range approved {
+		if e.ImportKey == "expo" {
+			expos++
+		}
+	}
+	if err != nil || expos != 1 {
+		t.Fatalf("concurrent imports stored %d events, %v", expos, err)
+	}
+
+	// Events stored before descriptions were Markdown have no HTML.
+	legacy := Event{Title: "Planting", Description: "Bring **gloves**", OrganizerID: "c2011011025", Author: "Ada", StartTime: start, Type: "haysev"}
+	if err := events.CreateEvent(ctx, &legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := events.RenderMarkdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	loaded := Event{ID: legacy.ID}
+	if err := events.GetEvent(ctx, &loaded); err != nil || loaded.DescriptionHTML != RenderMarkdown(legacy.Description) || loaded.DescriptionHTML == "" {
+		t.Fatalf("legacy event after RenderMarkdown = %q, %v", loaded.DescriptionHTML, err)
+	}
+}
+
+// concurrently runs fn n times at once, failing t on the first error.
+func concurrently(t *testing.T, n int, fn func() error) {
+	t.Helper()
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn()
+		}(i)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testCurriculumRepository(t *testing.T, curricula CurriculumRepository) {
+	ctx := context.Background()
+	u := &User{Username: "c2011011025", Department: 11011, Cirriculum: "Computer Engineering 2020"}
+	rows := []CourseData{
+		{CourseID: "272", CourseCode: "CENG 272", CourseName: "Software Engineering", Credits: "3", Grade: "", Semester: 4, Year: 2},
+		{CourseID: "101", CourseCode: "CENG 101", CourseName: "Programming I", Credits: "4", Grade: "BB", Semester: 1, Year: 1},
+		{CourseID: "103", CourseCode: "MATH 103", CourseName: "Calculus I", Credits: "5", Grade: "CB", Semester: 1, Year: 1},
+	}
+
+	sync, err := curricula.Sync(ctx, u, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sync.Added != 3 || sync.Updated != 0 || len(sync.GradeChanges) != 0 {
+		t.Fatalf("first sync = %+v", sync)
+	}
+	if len(sync.Courses) != 3 || sync.Courses[0].CourseCode != "CENG 101" || sync.Courses[2].CourseCode != "CENG 272" {
+		t.Fatalf("courses not ordered by year and semester: %+v", sync.Courses)
+	}
+	if sync.Courses[0].Credits != "4" || sync.Courses[0].Department != 11011 {
+		t.Fatalf("course not joined with the catalogue: %+v", sync.Courses[0])
+	}
+
+	again, err := curricula.Sync(ctx, u, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Added != 0 || again.Updated != 0 || again.Removed != 0 {
+		t.Fatalf("unchanged sync wrote something: %+v", again)
+	}
+
+	rows[0].Grade = "AA"
+	changed, err := curricula.Sync(ctx, u, rows[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.Updated != 1 || changed.Removed != 2 || len(changed.GradeChanges) != 1 {
+		t.Fatalf("re-sync = %+v", changed)
+	}
+	if gc := changed.GradeChanges[0]; gc.CourseID != "272" || gc.OldGrade != "" || gc.NewGrade != "AA" {
+		t.Fatalf("grade change = %+v", gc)
+	}
+
+	stored, err := curricula.GetUserCurriculum(ctx, u)
+	if err != nil || len(stored) != 1 || stored[0].Grade != "AA" {
+		t.Fatalf("GetUserCurriculum = %+v, %v", stored, err)
+	}
+	plan, err := curricula.GetCirriculum(ctx, 11011, "Computer Engineering 2020")
+	if err != nil || len(plan.Index) != 1 || plan.ID.IsZero() {
+		t.Fatalf("GetCirriculum = %+v, %v", plan, err)
+	}
+	if _, err := curricula.GetCirriculum(ctx, 99999, "none"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetCirriculum(unknown): got %v, want ErrNotFound", err)
+	}
+}
+
+func testSurveyJobRepository(t *testing.T, jobs SurveyJobRepository) {
+	ctx := context.Background()
+
+	if err := jobs.CreateJob(ctx, &SurveyJob{}); ErrorCode(err) != "INVALID_USER" {
+		t.Fatalf("CreateJob without user: got %v", err)
+	}
+	first := SurveyJob{UserID: "c2011011025", IdempotencyKey: "click-1"}
+	if err := jobs.CreateJob(ctx, &first); err != nil {
+		t.Fatal(err)
+	}
+	if first.ID.IsZero() || first.Status != JobQueued || first.CreatedAt == 0 {
+		t.Fatalf("created job not initialised: %+v", first)
+	}
+
+	active, err := jobs.FindJob(ctx, "c2011011025", "")
+	if err != nil || active.ID != first.ID {
+		t.Fatalf("FindJob(active) = %+v, %v", active, err)
+	}
+	byKey, err := jobs.FindJob(ctx, "c2011011025", "click-1")
+	if err != nil || byKey.ID != first.ID {
+		t.Fatalf("FindJob(key) = %+v, %v", byKey, err)
+	}
+	if _, err := jobs.FindJob(ctx, "c2011011026", "click-1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("FindJob(other user): got %v, want ErrNotFound", err)
+	}
+
+	first.Status = JobSucceeded
+	first.Items = append(first.Items, SurveyItem{Course: "CENG 272", Status: JobSucceeded, CompletedAt: primitive.NewDateTimeFromTime(time.Now())})
+	if err := jobs.UpdateJob(ctx, &first); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := jobs.GetJob(ctx, first.ID)
+	if err != nil || loaded.Status != JobSucceeded || len(loaded.Items) != 1 || loaded.Items[0].Course != "CENG 272" {
+		t.Fatalf("GetJob = %+v, %v", loaded, err)
+	}
+	if _, err := jobs.FindJob(ctx, "c2011011025", ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("FindJob(active) after finishing: got %v, want ErrNotFound", err)
+	}
+	if err := jobs.UpdateJob(ctx, &SurveyJob{ID: primitive.NewObjectID()}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("UpdateJob(unknown): got %v, want ErrNotFound", err)
+	}
+
+	second := SurveyJob{UserID: "c2011011025"}
+	if err := jobs.CreateJob(ctx, &second); err != nil {
+		t.Fatal(err)
+	}
+	n, err := jobs.FailUnfinished(ctx, "interrupted")
+	if err != nil || n != 1 {
+		t.Fatalf("FailUnfinished = %d, %v", n, err)
+	}
+	history, err := jobs.GetJobs(ctx, "c2011011025")
+	if err != nil || len(history) != 2 || history[0].ID != second.ID || history[0].Status != JobFailed {
+		t.Fatalf("GetJobs = %+v, %v", history, err)
+	}
+
+	if err := jobs.CreateJob(ctx, &SurveyJob{UserID: "c2011011025", IdempotencyKey: "click-1"}); ErrorCode(err) != "JOB_EXISTS" {
+		t.Fatalf("CreateJob(same key): got %v, want JOB_EXISTS", err)
+	}
+	if err := jobs.CreateJob(ctx, &SurveyJob{UserID: "c2011011026", IdempotencyKey: "click-1"}); err != nil {
+		t.Fatalf("CreateJob(same key, other user): %v", err)
+	}
+	var created atomic.Int32
+	concurrently(t, 8, func() error {
+		err := jobs.CreateJob(ctx, &SurveyJob{UserID: "c2011011027", IdempotencyKey: "click-2"})
+		if err == nil {
+			created.Add(1)
+		}
+		if errors.Is(err, ErrConflict) {
+			return nil
+		}
+		return err
+	})
+	if created.Load() != 1 {
+		t.Fatalf("concurrent CreateJob with one key created %d jobs", created.Load())
+	}
+}
+
+func testDepartmentRepository(t *testing.T, departments DepartmentRepository) {
+	ctx := context.Background()
+
+	cs := Department{Code: 11011, Faculty: 11, NameTR: "Bilgisayar Mühendisliği"}
+	if err := departments.PutDepartment(ctx, &cs); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("department of a missing faculty: got %v, want ErrNotFound", err)
+	}
+	if err := departments.PutFaculty(ctx, &Faculty{Code: 11, NameTR: "Mühendislik"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := departments.PutFaculty(ctx, &Faculty{Code: 11, NameTR: "Mühendislik Fakültesi", NameEN: "Faculty of Engineering"}); err != nil {
+		t.Fatal(err)
+	}
+	faculties, err := departments.GetFaculties(ctx)
+	if err != nil || len(faculties) != 1 || faculties[0].NameEN != "Faculty of Engineering" {
+		t.Fatalf("GetFaculties after replacing = %+v, %v", faculties, err)
+	}
+	if err := departments.PutDepartment(ctx, &cs); err != nil {
+		t.Fatal(err)
+	}
+	if err := departments.PutDepartment(ctx, &Department{Code: 11010, Faculty: 11, NameTR: "Makine Mühendisliği", Aliases: []string{"ME"}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := departments.GetDepartment(ctx, 11011)
+	if err != nil || got.NameTR != cs.NameTR || got.Aliases == nil {
+		t.Fatalf("GetDepartment = %+v, %v", got, err)
+	}
+	if _, err := departments.GetDepartment(ctx, 1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetDepartment(1): got %v, want ErrNotFound", err)
+	}
+	all, err := departments.GetDepartments(ctx)
+	if err != nil || len(all) != 2 || all[0].Code != 11010 {
+		t.Fatalf("GetDepartments = %+v, %v", all, err)
+	}
+	tree := BuildFacultyTree(faculties, all)
+	if len(tree) != 1 || len(tree[0].Departments) != 2 {
+		t.Fatalf("BuildFacultyTree = %+v", tree)
+	}
+}
+
+func testRoleRepository(t *testing.T, roles RoleRepository) {
+	ctx := context.Background()
+
+	if err := roles.EnsureRoles(ctx, DefaultRoles()); err != nil {
+		t.Fatal(err)
+	}
+	if err := roles.PutRole(ctx, &Role{Name: RoleAdmin, Description: "Runs the place"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := roles.EnsureRoles(ctx, DefaultRoles()); err != nil {
+		t.Fatal(err)
+	}
+	admin, err := roles.GetRole(ctx, RoleAdmin)
+	if err != nil || admin.Description != "Runs the place" {
+		t.Fatalf("EnsureRoles replaced a registered role: %+v, %v", admin, err)
+	}
+	for _, name := range []string{"student", "Admin", "a", ""} {
+		if err := roles.PutRole(ctx, &Role{Name: name}); !errors.Is(err, ErrValidation) {
+			t.Fatalf("PutRole(%q): got %v, want a validation error", name, err)
+		}
+	}
+	all, err := roles.GetRoles(ctx)
+	if err != nil || len(all) != 2 || all[0].Name != RoleAdmin {
+		t.Fatalf("GetRoles = %+v, %v", all, err)
+	}
+	if _, err := roles.GetRole(ctx, "student"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetRole(student): got %v, want ErrNotFound", err)
+	}
+
+	for _, c := range []RoleChange{
+		{Actor: "t1", Target: "c1", Granted: []string{RoleAdmin}},
+		{Actor: "t2", Target: "c1", Revoked: []string{RoleAdmin}},
+		{Actor: "t1", Target: "c2", Granted: []string{RoleHaysevAdmin}},
+	} {
+		if err := roles.LogChange(ctx, &c); err != nil {
+			t.Fatal(err)
+		}
+		if c.ID.IsZero() || c.At == 0 {
+			t.Fatalf("LogChange did not stamp %+v", c)
+		}
+	}
+	page, err := roles.GetChanges(ctx, RoleChangeQuery{Target: "c1"})
+	if err != nil || page.Total != 2 || page.Items[0].Actor != "t2" {
+		t.Fatalf("changes of c1 = %+v, %v, want newest first", page, err)
+	}
+	page, err = roles.GetChanges(ctx, RoleChangeQuery{PageQuery: PageQuery{Page: 2, PerPage: 1}, Actor: "t1"})
+	if err != nil || page.Total != 2 || len(page.Items) != 1 || page.Items[0].Target != "c1" {
+		t.Fatalf("second page of changes by t1 = %+v, %v", page, err)
+	}
+}
+
+func testStatsRepository(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+
+	var made []Suggestion
+	for _, author := range []string{"c2011011025", "c2011011026", "c2012011001", "c2011011025"} {
+		s := Suggestion{Title: "Suggestion of " + author, AuthorID: author}
+		if err := repos.Suggestions.InsertToDB(ctx, &s); err != nil {
+			t.Fatal(err)
+		}
+		made = append(made, s)
+	}
+	if err := repos.Suggestions.Approve(ctx, &made[0], "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Suggestions.Reject(ctx, &made[2], "admin", "duplicate"); err != nil {
+		t.Fatal(err)
+	}
+	for _, voter := range []string{"a", "b"} {
+		if err := repos.Suggestions.Vote(ctx, &made[1], voter, Upvote); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repos.Suggestions.GiveStar(ctx, &made[3], "a", 5); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []Event{
+		{Title: "Talk", OrganizerID: "ieee", Author: "IEEE", Type: "talk"},
+		{Title: "Workshop", OrganizerID: "ieee", Author: "IEEE", Type: "workshop"},
+		{Title: "Another talk", OrganizerID: "acm", Author: "ACM", Type: "talk"},
+	} {
+		e.StartTime = primitive.NewDateTimeFromTime(time.Now().Add(24 * time.Hour))
+		if err := repos.Events.CreateEvent(ctx, &e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	timeline, err := repos.Stats.SuggestionTimeline(ctx, StatsQuery{})
+	if err != nil || len(timeline) != 30 {
+		t.Fatalf("default timeline has %d points, %v, want 30", len(timeline), err)
+	}
+	today := timeline[len(timeline)-1]
+	if today.Period != time.Now().UTC().Format(time.DateOnly) || today.Total != 4 || today.Counts["pending"] != 2 || today.Counts["approved"] != 1 {
+		t.Fatalf("today = %+v", today)
+	}
+	if monthly, err := repos.Stats.SuggestionTimeline(ctx, StatsQuery{Interval: IntervalMonth, From: time.Now().UTC().Format(time.DateOnly)}); err != nil || len(monthly) != 1 || monthly[0].Total != 4 {
+		t.Fatalf("monthly timeline of today = %+v, %v", monthly, err)
+	}
+	if _, err := repos.Stats.SuggestionTimeline(ctx, StatsQuery{From: "2024-02-01", To: "2024-01-01"}); !errors.Is(err, ErrValidation) {
+		t.Fatalf("from after to: got %v, want a validation error", err)
+	}
+	if _, err := repos.Stats.SuggestionTimeline(ctx, StatsQuery{From: "2000-01-01", To: "2020-01-01", Interval: IntervalWeek}); ErrorCode(err) != "WINDOW_TOO_LARGE" {
+		t.Fatalf("twenty years by week: got %v, want WINDOW_TOO_LARGE", err)
+	}
+
+	decisions, err := repos.Stats.DecisionTimes(ctx, StatsQuery{})
+	if err != nil || decisions.Approved.Decisions != 1 || decisions.Rejected.Decisions != 1 || decisions.Pending != 2 || decisions.Approved.MedianHours > 1 {
+		t.Fatalf("DecisionTimes = %+v, %v", decisions, err)
+	}
+	departments, err := repos.Stats.TopDepartments(ctx, StatsQuery{})
+	if err != nil || len(departments) != 2 || departments[0] != (DepartmentCount{Department: 11011, Count: 3, Approved: 1}) {
+		t.Fatalf("TopDepartments = %+v, %v", departments, err)
+	}
+	authors, err := repos.Stats.TopAuthors(ctx, StatsQuery{Limit: 1})
+	if err != nil || len(authors) != 1 || authors[0] != (AuthorCount{Author: "c2011011025", Count: 2, Approved: 1}) {
+		t.Fatalf("TopAuthors = %+v, %v", authors, err)
+	}
+	top, err := repos.Stats.TopSuggestions(ctx, StatsQuery{Limit: 2})
+	if err != nil || len(top) != 2 || top[0].ID != made[1].ID || top[0].Upvotes != 2 || top[1].ID != made[3].ID {
+		t.Fatalf("TopSuggestions by upvotes = %+v, %v", top, err)
+	}
+	top, err = repos.Stats.TopSuggestions(ctx, StatsQuery{By: "stars", Limit: 1})
+	if err != nil || len(top) != 1 || top[0].ID != made[3].ID || top[0].Stars != 5 || top[0].Ratings != 1 {
+		t.Fatalf("TopSuggestions by stars = %+v, %v", top, err)
+	}
+	if old, err := repos.Stats.TopSuggestions(ctx, StatsQuery{From: "2020-01-01", To: "2020-12-31"}); err != nil || len(old) != 0 {
+		t.Fatalf("TopSuggestions of 2020 = %+v, %v", old, err)
+	}
+
+	events, err := repos.Stats.EventStats(ctx, StatsQuery{})
+	if err != nil || events.Total != 3 || events.ByType[0] != (KeyCount{Key: "talk", Count: 2}) || events.ByOrganizer[0] != (KeyCount{Key: "ieee", Count: 2}) {
+		t.Fatalf("EventStats = %+v, %v", events, err)
+	}
+}
+
+func testExportRepository(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+
+	var made []Suggestion
+	for _, title := range []string{"Longer library hours", "Bike racks", "Vending machine"} {
+		s := Suggestion{Title: title, AuthorID: "c2011011025"}
+		if err := repos.Suggestions.InsertToDB(ctx, &s); err != nil {
+			t.Fatal(err)
+		}
+		made = append(made, s)
+	}
+	if err := repos.Suggestions.Approve(ctx, &made[0], "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Suggestions.Reject(ctx, &made[1], "admin", "duplicate"); err != nil {
+		t.Fatal(err)
+	}
+	for _, star := range []int{4, 5} {
+		if err := repos.Suggestions.GiveStar(ctx, &made[0], fmt.Sprint("c201101100", star), star); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repos.Suggestions.Vote(ctx, &made[0], "c2011011001", Upvote); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Events.CreateEvent(ctx, &Event{Title: "Talk", OrganizerID: "ieee", Author: "IEEE", Type: "talk", StartTime: primitive.NewDateTimeFromTime(time.Now().Add(24 * time.Hour))}); err != nil {
+		t.Fatal(err)
+	}
+	approved := made[0]
+	approved.Status = "approved"
+	if err := repos.Projects.CreateFrom(ctx, &Project{AdvisorID: "t1000000001"}, approved); err != nil {
+		t.Fatal(err)
+	}
+
+	var suggestions []SuggestionExport
+	collect := func(e SuggestionExport) error {
+		suggestions = append(suggestions, e)
+		return nil
+	}
+	if err := repos.Exports.EachSuggestion(ctx, ExportQuery{}, collect); err != nil || len(suggestions) != 3 {
+		t.Fatalf("EachSuggestion = %+v, %v", suggestions, err)
+	}
+	first := suggestions[0]
+	if first.ID != made[0].ID || first.Status != "approved" || first.Upvotes != 1 || first.Ratings != 2 || first.Stars != 4.5 || first.DecidedBy != "admin" || first.Department != 11011 {
+		t.Fatalf("approved suggestion exported as %+v", first)
+	}
+	if rejected := suggestions[1]; rejected.RejectionReason != "duplicate" || rejected.DecidedAt == "" {
+		t.Fatalf("rejected suggestion exported as %+v", rejected)
+	}
+	if suggestions[2].DecidedBy != "" {
+		t.Fatalf("pending suggestion exported as %+v", suggestions[2])
+	}
+
+	suggestions = nil
+	if err := repos.Exports.EachSuggestion(ctx, ExportQuery{Status: "rejected"}, collect); err != nil || len(suggestions) != 1 || suggestions[0].ID != made[1].ID {
+		t.Fatalf("rejected suggestions = %+v, %v", suggestions, err)
+	}
+	suggestions = nil
+	if err := repos.Exports.EachSuggestion(ctx, ExportQuery{From: "2020-01-01", To: "2020-12-31"}, collect); err != nil || len(suggestions) != 0 {
+		t.Fatalf("suggestions of 2020 = %+v, %v", suggestions, err)
+	}
+	today := time.Now().UTC().Format(time.DateOnly)
+	if err := repos.Exports.EachSuggestion(ctx, ExportQuery{From: today, To: today}, collect); err != nil || len(suggestions) != 3 {
+		t.Fatalf("suggestions of today = %+v, %v", suggestions, err)
+	}
+	if err := repos.Exports.EachSuggestion(ctx, ExportQuery{From: "2024-02-01", To: "2024-01-01"}, collect); !errors.Is(err, ErrValidation) {
+		t.Fatalf("from after to: got %v, want a validation error", err)
+	}
+	stop := errors.New("stop")
+	calls := 0
+	if err := repos.Exports.EachSuggestion(ctx, ExportQuery{}, func(SuggestionExport) error { calls++; return stop }); err != stop || calls != 1 {
+		t.Fatalf("EachSuggestion went on after an error: %v, %d calls", err, calls)
+	}
+
+	var events []Event
+	if err := repos.Exports.EachEvent(ctx, ExportQuery{Status: "pending", From: today}, func(e Event) error {
+		events = append(events, e)
+		return nil
+	}); err != nil || len(events) != 1 || events[0].Title != "Talk" {
+		t.Fatalf("EachEvent = %+v, %v", events, err)
+	}
+	var projects []ProjectExport
+	if err := repos.Exports.EachProject(ctx, ExportQuery{}, func(p ProjectExport) error {
+		projects = append(projects, p)
+		return nil
+	}); err != nil || len(projects) != 1 || projects[0].Advisor != "t1000000001" || len(projects[0].Team) != 1 || projects[0].Team[0] != "c2011011025" {
+		t.Fatalf("EachProject = %+v, %v", projects, err)
+	}
+}
+
+func testAttachmentRepository(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	e := Event{Title: "Poster session", OrganizerID: "c2011011025", Author: "Ada", Type: "haysev", StartTime: primitive.NewDateTimeFromTime(time.Now())}
+	if err := repos.Events.CreateEvent(ctx, &e); err != nil {
+		t.Fatal(err)
+	}
+	poster := Attachment{Kind: AttachedToEvent, Parent: e.ID, Name: "poster.png", ContentType: "image/png", Size: 2048, Thumbnail: true, UploadedBy: "c2011011025"}
+	if err := repos.Attachments.AddAttachment(ctx, &poster); err != nil {
+		t.Fatal(err)
+	}
+	if poster.ID.IsZero() || poster.UploadedAt == 0 {
+		t.Fatalf("added attachment not initialised: %+v", poster)
+	}
+	got, err := repos.Attachments.GetAttachment(ctx, poster.ID)
+	if err != nil || got != poster {
+		t.Fatalf("GetAttachment = %+v, %v", got, err)
+	}
+	if err := repos.Events.GetEvent(ctx, &e); err != nil || len(e.Attachments) != 1 || e.Attachments[0] != poster.Ref() {
+		t.Fatalf("event attachments = %+v, %v", e.Attachments, err)
+	}
+
+	orphan := Attachment{Kind: AttachedToProject, Parent: primitive.NewObjectID(), Name: "plan.pdf"}
+	if err := repos.Attachments.AddAttachment(ctx, &orphan); ErrorCode(err) != "PROJECT_NOT_FOUND" {
+		t.Fatalf("attachment of an unknown project: %v", err)
+	}
+	if _, err := repos.Attachments.GetAttachment(ctx, orphan.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("attachment of an unknown project kept: %v", err)
+	}
+	if err := repos.Attachments.AddAttachment(ctx, &Attachment{Kind: "users", Parent: e.ID}); !errors.Is(err, ErrValidation) {
+		t.Fatalf("attachment of a user: %v", err)
+	}
+
+	if err := repos.Attachments.RemoveAttachment(ctx, &poster); err != nil {
+		t.Fatal(err)
+	}
+	e = Event{ID: e.ID}
+	if err := repos.Events.GetEvent(ctx, &e); err != nil || len(e.Attachments) != 0 {
+		t.Fatalf("event attachments after removal = %+v, %v", e.Attachments, err)
+	}
+	if err := repos.Attachments.RemoveAttachment(ctx, &poster); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second removal: %v", err)
+	}
+}
+
+func testFollowRepository(t *testing.T, follows FollowRepository) {
+	ctx := context.Background()
+	garden := Suggestion{ID: primitive.NewObjectID(), Title: "Benches", Tags: []string{"garden"}, Mentions: []string{"c2011011027"}}
+	other := Suggestion{ID: primitive.NewObjectID(), Title: "Lights"}
+
+	for _, f := range []Follow{
+		{User: "c2011011025", Kind: SubjectSuggestion, Target: garden.ID.Hex()},
+		{User: "c2011011025", Kind: SubjectSuggestion, Target: garden.ID.Hex()},
+		{User: "c2011011026", Kind: SubjectTag, Target: "Garden"},
+	} {
+		if err := follows.Follow(ctx, &f); err != nil || f.Since == 0 {
+			t.Fatalf("follow %+v: %v", f, err)
+		}
+	}
+	for _, f := range []Follow{
+		{User: "c2011011025", Kind: "users", Target: "c2011011026"},
+		{User: "c2011011025", Kind: SubjectEvent, Target: "not-an-id"},
+		{User: "c2011011025", Kind: SubjectTag, Target: "1st"},
+	} {
+		if err := follows.Follow(ctx, &f); !errors.Is(err, ErrValidation) {
+			t.Errorf("follow %+v: %v", f, err)
+		}
+	}
+	page, err := follows.GetFollows(ctx, "c2011011026", PageQuery{})
+	if err != nil || page.Total != 1 || page.Items[0].Target != "garden" {
+		t.Fatalf("follows = %+v, %v", page, err)
+	}
+	concurrently(t, 8, func() error {
+		return follows.Follow(ctx, &Follow{User: "c2011011029", Kind: SubjectTag, Target: "garden"})
+	})
+	if page, err := follows.GetFollows(ctx, "c2011011029", PageQuery{}); err != nil || page.Total != 1 {
+		t.Fatalf("concurrent follows = %+v, %v", page, err)
+	}
+
+	for _, a := range []Activity{garden.Activity(ActivityApproved), other.Activity(ActivityApproved), garden.Activity(ActivityRejected)} {
+		if err := follows.Publish(ctx, &a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for user, want := range map[string][]string{
+		"c2011011025": {ActivityRejected, ActivityApproved},
+		"c2011011026": {ActivityApproved},
+		"c2011011027": {ActivityApproved},
+		"c2011011028": nil,
+	} {
+		feed, err := follows.Feed(ctx, user, PageQuery{})
+		var got []string
+		for _, a := range feed.Items {
+			if a.Target != garden.ID {
+				t.Errorf("feed of %s has %+v", user, a)
+			}
+			got = append(got, a.Type)
+		}
+		if err != nil || !slices.Equal(got, want) || feed.Total != int64(len(want)) {
+			t.Errorf("feed of %s = %v, %v, want %v", user, got, err, want)
+		}
+	}
+
+	project := Follow{Kind: SubjectProject, Target: garden.ID.Hex()}
+	if err := follows.CopyFollowers(ctx, Follow{Kind: SubjectSuggestion, Target: garden.ID.Hex()}, project); err != nil {
+		t.Fatal(err)
+	}
+	if page, err := follows.GetFollows(ctx, "c2011011025", PageQuery{}); err != nil || page.Total != 2 || page.Items[0].Kind != SubjectProject {
+		t.Fatalf("follows after the project = %+v, %v", page, err)
+	}
+
+	unfollow := Follow{User: "c2011011026", Kind: SubjectTag, Target: "GARDEN"}
+	if err := follows.Unfollow(ctx, &unfollow); err != nil {
+		t.Fatal(err)
+	}
+	if err := follows.Unfollow(ctx, &unfollow); ErrorCode(err) != "FOLLOW_NOT_FOUND" {
+		t.Fatalf("second unfollow: %v", err)
+	}
+	if feed, err := follows.Feed(ctx, "c2011011026", PageQuery{}); err != nil || feed.Total != 0 {
+		t.Fatalf("feed after unfollowing = %+v, %v", feed, err)
+	}
+}
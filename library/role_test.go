@@ -0,0 +1,60 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestChangeRoles(t *testing.T) {
+	ctx := context.Background()
+	repos := NewMemoryRepositories()
+	if err := repos.Roles.EnsureRoles(ctx, DefaultRoles()); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []User{
+		{Username: "t1000000001", UserType: "teacher"},
+		{Username: "c2011011025", UserType: "student"},
+	} {
+		if err := repos.Users.InsertToDB(ctx, &u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	change := func(actor, target string, update RoleUpdate) (User, error) {
+		return ChangeRoles(ctx, repos.Roles, repos.Users, actor, target, update)
+	}
+
+	u, err := change("t1000000001", "c2011011025", RoleUpdate{Grant: []string{RoleAdmin, RoleHaysevAdmin}})
+	if err != nil || fmt.Sprint(u.Roles) != "[student admin haysev_admin]" {
+		t.Fatalf("grant = %v, %v", u.Roles, err)
+	}
+	u, err = change("t1000000001", "c2011011025", RoleUpdate{Grant: []string{RoleAdmin}, Revoke: []string{RoleHaysevAdmin}})
+	if err != nil || fmt.Sprint(u.Roles) != "[student admin]" {
+		t.Fatalf("grant held and revoke = %v, %v", u.Roles, err)
+	}
+	if _, err := change("t1000000001", "c2011011025", RoleUpdate{Revoke: []string{RoleHaysevAdmin}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var invalid *Error
+	_, err = change("t1000000001", "c2011011025", RoleUpdate{Grant: []string{"root", RoleAdmin}, Revoke: []string{"student", RoleAdmin}})
+	if !errors.As(err, &invalid) || invalid.Code != "INVALID_ROLES" || len(invalid.Fields) != 3 {
+		t.Fatalf("unknown and conflicting roles: got %#v", err)
+	}
+	if _, err := change("c2011011025", "c2011011025", RoleUpdate{Revoke: []string{RoleAdmin}}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("revoking own admin role: got %v, want ErrForbidden", err)
+	}
+	if _, err := change("c2011011025", "nobody", RoleUpdate{Grant: []string{RoleAdmin}}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown target: got %v, want ErrNotFound", err)
+	}
+
+	log, err := repos.Roles.GetChanges(ctx, RoleChangeQuery{Target: "c2011011025"})
+	if err != nil || log.Total != 2 {
+		t.Fatalf("audit log = %+v, %v, want only the two changes that changed something", log, err)
+	}
+	latest := log.Items[0]
+	if latest.Actor != "t1000000001" || fmt.Sprint(latest.Granted, latest.Revoked, latest.Roles) != "[] [haysev_admin] [student admin]" {
+		t.Fatalf("latest change = %+v", latest)
+	}
+}
@@ -0,0 +1,84 @@
+package library
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+const redacted = "********"
+
+// Secret holds a password as bytes so it can be wiped once it has been used.
+// It never prints or marshals its value; decoding JSON is the only way in.
+//
+// Wiping only reaches the bytes of the Secret. APIs that take the password
+// as a string, such as the IMAP login, are handed a copy that stays in
+// memory until the garbage collector reuses it.
+type Secret []byte
+
+// UnmarshalJSON copies the string straight into the secret so no string copy
+// of the password is left behind, except for the rare escaped value.
+func (s *Secret) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*s = nil
+		return nil
+	}
+	if len(data) >= 2 && data[0] == '"' && data[len(data)-1] == '"' && bytes.IndexByte(data, '\\') < 0 {
+		*s = append(Secret(nil), data[1:len(data)-1]...)
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	*s = Secret(str)
+	return nil
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redacted + `"`), nil
+}
+
+func (s Secret) String() string {
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return redacted
+}
+
+// Format keeps every fmt verb, %x and %v included, from printing the value.
+func (s Secret) Format(f fmt.State, verb rune) {
+	fmt.Fprint(f, redacted)
+}
+
+// Copy returns a secret with its own backing array, for holding on to a
+// password after the request that carried it is wiped.
+func (s Secret) Copy() Secret {
+	return append(Secret(nil), s...)
+}
+
+// Wipe overwrites the secret with zeros.
+func (s Secret) Wipe() {
+	for i := range s {
+		s[i] = 0
+	}
+}
+
+// AppendJSON appends the secret as a JSON string to dst, for building request
+// bodies that can be wiped afterwards.
+func (s Secret) AppendJSON(dst []byte) []byte {
+	const hex = "0123456789abcdef"
+	dst = append(dst, '"')
+	for _, b := range s {
+		switch {
+		case b == '"' || b == '\\':
+			dst = append(dst, '\\', b)
+		case b < 0x20:
+			dst = append(dst, '\\', 'u', '0', '0', hex[b>>4], hex[b&0xf])
+		default:
+			dst = append(dst, b)
+		}
+	}
+	return append(dst, '"')
+}
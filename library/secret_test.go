@@ -0,0 +1,52 @@
+package library
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSecretNeverPrints(t *testing.T) {
+	var form struct {
+		Password Secret `json:"password"`
+	}
+	if err := json.Unmarshal([]byte(`{"password":"hunter2"}`), &form); err != nil {
+		t.Fatal(err)
+	}
+	if string(form.Password) != "hunter2" {
+		t.Fatalf("decoded %q, want hunter2", string(form.Password))
+	}
+	out, _ := json.Marshal(form)
+	for _, s := range []string{string(out), fmt.Sprint(form), fmt.Sprintf("%+v %#v %x %s", form, form, form.Password, form.Password)} {
+		if strings.Contains(s, "hunter2") || strings.Contains(s, "68756e74657232") {
+			t.Errorf("password leaked: %s", s)
+		}
+	}
+
+	kept := form.Password.Copy()
+	form.Password.Wipe()
+	if strings.Trim(string(form.Password), "\x00") != "" {
+		t.Errorf("Wipe left %q", string(form.Password))
+	}
+	if string(kept) != "hunter2" {
+		t.Errorf("Copy shares its bytes with the original")
+	}
+}
+
+func TestSecretAppendJSON(t *testing.T) {
+	for _, password := range []string{"plain", `quo"te\back`, "tab\tnew\nline", "şifre"} {
+		var back string
+		if err := json.Unmarshal(Secret(password).AppendJSON(nil), &back); err != nil {
+			t.Fatalf("%q: %v", password, err)
+		}
+		if back != password {
+			t.Errorf("round trip of %q gave %q", password, back)
+		}
+		var secret Secret
+		raw, _ := json.Marshal(password)
+		if err := json.Unmarshal(raw, &secret); err != nil || string(secret) != password {
+			t.Errorf("decoding %s gave %q, %v", raw, string(secret), err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package library
+
+import (
+	"errors"
+	"testing"
+)
+
+func transcriptFixture() []CourseData {
+	return []CourseData{
+		{CourseID: "101", CourseCode: "CENG 101", Credits: "4", Grade: "AA", Year: 1, Semester: 1},
+		{CourseID: "103", CourseCode: "MATH 103", Credits: "5", Grade: "CB", Year: 1, Semester: 1},
+		{CourseID: "105", CourseCode: "ENG 101", Credits: "3", Grade: "EX", Year: 1, Semester: 1},
+		{CourseID: "102", CourseCode: "CENG 102", Credits: "4", Grade: "FF", Year: 1, Semester: 2},
+		{CourseID: "104", CourseCode: "MATH 104", Credits: "5,0", Grade: "BB", Year: 1, Semester: 2},
+		{CourseID: "272", CourseCode: "CENG 272", Credits: "3", Grade: "", Year: 2, Semester: 4},
+	}
+}
+
+func TestTranscript(t *testing.T) {
+	tr := DefaultGradeScale().Transcript(transcriptFixture(), nil)
+
+	// Fall: (4*4 + 5*2.5) / 9 = 3.17; spring: (4*0 + 5*3) / 9 = 1.67.
+	if len(tr.Semesters) != 2 {
+		t.Fatalf("semesters = %+v", tr.Semesters)
+	}
+	fall, spring := tr.Semesters[0], tr.Semesters[1]
+	if fall.GPA != 3.17 || fall.AttemptedCredits != 9 || fall.EarnedCredits != 12 {
+		t.Errorf("fall = %+v", fall)
+	}
+	if spring.GPA != 1.67 || spring.EarnedCredits != 5 || spring.CumulativeGPA != 2.42 {
+		t.Errorf("spring = %+v", spring)
+	}
+	if tr.GPA != 2.42 || tr.EarnedCredits != 17 || tr.RequiredCredits != 24 || tr.Progress != 0.71 {
+		t.Errorf("transcript = %+v", tr)
+	}
+	if len(tr.Remaining) != 2 || tr.Remaining[0].Courses[0].CourseID != "102" || tr.Remaining[1].Courses[0].CourseID != "272" {
+		t.Errorf("remaining = %+v", tr.Remaining)
+	}
+
+	plan := &Cirriculum{Index: []CirriculumIndex{{CourseID: "101", Year: 1, Semester: 1}, {CourseID: "999", Year: 4, Semester: 8}}}
+	tr = DefaultGradeScale().Transcript(transcriptFixture(), plan)
+	if tr.RequiredCredits != 4 || len(tr.Remaining) != 1 || tr.Remaining[0].Semester != 8 {
+		t.Errorf("with plan = %+v", tr)
+	}
+}
+
+func TestWhatIf(t *testing.T) {
+	scale := DefaultGradeScale()
+	w, err := scale.WhatIf(transcriptFixture(), nil, []HypotheticalGrade{
+		{CourseID: "102", Grade: "bb"},
+		{CourseID: "272", Grade: "AA"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// (16 + 12.5 + 12 + 15 + 12) / 21 = 3.21
+	if w.CurrentGPA != 2.42 || w.ProjectedGPA != 3.21 {
+		t.Fatalf("what-if = %+v", w)
+	}
+
+	_, err = scale.WhatIf(transcriptFixture(), nil, []HypotheticalGrade{{CourseID: "nope", Grade: "AA"}, {CourseID: "101", Grade: "A+"}})
+	var e *Error
+	if !errors.As(err, &e) || len(e.Fields) != 2 || e.Fields[1].Field != "grades[1].grade" {
+		t.Fatalf("invalid what-if: %v", err)
+	}
+}
+
+func TestParseGradeScale(t *testing.T) {
+	scale, err := ParseGradeScale("A=4, B=3, C=2, D=1, F=0, S=pass, U=fail", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := scale["D"]; !g.InGPA || g.Passed {
+		t.Errorf("D = %+v, want counted but failing", g)
+	}
+	if g := scale["S"]; g.InGPA || !g.Passed {
+		t.Errorf("S = %+v, want passing without GPA", g)
+	}
+	for _, bad := range []string{"", "A", "A=x", "A=-1"} {
+		if _, err := ParseGradeScale(bad, 1); err == nil {
+			t.Errorf("ParseGradeScale(%q) succeeded", bad)
+		}
+	}
+}
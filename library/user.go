@@ -2,150 +2,259 @@ package library
 
 import (
 	"272-backend/config"
-	"272-backend/pkg"
-	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
-	"errors"
-	"io"
 	"log"
-	"net/http"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/emersion/go-imap/client"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var (
-	Users *mongo.Collection
-)
+type User struct {
+	Username   string   `json:"id,omitempty" bson:"_id,omitempty"`
+	FullName   string   `json:"full_name" bson:"full_name"`
+	UserType   string   `json:"user_type" bson:"user_type"`
+	Roles      []string `json:"roles" bson:"roles"`
+	Department int      `json:"department" bson:"department"`
+	// DepartmentSource tells how Department was found, see AssignDepartment.
+	DepartmentSource string  `json:"department_source,omitempty" bson:"department_source,omitempty"`
+	FacultyCode      int     `json:"faculty_code,omitempty" bson:"faculty_code,omitempty"`
+	DepartmentName   string  `json:"department_name" bson:"department_name"`
+	Department_alt   string  `json:"department_alt"`
+	Cirriculum       string  `json:"cirriculum" bson:"cirriculum"`
+	Faculty          string  `json:"faculty" bson:"faculty"`
+	Advisor          string  `json:"advisor" bson:"advisor"`
+	Rank             string  `json:"rank" bson:"rank"`
+	Year             string  `json:"year"`
+	Privacy          Privacy `json:"privacy" bson:"privacy,omitempty"`
+	// ProfileSyncedAt is when the profile was last fetched from the portal.
+	ProfileSyncedAt primitive.DateTime `json:"profile_synced_at,omitempty" bson:"profile_synced_at,omitempty"`
+}
 
-func init() {
-	Users = pkg.Mongo.Collection("users")
+// GetDepartmentID returns the department code in the student number of u,
+// or 0 for staff. Use Department for the mapped department.
+func (u *User) GetDepartmentID() int {
+	return GetDepartmentID(u.Username)
 }
 
-type User struct {
-	Username       string   `json:"id,omitempty" bson:"_id,omitempty"`
-	FullName       string   `json:"full_name" bson:"full_name"`
-	UserType       string   `json:"user_type" bson:"user_type"`
-	Roles          []string `json:"roles" bson:"roles"`
-	Department     int      `json:"department" bson:"department"`
-	DepartmentName string   `json:"department_name" bson:"department_name"`
-	Department_alt string   `json:"department_alt"`
-	Cirriculum     string   `json:"cirriculum" bson:"cirriculum"`
-	Faculty        string   `json:"faculty" bson:"faculty"`
-	Advisor        string   `json:"advisor" bson:"advisor"`
-	Rank           string   `json:"rank" bson:"rank"`
-	Year           string   `json:"year"`
+// mongoUserRepository keeps users in the "users" collection.
+type mongoUserRepository struct {
+	users *mongo.Collection
 }
 
-func (u *User) GetDepartmentID() int {
-	chars := strings.Split(u.Username[3:], "")
-	id_slice := []string{}
-	for i := 0; i < len(chars)-3; i++ {
-		id_slice = append(id_slice, chars[i])
-	}
-	department, _ := strconv.Atoi(strings.Join(id_slice, ""))
-	return department
+func NewMongoUserRepository(db *mongo.Database) UserRepository {
+	return &mongoUserRepository{users: db.Collection("users")}
 }
 
-func (u *User) InsertToDB() error {
+// prepareInsert validates a new user and fills the fields derived from it.
+func (u *User) prepareInsert() error {
 	if u.Username == "" || u.UserType == "" {
-		return errors.New("INVALID_USER")
+		return Validation("INVALID_USER", "Username and user type are required")
 	}
-	u.Roles = append(u.Roles, u.UserType)
+	u.Roles = addRoles(u.Roles, u.UserType)
 	u.Department = u.GetDepartmentID()
+	if u.Department != 0 {
+		u.DepartmentSource = DepartmentFromStudentNumber
+	}
+	return nil
+}
 
-	if _, err := Users.InsertOne(context.TODO(), u); err != nil {
+func (r *mongoUserRepository) InsertToDB(ctx context.Context, u *User) error {
+	if err := u.prepareInsert(); err != nil {
 		return err
 	}
-	if err := Users.FindOne(context.TODO(), bson.M{"_id": u.Username}).Decode(&u); err != nil {
-		return err
+	if _, err := r.users.InsertOne(ctx, u); err != nil {
+		return conflict(err, errUserExists)
+	}
+	if err := r.users.FindOne(ctx, bson.M{"_id": u.Username}).Decode(&u); err != nil {
+		return notFound(err, errUserNotFound)
 	}
 	return nil
 }
 
-func (u *User) PutRoles(roles []string) error {
-	u.Roles = append(u.Roles, roles...)
-	update := bson.M{
-		"$set": bson.M{
-			"roles": u.Roles,
-		},
+func (r *mongoUserRepository) ImportUser(ctx context.Context, u *User) (UpsertResult, error) {
+	if err := u.prepareInsert(); err != nil {
+		return UpsertUnchanged, err
+	}
+	update := bson.M{"$addToSet": bson.M{"roles": bson.M{"$each": u.Roles}}}
+	onInsert := bson.M{"department": u.Department}
+	if u.DepartmentSource != "" {
+		onInsert["department_source"] = u.DepartmentSource
+	}
+	if u.FullName != "" {
+		update["$set"] = bson.M{"full_name": u.FullName}
+	} else {
+		onInsert["full_name"] = ""
+	}
+	update["$setOnInsert"] = onInsert
+	// A user stored with another type matches no document, so the upsert
+	// collides with it on _id.
+	res, err := r.users.UpdateOne(ctx, bson.M{"_id": u.Username, "user_type": u.UserType}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return UpsertUnchanged, conflict(err, errUserTypeMismatch)
 	}
-	query := bson.M{
-		"_id": u.Username,
+	result := UpsertUnchanged
+	if res.UpsertedCount > 0 {
+		result = UpsertCreated
+	} else if res.ModifiedCount > 0 {
+		result = UpsertUpdated
 	}
-	if _, err := Users.UpdateOne(context.TODO(), query, update); err != nil {
+	return result, notFound(r.users.FindOne(ctx, bson.M{"_id": u.Username}).Decode(u), errUserNotFound)
+}
+
+func (r *mongoUserRepository) GrantRoles(ctx context.Context, u *User, roles []string) error {
+	return r.updateRoles(ctx, u, bson.M{"$addToSet": bson.M{"roles": bson.M{"$each": roles}}})
+}
+
+func (r *mongoUserRepository) RevokeRoles(ctx context.Context, u *User, roles []string) error {
+	return r.updateRoles(ctx, u, bson.M{"$pullAll": bson.M{"roles": roles}})
+}
+
+// updateRoles applies update to the stored roles of u, so concurrent changes
+// to other roles are not lost, and refreshes u.
+func (r *mongoUserRepository) updateRoles(ctx context.Context, u *User, update bson.M) error {
+	res, err := r.users.UpdateOne(ctx, bson.M{"_id": u.Username}, update)
+	if err != nil {
 		return err
 	}
-	return nil
+	if res.MatchedCount == 0 {
+		return errUserNotFound.Wrap(mongo.ErrNoDocuments)
+	}
+	return notFound(r.users.FindOne(ctx, bson.M{"_id": u.Username}).Decode(u), errUserNotFound)
 }
 
-func (u *User) FindUser() error {
+// FindUser fills u from the document matching its Username and UserType.
+func (r *mongoUserRepository) FindUser(ctx context.Context, u *User) error {
 	query := bson.M{
 		"_id":       u.Username,
 		"user_type": u.UserType,
 	}
-	if err := Users.FindOne(context.TODO(), query).Decode(&u); err != nil {
-		return err
+	if err := r.users.FindOne(ctx, query).Decode(&u); err != nil {
+		return notFound(err, errUserNotFound)
 	}
 	return nil
 }
 
-func (u *User) GetByUsername() error {
+func (r *mongoUserRepository) UpdateProfile(ctx context.Context, u *User, info PersonalInfo) error {
+	update := bson.M{
+		"$set": bson.M{
+			"full_name":         info.FullName,
+			"year":              info.Year,
+			"department_alt":    info.Department_alt,
+			"department_name":   info.DepartmentName,
+			"faculty":           info.Faculty,
+			"advisor":           info.Advisor,
+			"cirriculum":        info.Cirriculum,
+			"rank":              info.Rank,
+			"profile_synced_at": primitive.NewDateTimeFromTime(time.Now()),
+		},
+	}
 	query := bson.M{
-		"_id":       u.Username,
-		"user_type": u.UserType,
+		"_id": u.Username,
 	}
-	if err := Users.FindOne(context.TODO(), query).Decode(&u); err != nil {
+	if _, err := r.users.UpdateOne(ctx, query, update); err != nil {
 		return err
 	}
+	if err := r.users.FindOne(ctx, bson.M{"_id": u.Username}).Decode(&u); err != nil {
+		return notFound(err, errUserNotFound)
+	}
 	return nil
 }
 
-func (u *User) LoginByEmail(pwd string) error {
-	host := config.IMAP_S_HOST
-	if u.UserType == "teacher" {
-		host = config.IMAP_T_HOST
-	}
-	Imap, err := client.DialTLS(host+":"+config.IMAP_PORT, &tls.Config{
-		InsecureSkipVerify: true,
-	})
+func (r *mongoUserRepository) SetDepartment(ctx context.Context, u *User, department, faculty int, source string) error {
+	res, err := r.users.UpdateOne(ctx, bson.M{"_id": u.Username}, bson.M{"$set": bson.M{
+		"department":        department,
+		"faculty_code":      faculty,
+		"department_source": source,
+	}})
 	if err != nil {
-		log.Println(err)
 		return err
 	}
-	defer Imap.Logout()
+	if res.MatchedCount == 0 {
+		return errUserNotFound.Wrap(mongo.ErrNoDocuments)
+	}
+	return notFound(r.users.FindOne(ctx, bson.M{"_id": u.Username}).Decode(u), errUserNotFound)
+}
+
+func (r *mongoUserRepository) GetUser(ctx context.Context, id string) (User, error) {
+	var user User
+	if err := r.users.FindOne(ctx, bson.M{"_id": id}).Decode(&user); err != nil {
+		return user, notFound(err, errUserNotFound)
+	}
+	return user, nil
+}
+
+// ProfileSource looks up the portal profile of a user with their portal
+// credentials.
+type ProfileSource interface {
+	Profile(ctx context.Context, username string, password Secret) (PersonalInfo, error)
+}
+
+// Auth checks university credentials against the IMAP servers and keeps the
+// matching User document up to date.
+type Auth struct {
+	cfg         *config.Config
+	users       UserRepository
+	departments DepartmentRepository
+	profiles    ProfileSource
+}
+
+func NewAuth(cfg *config.Config, users UserRepository, departments DepartmentRepository, profiles ProfileSource) *Auth {
+	return &Auth{cfg: cfg, users: users, departments: departments, profiles: profiles}
+}
+
+// LoginByEmail signs in to the IMAP server over verified TLS. The caller
+// wipes pwd.
+func (a *Auth) LoginByEmail(ctx context.Context, u *User, pwd Secret) error {
+	host := a.cfg.IMAPStudentHost
+	if u.UserType == "teacher" {
+		host = a.cfg.IMAPTeacherHost
+	}
 	username := u.Username
 	if u.UserType == "student" && strings.Contains(username, "@") {
 		username = strings.Split(username, "@")[0]
 	}
-	if err := Imap.Login(username, pwd); err != nil {
-		return err
+	if username == "" {
+		return Validation("INVALID_USERNAME", "Username is required", FieldError{Field: "username", Code: "required", Message: "username is required"})
+	}
+	Imap, err := client.DialTLS(host+":"+a.cfg.IMAPPortString(), a.cfg.TLSConfig())
+	if err != nil {
+		log.Println(err)
+		return Unavailable("MAIL_SERVER_UNAVAILABLE", "The university mail server could not be reached").Wrap(err)
+	}
+	defer Imap.Logout()
+	// go-imap only takes the password as a string; see Secret.
+	if err := Imap.Login(username, string(pwd)); err != nil {
+		return Unauthorized("INVALID_CREDENTIALS", "Username or password is incorrect").Wrap(err)
 	}
 	if u.UserType == "student" && username[0] != 'c' {
 		username = "c" + username
 	}
 	defer Imap.Logout()
 	u.Username = username
-	if err := u.GetByUsername(); err != nil {
-		u.InsertToDB()
+	if err := a.users.FindUser(ctx, u); err != nil {
+		a.users.InsertToDB(ctx, u)
 	}
 	// Eğer test edecekseniz bu kısmı kaldırın
 	// TODO: Remove this part and use mongodb browserless
 	if u.FullName == "" || u.DepartmentName == "" || u.Faculty == "" || u.Advisor == "" || u.Cirriculum == "" {
-		if err := u.fetchPersonalInfo(pwd); err != nil {
+		if err := a.fetchPersonalInfo(ctx, u, pwd); err != nil {
 			return err
 		}
 	}
+	if err := AssignDepartment(ctx, a.departments, a.users, u); err != nil {
+		log.Printf("Department of %s not mapped: %v", u.Username, err)
+	}
 	return nil
 }
 
 // Eğer test edecekseniz bu kısmı kaldırın
-type personalInfo struct {
+type PersonalInfo struct {
 	FullName       string `json:"name"`
 	Year           string `json:"year"`
 	Faculty        string `json:"faculty"`
@@ -157,91 +266,15 @@ type personalInfo struct {
 }
 
 // Eğer test edecekseniz bu kısmı kaldırın
-func (u *User) fetchPersonalInfo(pwd string) error {
-	postData := map[string]string{
-		"username": u.Username,
-		"password": pwd,
-	}
-	jsonData, err := json.Marshal(postData)
-	if err != nil {
-		return err
-	}
-	response, err := http.Post(config.BSL_URI+"/profile", "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return err
-	}
-	defer response.Body.Close()
-	body, err := io.ReadAll(response.Body)
+func (a *Auth) fetchPersonalInfo(ctx context.Context, u *User, pwd Secret) error {
+	info, err := a.profiles.Profile(ctx, u.Username, pwd)
 	if err != nil {
 		return err
 	}
-
-	var info personalInfo
-	err = json.Unmarshal(body, &info)
-	if err != nil {
-		return err
-	}
-	update := bson.M{
-		"$set": bson.M{
-			"full_name":       info.FullName,
-			"year":            info.Year,
-			"department_alt":  info.Department_alt,
-			"department_name": info.DepartmentName,
-			"faculty":         info.Faculty,
-			"advisor":         info.Advisor,
-			"cirriculum":      info.Cirriculum,
-			"rank":            info.Rank,
-		},
-	}
-	query := bson.M{
-		"_id": u.Username,
-	}
-	if _, err := Users.UpdateOne(context.TODO(), query, update); err != nil {
-		return err
-	}
-	if err := Users.FindOne(context.TODO(), bson.M{"_id": u.Username}).Decode(&u); err != nil {
-		return err
-	}
-	return nil
+	return a.users.UpdateProfile(ctx, u, info)
 }
 
 func (u *User) Stringify() string {
 	out, _ := json.Marshal(u)
 	return string(out)
 }
-
-func (u *User) InitToken(token string) error {
-	us, err := pkg.Redis.Get(token)
-	if err != nil {
-		return err
-	}
-	if err := json.Unmarshal([]byte(us), &u); err != nil {
-		return err
-	}
-	return nil
-}
-
-func GetUsers() ([]User, error) {
-	users := []User{}
-	cursor, err := Users.Find(context.TODO(), bson.M{})
-	if err != nil {
-		return users, err
-	}
-	defer cursor.Close(context.Background())
-	for cursor.Next(context.Background()) {
-		var user User
-		if err := cursor.Decode(&user); err != nil {
-			return users, err
-		}
-		users = append(users, user)
-	}
-	return users, nil
-}
-
-func GetUser(id string) (User, error) {
-	var user User
-	if err := Users.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&user); err != nil {
-		return user, err
-	}
-	return user, nil
-}
@@ -0,0 +1,104 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// validate checks request structs against their `validate` tags. swag reads
+// the same tags, so required, min, max and oneof show up in the API docs.
+var validate = newValidator()
+
+// embedded names embedded structs such as PageQuery, whose fields the client
+// sends at the top level, so fieldPath can leave them out.
+const embedded = "<embedded>"
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" && f.Anonymous {
+			return embedded
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+	v.RegisterValidation("objectid", func(fl validator.FieldLevel) bool {
+		return primitive.IsValidObjectID(fl.Field().String())
+	})
+	return v
+}
+
+// Validate checks every field of v and reports all failures at once as a
+// VALIDATION_FAILED error.
+func Validate(v interface{}) error {
+	err := validate.Struct(v)
+	if err == nil {
+		return nil
+	}
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return err
+	}
+	fields := make([]FieldError, 0, len(invalid))
+	for _, fe := range invalid {
+		fields = append(fields, FieldError{
+			Field:   fieldPath(fe),
+			Code:    fe.Tag(),
+			Message: fieldMessage(fe),
+		})
+	}
+	return Validation("VALIDATION_FAILED", "Request validation failed", fields...)
+}
+
+// fieldPath names a field the way the client sent it, e.g. grades[0].grade.
+func fieldPath(fe validator.FieldError) string {
+	if _, path, ok := strings.Cut(fe.Namespace(), "."); ok {
+		return strings.ReplaceAll(path, embedded+".", "")
+	}
+	return fe.Field()
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	field := fieldPath(fe)
+	text := fe.Kind() == reflect.String || fe.Type() == reflect.TypeOf(Secret(nil))
+	switch fe.Tag() {
+	case "required":
+		return field + " is required"
+	case "min":
+		if text {
+			return fmt.Sprintf("%s must be at least %s characters long", field, fe.Param())
+		}
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("%s must have at least %s items", field, fe.Param())
+		}
+		return fmt.Sprintf("%s must be at least %s", field, fe.Param())
+	case "max":
+		if text {
+			return fmt.Sprintf("%s must be at most %s characters long", field, fe.Param())
+		}
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("%s must have at most %s items", field, fe.Param())
+		}
+		return fmt.Sprintf("%s must be at most %s", field, fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, strings.ReplaceAll(fe.Param(), " ", ", "))
+	case "objectid":
+		return field + " must be a 24 character hex ObjectID"
+	case "startsnotwith":
+		return fmt.Sprintf("%s must not start with %s", field, fe.Param())
+	case "datetime":
+		return field + " must be an RFC 3339 date"
+	}
+	return field + " is invalid"
+}
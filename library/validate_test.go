@@ -0,0 +1,40 @@
+package library
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateReportsEveryField(t *testing.T) {
+	var params struct {
+		Title   string `json:"title" validate:"required,min=3,max=120"`
+		Star    int    `json:"star" validate:"min=1,max=5"`
+		Kind    string `json:"kind" validate:"oneof=student teacher"`
+		OwnerID string `json:"owner_id" validate:"objectid"`
+	}
+	params.Star = 9
+	params.Kind = "admin"
+	params.OwnerID = "nope"
+
+	err := Validate(&params)
+	if !errors.Is(err, ErrValidation) {
+		t.Fatalf("Validate() = %v, want a validation error", err)
+	}
+	var e *Error
+	errors.As(err, &e)
+	want := map[string]string{"title": "required", "star": "max", "kind": "oneof", "owner_id": "objectid"}
+	if len(e.Fields) != len(want) {
+		t.Fatalf("got %d field errors, want %d: %+v", len(e.Fields), len(want), e.Fields)
+	}
+	for _, f := range e.Fields {
+		if want[f.Field] != f.Code {
+			t.Errorf("field %s: code %q, want %q", f.Field, f.Code, want[f.Field])
+		}
+	}
+
+	params.Title, params.Star, params.Kind = "Library hours", 4, "teacher"
+	params.OwnerID = "65f000000000000000000000"
+	if err := Validate(&params); err != nil {
+		t.Fatalf("Validate() = %v, want nil", err)
+	}
+}
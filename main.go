@@ -1,28 +1,39 @@
 package main
 
 import (
+	"context"
+
 	"github.com/gofiber/fiber/v2/log"
 
+	"272-backend/app"
 	"272-backend/config"
 	_ "272-backend/docs"
-	"272-backend/pkg"
-	_ "272-backend/routes"
 )
 
-// @title Fiber Example API
+//go:generate go run ./cmd/apidocs
+
+// @title Probee API
 // @version 1.0
-// @description This is a sample swagger for Fiber
-// @termsOfService http://swagger.io/terms/
-// @contact.name API Support
-// @contact.email fiber@swagger.io
-// @license.name Apache 2.0
-// @license.url http://www.apache.org/licenses/LICENSE-2.0.html
-// @host api-probee.yalin.app
-// @BasePath /
+// @description Suggestions, projects and events of the university community, and the student portal. Failed requests answer with an ErrorPayload.
+// @contact.name Probee
+// @contact.url https://probee.yalin.app
+// @BasePath /v1
+// @securityDefinitions.apikey Bearer
+// @in header
+// @name Authorization
+// @description The token from POST /session as "Bearer <token>"
 func main() {
-	if err := pkg.App.Listen(config.PORT); err != nil {
-		log.Fatal("Oops... Server is not running! Reason: %v", err)
-	} else {
-		log.Info("Server is running on port 3000...")
+	cfg, err := config.Load(config.Options{})
+	if err != nil {
+		log.Fatalf("Oops... Configuration is invalid! Reason: %v", err)
+	}
+	log.Infof("Configuration loaded: %s", cfg)
+	application, err := app.New(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("Oops... Server could not start! Reason: %v", err)
+	}
+	if err := application.Run(); err != nil {
+		log.Fatalf("Oops... Server is not running! Reason: %v", err)
 	}
+	log.Info("Server stopped")
 }
@@ -0,0 +1,53 @@
+// Package activity follows suggestions, projects and events for the users
+// who create or upvote them and tells their followers what happens to them.
+// These are side effects of requests that have already succeeded, so
+// failures are logged rather than returned.
+package activity
+
+import (
+	"context"
+	"log"
+
+	"272-backend/library"
+)
+
+// Recorder records follows and activity. A nil Recorder records nothing.
+type Recorder struct {
+	follows library.FollowRepository
+}
+
+func NewRecorder(follows library.FollowRepository) *Recorder {
+	return &Recorder{follows: follows}
+}
+
+// Follow makes user follow kind target, see library.Follow.
+func (r *Recorder) Follow(ctx context.Context, user, kind, target string) {
+	if r == nil || user == "" {
+		return
+	}
+	follow := library.Follow{User: user, Kind: kind, Target: target}
+	if err := r.follows.Follow(ctx, &follow); err != nil {
+		log.Printf("%s not following %s: %v", user, follow.Subject(), err)
+	}
+}
+
+// Carry makes the followers of from follow to, as when a suggestion becomes
+// a project.
+func (r *Recorder) Carry(ctx context.Context, from, to library.Follow) {
+	if r == nil {
+		return
+	}
+	if err := r.follows.CopyFollowers(ctx, from, to); err != nil {
+		log.Printf("Followers of %s not following %s: %v", from.Subject(), to.Subject(), err)
+	}
+}
+
+// Publish shows a in the feeds of the followers of its subjects.
+func (r *Recorder) Publish(ctx context.Context, a library.Activity) {
+	if r == nil {
+		return
+	}
+	if err := r.follows.Publish(ctx, &a); err != nil {
+		log.Printf("Activity %s on %s %s not published: %v", a.Type, a.Kind, a.Target.Hex(), err)
+	}
+}
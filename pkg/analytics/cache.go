@@ -0,0 +1,236 @@
+// Package analytics caches dashboard statistics in Redis.
+//
+// Every statistic depends on the suggestions or on the events. Each of the
+// two has a generation number in Redis that is part of the cache keys; the
+// repositories returned by Suggestions and Events bump it after every write,
+// so the next read computes afresh and older entries simply expire.
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"272-backend/library"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// What a statistic depends on.
+const (
+	scopeSuggestions = "suggestions"
+	scopeEvents      = "events"
+)
+
+// store is the part of Redis the cache needs.
+type store interface {
+	// Get reports a missing key as ok false, not as an error.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Incr(ctx context.Context, key string) error
+}
+
+type redisStore struct {
+	client *redis.Client
+}
+
+func (s redisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	return value, err == nil, err
+}
+
+func (s redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (s redisStore) Incr(ctx context.Context, key string) error {
+	return s.client.Incr(ctx, key).Err()
+}
+
+// Cache is a library.StatsRepository that serves results from Redis for up
+// to ttl, or until a write makes them stale. When Redis fails the statistics
+// are computed directly.
+type Cache struct {
+	stats library.StatsRepository
+	store store
+	ttl   time.Duration
+}
+
+var _ library.StatsRepository = (*Cache)(nil)
+
+// NewCache caches stats in rdb. A ttl of 0 turns caching off.
+func NewCache(stats library.StatsRepository, rdb *redis.Client, ttl time.Duration) *Cache {
+	return newCache(stats, redisStore{client: rdb}, ttl)
+}
+
+func newCache(stats library.StatsRepository, s store, ttl time.Duration) *Cache {
+	return &Cache{stats: stats, store: s, ttl: ttl}
+}
+
+func generationKey(scope string) string {
+	return "stats:generation:" + scope
+}
+
+// invalidate makes every cached statistic of scope stale.
+func (c *Cache) invalidate(ctx context.Context, scope string) {
+	if c.ttl == 0 {
+		return
+	}
+	if err := c.store.Incr(ctx, generationKey(scope)); err != nil {
+		log.Printf("Statistics of %s not invalidated: %v", scope, err)
+	}
+}
+
+// cached returns the statistic name of scope for q from the cache, or
+// computes and stores it.
+func cached[T any](ctx context.Context, c *Cache, scope, name string, q library.StatsQuery, compute func() (T, error)) (T, error) {
+	if c.ttl == 0 {
+		return compute()
+	}
+	generation := "0"
+	raw, ok, err := c.store.Get(ctx, generationKey(scope))
+	if err != nil {
+		log.Printf("Statistics cache unavailable: %v", err)
+		return compute()
+	}
+	if ok {
+		generation = string(raw)
+	}
+	query, _ := json.Marshal(q)
+	key := "stats:" + name + ":" + generation + ":" + string(query)
+	var value T
+	if raw, ok, err := c.store.Get(ctx, key); err == nil && ok && json.Unmarshal(raw, &value) == nil {
+		return value, nil
+	}
+	if value, err = compute(); err != nil {
+		return value, err
+	}
+	if raw, err := json.Marshal(value); err == nil {
+		if err := c.store.Set(ctx, key, raw, c.ttl); err != nil {
+			log.Printf("Statistics %s not cached: %v", name, err)
+		}
+	}
+	return value, nil
+}
+
+func (c *Cache) SuggestionTimeline(ctx context.Context, q library.StatsQuery) ([]library.TimelinePoint, error) {
+	return cached(ctx, c, scopeSuggestions, "timeline", q, func() ([]library.TimelinePoint, error) {
+		return c.stats.SuggestionTimeline(ctx, q)
+	})
+}
+
+func (c *Cache) DecisionTimes(ctx context.Context, q library.StatsQuery) (library.DecisionStats, error) {
+	return cached(ctx, c, scopeSuggestions, "decisions", q, func() (library.DecisionStats, error) {
+		return c.stats.DecisionTimes(ctx, q)
+	})
+}
+
+func (c *Cache) TopDepartments(ctx context.Context, q library.StatsQuery) ([]library.DepartmentCount, error) {
+	return cached(ctx, c, scopeSuggestions, "departments", q, func() ([]library.DepartmentCount, error) {
+		return c.stats.TopDepartments(ctx, q)
+	})
+}
+
+func (c *Cache) TopAuthors(ctx context.Context, q library.StatsQuery) ([]library.AuthorCount, error) {
+	return cached(ctx, c, scopeSuggestions, "authors", q, func() ([]library.AuthorCount, error) {
+		return c.stats.TopAuthors(ctx, q)
+	})
+}
+
+func (c *Cache) TopSuggestions(ctx context.Context, q library.StatsQuery) ([]library.TopSuggestion, error) {
+	return cached(ctx, c, scopeSuggestions, "top", q, func() ([]library.TopSuggestion, error) {
+		return c.stats.TopSuggestions(ctx, q)
+	})
+}
+
+func (c *Cache) EventStats(ctx context.Context, q library.StatsQuery) (library.EventStats, error) {
+	return cached(ctx, c, scopeEvents, "events", q, func() (library.EventStats, error) {
+		return c.stats.EventStats(ctx, q)
+	})
+}
+
+// Suggestions wraps r so that its writes invalidate the suggestion
+// statistics.
+func (c *Cache) Suggestions(r library.SuggestionRepository) library.SuggestionRepository {
+	return &suggestions{SuggestionRepository: r, cache: c}
+}
+
+// Events wraps r so that its writes invalidate the event statistics.
+func (c *Cache) Events(r library.EventRepository) library.EventRepository {
+	return &events{EventRepository: r, cache: c}
+}
+
+// after invalidates scope when the write it follows succeeded.
+func (c *Cache) after(ctx context.Context, scope string, err error) error {
+	if err == nil {
+		c.invalidate(ctx, scope)
+	}
+	return err
+}
+
+type suggestions struct {
+	library.SuggestionRepository
+	cache *Cache
+}
+
+func (r *suggestions) InsertToDB(ctx context.Context, s *library.Suggestion) error {
+	return r.cache.after(ctx, scopeSuggestions, r.SuggestionRepository.InsertToDB(ctx, s))
+}
+
+func (r *suggestions) Edit(ctx context.Context, s *library.Suggestion, title string, content library.Markdown) error {
+	return r.cache.after(ctx, scopeSuggestions, r.SuggestionRepository.Edit(ctx, s, title, content))
+}
+
+func (r *suggestions) Vote(ctx context.Context, s *library.Suggestion, userID string, kind library.VoteKind) error {
+	return r.cache.after(ctx, scopeSuggestions, r.SuggestionRepository.Vote(ctx, s, userID, kind))
+}
+
+func (r *suggestions) Unvote(ctx context.Context, s *library.Suggestion, userID string, kind library.VoteKind) error {
+	return r.cache.after(ctx, scopeSuggestions, r.SuggestionRepository.Unvote(ctx, s, userID, kind))
+}
+
+func (r *suggestions) GiveStar(ctx context.Context, s *library.Suggestion, userID string, star int) error {
+	return r.cache.after(ctx, scopeSuggestions, r.SuggestionRepository.GiveStar(ctx, s, userID, star))
+}
+
+func (r *suggestions) Reject(ctx context.Context, s *library.Suggestion, executorID string, reason string) error {
+	return r.cache.after(ctx, scopeSuggestions, r.SuggestionRepository.Reject(ctx, s, executorID, reason))
+}
+
+func (r *suggestions) Approve(ctx context.Context, s *library.Suggestion, executorID string) error {
+	return r.cache.after(ctx, scopeSuggestions, r.SuggestionRepository.Approve(ctx, s, executorID))
+}
+
+func (r *suggestions) Report(ctx context.Context, s *library.Suggestion, executorID string) error {
+	return r.cache.after(ctx, scopeSuggestions, r.SuggestionRepository.Report(ctx, s, executorID))
+}
+
+type events struct {
+	library.EventRepository
+	cache *Cache
+}
+
+func (r *events) CreateEvent(ctx context.Context, e *library.Event) error {
+	return r.cache.after(ctx, scopeEvents, r.EventRepository.CreateEvent(ctx, e))
+}
+
+func (r *events) ImportEvent(ctx context.Context, e *library.Event) (library.UpsertResult, error) {
+	result, err := r.EventRepository.ImportEvent(ctx, e)
+	if result != library.UpsertUnchanged {
+		r.cache.invalidate(ctx, scopeEvents)
+	}
+	return result, err
+}
+
+func (r *events) ApproveEvent(ctx context.Context, e *library.Event) error {
+	return r.cache.after(ctx, scopeEvents, r.EventRepository.ApproveEvent(ctx, e))
+}
+
+func (r *events) RemoveEvent(ctx context.Context, e *library.Event) error {
+	return r.cache.after(ctx, scopeEvents, r.EventRepository.RemoveEvent(ctx, e))
+}
@@ -0,0 +1,108 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"272-backend/library"
+)
+
+type mapStore struct {
+	values map[string][]byte
+	down   bool
+}
+
+var errDown = errors.New("connection refused")
+
+func (s *mapStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if s.down {
+		return nil, false, errDown
+	}
+	v, ok := s.values[key]
+	return v, ok, nil
+}
+
+func (s *mapStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if s.down {
+		return errDown
+	}
+	s.values[key] = value
+	return nil
+}
+
+func (s *mapStore) Incr(ctx context.Context, key string) error {
+	if s.down {
+		return errDown
+	}
+	n, _ := strconv.Atoi(string(s.values[key]))
+	s.values[key] = []byte(strconv.Itoa(n + 1))
+	return nil
+}
+
+// countingStats counts how often each statistic is computed.
+type countingStats struct {
+	library.StatsRepository
+	computed map[string]int
+}
+
+func (s *countingStats) TopAuthors(ctx context.Context, q library.StatsQuery) ([]library.AuthorCount, error) {
+	s.computed["authors"]++
+	return s.StatsRepository.TopAuthors(ctx, q)
+}
+
+func (s *countingStats) EventStats(ctx context.Context, q library.StatsQuery) (library.EventStats, error) {
+	s.computed["events"]++
+	return s.StatsRepository.EventStats(ctx, q)
+}
+
+func TestCacheInvalidatesOnWrites(t *testing.T) {
+	ctx := context.Background()
+	repos := library.NewMemoryRepositories()
+	stats := &countingStats{StatsRepository: repos.Stats, computed: map[string]int{}}
+	s := &mapStore{values: map[string][]byte{}}
+	cache := newCache(stats, s, time.Minute)
+	suggestions := cache.Suggestions(repos.Suggestions)
+
+	authors := func() []library.AuthorCount {
+		t.Helper()
+		a, err := cache.TopAuthors(ctx, library.StatsQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	if len(authors()) != 0 || len(authors()) != 0 || stats.computed["authors"] != 1 {
+		t.Fatalf("authors computed %d times for two reads", stats.computed["authors"])
+	}
+	if _, err := cache.TopAuthors(ctx, library.StatsQuery{Limit: 1}); err != nil || stats.computed["authors"] != 2 {
+		t.Fatalf("another query served from the cache: %d, %v", stats.computed["authors"], err)
+	}
+
+	benches := library.Suggestion{Title: "More benches", AuthorID: "c2011011025"}
+	if err := suggestions.InsertToDB(ctx, &benches); err != nil {
+		t.Fatal(err)
+	}
+	if a := authors(); len(a) != 1 || a[0].Approved != 0 || stats.computed["authors"] != 3 {
+		t.Fatalf("after a write: %+v, computed %d times", a, stats.computed["authors"])
+	}
+	if _, err := cache.EventStats(ctx, library.StatsQuery{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := suggestions.Approve(ctx, &benches, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.EventStats(ctx, library.StatsQuery{}); err != nil || stats.computed["events"] != 1 {
+		t.Fatalf("a suggestion write made event statistics stale: %d, %v", stats.computed["events"], err)
+	}
+	if a := authors(); a[0].Approved != 1 {
+		t.Fatalf("after approving: %+v", a)
+	}
+
+	s.down = true
+	if a := authors(); len(a) != 1 || stats.computed["authors"] != 5 {
+		t.Fatalf("with Redis down: %+v, computed %d times", a, stats.computed["authors"])
+	}
+}
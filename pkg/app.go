@@ -1,12 +1,14 @@
 package pkg
 
 import (
-	"encoding/json"
+	"272-backend/config"
+	"272-backend/pkg/openapi"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/gofiber/swagger"
 )
 
@@ -18,15 +20,27 @@ import (
 	Token    string   `json:"token" bson:"token"`
 } */
 
-var (
-	App          *fiber.App
-	SessionStore *session.Store
-)
+// MaxBodySize bounds request bodies, leaving room for the largest
+// attachment, 32 MB, and the multipart form around it.
+const MaxBodySize = 33 << 20
 
-func init() {
-	SessionStore = session.New()
-	App = fiber.New()
-	App.Use(
+// NewFiber builds the HTTP server with the middleware every route shares.
+// Route groups are registered on it afterwards. c.IP() believes the proxy
+// header of cfg only on requests from its trusted proxies.
+func NewFiber(cfg *config.Config) *fiber.App {
+	app := fiber.New(fiber.Config{
+		ErrorHandler:            ErrorHandler,
+		BodyLimit:               MaxBodySize,
+		ProxyHeader:             cfg.ProxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.TrustedProxies,
+		EnableIPValidation:      true,
+	})
+	app.Use(
+		requestid.New(),
+		// A panicking handler answers 500 through ErrorHandler rather than
+		// taking the server down.
+		recover.New(),
 		cors.New(cors.Config{
 			AllowOrigins: "https://www.yalin.app, https://probee.yalin.app, http://127.0.0.1:3000",
 			AllowHeaders: "Origin, Content-Type, User-Agent, Accept, Authorization",
@@ -34,12 +48,19 @@ func init() {
 				return os.Getenv("ENVIRONMENT") == "development"
 			}, */
 		}),
-		logger.New(),
+		logger.New(logger.Config{
+			Format:     "[${time}] ${locals:requestid} ${status} - ${latency} ${method} ${url}\n",
+			CustomTags: scrubbedTags,
+		}),
 		/* getSession, */
 	)
-	App.Get("/swagger/*", swagger.HandlerDefault) // default
+	// The API is described outside the versioned routes; the Swagger UI
+	// shows the OpenAPI 3 document rather than the Swagger 2 one it is
+	// converted from.
+	app.Get("/openapi.json", openapi.Handler())
+	app.Get("/swagger/*", swagger.New(swagger.Config{URL: "/openapi.json"}))
 
-	/* App.Get("/swagger/*", swagger.New(swagger.Config{ // custom
+	/* app.Get("/swagger/*", swagger.New(swagger.Config{ // custom
 		URL:         "http://127.0.0.1:5000/swagger/doc.json",
 		DeepLinking: false,
 		// Expand ("list") or Collapse ("none") tag groups by default
@@ -53,6 +74,7 @@ func init() {
 		OAuth2RedirectUrl: "http://localhost:8080/swagger/oauth2-redirect.html",
 	})) */
 
+	return app
 }
 
 /*
@@ -135,21 +157,3 @@ func GetAuthDocumentByToken(token string) (FormT, error) {
 	return auth, nil
 }
 */
-
-func GetRoles(c *fiber.Ctx) []string {
-	sess, err := SessionStore.Get(c)
-	if err != nil {
-		return []string{}
-	}
-	token := sess.Get("token")
-	rolesString, err := Redis.Get(token.(string))
-	if err != nil {
-		return []string{}
-	}
-	var roles []string
-	err = json.Unmarshal([]byte(rolesString), &roles)
-	if err != nil {
-		return []string{}
-	}
-	return roles
-}
@@ -0,0 +1,28 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"272-backend/config"
+	"272-backend/library"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestFiberRecoversFromPanics(t *testing.T) {
+	app := NewFiber(&config.Config{})
+	app.Get("/panic", func(c *fiber.Ctx) error {
+		var items []int
+		return c.JSON(items[1])
+	})
+	res, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/panic", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload library.ErrorPayload
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil || res.StatusCode != fiber.StatusInternalServerError || payload.RequestID == "" {
+		t.Fatalf("panicking handler: %d %+v, %v", res.StatusCode, payload, err)
+	}
+}
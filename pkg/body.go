@@ -0,0 +1,23 @@
+package pkg
+
+import (
+	"272-backend/library"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ParseBody decodes the request body into out and validates it.
+func ParseBody(c *fiber.Ctx, out interface{}) error {
+	if err := c.BodyParser(out); err != nil {
+		return library.Validation("INVALID_REQUEST", "Invalid request body")
+	}
+	return library.Validate(out)
+}
+
+// ParseQuery decodes the query string into out and validates it.
+func ParseQuery(c *fiber.Ctx, out interface{}) error {
+	if err := c.QueryParser(out); err != nil {
+		return library.Validation("INVALID_REQUEST", "Invalid query string")
+	}
+	return library.Validate(out)
+}
@@ -0,0 +1,52 @@
+package bsl
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker stops calls to BSL after threshold consecutive failures. Once
+// cooldown has passed it lets a single probe through: a success closes it
+// again, a failure keeps it open for another cooldown.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return true
+	}
+	if b.now().Sub(b.openedAt) < b.cooldown {
+		return false
+	}
+	// Half open: this caller is the probe, everyone else waits for it.
+	b.openedAt = b.now()
+	return true
+}
+
+// record reports the outcome of an allowed call. Only failures that mean BSL
+// itself is down count; a rejected password is a healthy answer.
+func (b *breaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = b.now()
+	}
+}
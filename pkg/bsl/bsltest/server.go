@@ -0,0 +1,158 @@
+// Package bsltest runs a stand-in BSL server so portal and profile flows can
+// be exercised without the real scraper.
+package bsltest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"272-backend/library"
+	"272-backend/pkg/bsl"
+)
+
+// User is a portal account known to the stub.
+type User struct {
+	Password   string
+	Profile    library.PersonalInfo
+	Curriculum []bsl.Course
+	// Surveys names the courses whose survey is still pending.
+	Surveys []string
+	// UnnamedSurveys makes /survey answer with a message only, leaving out
+	// the course, and never answer 404.
+	UnnamedSurveys bool
+}
+
+// Server answers the BSL endpoints from an in-memory set of users.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	users    map[string]User
+	failNext int
+	status   int
+	delay    time.Duration
+	calls    map[string]int
+}
+
+// NewServer starts a stub. Close it when done.
+func NewServer() *Server {
+	s := &Server{users: map[string]User{}, calls: map[string]int{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/profile", s.handle(func(u *User) (int, interface{}) { return http.StatusOK, u.Profile }))
+	mux.HandleFunc("/curriculum", s.handle(func(u *User) (int, interface{}) { return http.StatusOK, u.Curriculum }))
+	mux.HandleFunc("/survey", s.handle(func(u *User) (int, interface{}) {
+		if u.UnnamedSurveys {
+			if len(u.Surveys) > 0 {
+				u.Surveys = u.Surveys[1:]
+			}
+			return http.StatusOK, bsl.Message{Message: "Survey completed"}
+		}
+		if len(u.Surveys) == 0 {
+			return http.StatusNotFound, bsl.Message{Message: "No pending surveys"}
+		}
+		course := u.Surveys[0]
+		u.Surveys = u.Surveys[1:]
+		return http.StatusOK, bsl.SurveyResult{Message: "Survey completed", Course: course}
+	}))
+	mux.HandleFunc("/surveys", s.handle(func(u *User) (int, interface{}) {
+		u.Surveys = nil
+		return http.StatusOK, bsl.Message{Message: "Surveys completed"}
+	}))
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// AddUser registers or replaces a portal account.
+func (s *Server) AddUser(username string, u User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[username] = u
+}
+
+// FailNext answers the next n requests with status instead of a result.
+func (s *Server) FailNext(n, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failNext, s.status = n, status
+}
+
+// SetDelay makes every response wait d first.
+func (s *Server) SetDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delay = d
+}
+
+// PendingSurveys returns the courses whose survey username has not filled in.
+func (s *Server) PendingSurveys(username string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.users[username].Surveys...)
+}
+
+// Calls returns how many requests reached path.
+func (s *Server) Calls(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[path]
+}
+
+// handle checks the credentials in the request and answers with what result
+// returns. result runs under the lock and may change the user.
+func (s *Server) handle(result func(u *User) (int, interface{})) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s.mu.Lock()
+		s.calls[r.URL.Path]++
+		delay := s.delay
+		status := 0
+		if s.failNext > 0 {
+			s.failNext--
+			status = s.status
+		}
+		s.mu.Unlock()
+
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if status != 0 {
+			writeJSON(w, status, bsl.Message{Message: http.StatusText(status)})
+			return
+		}
+		var creds struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+			writeJSON(w, http.StatusBadRequest, bsl.Message{Message: "Invalid body"})
+			return
+		}
+		s.mu.Lock()
+		u, ok := s.users[creds.Username]
+		if !ok || u.Password != creds.Password {
+			s.mu.Unlock()
+			writeJSON(w, http.StatusUnauthorized, bsl.Message{Message: "Invalid credentials"})
+			return
+		}
+		status, body := result(&u)
+		s.users[creds.Username] = u
+		s.mu.Unlock()
+		writeJSON(w, status, body)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,251 @@
+// Package bsl is the client for BSL, the scraper service that signs in to the
+// university student portal with a user's credentials and returns what it
+// finds there.
+package bsl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"272-backend/config"
+	"272-backend/library"
+)
+
+// maxResponseSize bounds how much of a BSL response is read.
+const maxResponseSize = 4 << 20
+
+// ErrCircuitOpen is the cause of the error returned while the circuit breaker
+// is failing calls fast.
+var ErrCircuitOpen = errors.New("bsl: circuit breaker is open")
+
+var (
+	errUnavailable = library.Unavailable("PORTAL_UNAVAILABLE", "The student portal could not be reached")
+	errCircuitOpen = library.Unavailable("PORTAL_UNAVAILABLE", "The student portal is unavailable, try again later")
+	errBadResponse = library.Unavailable("PORTAL_BAD_RESPONSE", "The student portal returned an unexpected response")
+	errCredentials = library.Unauthorized("PORTAL_INVALID_CREDENTIALS", "Portal username or password is incorrect")
+	errNotFound    = library.NotFound("PORTAL_NOT_FOUND", "The student portal has no such record")
+	errRejected    = library.Validation("PORTAL_REJECTED", "The student portal rejected the request")
+)
+
+// StatusError is the cause of errors built from a non 2xx BSL response.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("bsl: status %d: %s", e.StatusCode, e.Body)
+}
+
+// Course is one row of a user's curriculum as BSL reports it.
+type Course struct {
+	Code       string `json:"code"`
+	CourseID   string `json:"course_id"`
+	CourseCode string `json:"course_code"`
+	CourseName string `json:"course_name"`
+	Credits    string `json:"credits"`
+	Grade      string `json:"grade"`
+	Semester   int    `json:"semester"`
+	Year       int    `json:"year"`
+}
+
+// Message is BSL's answer to calls that only report an outcome.
+type Message struct {
+	Message string `json:"message"`
+}
+
+// SurveyResult is BSL's answer to a single survey submission. Course names
+// the course whose survey was filled in; a BSL answering with the message
+// alone leaves it empty.
+type SurveyResult struct {
+	Message string `json:"message"`
+	Course  string `json:"course,omitempty"`
+}
+
+// Options tunes a Client. Zero values fall back to the defaults noted below.
+type Options struct {
+	// Timeout bounds each attempt, 30s by default.
+	Timeout time.Duration
+	// MaxRetries is how often idempotent calls are retried.
+	MaxRetries int
+	// Backoff is the delay before the first retry, doubled after each
+	// attempt. 250ms by default.
+	Backoff time.Duration
+	// BreakerThreshold consecutive failures open the circuit breaker for
+	// BreakerCooldown, 5 and 30s by default.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// HTTPClient is http.DefaultClient when nil.
+	HTTPClient *http.Client
+}
+
+// Client calls BSL. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	http       *http.Client
+	timeout    time.Duration
+	maxRetries int
+	backoff    time.Duration
+	breaker    *breaker
+}
+
+func New(baseURL string, opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 250 * time.Millisecond
+	}
+	if opts.BreakerThreshold <= 0 {
+		opts.BreakerThreshold = 5
+	}
+	if opts.BreakerCooldown <= 0 {
+		opts.BreakerCooldown = 30 * time.Second
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		http:       opts.HTTPClient,
+		timeout:    opts.Timeout,
+		maxRetries: opts.MaxRetries,
+		backoff:    opts.Backoff,
+		breaker:    newBreaker(opts.BreakerThreshold, opts.BreakerCooldown),
+	}
+}
+
+// NewFromConfig builds a Client from the BSL_* settings. Certificates are
+// verified against TLS_CA_FILE when it is set.
+func NewFromConfig(cfg *config.Config) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg.TLSConfig()
+	return New(cfg.BSLURI, Options{
+		Timeout:          cfg.BSLTimeout,
+		MaxRetries:       cfg.BSLMaxRetries,
+		BreakerThreshold: cfg.BSLBreakerThreshold,
+		BreakerCooldown:  cfg.BSLBreakerCooldown,
+		HTTPClient:       &http.Client{Transport: transport},
+	})
+}
+
+// credentials builds the request body by hand so the copy of the password in
+// it can be wiped once the call is done.
+func credentials(username string, password library.Secret) []byte {
+	name, _ := json.Marshal(username)
+	body := make([]byte, 0, len(name)+len(password)+32)
+	body = append(body, `{"username":`...)
+	body = append(body, name...)
+	body = append(body, `,"password":`...)
+	body = password.AppendJSON(body)
+	return append(body, '}')
+}
+
+// Profile returns the personal information shown on the user's portal page.
+func (c *Client) Profile(ctx context.Context, username string, password library.Secret) (library.PersonalInfo, error) {
+	var info library.PersonalInfo
+	err := c.post(ctx, "/profile", credentials(username, password), &info, true)
+	return info, err
+}
+
+// Curriculum returns every course of the user's curriculum with their grades.
+func (c *Client) Curriculum(ctx context.Context, username string, password library.Secret) ([]Course, error) {
+	var courses []Course
+	err := c.post(ctx, "/curriculum", credentials(username, password), &courses, true)
+	return courses, err
+}
+
+// Survey fills in the next pending course survey. A BSL that names the
+// course answers 404, reported as a PORTAL_NOT_FOUND error, once no survey
+// is pending. It is never retried.
+func (c *Client) Survey(ctx context.Context, username string, password library.Secret) (SurveyResult, error) {
+	var result SurveyResult
+	err := c.post(ctx, "/survey", credentials(username, password), &result, false)
+	return result, err
+}
+
+// Surveys fills in every pending course survey. It is never retried.
+func (c *Client) Surveys(ctx context.Context, username string, password library.Secret) (Message, error) {
+	var msg Message
+	err := c.post(ctx, "/surveys", credentials(username, password), &msg, false)
+	return msg, err
+}
+
+// post sends body, which it wipes before returning, and decodes the answer
+// into out.
+func (c *Client) post(ctx context.Context, path string, body []byte, out interface{}, idempotent bool) error {
+	defer library.Secret(body).Wipe()
+	attempts := 1
+	if idempotent {
+		attempts += c.maxRetries
+	}
+	delay := c.backoff
+	for attempt := 1; ; attempt++ {
+		if !c.breaker.allow() {
+			return errCircuitOpen.Wrap(ErrCircuitOpen)
+		}
+		down, err := c.do(ctx, path, body, out)
+		if ctx.Err() != nil {
+			// The caller gave up, which says nothing about BSL.
+			return errUnavailable.Wrap(ctx.Err())
+		}
+		c.breaker.record(down)
+		if !down || attempt >= attempts {
+			return err
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return errUnavailable.Wrap(ctx.Err())
+		}
+		delay *= 2
+	}
+}
+
+// do makes a single attempt. down reports failures that mean BSL is not
+// working, which are the ones worth retrying.
+func (c *Client) do(ctx context.Context, path string, body []byte, out interface{}) (down bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return true, errUnavailable.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return statusError(&StatusError{StatusCode: resp.StatusCode, Body: string(msg)})
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(out); err != nil {
+		return true, errBadResponse.Wrap(err)
+	}
+	return false, nil
+}
+
+func statusError(e *StatusError) (down bool, err error) {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return false, errCredentials.Wrap(e)
+	case e.StatusCode == http.StatusNotFound:
+		return false, errNotFound.Wrap(e)
+	case e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500:
+		return true, errUnavailable.Wrap(e)
+	case e.StatusCode >= 400:
+		return false, errRejected.Wrap(e)
+	}
+	return false, errBadResponse.Wrap(e)
+}
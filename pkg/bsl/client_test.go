@@ -0,0 +1,132 @@
+package bsl_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"272-backend/library"
+	"272-backend/pkg/bsl"
+	"272-backend/pkg/bsl/bsltest"
+)
+
+func newStub(t *testing.T) *bsltest.Server {
+	t.Helper()
+	stub := bsltest.NewServer()
+	t.Cleanup(stub.Close)
+	stub.AddUser("c2011011025", bsltest.User{
+		Password: "secret",
+		Profile:  library.PersonalInfo{FullName: "Ada Yılmaz", DepartmentName: "Computer Engineering"},
+		Curriculum: []bsl.Course{
+			{CourseCode: "CENG 272", CourseName: "Software Engineering", Credits: "3", Grade: "AA", Semester: 4, Year: 2},
+		},
+	})
+	return stub
+}
+
+func newClient(stub *bsltest.Server, opts bsl.Options) *bsl.Client {
+	if opts.Backoff == 0 {
+		opts.Backoff = time.Millisecond
+	}
+	return bsl.New(stub.URL, opts)
+}
+
+func TestClientProfileAndCurriculum(t *testing.T) {
+	stub := newStub(t)
+	client := newClient(stub, bsl.Options{})
+	ctx := context.Background()
+
+	info, err := client.Profile(ctx, "c2011011025", library.Secret("secret"))
+	if err != nil || info.FullName != "Ada Yılmaz" {
+		t.Fatalf("Profile() = %+v, %v", info, err)
+	}
+	courses, err := client.Curriculum(ctx, "c2011011025", library.Secret("secret"))
+	if err != nil || len(courses) != 1 || courses[0].Grade != "AA" {
+		t.Fatalf("Curriculum() = %+v, %v", courses, err)
+	}
+}
+
+func TestClientMapsStatusCodes(t *testing.T) {
+	stub := newStub(t)
+	client := newClient(stub, bsl.Options{MaxRetries: 2})
+	ctx := context.Background()
+
+	_, err := client.Profile(ctx, "c2011011025", library.Secret("wrong"))
+	if code := library.ErrorCode(err); code != "PORTAL_INVALID_CREDENTIALS" {
+		t.Fatalf("wrong password: code %q (%v)", code, err)
+	}
+	var status *bsl.StatusError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong password: cause %v", err)
+	}
+	if calls := stub.Calls("/profile"); calls != 1 {
+		t.Fatalf("rejected credentials were retried: %d calls", calls)
+	}
+
+	stub.FailNext(1, http.StatusUnprocessableEntity)
+	if _, err := client.Profile(ctx, "c2011011025", library.Secret("secret")); library.ErrorCode(err) != "PORTAL_REJECTED" {
+		t.Fatalf("422: %v", err)
+	}
+}
+
+func TestClientRetriesIdempotentCalls(t *testing.T) {
+	stub := newStub(t)
+	client := newClient(stub, bsl.Options{MaxRetries: 2})
+	ctx := context.Background()
+
+	stub.FailNext(2, http.StatusBadGateway)
+	if _, err := client.Curriculum(ctx, "c2011011025", library.Secret("secret")); err != nil {
+		t.Fatalf("Curriculum() after two failures: %v", err)
+	}
+	if calls := stub.Calls("/curriculum"); calls != 3 {
+		t.Fatalf("got %d calls, want 3", calls)
+	}
+
+	stub.FailNext(1, http.StatusBadGateway)
+	_, err := client.Surveys(ctx, "c2011011025", library.Secret("secret"))
+	if !errors.Is(err, library.ErrUnavailable) {
+		t.Fatalf("Surveys() = %v, want unavailable", err)
+	}
+	if calls := stub.Calls("/surveys"); calls != 1 {
+		t.Fatalf("survey submission was retried: %d calls", calls)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	stub := newStub(t)
+	stub.SetDelay(200 * time.Millisecond)
+	client := newClient(stub, bsl.Options{Timeout: 20 * time.Millisecond})
+
+	_, err := client.Profile(context.Background(), "c2011011025", library.Secret("secret"))
+	if library.ErrorCode(err) != "PORTAL_UNAVAILABLE" {
+		t.Fatalf("Profile() = %v, want PORTAL_UNAVAILABLE", err)
+	}
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	stub := newStub(t)
+	client := newClient(stub, bsl.Options{BreakerThreshold: 2, BreakerCooldown: 50 * time.Millisecond})
+	ctx := context.Background()
+
+	stub.FailNext(2, http.StatusServiceUnavailable)
+	for i := 0; i < 2; i++ {
+		client.Profile(ctx, "c2011011025", library.Secret("secret"))
+	}
+	_, err := client.Profile(ctx, "c2011011025", library.Secret("secret"))
+	if !errors.Is(err, bsl.ErrCircuitOpen) {
+		t.Fatalf("Profile() = %v, want the breaker to be open", err)
+	}
+	if calls := stub.Calls("/profile"); calls != 2 {
+		t.Fatalf("open breaker still called BSL: %d calls", calls)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := client.Profile(ctx, "c2011011025", library.Secret("secret")); err != nil {
+		t.Fatalf("probe after cooldown: %v", err)
+	}
+	if _, err := client.Profile(ctx, "c2011011025", library.Secret("secret")); err != nil {
+		t.Fatalf("breaker did not close after a successful probe: %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+// Package client calls the API from Go tools such as bots and migration
+// scripts. It signs in, signs in again when the server stops accepting its
+// token, and turns error responses back into *library.Error, so
+// errors.Is(err, library.ErrNotFound) and library.ErrorCode work on the
+// client as they do on the server.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"272-backend/library"
+)
+
+// apiVersion is the BasePath of the routes this client is written against.
+const apiVersion = "/v1"
+
+// maxResponseSize bounds how much of a response is read.
+const maxResponseSize = 16 << 20
+
+var errBadResponse = library.Unavailable("BAD_RESPONSE", "The API returned an unexpected response")
+
+// kindByStatus undoes the status codes the server picks for each kind of
+// error. Other statuses, 500 among them, leave the kind empty.
+var kindByStatus = map[int]library.ErrorKind{
+	http.StatusNotFound:              library.KindNotFound,
+	http.StatusBadRequest:            library.KindValidation,
+	http.StatusConflict:              library.KindConflict,
+	http.StatusForbidden:             library.KindForbidden,
+	http.StatusUnauthorized:          library.KindUnauthorized,
+	http.StatusServiceUnavailable:    library.KindUnavailable,
+	http.StatusBadGateway:            library.KindUnavailable,
+	http.StatusGatewayTimeout:        library.KindUnavailable,
+	http.StatusTooManyRequests:       library.KindRateLimited,
+	http.StatusRequestEntityTooLarge: library.KindTooLarge,
+	http.StatusUnsupportedMediaType:  library.KindUnsupported,
+}
+
+// StatusError is the cause of the *library.Error returned for a non 2xx
+// response.
+type StatusError struct {
+	StatusCode int
+	// RequestID identifies the request in the server logs.
+	RequestID string
+	// RetryAfter is how long the server asked to wait before trying again,
+	// zero when it did not.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	if e.RequestID == "" {
+		return fmt.Sprintf("status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("status %d, request %s", e.StatusCode, e.RequestID)
+}
+
+// Options tunes a Client. Zero values fall back to the defaults noted below.
+type Options struct {
+	// Token authenticates calls until Login replaces it. Without
+	// credentials from Login, a token the server rejects fails the call.
+	Token string
+	// Timeout bounds each call, 30s by default.
+	Timeout time.Duration
+	// HTTPClient is http.DefaultClient when nil.
+	HTTPClient *http.Client
+}
+
+// Client calls the API. It is safe for concurrent use.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	timeout time.Duration
+
+	// mu guards token and credentials, and is held while signing in so
+	// calls rejected together sign in once.
+	mu          sync.Mutex
+	token       string
+	credentials *Credentials
+}
+
+// New returns a client of the API served at baseURL, such as
+// https://api-probee.yalin.app, without the version.
+func New(baseURL string, opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/") + apiVersion,
+		http:    opts.HTTPClient,
+		timeout: opts.Timeout,
+		token:   opts.Token,
+	}
+}
+
+// Token returns the token calls are authenticated with.
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// request is one call to the API. Bodies holding a password are wiped once
+// the call is done.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   []byte
+	secret bool
+}
+
+// call sends r, and when the server rejects the token, signs in again with
+// the credentials from Login and sends it once more.
+func (c *Client) call(ctx context.Context, r request, out interface{}) error {
+	if r.secret {
+		defer library.Secret(r.body).Wipe()
+	}
+	token := c.Token()
+	err := c.send(ctx, r, token, out)
+	if !errors.Is(err, library.ErrUnauthorized) {
+		return err
+	}
+	fresh, ok, loginErr := c.refresh(ctx, token)
+	if loginErr != nil {
+		return loginErr
+	}
+	if !ok {
+		return err
+	}
+	return c.send(ctx, r, fresh, out)
+}
+
+// refresh signs in again after the server rejected stale, unless another
+// call already has. ok is false without credentials to sign in with.
+func (c *Client) refresh(ctx context.Context, stale string) (token string, ok bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.credentials == nil {
+		return "", false, nil
+	}
+	if c.token != stale {
+		return c.token, true, nil
+	}
+	session, err := c.login(ctx, *c.credentials)
+	if err != nil {
+		return "", false, err
+	}
+	c.token = session.Token
+	return c.token, true, nil
+}
+
+// send makes a single attempt with token and decodes the answer into out,
+// unless out is nil.
+func (c *Client) send(ctx context.Context, r request, token string, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	target := c.baseURL + r.path
+	if len(r.query) > 0 {
+		target += "?" + r.query.Encode()
+	}
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, target, body)
+	if err != nil {
+		return err
+	}
+	for key, values := range r.header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if r.body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return decodeError(resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(out); err != nil {
+		return errBadResponse.Wrap(err)
+	}
+	return nil
+}
+
+// decodeError rebuilds the domain error behind an error response. Responses
+// without an ErrorPayload, such as those of a proxy, are named after their
+// status the way the server names errors that are not domain errors.
+func decodeError(resp *http.Response) error {
+	status := &StatusError{StatusCode: resp.StatusCode, RequestID: resp.Header.Get("X-Request-Id")}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		status.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	e := &library.Error{Kind: kindByStatus[resp.StatusCode], Err: status}
+	var payload library.ErrorPayload
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&payload); err != nil || payload.Error == "" {
+		e.Code = strings.ToUpper(strings.ReplaceAll(http.StatusText(resp.StatusCode), " ", "_"))
+		e.Message = http.StatusText(resp.StatusCode)
+		return e
+	}
+	e.Code, e.Message, e.Fields = payload.Error, payload.Message, payload.Fields
+	if payload.RequestID != "" {
+		status.RequestID = payload.RequestID
+	}
+	return e
+}
+
+func jsonBody(v interface{}) []byte {
+	body, err := json.Marshal(v)
+	if err != nil {
+		// Every body is a plain struct of this package or library.
+		panic(err)
+	}
+	return body
+}
+
+// query encodes the fields of the struct q tagged `query`, as the server
+// parses them, leaving out zero values.
+func query(q interface{}) url.Values {
+	values := url.Values{}
+	addQuery(values, reflect.ValueOf(q))
+	return values
+}
+
+func addQuery(values url.Values, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			addQuery(values, v.Field(i))
+			continue
+		}
+		name := field.Tag.Get("query")
+		if name == "" || name == "-" || v.Field(i).IsZero() {
+			continue
+		}
+		values.Set(name, fmt.Sprint(v.Field(i).Interface()))
+	}
+}
+
+// pathID escapes id for use as a path segment.
+func pathID(id string) string {
+	return "/" + url.PathEscape(id)
+}
@@ -0,0 +1,260 @@
+package client_test
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"272-backend/config"
+	"272-backend/library"
+	"272-backend/pkg"
+	"272-backend/pkg/client"
+	"272-backend/pkg/profiles"
+	"272-backend/routes"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	imapserver "github.com/emersion/go-imap/server"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+)
+
+// mailBackend accepts the accounts in passwords, counting sign ins. The
+// mailboxes are never looked at.
+type mailBackend struct {
+	passwords map[string]string
+	logins    atomic.Int32
+}
+
+func (b *mailBackend) Login(_ *imap.ConnInfo, username, password string) (backend.User, error) {
+	if want, ok := b.passwords[username]; !ok || want != password {
+		return nil, errors.New("invalid credentials")
+	}
+	b.logins.Add(1)
+	return mailUser(username), nil
+}
+
+type mailUser string
+
+func (u mailUser) Username() string                            { return string(u) }
+func (mailUser) ListMailboxes(bool) ([]backend.Mailbox, error) { return nil, nil }
+func (mailUser) GetMailbox(string) (backend.Mailbox, error)    { return nil, backend.ErrNoSuchMailbox }
+func (mailUser) CreateMailbox(string) error                    { return nil }
+func (mailUser) DeleteMailbox(string) error                    { return nil }
+func (mailUser) RenameMailbox(string, string) error            { return nil }
+func (mailUser) Logout() error                                 { return nil }
+
+// server serves the API over TLS with memory repositories, signing in
+// against a mail server that shares its certificate. rotate replaces the
+// JWT secret, which makes every issued token invalid.
+type server struct {
+	URL    string
+	HTTP   *http.Client
+	mail   *mailBackend
+	rotate func(secret string)
+}
+
+func newServer(t *testing.T) *server {
+	t.Helper()
+	ctx := context.Background()
+	repos := library.NewMemoryRepositories()
+	profile := library.User{FullName: "Ada", DepartmentName: "Computer Engineering", Faculty: "Engineering", Advisor: "t1000000001", Cirriculum: "2020"}
+	student, teacher := profile, profile
+	student.Username, student.UserType = "c2011011025", "student"
+	teacher.Username, teacher.UserType, teacher.Roles = "t1000000001", "teacher", []string{library.RoleAdmin, library.RoleHaysevAdmin}
+	for _, u := range []*library.User{&student, &teacher} {
+		if err := repos.Users.InsertToDB(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var handler atomic.Value
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.Load().(http.HandlerFunc).ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	mail := &mailBackend{passwords: map[string]string{"c2011011025": "student-pw", "t1000000001": "teacher-pw"}}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	imapServer := imapserver.New(mail)
+	go imapServer.Serve(tls.NewListener(listener, srv.TLS))
+	t.Cleanup(func() { imapServer.Close() })
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	redis := miniredis.RunT(t)
+	cfg, err := config.Load(config.Options{
+		EnvFile: filepath.Join(t.TempDir(), ".env"),
+		Environ: []string{
+			"MONGO_URI=mongodb://unused", "MONGO_DBNAME=test", "BSL_URI=http://unused",
+			"REDIS_URI=redis://" + redis.Addr(),
+			"JWT_SECRET_KEY=test-secret",
+			"IMAP_S_HOST=127.0.0.1", "IMAP_T_HOST=127.0.0.1",
+			"IMAP_PORT=" + strconv.Itoa(listener.Addr().(*net.TCPAddr).Port),
+			"TLS_CA_FILE=" + ca,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdb, err := pkg.NewRedis(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rdb.Close() })
+	anonymizer, err := library.NewAnonymizer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotate := func(secret string) {
+		app := pkg.NewFiber(cfg)
+		routes.Register(app, routes.Deps{
+			Config:     cfg,
+			JWT:        pkg.NewJWT(secret).WithUsers(repos.Users),
+			Redis:      rdb,
+			Anonymizer: anonymizer,
+			Repos:      repos,
+			Profiles:   profiles.NewRefresher(repos.Users, repos.Departments, nil, nil, profiles.Options{}),
+		})
+		handler.Store(adaptor.FiberApp(app))
+	}
+	rotate(cfg.JWTSecretKey)
+	return &server{URL: srv.URL, HTTP: srv.Client(), mail: mail, rotate: rotate}
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	srv := newServer(t)
+	student := client.New(srv.URL, client.Options{HTTPClient: srv.HTTP})
+	admin := client.New(srv.URL, client.Options{HTTPClient: srv.HTTP})
+
+	_, err := student.Login(ctx, client.Credentials{Username: "c2011011025", Password: library.Secret("wrong"), UserType: "student"})
+	var status *client.StatusError
+	if !errors.Is(err, library.ErrUnauthorized) || library.ErrorCode(err) != "INVALID_CREDENTIALS" || !errors.As(err, &status) || status.RequestID == "" {
+		t.Fatalf("wrong password: %v", err)
+	}
+	_, err = student.Login(ctx, client.Credentials{Username: "@example.edu", Password: library.Secret("student-pw"), UserType: "student"})
+	if !errors.Is(err, library.ErrValidation) || len(err.(*library.Error).Fields) != 1 || err.(*library.Error).Fields[0].Code != "startsnotwith" {
+		t.Fatalf("empty local part: %v", err)
+	}
+	session, err := student.Login(ctx, client.Credentials{Username: "c2011011025@example.edu", Password: library.Secret("student-pw"), UserType: "student"})
+	if err != nil || session.User.Username != "c2011011025" || session.Token == "" {
+		t.Fatalf("login: %+v, %v", session, err)
+	}
+	if _, err := admin.Login(ctx, client.Credentials{Username: "t1000000001", Password: library.Secret("teacher-pw"), UserType: "teacher"}); err != nil {
+		t.Fatal(err)
+	}
+	if me, err := student.Session(ctx); err != nil || me.UserType != "student" {
+		t.Fatalf("session: %+v, %v", me, err)
+	}
+
+	_, err = student.CreateSuggestion(ctx, library.CreateSuggestionParams{Title: "ab", Content: "Too short a title"})
+	if !errors.Is(err, library.ErrValidation) || len(err.(*library.Error).Fields) != 1 || err.(*library.Error).Fields[0].Field != "title" {
+		t.Fatalf("invalid suggestion: %v", err)
+	}
+	s, err := student.CreateSuggestion(ctx, library.CreateSuggestionParams{Title: "More benches", Content: "In the #garden"})
+	if err != nil || s.ContentHTML == "" {
+		t.Fatalf("create suggestion: %+v, %v", s, err)
+	}
+	if _, err := student.ApproveSuggestion(ctx, s.ID); !errors.Is(err, library.ErrForbidden) {
+		t.Fatalf("approve as student: %v", err)
+	}
+	if _, err := admin.ApproveSuggestion(ctx, s.ID); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = admin.Upvote(ctx, s.ID); err != nil || s.Upvotes != 1 {
+		t.Fatalf("upvote: %+v, %v", s, err)
+	}
+	if approved, err := student.Suggestions(ctx, library.RankingQuery{Sort: "new", Tag: "garden"}); err != nil || len(approved) != 1 {
+		t.Fatalf("suggestions tagged garden: %v, %v", approved, err)
+	}
+	if _, err := student.Suggestion(ctx, "65f0c1d2e3f4a5b6c7d8e9f0"); library.ErrorCode(err) != "SUGGESTION_NOT_FOUND" {
+		t.Fatalf("missing suggestion: %v", err)
+	}
+	project, err := admin.CreateProject(ctx, s.ID, "t1000000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := student.Project(ctx, s.ID); err != nil || got.ID != project.ID {
+		t.Fatalf("project: %+v, %v", got, err)
+	}
+
+	event, err := student.CreateEvent(ctx, client.EventParams{Title: "Garden day", Description: "Bring #garden tools", StartTime: time.Now().Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := admin.PendingEvents(ctx); err != nil || len(pending) != 1 {
+		t.Fatalf("pending events: %v, %v", pending, err)
+	}
+	if _, err := admin.ApproveEvent(ctx, event.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if events, err := student.Events(ctx); err != nil || len(events) != 1 || events[0].Status != "approved" {
+		t.Fatalf("events: %+v, %v", events, err)
+	}
+
+	if me, err := student.UpdatePrivacy(ctx, library.Privacy{Year: library.VisibilityPrivate}); err != nil || me.Privacy.Year != library.VisibilityPrivate {
+		t.Fatalf("update privacy: %+v, %v", me, err)
+	}
+	if users, err := admin.Users(ctx, library.UserQuery{UserType: "student"}); err != nil || users.Total != 1 {
+		t.Fatalf("users: %+v, %v", users, err)
+	}
+	if jobs, err := student.SurveyJobs(ctx); err != nil || len(jobs) != 0 {
+		t.Fatalf("survey jobs: %v, %v", jobs, err)
+	}
+	if courses, err := student.Curriculum(ctx); err != nil || len(courses) != 0 {
+		t.Fatalf("curriculum before a sync: %v, %v", courses, err)
+	}
+
+	// A new secret rejects every token; calls rejected together sign in once.
+	srv.rotate("rotated-secret")
+	logins := srv.mail.logins.Load()
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = student.MySuggestions(ctx)
+		}(i)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		t.Fatalf("after rotating the secret: %v", err)
+	}
+	if got := srv.mail.logins.Load() - logins; got != 1 {
+		t.Fatalf("signed in %d times after rotating the secret", got)
+	}
+
+	stale := client.New(srv.URL, client.Options{Token: session.Token, HTTPClient: srv.HTTP})
+	if _, err := stale.MySuggestions(ctx); !errors.Is(err, library.ErrUnauthorized) {
+		t.Fatalf("stale token without credentials: %v", err)
+	}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := student.MySuggestions(canceled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled context: %v", err)
+	}
+	if err := student.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := student.MySuggestions(ctx); !errors.Is(err, library.ErrUnauthorized) {
+		t.Fatalf("after logout: %v", err)
+	}
+}
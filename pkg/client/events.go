@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"272-backend/library"
+)
+
+// EventParams describe a new event. Description is Markdown.
+type EventParams struct {
+	Title       string
+	Description string
+	StartTime   time.Time
+}
+
+func (c *Client) Events(ctx context.Context) ([]library.Event, error) {
+	var events []library.Event
+	err := c.call(ctx, request{method: http.MethodGet, path: "/events"}, &events)
+	return events, err
+}
+
+// PendingEvents returns the events waiting for approval.
+func (c *Client) PendingEvents(ctx context.Context) ([]library.Event, error) {
+	var events []library.Event
+	err := c.call(ctx, request{method: http.MethodGet, path: "/events/pending"}, &events)
+	return events, err
+}
+
+// CreateEvent proposes an event organized by the signed in user.
+func (c *Client) CreateEvent(ctx context.Context, params EventParams) (library.Event, error) {
+	body := jsonBody(struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		StartTime   string `json:"start_time"`
+	}{params.Title, params.Description, params.StartTime.Format(time.RFC3339)})
+	var event library.Event
+	err := c.call(ctx, request{method: http.MethodPost, path: "/events", body: body}, &event)
+	return event, err
+}
+
+func (c *Client) ApproveEvent(ctx context.Context, id string) (library.Event, error) {
+	var event library.Event
+	err := c.call(ctx, request{method: http.MethodPatch, path: "/events" + pathID(id)}, &event)
+	return event, err
+}
+
+func (c *Client) DeleteEvent(ctx context.Context, id string) error {
+	return c.call(ctx, request{method: http.MethodDelete, path: "/events" + pathID(id)}, nil)
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"272-backend/library"
+	"272-backend/pkg/bsl"
+)
+
+// passwordBody builds {"password": password} by hand so the copy of the
+// password in it can be wiped once the call is done. Calls reaching the
+// portal take the password of the signed in user, which may be nil when it
+// was remembered at login.
+func passwordBody(password library.Secret) []byte {
+	if len(password) == 0 {
+		return []byte("{}")
+	}
+	body := make([]byte, 0, len(password)+16)
+	body = append(body, `{"password":`...)
+	body = password.AppendJSON(body)
+	return append(body, '}')
+}
+
+// Curriculum returns the curriculum and grades stored by the last sync.
+func (c *Client) Curriculum(ctx context.Context) ([]library.CourseData, error) {
+	var courses []library.CourseData
+	err := c.call(ctx, request{method: http.MethodGet, path: "/portal/curriculum"}, &courses)
+	return courses, err
+}
+
+// SyncCurriculum fetches the curriculum and grades from the portal.
+func (c *Client) SyncCurriculum(ctx context.Context, password library.Secret) (library.CurriculumSync, error) {
+	var sync library.CurriculumSync
+	err := c.call(ctx, request{method: http.MethodPost, path: "/portal/curriculum", body: passwordBody(password), secret: true}, &sync)
+	return sync, err
+}
+
+func (c *Client) Transcript(ctx context.Context) (library.Transcript, error) {
+	var transcript library.Transcript
+	err := c.call(ctx, request{method: http.MethodGet, path: "/portal/transcript"}, &transcript)
+	return transcript, err
+}
+
+// WhatIf projects the GPA as if grades had been received.
+func (c *Client) WhatIf(ctx context.Context, grades []library.HypotheticalGrade) (library.WhatIf, error) {
+	body := jsonBody(struct {
+		Grades []library.HypotheticalGrade `json:"grades"`
+	}{grades})
+	var projection library.WhatIf
+	err := c.call(ctx, request{method: http.MethodPost, path: "/portal/transcript/what-if", body: body}, &projection)
+	return projection, err
+}
+
+// FillSurvey fills in the next pending course survey right away.
+func (c *Client) FillSurvey(ctx context.Context, password library.Secret) (bsl.SurveyResult, error) {
+	var result bsl.SurveyResult
+	err := c.call(ctx, request{method: http.MethodPost, path: "/portal/survey", body: passwordBody(password), secret: true}, &result)
+	return result, err
+}
+
+// FillSurveys queues a job filling in every pending course survey. A running
+// job, or the one created with the same idempotency key, is returned instead
+// of a new one; key may be empty.
+func (c *Client) FillSurveys(ctx context.Context, password library.Secret, key string) (library.SurveyJob, error) {
+	r := request{method: http.MethodPost, path: "/portal/surveys", body: passwordBody(password), secret: true}
+	if key != "" {
+		r.header = http.Header{"Idempotency-Key": {key}}
+	}
+	var job library.SurveyJob
+	err := c.call(ctx, r, &job)
+	return job, err
+}
+
+// Surveys returns every survey filled in by a job, newest first.
+func (c *Client) Surveys(ctx context.Context) ([]library.SurveyItem, error) {
+	var surveys []library.SurveyItem
+	err := c.call(ctx, request{method: http.MethodGet, path: "/portal/surveys"}, &surveys)
+	return surveys, err
+}
+
+func (c *Client) SurveyJobs(ctx context.Context) ([]library.SurveyJob, error) {
+	var jobs []library.SurveyJob
+	err := c.call(ctx, request{method: http.MethodGet, path: "/portal/jobs"}, &jobs)
+	return jobs, err
+}
+
+func (c *Client) SurveyJob(ctx context.Context, id string) (library.SurveyJob, error) {
+	var job library.SurveyJob
+	err := c.call(ctx, request{method: http.MethodGet, path: "/portal/jobs" + pathID(id)}, &job)
+	return job, err
+}
@@ -0,0 +1,33 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"272-backend/library"
+)
+
+func (c *Client) Projects(ctx context.Context) ([]library.Project, error) {
+	var projects []library.Project
+	err := c.call(ctx, request{method: http.MethodGet, path: "/projects"}, &projects)
+	return projects, err
+}
+
+// Project returns a project by its ID, which is that of its suggestion.
+func (c *Client) Project(ctx context.Context, id string) (library.Project, error) {
+	var project library.Project
+	err := c.call(ctx, request{method: http.MethodGet, path: "/projects" + pathID(id)}, &project)
+	return project, err
+}
+
+// CreateProject turns an approved suggestion into a project advised by the
+// teacher with username advisor.
+func (c *Client) CreateProject(ctx context.Context, suggestion, advisor string) (library.Project, error) {
+	body := jsonBody(struct {
+		Suggestion string `json:"suggestion"`
+		Advisor    string `json:"advisor"`
+	}{suggestion, advisor})
+	var project library.Project
+	err := c.call(ctx, request{method: http.MethodPost, path: "/projects", body: body}, &project)
+	return project, err
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"272-backend/library"
+)
+
+// Credentials sign in with the university mail account.
+type Credentials struct {
+	Username string
+	Password library.Secret
+	// UserType is student or teacher.
+	UserType string
+	// RememberPassword keeps the password on the server for a few minutes,
+	// so portal calls may leave it out.
+	RememberPassword bool
+}
+
+// body builds the login form by hand so the copy of the password in it can
+// be wiped once the call is done.
+func (cr Credentials) body() []byte {
+	username, _ := json.Marshal(cr.Username)
+	userType, _ := json.Marshal(cr.UserType)
+	body := make([]byte, 0, len(username)+len(userType)+len(cr.Password)+80)
+	body = append(body, `{"username":`...)
+	body = append(body, username...)
+	body = append(body, `,"password":`...)
+	body = cr.Password.AppendJSON(body)
+	body = append(body, `,"user_type":`...)
+	body = append(body, userType...)
+	body = append(body, `,"remember_password":`...)
+	body = strconv.AppendBool(body, cr.RememberPassword)
+	return append(body, '}')
+}
+
+// SessionUser is the signed in user.
+type SessionUser struct {
+	Username   string   `json:"username"`
+	UserType   string   `json:"user_type"`
+	FullName   string   `json:"full_name,omitempty"`
+	Department int      `json:"department"`
+	Roles      []string `json:"roles"`
+}
+
+// Session is the answer to Login.
+type Session struct {
+	User               SessionUser `json:"user"`
+	Token              string      `json:"token"`
+	PasswordRemembered bool        `json:"password_remembered"`
+}
+
+// Login signs in and authenticates the calls that follow with the new
+// token. The client keeps a copy of cr to sign in again whenever the
+// server stops accepting the token, until Logout.
+func (c *Client) Login(ctx context.Context, cr Credentials) (Session, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	session, err := c.login(ctx, cr)
+	if err != nil {
+		return session, err
+	}
+	c.forget()
+	cr.Password = cr.Password.Copy()
+	c.token, c.credentials = session.Token, &cr
+	return session, nil
+}
+
+// login signs in without touching the state of c.
+func (c *Client) login(ctx context.Context, cr Credentials) (Session, error) {
+	var session Session
+	body := cr.body()
+	defer library.Secret(body).Wipe()
+	err := c.send(ctx, request{method: http.MethodPost, path: "/session", body: body}, "", &session)
+	return session, err
+}
+
+// forget drops the token and wipes the credentials; mu is held.
+func (c *Client) forget() {
+	if c.credentials != nil {
+		c.credentials.Password.Wipe()
+	}
+	c.token, c.credentials = "", nil
+}
+
+// Session returns the signed in user.
+func (c *Client) Session(ctx context.Context) (SessionUser, error) {
+	var answer struct {
+		User SessionUser `json:"user"`
+	}
+	err := c.call(ctx, request{method: http.MethodGet, path: "/session"}, &answer)
+	return answer.User, err
+}
+
+// Logout signs out, forgetting the password the server remembered, and
+// drops the token and credentials of the client.
+func (c *Client) Logout(ctx context.Context) error {
+	if err := c.call(ctx, request{method: http.MethodDelete, path: "/session"}, nil); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.forget()
+	return nil
+}
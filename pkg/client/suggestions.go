@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"272-backend/library"
+)
+
+// Suggestions returns the approved suggestions selected and ordered by q.
+func (c *Client) Suggestions(ctx context.Context, q library.RankingQuery) ([]library.SuggestionResponse, error) {
+	var suggestions []library.SuggestionResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: "/suggestions", query: query(q)}, &suggestions)
+	return suggestions, err
+}
+
+// MySuggestions returns the suggestions of the signed in user.
+func (c *Client) MySuggestions(ctx context.Context) ([]library.SuggestionResponse, error) {
+	var suggestions []library.SuggestionResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: "/suggestions/mine"}, &suggestions)
+	return suggestions, err
+}
+
+// PendingSuggestions returns the suggestions waiting for an admin.
+func (c *Client) PendingSuggestions(ctx context.Context) ([]library.SuggestionResponse, error) {
+	var suggestions []library.SuggestionResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: "/suggestions/pending"}, &suggestions)
+	return suggestions, err
+}
+
+func (c *Client) Suggestion(ctx context.Context, id string) (library.SuggestionResponse, error) {
+	return c.suggestion(ctx, http.MethodGet, pathID(id), nil)
+}
+
+func (c *Client) CreateSuggestion(ctx context.Context, params library.CreateSuggestionParams) (library.SuggestionResponse, error) {
+	return c.suggestion(ctx, http.MethodPost, "", params)
+}
+
+// EditSuggestion changes a pending suggestion of the signed in user.
+func (c *Client) EditSuggestion(ctx context.Context, id string, params library.EditSuggestionParams) (library.SuggestionResponse, error) {
+	return c.suggestion(ctx, http.MethodPatch, pathID(id), params)
+}
+
+func (c *Client) Upvote(ctx context.Context, id string) (library.SuggestionResponse, error) {
+	return c.suggestion(ctx, http.MethodPut, pathID(id)+"/upvote", nil)
+}
+
+func (c *Client) RemoveUpvote(ctx context.Context, id string) (library.SuggestionResponse, error) {
+	return c.suggestion(ctx, http.MethodDelete, pathID(id)+"/upvote", nil)
+}
+
+func (c *Client) Downvote(ctx context.Context, id string) (library.SuggestionResponse, error) {
+	return c.suggestion(ctx, http.MethodPut, pathID(id)+"/downvote", nil)
+}
+
+func (c *Client) RemoveDownvote(ctx context.Context, id string) (library.SuggestionResponse, error) {
+	return c.suggestion(ctx, http.MethodDelete, pathID(id)+"/downvote", nil)
+}
+
+// Star rates a suggestion from 1 to 5 stars.
+func (c *Client) Star(ctx context.Context, id string, star int) (library.SuggestionResponse, error) {
+	return c.suggestion(ctx, http.MethodPut, pathID(id)+"/star", library.StarSuggestionParams{Star: star})
+}
+
+func (c *Client) ApproveSuggestion(ctx context.Context, id string) (library.SuggestionResponse, error) {
+	return c.suggestion(ctx, http.MethodPatch, pathID(id)+"/approve", nil)
+}
+
+func (c *Client) RejectSuggestion(ctx context.Context, id, reason string) (library.SuggestionResponse, error) {
+	return c.suggestion(ctx, http.MethodPatch, pathID(id)+"/reject", library.WithReasonParams{Reason: reason})
+}
+
+func (c *Client) ReportSuggestion(ctx context.Context, id string) (library.SuggestionResponse, error) {
+	return c.suggestion(ctx, http.MethodPatch, pathID(id)+"/report", nil)
+}
+
+// suggestion makes a call under /suggestions answered with one suggestion.
+func (c *Client) suggestion(ctx context.Context, method, path string, params interface{}) (library.SuggestionResponse, error) {
+	r := request{method: method, path: "/suggestions" + path}
+	if params != nil {
+		r.body = jsonBody(params)
+	}
+	var s library.SuggestionResponse
+	err := c.call(ctx, r, &s)
+	return s, err
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"272-backend/library"
+)
+
+// Me is the record of the signed in user with every privacy setting spelled
+// out.
+type Me struct {
+	library.User
+	Privacy library.Privacy `json:"privacy"`
+}
+
+// Users searches the user directory; q.Viewer is ignored.
+func (c *Client) Users(ctx context.Context, q library.UserQuery) (library.Page[library.UserProfile], error) {
+	var page library.Page[library.UserProfile]
+	err := c.call(ctx, request{method: http.MethodGet, path: "/users", query: query(q)}, &page)
+	return page, err
+}
+
+// User returns the profile of a user, without the fields their privacy
+// settings hide.
+func (c *Client) User(ctx context.Context, username string) (library.UserProfile, error) {
+	var profile library.UserProfile
+	err := c.call(ctx, request{method: http.MethodGet, path: "/users" + pathID(username)}, &profile)
+	return profile, err
+}
+
+func (c *Client) Me(ctx context.Context) (Me, error) {
+	var me Me
+	err := c.call(ctx, request{method: http.MethodGet, path: "/users/me"}, &me)
+	return me, err
+}
+
+// UpdatePrivacy changes the privacy settings of the signed in user. Fields
+// left empty keep their current setting.
+func (c *Client) UpdatePrivacy(ctx context.Context, privacy library.Privacy) (Me, error) {
+	body := jsonBody(struct {
+		Privacy library.Privacy `json:"privacy"`
+	}{privacy})
+	var me Me
+	err := c.call(ctx, request{method: http.MethodPatch, path: "/users/me", body: body}, &me)
+	return me, err
+}
+
+// RefreshProfile queues a refresh of the profile of the signed in user from
+// the portal. password may be nil when it was remembered at login.
+func (c *Client) RefreshProfile(ctx context.Context, password library.Secret) error {
+	return c.call(ctx, request{method: http.MethodPost, path: "/users/me/refresh", body: passwordBody(password), secret: true}, nil)
+}
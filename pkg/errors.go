@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"272-backend/library"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+var statusByKind = map[library.ErrorKind]int{
+	library.KindNotFound:     fiber.StatusNotFound,
+	library.KindValidation:   fiber.StatusBadRequest,
+	library.KindConflict:     fiber.StatusConflict,
+	library.KindForbidden:    fiber.StatusForbidden,
+	library.KindUnauthorized: fiber.StatusUnauthorized,
+	library.KindUnavailable:  fiber.StatusServiceUnavailable,
+	library.KindRateLimited:  fiber.StatusTooManyRequests,
+	library.KindTooLarge:     fiber.StatusRequestEntityTooLarge,
+	library.KindUnsupported:  fiber.StatusUnsupportedMediaType,
+}
+
+// ErrorHandler turns every error returned by a handler into a
+// library.ErrorPayload. Domain errors keep their code and message; anything
+// else is logged and reported as INTERNAL_ERROR so driver messages never
+// reach clients.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	status, payload := errorResponse(err)
+	payload.RequestID = c.GetRespHeader(fiber.HeaderXRequestID)
+	if status >= fiber.StatusInternalServerError {
+		log.Printf("request %s: %s %s: %v", payload.RequestID, c.Method(), ScrubURL(c.OriginalURL()), err)
+	}
+	return c.Status(status).JSON(payload)
+}
+
+func errorResponse(err error) (int, library.ErrorPayload) {
+	var domainErr *library.Error
+	if errors.As(err, &domainErr) {
+		status, ok := statusByKind[domainErr.Kind]
+		if !ok {
+			status = fiber.StatusInternalServerError
+		}
+		return status, library.ErrorPayload{
+			Message: domainErr.Message,
+			Error:   domainErr.Code,
+			Fields:  domainErr.Fields,
+		}
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code, library.ErrorPayload{
+			Message: fiberErr.Message,
+			Error:   strings.ToUpper(strings.ReplaceAll(utils.StatusMessage(fiberErr.Code), " ", "_")),
+		}
+	}
+	return fiber.StatusInternalServerError, library.ErrorPayload{
+		Message: "Something went wrong",
+		Error:   "INTERNAL_ERROR",
+	}
+}
@@ -0,0 +1,202 @@
+// Package export writes tables of records as CSV, XLSX or NDJSON, one record
+// at a time, for the admin exports.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// The supported formats, the values of the format query parameter.
+const (
+	CSV    = "csv"
+	XLSX   = "xlsx"
+	NDJSON = "ndjson"
+)
+
+// ContentType returns the media type of format.
+func ContentType(format string) string {
+	switch format {
+	case XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case NDJSON:
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Column is a column of a table of T. Value returns a string, an int or a
+// float64, so spreadsheets get numbers where they should.
+type Column[T any] struct {
+	Name  string
+	Value func(T) any
+}
+
+// Writer writes the records of a table.
+type Writer interface {
+	// Write adds record, whose columns hold cells. NDJSON encodes record
+	// itself and ignores cells.
+	Write(record any, cells []any) error
+	// Close writes whatever is buffered. The underlying io.Writer is not
+	// closed.
+	Close() error
+}
+
+// NewWriter starts a table with header in format on w.
+func NewWriter(w io.Writer, format string, header []string) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSVWriter(w, header)
+	case XLSX:
+		return newXLSXWriter(w, header)
+	case NDJSON:
+		return &ndjsonWriter{encoder: json.NewEncoder(w)}, nil
+	}
+	return nil, fmt.Errorf("export: unknown format %q", format)
+}
+
+// Table writes records to w with the columns of T.
+type Table[T any] struct {
+	w       Writer
+	columns []Column[T]
+	cells   []any
+}
+
+// NewTable starts a table of columns in format on w.
+func NewTable[T any](w io.Writer, format string, columns []Column[T]) (*Table[T], error) {
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	writer, err := NewWriter(w, format, header)
+	if err != nil {
+		return nil, err
+	}
+	return &Table[T]{w: writer, columns: columns, cells: make([]any, len(columns))}, nil
+}
+
+func (t *Table[T]) Write(record T) error {
+	for i, column := range t.columns {
+		t.cells[i] = column.Value(record)
+	}
+	return t.w.Write(record, t.cells)
+}
+
+func (t *Table[T]) Close() error {
+	return t.w.Close()
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, header []string) (*csvWriter, error) {
+	// The byte order mark makes Excel read the file as UTF-8, which Turkish
+	// names need.
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return nil, err
+	}
+	c := &csvWriter{w: csv.NewWriter(w)}
+	return c, c.w.Write(header)
+}
+
+func (c *csvWriter) Write(record any, cells []any) error {
+	row := make([]string, len(cells))
+	for i, cell := range cells {
+		row[i] = csvCell(cell)
+	}
+	if err := c.w.Write(row); err != nil {
+		return err
+	}
+	// Hand every row to w, so a slow export still streams.
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// csvCell formats cell for a spreadsheet. Text that a spreadsheet would take
+// for a formula, such as a suggestion titled "=HYPERLINK(...)", is prefixed
+// with a quote so it stays text.
+func csvCell(cell any) string {
+	switch v := cell.(type) {
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		if v != "" && (v[0] == '=' || v[0] == '+' || v[0] == '-' || v[0] == '@' || v[0] == '\t' || v[0] == '\r') {
+			return "'" + v
+		}
+		return v
+	}
+	return fmt.Sprint(cell)
+}
+
+// xlsxWriter streams rows into a worksheet, which excelize keeps on disk
+// once it grows. The workbook is written to w on Close, as the format
+// cannot be written out piecewise.
+type xlsxWriter struct {
+	w      io.Writer
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	row    int
+}
+
+const sheet = "Sheet1"
+
+func newXLSXWriter(w io.Writer, header []string) (*xlsxWriter, error) {
+	file := excelize.NewFile()
+	stream, err := file.NewStreamWriter(sheet)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	x := &xlsxWriter{w: w, file: file, stream: stream, row: 1}
+	cells := make([]any, len(header))
+	for i, name := range header {
+		cells[i] = name
+	}
+	if err := x.Write(nil, cells); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return x, nil
+}
+
+func (x *xlsxWriter) Write(record any, cells []any) error {
+	cell, err := excelize.CoordinatesToCellName(1, x.row)
+	if err != nil {
+		return err
+	}
+	x.row++
+	return x.stream.SetRow(cell, cells)
+}
+
+func (x *xlsxWriter) Close() error {
+	defer x.file.Close()
+	if err := x.stream.Flush(); err != nil {
+		return err
+	}
+	return x.file.Write(x.w)
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (n *ndjsonWriter) Write(record any, cells []any) error {
+	return n.encoder.Encode(record)
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,78 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+type row struct {
+	Title string  `json:"title"`
+	Stars float64 `json:"stars"`
+}
+
+var columns = []Column[row]{
+	{Name: "title", Value: func(r row) any { return r.Title }},
+	{Name: "stars", Value: func(r row) any { return r.Stars }},
+}
+
+func write(t *testing.T, format string, rows ...row) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	table, err := NewTable(&buf, format, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rows {
+		if err := table.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := table.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCSV(t *testing.T) {
+	got := string(write(t, CSV, row{Title: "Kütüphane, 7/24", Stars: 4.5}, row{Title: "=HYPERLINK(\"http://evil\")"}))
+	want := "\ufefftitle,stars\n\"Kütüphane, 7/24\",4.5\n\"'=HYPERLINK(\"\"http://evil\"\")\",0\n"
+	if got != want {
+		t.Fatalf("CSV = %q, want %q", got, want)
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(string(write(t, NDJSON, row{Title: "a", Stars: 1}, row{Title: "b"}))), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	var r row
+	if err := json.Unmarshal([]byte(lines[0]), &r); err != nil || r != (row{Title: "a", Stars: 1}) {
+		t.Fatalf("first line = %s, %v", lines[0], err)
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	file, err := excelize.OpenReader(bytes.NewReader(write(t, XLSX, row{Title: "=1+1", Stars: 3})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := file.GetRows(sheet)
+	if err != nil || len(rows) != 2 || rows[0][0] != "title" || rows[1][0] != "=1+1" || rows[1][1] != "3" {
+		t.Fatalf("rows = %q, %v", rows, err)
+	}
+	if formula, err := file.GetCellFormula(sheet, "A2"); err != nil || formula != "" {
+		t.Fatalf("title became the formula %q, %v", formula, err)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := NewWriter(&bytes.Buffer{}, "pdf", nil); err == nil {
+		t.Fatal("pdf accepted")
+	}
+}
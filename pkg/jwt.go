@@ -1,28 +1,74 @@
 package pkg
 
 import (
-	"272-backend/config"
+	"errors"
 	"log"
 
+	"272-backend/library"
+
 	jwtware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func UseJWT(route fiber.Router) {
+// JWT signs and verifies session tokens with a single HMAC secret.
+type JWT struct {
+	secret []byte
+	users  library.UserRepository
+}
+
+func NewJWT(secret string) *JWT {
+	return &JWT{secret: []byte(secret)}
+}
+
+// WithUsers makes Use replace the roles a token was issued with by the ones
+// the user holds now, so granted and revoked roles take effect on the next
+// request instead of the next login. It returns j.
+func (j *JWT) WithUsers(users library.UserRepository) *JWT {
+	j.users = users
+	return j
+}
+
+// Use rejects requests on route that do not carry a valid bearer token.
+func (j *JWT) Use(route fiber.Router) {
 	route.Use(jwtware.New(jwtware.Config{
-		SigningKey: jwtware.SigningKey{Key: []byte(config.JWT_SECRET_KEY)},
+		SigningKey: jwtware.SigningKey{Key: j.secret},
 		ContextKey: "user",
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			log.Println(err.Error())
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+			return library.Unauthorized("UNAUTHORIZED", "Authentication token is missing, invalid or expired")
 		},
 	}))
+	if j.users != nil {
+		route.Use(j.currentRoles)
+	}
+}
+
+// currentRoles overwrites the roles claim of the verified token with the
+// stored roles. Tokens of deleted users stop working.
+func (j *JWT) currentRoles(c *fiber.Ctx) error {
+	claims, err := Claims(c)
+	if err != nil {
+		return err
+	}
+	user, err := j.users.GetUser(c.UserContext(), claims["username"].(string))
+	if errors.Is(err, library.ErrNotFound) {
+		return library.Unauthorized("INVALID_TOKEN", "Authentication token is invalid or expired").Wrap(err)
+	}
+	if err != nil {
+		return err
+	}
+	roles := make([]interface{}, len(user.Roles))
+	for i, role := range user.Roles {
+		roles[i] = role
+	}
+	claims["roles"] = roles
+	return c.Next()
 }
 
-func CreateToken(claims jwt.MapClaims) string {
+func (j *JWT) CreateToken(claims jwt.MapClaims) string {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	t, err := token.SignedString([]byte(config.JWT_SECRET_KEY))
+	t, err := token.SignedString(j.secret)
 	if err != nil {
 		log.Println(err.Error())
 		return ""
@@ -30,9 +76,9 @@ func CreateToken(claims jwt.MapClaims) string {
 	return t
 }
 
-func ParseToken(tokenString string) (jwt.MapClaims, error) {
+func (j *JWT) ParseToken(tokenString string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.JWT_SECRET_KEY), nil
+		return j.secret, nil
 	})
 	if err != nil {
 		return nil, err
@@ -43,3 +89,53 @@ func ParseToken(tokenString string) (jwt.MapClaims, error) {
 	}
 	return claims, nil
 }
+
+// Claims returns the claims of the token verified by Use.
+func Claims(c *fiber.Ctx) (jwt.MapClaims, error) {
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return nil, library.Unauthorized("NOT_LOGGED_IN", "You are not logged in")
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, library.Unauthorized("INVALID_TOKEN", "Authentication token is invalid or expired")
+	}
+	if username, _ := claims["username"].(string); username == "" {
+		return nil, library.Unauthorized("INVALID_TOKEN", "Authentication token is invalid or expired")
+	}
+	return claims, nil
+}
+
+// HasRole reports whether the verified token carries role.
+func HasRole(claims jwt.MapClaims, role string) bool {
+	roles, _ := claims["roles"].([]interface{})
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Viewer describes the signed in user to whom suggestions are shown.
+func Viewer(c *fiber.Ctx, a *library.Anonymizer) (library.Viewer, error) {
+	claims, err := Claims(c)
+	if err != nil {
+		return library.Viewer{}, err
+	}
+	return a.Viewer(claims["username"].(string), HasRole(claims, library.RoleAdmin)), nil
+}
+
+// RequireRole lets requests through only when the token carries role.
+func RequireRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, err := Claims(c)
+		if err != nil {
+			return err
+		}
+		if !HasRole(claims, role) {
+			return library.Forbidden("NOT_PERMITTED", "You are not authorized to access this route")
+		}
+		return c.Next()
+	}
+}
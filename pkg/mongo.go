@@ -11,24 +11,22 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var (
-	Mongo *mongo.Database
-)
-
-func init() {
-	mongoURI := config.MONGO_URI
-	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(mongoURI))
+// NewMongo connects to the deployment in cfg and pings it. The caller owns the
+// returned client and must Disconnect it.
+func NewMongo(ctx context.Context, cfg *config.Config) (*mongo.Client, *mongo.Database, error) {
 	log.Println("Connecting to MongoDB...")
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.MongoURI))
 	if err != nil {
-		log.Println(err.Error())
 		log.Println("Error connecting to MongoDB")
-	} else {
-		var result bson.M
-		Mongo = client.Database(config.MONGO_DBNAME)
-		if err := Mongo.RunCommand(context.TODO(), bson.D{{Key: "ping", Value: 1}}).Decode(&result); err != nil {
-			log.Fatalln("Error pinging MongoDB deployment")
-		} else {
-			log.Println("Successfully connected to MongoDB!")
-		}
+		return nil, nil, err
+	}
+	var result bson.M
+	db := client.Database(cfg.MongoDBName)
+	if err := db.RunCommand(ctx, bson.D{{Key: "ping", Value: 1}}).Decode(&result); err != nil {
+		log.Println("Error pinging MongoDB deployment")
+		_ = client.Disconnect(context.Background())
+		return nil, nil, err
 	}
+	log.Println("Successfully connected to MongoDB!")
+	return client, db, nil
 }
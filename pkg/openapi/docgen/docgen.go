@@ -0,0 +1,28 @@
+// Package docgen generates the Swagger 2 description of the API from the
+// handler annotations, as `swag init` would with the settings of this
+// repository. The output is committed under docs; go generate refreshes it.
+package docgen
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+
+	"github.com/swaggo/swag/gen"
+)
+
+// Build reads the annotations of the module rooted at root and writes the
+// docs package, in the given output types (go, json, yaml), to outputDir.
+func Build(root, outputDir string, outputTypes ...string) error {
+	return gen.New().Build(&gen.Config{
+		SearchDir:          root,
+		MainAPIFile:        "main.go",
+		PropNamingStrategy: "camelcase",
+		OutputDir:          outputDir,
+		OutputTypes:        outputTypes,
+		OverridesFile:      filepath.Join(root, gen.DefaultOverridesFile),
+		ParseDepth:         100,
+		PackageName:        "docs",
+		Debugger:           log.New(io.Discard, "", 0),
+	})
+}
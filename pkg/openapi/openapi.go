@@ -0,0 +1,75 @@
+// Package openapi describes the API as OpenAPI 3. swag generates Swagger 2
+// from the handler annotations into the docs package (see docgen); the
+// document is converted from that.
+package openapi
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gofiber/fiber/v2"
+	"github.com/swaggo/swag"
+)
+
+// SecurityScheme names the scheme handlers require with @Security.
+const SecurityScheme = "Bearer"
+
+// Convert turns a Swagger 2 document into OpenAPI 3. Swagger 2 only knows
+// API keys, so SecurityScheme becomes an HTTP bearer scheme carrying a JWT;
+// file responses become binary strings, and without a host the base path
+// becomes a relative server URL.
+func Convert(swagger2 []byte) (*openapi3.T, error) {
+	var doc2 openapi2.T
+	if err := json.Unmarshal(swagger2, &doc2); err != nil {
+		return nil, err
+	}
+	doc, err := openapi2conv.ToV3(&doc2)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Servers) == 0 && doc2.BasePath != "" {
+		doc.AddServer(&openapi3.Server{URL: doc2.BasePath})
+	}
+	if _, ok := doc.Components.SecuritySchemes[SecurityScheme]; ok {
+		doc.Components.SecuritySchemes[SecurityScheme] = &openapi3.SecuritySchemeRef{Value: openapi3.NewJWTSecurityScheme()}
+	}
+	for _, item := range doc.Paths.Map() {
+		for _, op := range item.Operations() {
+			for _, resp := range op.Responses.Map() {
+				for _, media := range resp.Value.Content {
+					if media.Schema != nil && media.Schema.Value.Type == "file" {
+						media.Schema = openapi3.NewStringSchema().WithFormat("binary").NewRef()
+					}
+				}
+			}
+		}
+	}
+	return doc, nil
+}
+
+// Handler serves the document swag registered, converted once on the first
+// request.
+func Handler() fiber.Handler {
+	load := sync.OnceValues(func() ([]byte, error) {
+		swagger2, err := swag.ReadDoc()
+		if err != nil {
+			return nil, err
+		}
+		doc, err := Convert([]byte(swagger2))
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(doc)
+	})
+	return func(c *fiber.Ctx) error {
+		doc, err := load()
+		if err != nil {
+			return err
+		}
+		c.Type("json")
+		return c.Send(doc)
+	}
+}
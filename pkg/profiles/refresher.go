@@ -0,0 +1,218 @@
+// Package profiles keeps the portal profiles of users fresh in the
+// background: after a login finds a stale profile, on request, and on a
+// schedule for users whose password is remembered in the credential vault.
+package profiles
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"272-backend/library"
+	"272-backend/pkg"
+)
+
+// sweepBatch bounds how many stale profiles one sweep looks at.
+const sweepBatch = 50
+
+var errQueueFull = library.Unavailable("PROFILE_QUEUE_FULL", "Too many profile refreshes are waiting, try again later")
+
+// Options tunes a Refresher. Zero values fall back to the defaults noted below.
+type Options struct {
+	// MaxAge is how old a profile may get before it is refreshed, 24h by
+	// default.
+	MaxAge time.Duration
+	// SweepInterval is how often stale profiles with a remembered password
+	// are queued. Sweeps are off when it is zero or there is no vault.
+	SweepInterval time.Duration
+	// QueueSize refreshes may wait for the worker, 100 by default.
+	QueueSize int
+	// Timeout bounds a single refresh, 1 minute by default.
+	Timeout time.Duration
+}
+
+// task is a queued refresh with its own copy of the password, wiped once the
+// refresh is done.
+type task struct {
+	username string
+	password library.Secret
+}
+
+// Refresher fetches profiles from the portal one at a time, so a burst of
+// logins does not turn into a burst of portal sessions.
+type Refresher struct {
+	users       library.UserRepository
+	departments library.DepartmentRepository
+	source      library.ProfileSource
+	vault       *pkg.CredentialVault
+	queue       chan task
+	maxAge      time.Duration
+	sweep       time.Duration
+	timeout     time.Duration
+
+	// mu guards queued, the users with a refresh waiting or running.
+	mu     sync.Mutex
+	queued map[string]bool
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+}
+
+func NewRefresher(users library.UserRepository, departments library.DepartmentRepository, source library.ProfileSource, vault *pkg.CredentialVault, opts Options) *Refresher {
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = 24 * time.Hour
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 100
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Minute
+	}
+	return &Refresher{
+		users:       users,
+		departments: departments,
+		source:      source,
+		vault:       vault,
+		queue:       make(chan task, opts.QueueSize),
+		maxAge:      opts.MaxAge,
+		sweep:       opts.SweepInterval,
+		timeout:     opts.Timeout,
+		queued:      map[string]bool{},
+	}
+}
+
+// Stale reports whether the profile of u is due for a refresh.
+func (r *Refresher) Stale(u *library.User) bool {
+	return time.Since(u.ProfileSyncedAt.Time()) > r.maxAge
+}
+
+// Enqueue queues a refresh of username with its own copy of password. It
+// reports false when a refresh of the user is already waiting, which serves
+// this call as well.
+func (r *Refresher) Enqueue(username string, password library.Secret) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.queued[username] {
+		return false, nil
+	}
+	t := task{username: username, password: password.Copy()}
+	select {
+	case r.queue <- t:
+		r.queued[username] = true
+		return true, nil
+	default:
+		t.password.Wipe()
+		return false, errQueueFull
+	}
+}
+
+// Start runs the worker and, when enabled, the sweeps until Stop.
+func (r *Refresher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for {
+			select {
+			case t := <-r.queue:
+				r.refresh(ctx, t)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	if r.sweep > 0 && r.vault.Enabled() {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			ticker := time.NewTicker(r.sweep)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					r.Sweep(ctx)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+}
+
+// Stop cancels the running refresh, waits for the workers until ctx expires
+// and wipes the passwords still queued.
+func (r *Refresher) Stop(ctx context.Context) error {
+	if r.cancel == nil {
+		return nil
+	}
+	r.cancel()
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	for {
+		select {
+		case t := <-r.queue:
+			t.password.Wipe()
+		default:
+			return nil
+		}
+	}
+}
+
+// Sweep queues a refresh for stale profiles whose password is remembered.
+func (r *Refresher) Sweep(ctx context.Context) int {
+	users, err := r.users.StaleProfiles(ctx, time.Now().Add(-r.maxAge), sweepBatch)
+	if err != nil {
+		log.Printf("Profile sweep: %v", err)
+		return 0
+	}
+	n := 0
+	for _, u := range users {
+		password, err := r.vault.Get(ctx, u.Username)
+		if err != nil {
+			continue
+		}
+		queued, err := r.Enqueue(u.Username, password)
+		password.Wipe()
+		if err != nil {
+			break
+		}
+		if queued {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Refresher) refresh(ctx context.Context, t task) {
+	defer func() {
+		t.password.Wipe()
+		r.mu.Lock()
+		delete(r.queued, t.username)
+		r.mu.Unlock()
+	}()
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	info, err := r.source.Profile(ctx, t.username, t.password)
+	if err != nil {
+		log.Printf("Profile refresh of %s: %v", t.username, err)
+		return
+	}
+	u := library.User{Username: t.username}
+	if err := r.users.UpdateProfile(ctx, &u, info); err != nil {
+		log.Printf("Profile refresh of %s: %v", t.username, err)
+		return
+	}
+	// The portal may report a different department name than before.
+	if err := library.AssignDepartment(ctx, r.departments, r.users, &u); err != nil {
+		log.Printf("Department of %s not mapped: %v", t.username, err)
+	}
+}
@@ -0,0 +1,60 @@
+package profiles_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"272-backend/library"
+	"272-backend/pkg/bsl"
+	"272-backend/pkg/bsl/bsltest"
+	"272-backend/pkg/profiles"
+)
+
+func TestRefresherUpdatesStaleProfiles(t *testing.T) {
+	stub := bsltest.NewServer()
+	defer stub.Close()
+	stub.AddUser("c2011011025", bsltest.User{Password: "secret", Profile: library.PersonalInfo{FullName: "Ada Lovelace", Year: "4"}})
+	users := library.NewMemoryUserRepository()
+	ctx := context.Background()
+	u := library.User{Username: "c2011011025", UserType: "student"}
+	if err := users.InsertToDB(ctx, &u); err != nil {
+		t.Fatal(err)
+	}
+
+	refresher := profiles.NewRefresher(users, library.NewMemoryDepartmentRepository(), bsl.New(stub.URL, bsl.Options{}), nil, profiles.Options{MaxAge: time.Hour})
+	if !refresher.Stale(&u) {
+		t.Fatal("a never synced profile is not stale")
+	}
+	stub.SetDelay(20 * time.Millisecond)
+	refresher.Start()
+	defer refresher.Stop(ctx)
+
+	password := library.Secret("secret")
+	if queued, err := refresher.Enqueue(u.Username, password); !queued || err != nil {
+		t.Fatalf("first Enqueue = %v, %v", queued, err)
+	}
+	password.Wipe()
+	if queued, err := refresher.Enqueue(u.Username, library.Secret("secret")); queued || err != nil {
+		t.Fatalf("second Enqueue = %v, %v, want the waiting refresh to serve it", queued, err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		got, err := users.GetUser(ctx, u.Username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.FullName == "Ada Lovelace" {
+			if refresher.Stale(&got) {
+				t.Fatal("a refreshed profile is still stale")
+			}
+			if n := refresher.Sweep(ctx); n != 0 {
+				t.Fatalf("Sweep without a vault queued %d refreshes", n)
+			}
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("profile was not refreshed")
+}
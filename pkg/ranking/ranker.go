@@ -0,0 +1,77 @@
+// Package ranking keeps the hot rank of suggestions current. Votes and stars
+// rank a suggestion as they are cast, but the rank also decays with age, so
+// the Ranker refreshes every approved suggestion on a schedule.
+package ranking
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"272-backend/library"
+)
+
+// Ranker refreshes the hot rank of the approved suggestions every interval.
+type Ranker struct {
+	suggestions library.SuggestionRepository
+	interval    time.Duration
+
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+}
+
+// NewRanker refreshes every interval; zero turns the refreshes off, leaving
+// ranks to change with votes and stars only.
+func NewRanker(suggestions library.SuggestionRepository, interval time.Duration) *Ranker {
+	return &Ranker{suggestions: suggestions, interval: interval}
+}
+
+// Start refreshes the ranks once, as they may be stale after downtime, then
+// keeps refreshing them until Stop.
+func (r *Ranker) Start(ctx context.Context) error {
+	if err := r.suggestions.Rank(ctx); err != nil {
+		return err
+	}
+	if r.interval <= 0 {
+		return nil
+	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.suggestions.Rank(runCtx); err != nil {
+					log.Printf("Ranking suggestions: %v", err)
+				}
+			case <-runCtx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop ends the refreshes, waiting for a running one until ctx expires.
+func (r *Ranker) Stop(ctx context.Context) error {
+	if r.cancel == nil {
+		return nil
+	}
+	r.cancel()
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
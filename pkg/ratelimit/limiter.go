@@ -0,0 +1,226 @@
+// Package ratelimit throttles clients with sliding windows kept in Redis, and
+// locks accounts out after repeated failed logins.
+//
+// Every window is a sorted set of request timestamps, so a client gets at
+// most Limit requests in any Window long stretch, not 2×Limit across the edge
+// of two fixed windows. When Redis fails requests are let through: the API
+// stays up and only loses its throttling.
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"272-backend/config"
+	"272-backend/library"
+	"272-backend/pkg"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// store is the part of Redis the limiter and the lockout need.
+type store interface {
+	// Hit records a request at now in the window of key unless limit
+	// requests were already made within window. It returns whether the
+	// request was allowed, how many requests the window holds and when the
+	// oldest of them was made.
+	Hit(ctx context.Context, key string, now time.Time, window time.Duration, limit int) (allowed bool, count int, oldest time.Time, err error)
+	// Incr adds one to the counter key, which expires ttl after its first
+	// increment.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int, error)
+	// Lock sets key for ttl.
+	Lock(ctx context.Context, key string, ttl time.Duration) error
+	// TTL returns how long key lives on, 0 when it does not exist.
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	Del(ctx context.Context, keys ...string) error
+}
+
+// hitScript trims the window, adds the request when there is room and
+// returns whether it did, the size of the window and its oldest timestamp.
+var hitScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < tonumber(ARGV[3]) then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', KEYS[1], window)
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return {allowed, count, oldest[2] or tostring(now)}
+`)
+
+type redisStore struct {
+	client *redis.Client
+}
+
+func (s redisStore) Hit(ctx context.Context, key string, now time.Time, window time.Duration, limit int) (bool, int, time.Time, error) {
+	// Requests made in the same millisecond need members of their own.
+	nonce := make([]byte, 4)
+	_, _ = rand.Read(nonce)
+	member := strconv.FormatInt(now.UnixMilli(), 10) + "-" + hex.EncodeToString(nonce)
+	res, err := hitScript.Run(ctx, s.client, []string{key}, now.UnixMilli(), window.Milliseconds(), limit, member).Slice()
+	if err != nil {
+		return true, 0, now, err
+	}
+	if len(res) != 3 {
+		return true, 0, now, fmt.Errorf("ratelimit: unexpected script result %v", res)
+	}
+	allowed, _ := res[0].(int64)
+	count, _ := res[1].(int64)
+	oldest, _ := strconv.ParseFloat(fmt.Sprint(res[2]), 64)
+	return allowed == 1, int(count), time.UnixMilli(int64(oldest)), nil
+}
+
+var incrScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+func (s redisStore) Incr(ctx context.Context, key string, ttl time.Duration) (int, error) {
+	return incrScript.Run(ctx, s.client, []string{key}, ttl.Milliseconds()).Int()
+}
+
+func (s redisStore) Lock(ctx context.Context, key string, ttl time.Duration) error {
+	return s.client.Set(ctx, key, 1, ttl).Err()
+}
+
+func (s redisStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(ctx, key).Result()
+	if err != nil || ttl < 0 {
+		return 0, err
+	}
+	return ttl, nil
+}
+
+func (s redisStore) Del(ctx context.Context, keys ...string) error {
+	return s.client.Del(ctx, keys...).Err()
+}
+
+// KeyFunc names the client a request counts against. An empty key exempts
+// the request.
+type KeyFunc func(c *fiber.Ctx) string
+
+// ByIP counts requests per client address.
+func ByIP(c *fiber.Ctx) string {
+	return "ip:" + c.IP()
+}
+
+// ByUser counts requests per signed in user, and per address before the
+// token is verified. Use it after pkg.JWT.Use.
+func ByUser(c *fiber.Ctx) string {
+	claims, err := pkg.Claims(c)
+	if err != nil {
+		return ByIP(c)
+	}
+	return "user:" + claims["username"].(string)
+}
+
+// Policy allows Rate requests per client. Name keeps the windows of
+// policies apart. Methods, when set, are the only methods it counts.
+type Policy struct {
+	Name    string
+	Rate    config.Rate
+	Key     KeyFunc
+	Methods []string
+}
+
+func (p Policy) applies(c *fiber.Ctx) bool {
+	if !p.Rate.Enabled() {
+		return false
+	}
+	if len(p.Methods) == 0 {
+		return true
+	}
+	for _, method := range p.Methods {
+		if c.Method() == method {
+			return true
+		}
+	}
+	return false
+}
+
+// Limiter enforces policies on requests. A nil Limiter allows everything.
+type Limiter struct {
+	store store
+	now   func() time.Time
+}
+
+func NewLimiter(rdb *redis.Client) *Limiter {
+	return newLimiter(redisStore{client: rdb})
+}
+
+func newLimiter(s store) *Limiter {
+	return &Limiter{store: s, now: time.Now}
+}
+
+var errRateLimited = library.RateLimited("RATE_LIMITED", "Too many requests, try again later")
+
+// Handler checks every request against policies and describes the tightest
+// of them in the RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and
+// RateLimit-Policy headers. A request over a limit is refused with 429 and
+// Retry-After, and the policies after the one it is over are not charged.
+func (l *Limiter) Handler(policies ...Policy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if l == nil {
+			return c.Next()
+		}
+		tightest := -1
+		var remaining int
+		var reset time.Duration
+		for i, p := range policies {
+			if !p.applies(c) {
+				continue
+			}
+			key := p.Key(c)
+			if key == "" {
+				continue
+			}
+			now := l.now()
+			allowed, count, oldest, err := l.store.Hit(c.UserContext(), "ratelimit:"+p.Name+":"+key, now, p.Rate.Window, p.Rate.Limit)
+			if err != nil {
+				log.Printf("Rate limit %s not checked: %v", p.Name, err)
+				continue
+			}
+			left := p.Rate.Limit - count
+			wait := oldest.Add(p.Rate.Window).Sub(now)
+			if tightest < 0 || left < remaining {
+				tightest, remaining, reset = i, left, wait
+			}
+			if !allowed {
+				setHeaders(c, p.Rate, 0, wait)
+				c.Set(fiber.HeaderRetryAfter, seconds(wait))
+				return errRateLimited
+			}
+		}
+		if tightest >= 0 {
+			setHeaders(c, policies[tightest].Rate, remaining, reset)
+		}
+		return c.Next()
+	}
+}
+
+func setHeaders(c *fiber.Ctx, rate config.Rate, remaining int, reset time.Duration) {
+	c.Set("RateLimit-Limit", strconv.Itoa(rate.Limit))
+	c.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	c.Set("RateLimit-Reset", seconds(reset))
+	c.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", rate.Limit, seconds(rate.Window)))
+}
+
+// seconds rounds d up to whole seconds, at least 1.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Max(1, math.Ceil(d.Seconds()))))
+}
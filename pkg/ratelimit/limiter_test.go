@@ -0,0 +1,268 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"272-backend/config"
+	"272-backend/pkg"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// memStore keeps windows, counters and locks in memory on a clock of its own.
+type memStore struct {
+	now      time.Time
+	windows  map[string][]time.Time
+	counters map[string]int
+	expires  map[string]time.Time
+	down     bool
+}
+
+var errDown = errors.New("connection refused")
+
+func newMemStore() *memStore {
+	return &memStore{
+		now:      time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+		windows:  map[string][]time.Time{},
+		counters: map[string]int{},
+		expires:  map[string]time.Time{},
+	}
+}
+
+func (s *memStore) Hit(ctx context.Context, key string, now time.Time, window time.Duration, limit int) (bool, int, time.Time, error) {
+	if s.down {
+		return true, 0, now, errDown
+	}
+	var kept []time.Time
+	for _, at := range s.windows[key] {
+		if at.After(now.Add(-window)) {
+			kept = append(kept, at)
+		}
+	}
+	allowed := len(kept) < limit
+	if allowed {
+		kept = append(kept, now)
+	}
+	s.windows[key] = kept
+	return allowed, len(kept), kept[0], nil
+}
+
+func (s *memStore) live(key string) bool {
+	expires, ok := s.expires[key]
+	return ok && s.now.Before(expires)
+}
+
+func (s *memStore) Incr(ctx context.Context, key string, ttl time.Duration) (int, error) {
+	if s.down {
+		return 0, errDown
+	}
+	if !s.live(key) {
+		s.counters[key] = 0
+		s.expires[key] = s.now.Add(ttl)
+	}
+	s.counters[key]++
+	return s.counters[key], nil
+}
+
+func (s *memStore) Lock(ctx context.Context, key string, ttl time.Duration) error {
+	if s.down {
+		return errDown
+	}
+	s.expires[key] = s.now.Add(ttl)
+	return nil
+}
+
+func (s *memStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	if s.down {
+		return 0, errDown
+	}
+	if !s.live(key) {
+		return 0, nil
+	}
+	return s.expires[key].Sub(s.now), nil
+}
+
+func (s *memStore) Del(ctx context.Context, keys ...string) error {
+	if s.down {
+		return errDown
+	}
+	for _, key := range keys {
+		delete(s.expires, key)
+		delete(s.counters, key)
+	}
+	return nil
+}
+
+func newApp(handlers ...fiber.Handler) *fiber.App {
+	return newProxiedApp(&config.Config{}, handlers...)
+}
+
+func newProxiedApp(cfg *config.Config, handlers ...fiber.Handler) *fiber.App {
+	app := pkg.NewFiber(cfg)
+	for _, h := range handlers {
+		app.Use(h)
+	}
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) }
+	app.Get("/", ok)
+	app.Post("/", ok)
+	return app
+}
+
+func TestLimiterSlidingWindow(t *testing.T) {
+	store := newMemStore()
+	limiter := newLimiter(store)
+	limiter.now = func() time.Time { return store.now }
+	app := newApp(limiter.Handler(
+		Policy{Name: "api", Rate: config.Rate{Limit: 10, Window: time.Minute}, Key: ByIP},
+		Policy{Name: "writes", Rate: config.Rate{Limit: 2, Window: time.Minute}, Key: ByIP, Methods: []string{fiber.MethodPost}},
+	))
+	send := func(method string) *http.Response {
+		t.Helper()
+		res, err := app.Test(httptest.NewRequest(method, "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := send(fiber.MethodGet)
+	if res.StatusCode != fiber.StatusNoContent || res.Header.Get("RateLimit-Limit") != "10" || res.Header.Get("RateLimit-Remaining") != "9" || res.Header.Get("RateLimit-Policy") != "10;w=60" {
+		t.Fatalf("first request: %d %v", res.StatusCode, res.Header)
+	}
+	store.now = store.now.Add(20 * time.Second)
+	if res := send(fiber.MethodPost); res.Header.Get("RateLimit-Limit") != "2" || res.Header.Get("RateLimit-Remaining") != "1" {
+		t.Fatalf("tightest policy not described: %v", res.Header)
+	}
+	store.now = store.now.Add(20 * time.Second)
+	send(fiber.MethodPost)
+	res = send(fiber.MethodPost)
+	if res.StatusCode != fiber.StatusTooManyRequests || res.Header.Get(fiber.HeaderRetryAfter) != "40" || res.Header.Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("third write: %d %v", res.StatusCode, res.Header)
+	}
+	if res := send(fiber.MethodGet); res.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("reads limited by the write policy: %d", res.StatusCode)
+	}
+
+	// The window slides: the first writes leave it one by one.
+	store.now = store.now.Add(41 * time.Second)
+	if res := send(fiber.MethodPost); res.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("write after the window slid: %d", res.StatusCode)
+	}
+	if res := send(fiber.MethodPost); res.StatusCode != fiber.StatusTooManyRequests {
+		t.Fatalf("second write in the slid window: %d", res.StatusCode)
+	}
+
+	store.down = true
+	if res := send(fiber.MethodPost); res.StatusCode != fiber.StatusNoContent || res.Header.Get("RateLimit-Limit") != "" {
+		t.Fatalf("store down: %d %v", res.StatusCode, res.Header)
+	}
+}
+
+func TestLimiterByForwardedIP(t *testing.T) {
+	policy := Policy{Name: "api", Rate: config.Rate{Limit: 1, Window: time.Minute}, Key: ByIP}
+	send := func(app *fiber.App, forwardedFor string) int {
+		t.Helper()
+		req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+		req.Header.Set(fiber.HeaderXForwardedFor, forwardedFor)
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode
+	}
+
+	// app.Test connects from 0.0.0.0, the trusted proxy here.
+	trusted := newProxiedApp(&config.Config{ProxyHeader: fiber.HeaderXForwardedFor, TrustedProxies: []string{"0.0.0.0"}}, newLimiter(newMemStore()).Handler(policy))
+	if got := send(trusted, "203.0.113.1"); got != fiber.StatusNoContent {
+		t.Fatalf("first request of 203.0.113.1: %d", got)
+	}
+	if got := send(trusted, "203.0.113.2"); got != fiber.StatusNoContent {
+		t.Fatalf("first request of 203.0.113.2: %d", got)
+	}
+	if got := send(trusted, "203.0.113.1"); got != fiber.StatusTooManyRequests {
+		t.Fatalf("second request of 203.0.113.1: %d", got)
+	}
+
+	untrusted := newProxiedApp(&config.Config{ProxyHeader: fiber.HeaderXForwardedFor, TrustedProxies: []string{"10.0.0.0/8"}}, newLimiter(newMemStore()).Handler(policy))
+	send(untrusted, "203.0.113.1")
+	if got := send(untrusted, "203.0.113.2"); got != fiber.StatusTooManyRequests {
+		t.Fatalf("forwarded address believed from an untrusted proxy: %d", got)
+	}
+}
+
+func TestLimiterOff(t *testing.T) {
+	var limiter *Limiter
+	app := newApp(limiter.Handler(Policy{Name: "api", Rate: config.Rate{Limit: 1, Window: time.Minute}, Key: ByIP}))
+	limiter = newLimiter(newMemStore())
+	off := newApp(limiter.Handler(Policy{Name: "api", Key: ByIP}))
+	for i := 0; i < 3; i++ {
+		for _, app := range []*fiber.App{app, off} {
+			res, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+			if err != nil || res.StatusCode != fiber.StatusNoContent {
+				t.Fatalf("request %d: %v, %v", i, res, err)
+			}
+		}
+	}
+}
+
+func TestLockout(t *testing.T) {
+	store := newMemStore()
+	lockout := newLockout(store, LockoutOptions{Threshold: 3, Base: time.Minute, Max: 3 * time.Minute})
+	app := pkg.NewFiber(&config.Config{})
+	app.Post("/:username", func(c *fiber.Ctx) error {
+		if err := lockout.Check(c, c.Params("username")); err != nil {
+			return err
+		}
+		if c.Query("password") != "secret" {
+			lockout.Fail(c.UserContext(), c.Params("username"))
+			return fiber.ErrUnauthorized
+		}
+		lockout.Reset(c.UserContext(), c.Params("username"))
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	login := func(username, password string, want int) string {
+		t.Helper()
+		res, err := app.Test(httptest.NewRequest(fiber.MethodPost, "/"+username+"?password="+password, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != want {
+			t.Fatalf("login of %s with %q: %d, want %d", username, password, res.StatusCode, want)
+		}
+		return res.Header.Get(fiber.HeaderRetryAfter)
+	}
+
+	login("c2011011025", "guess", fiber.StatusUnauthorized)
+	login("c2011011025", "guess", fiber.StatusUnauthorized)
+	login("c2011011025", "secret", fiber.StatusNoContent)
+	for i := 0; i < 3; i++ {
+		login("2011011025", "guess", fiber.StatusUnauthorized)
+	}
+	if wait := login("C2011011025", "secret", fiber.StatusTooManyRequests); wait != "60" {
+		t.Fatalf("first lock: Retry-After %s", wait)
+	}
+	login("t1000000001", "secret", fiber.StatusNoContent)
+
+	// Every failure after a lock doubles the next one, up to the max.
+	for i, want := range []time.Duration{2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		store.now = store.now.Add(time.Hour)
+		login("c2011011025", "guess", fiber.StatusUnauthorized)
+		if wait := login("c2011011025", "secret", fiber.StatusTooManyRequests); wait != strconv.Itoa(int(want.Seconds())) {
+			t.Fatalf("lock %d: Retry-After %s, want %s", i+2, wait, want)
+		}
+	}
+
+	store.now = store.now.Add(time.Hour)
+	login("c2011011025", "secret", fiber.StatusNoContent)
+	login("c2011011025", "guess", fiber.StatusUnauthorized)
+	login("c2011011025", "secret", fiber.StatusNoContent)
+
+	store.down = true
+	login("c2011011025", "secret", fiber.StatusNoContent)
+}
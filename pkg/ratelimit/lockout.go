@@ -0,0 +1,127 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"272-backend/library"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// failureMemory is how long failed logins are remembered without another
+// failure.
+const failureMemory = 24 * time.Hour
+
+// LockoutOptions tunes a Lockout.
+type LockoutOptions struct {
+	// Threshold failures in a row lock an account; 0 turns the lockout off.
+	Threshold int
+	// Base is the first lock, doubled by every further failure up to Max.
+	Base time.Duration
+	Max  time.Duration
+}
+
+// Lockout locks accounts out for a growing time after repeated failed
+// logins, so passwords cannot be guessed through the API. Logins are counted
+// per account whichever address they come from. A nil Lockout locks nothing.
+type Lockout struct {
+	store store
+	opts  LockoutOptions
+}
+
+func NewLockout(rdb *redis.Client, opts LockoutOptions) *Lockout {
+	return newLockout(redisStore{client: rdb}, opts)
+}
+
+func newLockout(s store, opts LockoutOptions) *Lockout {
+	return &Lockout{store: s, opts: opts}
+}
+
+// account names the account of username however the student number is
+// written.
+func account(username string) string {
+	if n, ok := library.ParseStudentNumber(username); ok {
+		return n.Username()
+	}
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+func failuresKey(username string) string {
+	return "lockout:failures:" + account(username)
+}
+
+func lockKey(username string) string {
+	return "lockout:lock:" + account(username)
+}
+
+func (l *Lockout) off() bool {
+	return l == nil || l.opts.Threshold <= 0
+}
+
+// locked is the error of a login to a locked account. Retry-After tells how
+// long the lock lasts.
+func locked(c *fiber.Ctx, wait time.Duration) error {
+	c.Set(fiber.HeaderRetryAfter, seconds(wait))
+	return library.RateLimited("ACCOUNT_LOCKED", "Too many failed logins, try again later")
+}
+
+// Check refuses a login to username while the account is locked.
+func (l *Lockout) Check(c *fiber.Ctx, username string) error {
+	if l.off() {
+		return nil
+	}
+	wait, err := l.store.TTL(c.UserContext(), lockKey(username))
+	if err != nil {
+		log.Printf("Lockout of %s not checked: %v", username, err)
+		return nil
+	}
+	if wait > 0 {
+		return locked(c, wait)
+	}
+	return nil
+}
+
+// Fail records a failed login to username and locks the account once the
+// failures reach the threshold.
+func (l *Lockout) Fail(ctx context.Context, username string) {
+	if l.off() {
+		return
+	}
+	failures, err := l.store.Incr(ctx, failuresKey(username), failureMemory)
+	if err != nil {
+		log.Printf("Failed login of %s not recorded: %v", username, err)
+		return
+	}
+	if failures < l.opts.Threshold {
+		return
+	}
+	if err := l.store.Lock(ctx, lockKey(username), l.lockFor(failures)); err != nil {
+		log.Printf("Account %s not locked: %v", username, err)
+	}
+}
+
+// lockFor returns how long the given number of failures locks an account.
+func (l *Lockout) lockFor(failures int) time.Duration {
+	wait := l.opts.Base
+	for i := l.opts.Threshold; i < failures && wait < l.opts.Max; i++ {
+		wait *= 2
+	}
+	if wait > l.opts.Max {
+		wait = l.opts.Max
+	}
+	return wait
+}
+
+// Reset forgets the failed logins of username after a successful one.
+func (l *Lockout) Reset(ctx context.Context, username string) {
+	if l.off() {
+		return
+	}
+	if err := l.store.Del(ctx, failuresKey(username), lockKey(username)); err != nil {
+		log.Printf("Failed logins of %s not reset: %v", username, err)
+	}
+}
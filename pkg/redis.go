@@ -15,8 +15,6 @@ type RedisInstance struct {
 	ctx    context.Context
 }
 
-var Redis RedisInstance
-
 // Source https://go.dev/tour/methods/1
 func (db RedisInstance) Get(key string) (string, error) {
 	val, err := db.Client.Get(db.ctx, key).Result()
@@ -34,26 +32,26 @@ func (db RedisInstance) Expire(key string, expiration time.Duration) error {
 	err := db.Client.Expire(db.ctx, key, expiration).Err()
 	return err
 }
+func (db RedisInstance) Close() error {
+	return db.Client.Close()
+}
 
+// NewRedis connects to the server in cfg and pings it.
 // Source: https://redis.io/docs/clients/go/
-func init() {
-	opt, err := redis.ParseURL(config.REDIS_URI)
-
+func NewRedis(ctx context.Context, cfg *config.Config) (*RedisInstance, error) {
+	opt, err := redis.ParseURL(cfg.RedisURI)
 	if err != nil {
 		log.Println("Error parsing redis url: " + err.Error())
-		log.Fatalln(err)
-	} else {
-		log.Println("Redis successfully connected...")
+		return nil, err
 	}
-
-	ctx := context.Background()
 	client := redis.NewClient(opt)
 	if err := client.Ping(ctx).Err(); err != nil {
-		log.Fatal(err)
+		_ = client.Close()
+		return nil, err
 	}
-
-	Redis = RedisInstance{
+	log.Println("Redis successfully connected...")
+	return &RedisInstance{
 		Client: client,
-		ctx:    ctx,
-	}
+		ctx:    context.Background(),
+	}, nil
 }
@@ -0,0 +1,126 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+)
+
+const scrubbed = "********"
+
+// sensitiveKeys are matched, case-insensitively, as substrings of field and
+// query parameter names.
+var sensitiveKeys = []string{"password", "passwd", "secret", "token", "authorization"}
+
+func sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// ScrubURL masks the values of sensitive query parameters in rawURL.
+func ScrubURL(rawURL string) string {
+	path, query, ok := strings.Cut(rawURL, "?")
+	if !ok {
+		return rawURL
+	}
+	return path + "?" + scrubQuery(query)
+}
+
+// scrubQuery keeps the order and encoding of query and only replaces values.
+func scrubQuery(query string) string {
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		key, _, ok := strings.Cut(pair, "=")
+		if name, err := url.QueryUnescape(key); err == nil {
+			key = name
+		}
+		if ok && sensitive(key) {
+			pairs[i] = pair[:strings.IndexByte(pair, '=')+1] + scrubbed
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// ScrubBody masks sensitive fields of a JSON or form body, at any depth.
+// Other bodies are reduced to their size, since there is no telling what
+// they hold.
+func ScrubBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	switch {
+	case strings.HasPrefix(contentType, fiber.MIMEApplicationJSON):
+		var v interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&v); err != nil {
+			break
+		}
+		out, err := json.Marshal(scrubValue(v))
+		if err != nil {
+			break
+		}
+		return string(out)
+	case strings.HasPrefix(contentType, fiber.MIMEApplicationForm):
+		return scrubQuery(string(body))
+	}
+	return "[" + strconv.Itoa(len(body)) + " bytes]"
+}
+
+func scrubValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if sensitive(key) {
+				v[key] = scrubbed
+			} else {
+				v[key] = scrubValue(value)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = scrubValue(v[i])
+		}
+	}
+	return v
+}
+
+// scrubbedTags replace the logger tags that can carry passwords, so no log
+// format can print them.
+var scrubbedTags = map[string]logger.LogFunc{
+	logger.TagURL: func(output logger.Buffer, c *fiber.Ctx, _ *logger.Data, _ string) (int, error) {
+		return output.WriteString(ScrubURL(c.OriginalURL()))
+	},
+	logger.TagQueryStringParams: func(output logger.Buffer, c *fiber.Ctx, _ *logger.Data, _ string) (int, error) {
+		return output.WriteString(scrubQuery(string(c.Request().URI().QueryString())))
+	},
+	logger.TagBody: func(output logger.Buffer, c *fiber.Ctx, _ *logger.Data, _ string) (int, error) {
+		return output.WriteString(ScrubBody(c.Get(fiber.HeaderContentType), c.Body()))
+	},
+	logger.TagQuery: func(output logger.Buffer, c *fiber.Ctx, _ *logger.Data, key string) (int, error) {
+		return output.WriteString(scrubField(key, c.Query(key)))
+	},
+	logger.TagForm: func(output logger.Buffer, c *fiber.Ctx, _ *logger.Data, key string) (int, error) {
+		return output.WriteString(scrubField(key, c.FormValue(key)))
+	},
+	logger.TagReqHeader: func(output logger.Buffer, c *fiber.Ctx, _ *logger.Data, key string) (int, error) {
+		return output.WriteString(scrubField(key, c.Get(key)))
+	},
+}
+
+func scrubField(key, value string) string {
+	if sensitive(key) && value != "" {
+		return scrubbed
+	}
+	return value
+}
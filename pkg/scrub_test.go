@@ -0,0 +1,38 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestScrubURL(t *testing.T) {
+	tests := map[string]string{
+		"/portal/curriculum":                       "/portal/curriculum",
+		"/users?page=2&q=ali":                      "/users?page=2&q=ali",
+		"/session?password=hunter2&user_type=x":    "/session?password=********&user_type=x",
+		"/x?access_token=abc&Pass%77ord=hunter2&a": "/x?access_token=********&Pass%77ord=********&a",
+	}
+	for in, want := range tests {
+		if got := ScrubURL(in); got != want {
+			t.Errorf("ScrubURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestScrubBody(t *testing.T) {
+	got := ScrubBody(fiber.MIMEApplicationJSON, []byte(`{"username":"c2011011025","password":"hunter2","nested":[{"new_password":"x"}],"n":12345678901234567890}`))
+	if strings.Contains(got, "hunter2") || strings.Contains(got, `"x"`) {
+		t.Errorf("JSON body leaked a password: %s", got)
+	}
+	if !strings.Contains(got, "c2011011025") || !strings.Contains(got, "12345678901234567890") {
+		t.Errorf("JSON body lost other fields: %s", got)
+	}
+	if got := ScrubBody(fiber.MIMEApplicationForm, []byte("username=a&password=hunter2")); got != "username=a&password=********" {
+		t.Errorf("form body = %q", got)
+	}
+	if got := ScrubBody(fiber.MIMEApplicationJSON, []byte(`{"password":"hunter2"`)); got != "[21 bytes]" {
+		t.Errorf("broken JSON body = %q", got)
+	}
+}
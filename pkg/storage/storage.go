@@ -0,0 +1,56 @@
+// Package storage keeps uploaded files, on the local filesystem or in an
+// S3-compatible bucket. Files are addressed by slash-separated keys the
+// caller chooses, such as "suggestions/<id>/<attachment id>".
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"272-backend/config"
+	"272-backend/library"
+)
+
+var (
+	errObjectMissing = library.NotFound("FILE_NOT_FOUND", "The file is no longer stored")
+	errInvalidKey    = library.Validation("INVALID_STORAGE_KEY", "Invalid file name")
+)
+
+// Storage keeps files by key. Implementations are safe for concurrent use.
+type Storage interface {
+	// Put stores the size bytes of r under key, replacing any file there.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open reads the file under key; a missing file is a not found error.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the file under key, if there is one.
+	Delete(ctx context.Context, key string) error
+}
+
+// New opens the storage STORAGE_DRIVER names.
+func New(cfg *config.Config) (Storage, error) {
+	switch cfg.StorageDriver {
+	case "local":
+		return NewLocal(cfg.StorageDir)
+	case "s3":
+		return NewS3(S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		})
+	}
+	return nil, fmt.Errorf("unknown storage driver %q", cfg.StorageDriver)
+}
+
+// checkKey refuses keys that are not clean relative paths, so that no key
+// escapes the directory or bucket prefix it is stored under.
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") || strings.Contains(key, "\\") {
+		return errInvalidKey
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"272-backend/library"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// The same contract runs against every implementation. The S3 run needs a
+// disposable MinIO or other S3-compatible service in S3_TEST_ENDPOINT, with
+// S3_TEST_ACCESS_KEY and S3_TEST_SECRET_KEY, and is skipped otherwise.
+
+func TestLocal(t *testing.T) {
+	s, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, s)
+}
+
+func TestS3(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+	ctx := context.Background()
+	s, err := NewS3(S3Options{
+		Endpoint:  endpoint,
+		Bucket:    fmt.Sprintf("probee-test-%d", time.Now().UnixNano()),
+		AccessKey: os.Getenv("S3_TEST_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_TEST_SECRET_KEY"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.client.MakeBucket(ctx, s.bucket, minio.MakeBucketOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = s.client.RemoveBucketWithOptions(ctx, s.bucket, minio.RemoveBucketOptions{ForceDelete: true})
+	})
+	testStorage(t, s)
+}
+
+func testStorage(t *testing.T, s Storage) {
+	ctx := context.Background()
+	read := func(key string) (string, error) {
+		t.Helper()
+		r, err := s.Open(ctx, key)
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		return string(data), err
+	}
+
+	if err := s.Put(ctx, "suggestions/1/a", strings.NewReader("sketch"), 6, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := read("suggestions/1/a"); err != nil || data != "sketch" {
+		t.Fatalf("read back %q, %v", data, err)
+	}
+	if err := s.Put(ctx, "suggestions/1/a", strings.NewReader("poster"), 6, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := read("suggestions/1/a"); err != nil || data != "poster" {
+		t.Fatalf("read back replaced file %q, %v", data, err)
+	}
+
+	if err := s.Delete(ctx, "suggestions/1/a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := read("suggestions/1/a"); !errors.Is(err, library.ErrNotFound) {
+		t.Fatalf("read deleted file: %v", err)
+	}
+	if err := s.Delete(ctx, "suggestions/1/a"); err != nil {
+		t.Fatalf("delete missing file: %v", err)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../secret", "a/../../b", "a//b", `a\b`} {
+		if err := s.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); !errors.Is(err, library.ErrValidation) {
+			t.Errorf("put %q: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+// Package surveys fills in course surveys on the student portal in the
+// background, one job per request, so the HTTP request does not wait for BSL.
+package surveys
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"272-backend/library"
+	"272-backend/pkg/bsl"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxSurveysPerJob stops a job that BSL keeps answering without ever running
+// out of surveys.
+const maxSurveysPerJob = 50
+
+var errQueueFull = library.Unavailable("SURVEY_QUEUE_FULL", "Too many survey jobs are waiting, try again later")
+
+// Options tunes a Runner. Zero values fall back to the defaults noted below.
+type Options struct {
+	// Workers run jobs concurrently, 2 by default.
+	Workers int
+	// QueueSize jobs may wait for a worker, 100 by default.
+	QueueSize int
+	// JobTimeout bounds a whole job, 10 minutes by default.
+	JobTimeout time.Duration
+}
+
+// task is a queued job together with the password it runs with. The password
+// lives only here, in memory, and is wiped once the job is done.
+type task struct {
+	jobID    primitive.ObjectID
+	userID   string
+	password library.Secret
+}
+
+func (t *task) wipe() {
+	t.password.Wipe()
+}
+
+// Runner queues survey jobs and works them off with a fixed set of workers.
+type Runner struct {
+	jobs    library.SurveyJobRepository
+	portal  *bsl.Client
+	queue   chan *task
+	workers int
+	timeout time.Duration
+
+	// mu makes the idempotency check and the job creation one step.
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+}
+
+func NewRunner(jobs library.SurveyJobRepository, portal *bsl.Client, opts Options) *Runner {
+	if opts.Workers <= 0 {
+		opts.Workers = 2
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 100
+	}
+	if opts.JobTimeout <= 0 {
+		opts.JobTimeout = 10 * time.Minute
+	}
+	return &Runner{
+		jobs:    jobs,
+		portal:  portal,
+		queue:   make(chan *task, opts.QueueSize),
+		workers: opts.Workers,
+		timeout: opts.JobTimeout,
+	}
+}
+
+// Start fails the jobs a previous process left unfinished, since their
+// passwords are gone, and starts the workers.
+func (r *Runner) Start(ctx context.Context) error {
+	if n, err := r.jobs.FailUnfinished(ctx, "The server restarted before the job finished"); err != nil {
+		return err
+	} else if n > 0 {
+		log.Printf("Marked %d unfinished survey jobs as failed", n)
+	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	for i := 0; i < r.workers; i++ {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			for {
+				select {
+				case t := <-r.queue:
+					r.run(runCtx, t)
+				case <-runCtx.Done():
+					return
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// Stop cancels running jobs and waits for the workers until ctx expires.
+// Jobs still queued are failed.
+func (r *Runner) Stop(ctx context.Context) error {
+	if r.cancel == nil {
+		return nil
+	}
+	r.cancel()
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	for {
+		select {
+		case t := <-r.queue:
+			t.wipe()
+		default:
+			_, err := r.jobs.FailUnfinished(ctx, "The server stopped before the job finished")
+			return err
+		}
+	}
+}
+
+// Enqueue starts a job for userID unless one is already running or key names
+// a job created before; then that job is returned and created is false. The
+// job keeps its own copy of password, so the caller may wipe it.
+func (r *Runner) Enqueue(ctx context.Context, userID string, password library.Secret, key string) (job library.SurveyJob, created bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key != "" {
+		if job, err := r.jobs.FindJob(ctx, userID, key); err == nil {
+			return job, false, nil
+		} else if !errors.Is(err, library.ErrNotFound) {
+			return job, false, err
+		}
+	}
+	if job, err := r.jobs.FindJob(ctx, userID, ""); err == nil {
+		return job, false, nil
+	} else if !errors.Is(err, library.ErrNotFound) {
+		return job, false, err
+	}
+
+	job = library.SurveyJob{UserID: userID, IdempotencyKey: key}
+	if err := r.jobs.CreateJob(ctx, &job); errors.Is(err, library.ErrConflict) {
+		// Another instance created the job of key since it was looked up.
+		job, err = r.jobs.FindJob(ctx, userID, key)
+		return job, false, err
+	} else if err != nil {
+		return job, false, err
+	}
+	t := &task{jobID: job.ID, userID: userID, password: password.Copy()}
+	select {
+	case r.queue <- t:
+		return job, true, nil
+	default:
+		t.wipe()
+		r.finish(&job, errQueueFull)
+		return job, false, errQueueFull
+	}
+}
+
+func (r *Runner) run(ctx context.Context, t *task) {
+	defer t.wipe()
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	job, err := r.jobs.GetJob(ctx, t.jobID)
+	if err != nil {
+		log.Printf("Survey job %s: %v", t.jobID.Hex(), err)
+		return
+	}
+	job.Status = library.JobRunning
+	job.StartedAt = primitive.NewDateTimeFromTime(time.Now())
+	if err := r.jobs.UpdateJob(ctx, &job); err != nil {
+		log.Printf("Survey job %s: %v", t.jobID.Hex(), err)
+	}
+
+	for i := 0; i < maxSurveysPerJob; i++ {
+		result, err := r.portal.Survey(ctx, t.userID, t.password)
+		if errors.Is(err, library.ErrNotFound) {
+			break
+		}
+		if err != nil {
+			r.finish(&job, err)
+			return
+		}
+		r.record(ctx, &job, result.Course, result.Message)
+		if result.Course == "" {
+			// Only a BSL that names the course of each survey is known to
+			// answer 404 once none is left; without the name, asking again
+			// may never end, so the rest are filled in with one call.
+			msg, err := r.portal.Surveys(ctx, t.userID, t.password)
+			if err != nil {
+				r.finish(&job, err)
+				return
+			}
+			r.record(ctx, &job, "", msg.Message)
+			break
+		}
+	}
+	r.finish(&job, nil)
+}
+
+// record adds a filled in survey to job. An empty course stands for the
+// surveys BSL filled in without naming them.
+func (r *Runner) record(ctx context.Context, job *library.SurveyJob, course, message string) {
+	job.Items = append(job.Items, library.SurveyItem{
+		Course:      course,
+		Status:      library.JobSucceeded,
+		Message:     message,
+		CompletedAt: primitive.NewDateTimeFromTime(time.Now()),
+	})
+	if err := r.jobs.UpdateJob(ctx, job); err != nil {
+		log.Printf("Survey job %s: %v", job.ID.Hex(), err)
+	}
+}
+
+// finish records the outcome of job. It uses its own context so a job
+// cancelled by Stop or its timeout is still marked as failed.
+func (r *Runner) finish(job *library.SurveyJob, cause error) {
+	job.Status = library.JobSucceeded
+	if cause != nil {
+		job.Status = library.JobFailed
+		job.Error = "Survey run failed"
+		var e *library.Error
+		if errors.As(cause, &e) {
+			job.Error = e.Message
+		}
+	}
+	job.FinishedAt = primitive.NewDateTimeFromTime(time.Now())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.jobs.UpdateJob(ctx, job); err != nil {
+		log.Printf("Survey job %s: %v", job.ID.Hex(), err)
+	}
+}
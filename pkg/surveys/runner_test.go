@@ -0,0 +1,179 @@
+package surveys_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"272-backend/library"
+	"272-backend/pkg/bsl"
+	"272-backend/pkg/bsl/bsltest"
+	"272-backend/pkg/surveys"
+)
+
+func waitFor(t *testing.T, jobs library.SurveyJobRepository, job library.SurveyJob) library.SurveyJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		got, err := jobs.GetJob(context.Background(), job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Active() {
+			return got
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", job.ID.Hex())
+	return job
+}
+
+func newRunner(t *testing.T, stub *bsltest.Server, jobs library.SurveyJobRepository) *surveys.Runner {
+	t.Helper()
+	runner := surveys.NewRunner(jobs, bsl.New(stub.URL, bsl.Options{Backoff: time.Millisecond}), surveys.Options{Workers: 1})
+	if err := runner.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { runner.Stop(context.Background()) })
+	return runner
+}
+
+func TestRunnerFillsEverySurvey(t *testing.T) {
+	stub := bsltest.NewServer()
+	defer stub.Close()
+	stub.AddUser("c2011011025", bsltest.User{Password: "secret", Surveys: []string{"CENG 272", "MATH 104"}})
+	jobs := library.NewMemorySurveyJobRepository()
+	runner := newRunner(t, stub, jobs)
+	ctx := context.Background()
+
+	stub.SetDelay(20 * time.Millisecond)
+	job, created, err := runner.Enqueue(ctx, "c2011011025", library.Secret("secret"), "click-1")
+	if err != nil || !created {
+		t.Fatalf("Enqueue = %v, %v", created, err)
+	}
+	again, created, err := runner.Enqueue(ctx, "c2011011025", library.Secret("secret"), "")
+	if err != nil || created || again.ID != job.ID {
+		t.Fatalf("second Enqueue while running = %s, %v, %v", again.ID.Hex(), created, err)
+	}
+
+	done := waitFor(t, jobs, job)
+	if done.Status != library.JobSucceeded || len(done.Items) != 2 || done.Items[1].Course != "MATH 104" || done.Items[0].CompletedAt == 0 {
+		t.Fatalf("finished job = %+v", done)
+	}
+	if pending := stub.PendingSurveys("c2011011025"); len(pending) != 0 {
+		t.Fatalf("surveys left: %v", pending)
+	}
+
+	replay, created, err := runner.Enqueue(ctx, "c2011011025", library.Secret("secret"), "click-1")
+	if err != nil || created || replay.ID != job.ID {
+		t.Fatalf("Enqueue with a used key = %s, %v, %v", replay.ID.Hex(), created, err)
+	}
+	if calls := stub.Calls("/survey"); calls != 3 {
+		t.Fatalf("BSL called %d times, want 3", calls)
+	}
+}
+
+func TestRunnerRecordsFailures(t *testing.T) {
+	stub := bsltest.NewServer()
+	defer stub.Close()
+	stub.AddUser("c2011011025", bsltest.User{Password: "secret", Surveys: []string{"CENG 272"}})
+	jobs := library.NewMemorySurveyJobRepository()
+	runner := newRunner(t, stub, jobs)
+
+	job, _, err := runner.Enqueue(context.Background(), "c2011011025", library.Secret("wrong"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := waitFor(t, jobs, job)
+	if done.Status != library.JobFailed || done.Error != "Portal username or password is incorrect" {
+		t.Fatalf("failed job = %+v", done)
+	}
+
+	stub.FailNext(1, http.StatusInternalServerError)
+	job, _, err = runner.Enqueue(context.Background(), "c2011011025", library.Secret("secret"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done := waitFor(t, jobs, job); done.Status != library.JobFailed || len(done.Items) != 0 {
+		t.Fatalf("job against a failing portal = %+v", done)
+	}
+	if calls := stub.Calls("/survey"); calls != 2 {
+		t.Fatalf("survey submission was retried: %d calls", calls)
+	}
+}
+
+func TestRunnerFillsUnnamedSurveysAtOnce(t *testing.T) {
+	stub := bsltest.NewServer()
+	defer stub.Close()
+	stub.AddUser("c2011011025", bsltest.User{Password: "secret", Surveys: []string{"CENG 272", "MATH 104", "PHYS 101"}, UnnamedSurveys: true})
+	jobs := library.NewMemorySurveyJobRepository()
+	runner := newRunner(t, stub, jobs)
+
+	job, _, err := runner.Enqueue(context.Background(), "c2011011025", library.Secret("secret"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := waitFor(t, jobs, job)
+	if done.Status != library.JobSucceeded || len(done.Items) != 2 || done.Items[0].Course != "" || done.Items[1].Message != "Surveys completed" {
+		t.Fatalf("finished job = %+v", done)
+	}
+	if calls := stub.Calls("/survey") + stub.Calls("/surveys"); calls != 2 {
+		t.Fatalf("BSL called %d times, want 2", calls)
+	}
+	if pending := stub.PendingSurveys("c2011011025"); len(pending) != 0 {
+		t.Fatalf("surveys left: %v", pending)
+	}
+}
+
+func TestRunnerFailsJobsLeftByAnotherProcess(t *testing.T) {
+	jobs := library.NewMemorySurveyJobRepository()
+	stale := library.SurveyJob{UserID: "c2011011025"}
+	if err := jobs.CreateJob(context.Background(), &stale); err != nil {
+		t.Fatal(err)
+	}
+	stub := bsltest.NewServer()
+	defer stub.Close()
+	newRunner(t, stub, jobs)
+
+	got, err := jobs.GetJob(context.Background(), stale.ID)
+	if err != nil || got.Status != library.JobFailed {
+		t.Fatalf("stale job = %+v, %v", got, err)
+	}
+}
+
+// lateJobs misses the jobs of a key once, as when another instance creates
+// the job right after it was looked up.
+type lateJobs struct {
+	library.SurveyJobRepository
+	missed bool
+}
+
+func (j *lateJobs) FindJob(ctx context.Context, userID, key string) (library.SurveyJob, error) {
+	if key != "" && !j.missed {
+		j.missed = true
+		return library.SurveyJob{}, library.ErrNotFound
+	}
+	return j.SurveyJobRepository.FindJob(ctx, userID, key)
+}
+
+func TestRunnerReturnsJobCreatedConcurrently(t *testing.T) {
+	stub := bsltest.NewServer()
+	defer stub.Close()
+	jobs := library.NewMemorySurveyJobRepository()
+	runner := newRunner(t, stub, &lateJobs{SurveyJobRepository: jobs})
+	ctx := context.Background()
+
+	other := library.SurveyJob{UserID: "c2011011025", IdempotencyKey: "click-1"}
+	if err := jobs.CreateJob(ctx, &other); err != nil {
+		t.Fatal(err)
+	}
+	other.Status = library.JobSucceeded
+	if err := jobs.UpdateJob(ctx, &other); err != nil {
+		t.Fatal(err)
+	}
+	job, created, err := runner.Enqueue(ctx, "c2011011025", library.Secret("secret"), "click-1")
+	if err != nil || created || job.ID != other.ID {
+		t.Fatalf("Enqueue = %s, %v, %v", job.ID.Hex(), created, err)
+	}
+}
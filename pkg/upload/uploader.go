@@ -0,0 +1,162 @@
+// Package upload checks uploaded files, keeps them in storage with a
+// thumbnail for images, and records them as attachments.
+package upload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+
+	"272-backend/library"
+	"272-backend/pkg/storage"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxNameLength bounds the file names kept with attachments, in runes.
+const maxNameLength = 200
+
+// Accepted maps the content types files may have, as sniffed from their
+// first bytes, to whether a thumbnail is made of them.
+var Accepted = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": false,
+}
+
+var (
+	errEmpty       = library.Validation("EMPTY_FILE", "The file is empty")
+	errUnsupported = library.Unsupported("UNSUPPORTED_FILE_TYPE", "Only PNG, JPEG, GIF and WebP images and PDF documents can be attached")
+)
+
+// Uploader stores attachments, refusing files larger than its maximum size.
+type Uploader struct {
+	storage     storage.Storage
+	attachments library.AttachmentRepository
+	maxSize     int64
+}
+
+func NewUploader(s storage.Storage, attachments library.AttachmentRepository, maxSize int64) *Uploader {
+	return &Uploader{storage: s, attachments: attachments, maxSize: maxSize}
+}
+
+// Upload stores the size bytes of file and records a, which names its
+// parent, uploader and file name. The content type is sniffed from the file
+// itself, whatever the upload claimed.
+func (u *Uploader) Upload(ctx context.Context, a *library.Attachment, file io.ReadSeeker, size int64) error {
+	if size <= 0 {
+		return errEmpty
+	}
+	if size > u.maxSize {
+		return library.TooLarge("FILE_TOO_LARGE", fmt.Sprintf("Files may be at most %d MB", u.maxSize>>20))
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	contentType, _, _ := strings.Cut(http.DetectContentType(head[:n]), ";")
+	thumbnail, ok := Accepted[contentType]
+	if !ok {
+		return errUnsupported
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	a.ID = primitive.NewObjectID()
+	a.Name = cleanName(a.Name)
+	a.ContentType = contentType
+	a.Size = size
+	if err := u.storage.Put(ctx, a.Key(), file, size, contentType); err != nil {
+		return err
+	}
+	if thumbnail {
+		a.Thumbnail = u.putThumbnail(ctx, a, file)
+	}
+	if err := u.attachments.AddAttachment(ctx, a); err != nil {
+		u.deleteFiles(ctx, a)
+		return err
+	}
+	return nil
+}
+
+// putThumbnail stores a thumbnail of the image a and reports whether it
+// did. An image that cannot be decoded is kept without one.
+func (u *Uploader) putThumbnail(ctx context.Context, a *library.Attachment, file io.ReadSeeker) bool {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		log.Printf("Thumbnail of %s: %v", a.Key(), err)
+		return false
+	}
+	thumb, err := Thumbnail(file)
+	if err != nil {
+		log.Printf("Thumbnail of %s: %v", a.Key(), err)
+		return false
+	}
+	if err := u.storage.Put(ctx, a.ThumbnailKey(), bytes.NewReader(thumb), int64(len(thumb)), ThumbnailType); err != nil {
+		log.Printf("Thumbnail of %s: %v", a.Key(), err)
+		return false
+	}
+	return true
+}
+
+// Open reads the file of a, or its thumbnail.
+func (u *Uploader) Open(ctx context.Context, a *library.Attachment, thumbnail bool) (io.ReadCloser, error) {
+	if thumbnail {
+		if !a.Thumbnail {
+			return nil, library.NotFound("THUMBNAIL_NOT_FOUND", "This attachment has no thumbnail")
+		}
+		return u.storage.Open(ctx, a.ThumbnailKey())
+	}
+	return u.storage.Open(ctx, a.Key())
+}
+
+// Remove forgets a, then deletes its files.
+func (u *Uploader) Remove(ctx context.Context, a *library.Attachment) error {
+	if err := u.attachments.RemoveAttachment(ctx, a); err != nil {
+		return err
+	}
+	u.deleteFiles(ctx, a)
+	return nil
+}
+
+// deleteFiles only logs failures: a file left behind is harmless, since
+// nothing refers to it any more.
+func (u *Uploader) deleteFiles(ctx context.Context, a *library.Attachment) {
+	keys := []string{a.Key()}
+	if a.Thumbnail {
+		keys = append(keys, a.ThumbnailKey())
+	}
+	for _, key := range keys {
+		if err := u.storage.Delete(ctx, key); err != nil {
+			log.Printf("Deleting %s: %v", key, err)
+		}
+	}
+}
+
+// cleanName keeps the base name of an uploaded file without control
+// characters, so it is safe to send back in a Content-Disposition header.
+func cleanName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > maxNameLength {
+		name = string(runes[:maxNameLength])
+	}
+	if name == "." || name == "/" || name == "" {
+		return "attachment"
+	}
+	return name
+}
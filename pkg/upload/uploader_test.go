@@ -0,0 +1,124 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+
+	"272-backend/library"
+	"272-backend/pkg/storage"
+)
+
+func pngOf(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		img.Set(x, 0, color.NRGBA{R: 200, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestThumbnail(t *testing.T) {
+	for _, c := range []struct{ w, h, wantW, wantH int }{
+		{1280, 640, 320, 160},
+		{100, 2000, 16, 320},
+		{40, 30, 40, 30},
+	} {
+		thumb, err := Thumbnail(bytes.NewReader(pngOf(t, c.w, c.h)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(thumb))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b := img.Bounds(); b.Dx() != c.wantW || b.Dy() != c.wantH {
+			t.Errorf("thumbnail of %dx%d is %dx%d, want %dx%d", c.w, c.h, b.Dx(), b.Dy(), c.wantW, c.wantH)
+		}
+	}
+	if _, err := Thumbnail(bytes.NewReader([]byte("\x89PNG\r\n\x1a\nnot really"))); err == nil {
+		t.Fatal("thumbnail of a broken image")
+	}
+}
+
+func TestUpload(t *testing.T) {
+	ctx := context.Background()
+	repos := library.NewMemoryRepositories()
+	files, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := NewUploader(files, repos.Attachments, 1<<20)
+	s := library.Suggestion{Title: "Benches", Content: "In the garden", AuthorID: "c2011011025"}
+	if err := repos.Suggestions.InsertToDB(ctx, &s); err != nil {
+		t.Fatal(err)
+	}
+	upload := func(name string, data []byte) (library.Attachment, error) {
+		a := library.Attachment{Kind: library.AttachedToSuggestion, Parent: s.ID, Name: name, UploadedBy: "c2011011025"}
+		return a, u.Upload(ctx, &a, bytes.NewReader(data), int64(len(data)))
+	}
+
+	// The type comes from the content, not the name.
+	sketch, err := upload("../../sketch.pdf", pngOf(t, 640, 480))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sketch.ContentType != "image/png" || !sketch.Thumbnail || sketch.Name != "sketch.pdf" {
+		t.Fatalf("uploaded image = %+v", sketch)
+	}
+	doc, err := upload("plan.pdf", []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n1 0 obj"))
+	if err != nil || doc.ContentType != "application/pdf" || doc.Thumbnail {
+		t.Fatalf("uploaded document = %+v, %v", doc, err)
+	}
+	if err := repos.Suggestions.WithID(ctx, &s, s.ID.Hex()); err != nil || len(s.Attachments) != 2 || s.Attachments[0] != sketch.Ref() {
+		t.Fatalf("suggestion attachments = %+v, %v", s.Attachments, err)
+	}
+
+	for _, c := range []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"page.html", []byte("<html><script>alert(1)</script></html>"), library.ErrUnsupported},
+		{"image.svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), library.ErrUnsupported},
+		{"empty.png", nil, library.ErrValidation},
+		{"huge.png", append(pngOf(t, 10, 10), make([]byte, 1<<20)...), library.ErrTooLarge},
+	} {
+		if _, err := upload(c.name, c.data); !errors.Is(err, c.want) {
+			t.Errorf("upload of %s: %v", c.name, err)
+		}
+	}
+
+	r, err := u.Open(ctx, &sketch, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumb, _ := io.ReadAll(r)
+	r.Close()
+	if _, err := jpeg.Decode(bytes.NewReader(thumb)); err != nil {
+		t.Fatalf("stored thumbnail: %v", err)
+	}
+	if _, err := u.Open(ctx, &doc, true); !errors.Is(err, library.ErrNotFound) {
+		t.Fatalf("thumbnail of a document: %v", err)
+	}
+
+	if err := u.Remove(ctx, &sketch); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Open(ctx, &sketch, false); !errors.Is(err, library.ErrNotFound) {
+		t.Fatalf("removed file: %v", err)
+	}
+	if err := repos.Suggestions.WithID(ctx, &s, s.ID.Hex()); err != nil || len(s.Attachments) != 1 || s.Attachments[0].ID != doc.ID {
+		t.Fatalf("suggestion attachments after removal = %+v, %v", s.Attachments, err)
+	}
+}
@@ -0,0 +1,136 @@
+package pkg
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"272-backend/config"
+	"272-backend/library"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var errPasswordRequired = library.Validation("PORTAL_PASSWORD_REQUIRED", "The portal password is required",
+	library.FieldError{Field: "password", Code: "required", Message: "password is required unless it was remembered at login"})
+
+// CredentialVault keeps portal passwords in Redis for a short while so the
+// frontend does not have to send them with every portal action. Passwords
+// are sealed with AES-GCM under a key only the API knows, bound to the
+// username, and expire after CREDENTIAL_VAULT_TTL.
+//
+// A nil *CredentialVault is a vault that is turned off: Put and Delete do
+// nothing and Get always reports PORTAL_PASSWORD_REQUIRED.
+type CredentialVault struct {
+	redis *redis.Client
+	aead  cipher.AEAD
+	ttl   time.Duration
+}
+
+// NewCredentialVault returns nil when CREDENTIAL_VAULT_KEY is not set.
+func NewCredentialVault(rdb *RedisInstance, cfg *config.Config) (*CredentialVault, error) {
+	if cfg.CredentialVaultKey == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(cfg.CredentialVaultKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &CredentialVault{redis: rdb.Client, aead: aead, ttl: cfg.CredentialVaultTTL}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func vaultKey(username string) string {
+	return "vault:" + username
+}
+
+// Enabled reports whether passwords can be remembered.
+func (v *CredentialVault) Enabled() bool {
+	return v != nil
+}
+
+// Put remembers password for username, replacing what was there.
+func (v *CredentialVault) Put(ctx context.Context, username string, password library.Secret) error {
+	if v == nil {
+		return nil
+	}
+	sealed, err := seal(v.aead, username, password)
+	if err != nil {
+		return err
+	}
+	return v.redis.Set(ctx, vaultKey(username), sealed, v.ttl).Err()
+}
+
+// Get returns the remembered password of username. The caller wipes it.
+func (v *CredentialVault) Get(ctx context.Context, username string) (library.Secret, error) {
+	if v == nil {
+		return nil, errPasswordRequired
+	}
+	sealed, err := v.redis.Get(ctx, vaultKey(username)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, errPasswordRequired
+	}
+	if err != nil {
+		return nil, err
+	}
+	password, err := open(v.aead, username, sealed)
+	if err != nil {
+		// A value sealed under a rotated key is as good as none.
+		return nil, errPasswordRequired.Wrap(err)
+	}
+	return password, nil
+}
+
+// Password returns sent when the request carried a password, and the one
+// remembered for username otherwise. The caller wipes it.
+func (v *CredentialVault) Password(ctx context.Context, username string, sent library.Secret) (library.Secret, error) {
+	if len(sent) > 0 {
+		return sent, nil
+	}
+	return v.Get(ctx, username)
+}
+
+// Delete forgets the password of username.
+func (v *CredentialVault) Delete(ctx context.Context, username string) error {
+	if v == nil {
+		return nil
+	}
+	return v.redis.Del(ctx, vaultKey(username)).Err()
+}
+
+// seal encrypts password with a fresh nonce and the username as additional
+// data, so a value copied to another user's key does not open.
+func seal(aead cipher.AEAD, username string, password library.Secret) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(password)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, password, []byte(username)), nil
+}
+
+func open(aead cipher.AEAD, username string, sealed []byte) (library.Secret, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("vault: sealed value is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	password, err := aead.Open(nil, nonce, ciphertext, []byte(username))
+	if err != nil {
+		return nil, err
+	}
+	return library.Secret(password), nil
+}
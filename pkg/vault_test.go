@@ -0,0 +1,48 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"272-backend/library"
+)
+
+func TestVaultSeal(t *testing.T) {
+	aead, err := newAEAD(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := seal(aead, "c2011011025", library.Secret("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("hunter2")) {
+		t.Fatal("sealed value holds the plain password")
+	}
+	password, err := open(aead, "c2011011025", sealed)
+	if err != nil || string(password) != "hunter2" {
+		t.Fatalf("open() = %q, %v", string(password), err)
+	}
+	if _, err := open(aead, "c2011011026", sealed); err == nil {
+		t.Error("a value sealed for one user opened for another")
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := open(aead, "c2011011025", sealed); err == nil {
+		t.Error("a tampered value opened")
+	}
+	again, _ := seal(aead, "c2011011025", library.Secret("hunter2"))
+	if bytes.Equal(again[:aead.NonceSize()], sealed[:aead.NonceSize()]) {
+		t.Error("nonce was reused")
+	}
+}
+
+func TestNilVault(t *testing.T) {
+	var v *CredentialVault
+	if err := v.Put(context.Background(), "c2011011025", library.Secret("hunter2")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Get(context.Background(), "c2011011025"); library.ErrorCode(err) != "PORTAL_PASSWORD_REQUIRED" {
+		t.Fatalf("Get() = %v, want PORTAL_PASSWORD_REQUIRED", err)
+	}
+}
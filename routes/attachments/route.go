@@ -0,0 +1,267 @@
+package attachments
+
+import (
+	"mime"
+
+	"272-backend/library"
+	"272-backend/pkg"
+	"272-backend/pkg/upload"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	errCannotAttach = library.Forbidden("NOT_PERMITTED", "You cannot attach files to this")
+	errCannotRead   = library.Forbidden("NOT_PERMITTED", "You cannot see the files of this")
+	errCannotRemove = library.Forbidden("NOT_PERMITTED", "You cannot remove this file")
+	errFileRequired = library.Validation("VALIDATION_FAILED", "A file is required", library.FieldError{Field: "file", Code: "required", Message: "file is required"})
+)
+
+type Handler struct {
+	Uploader    *upload.Uploader
+	Attachments library.AttachmentRepository
+	Suggestions library.SuggestionRepository
+	Projects    library.ProjectRepository
+	Events      library.EventRepository
+	Anonymizer  *library.Anonymizer
+}
+
+func Register(route fiber.Router, auth *pkg.JWT, h *Handler) {
+	auth.Use(route)
+	route.Post("/:kind/:id", h.uploadAttachment)
+	route.Get("/:id", h.getAttachment)
+	route.Get("/:id/thumbnail", h.getThumbnail)
+	route.Delete("/:id", h.removeAttachment)
+}
+
+// access is what the signed in user may do with the files of a suggestion,
+// project or event.
+type access struct {
+	read, write bool
+	// uploader is the name the user's uploads are recorded under: the
+	// pseudonym on their own anonymous suggestions, so that the files do not
+	// give them away.
+	uploader string
+}
+
+// access loads the parent id of kind and decides what the user may do with
+// its files. Everyone may see the files of approved suggestions and events
+// and of projects; authors, project members and organizers, and the admins
+// of each, may attach files.
+func (h *Handler) access(c *fiber.Ctx, kind string, id primitive.ObjectID) (access, error) {
+	claims, err := pkg.Claims(c)
+	if err != nil {
+		return access{}, err
+	}
+	username := claims["username"].(string)
+	admin := pkg.HasRole(claims, library.RoleAdmin)
+	a := access{uploader: username}
+	switch kind {
+	case library.AttachedToSuggestion:
+		var s library.Suggestion
+		if err := h.Suggestions.WithID(c.UserContext(), &s, id.Hex()); err != nil {
+			return a, err
+		}
+		viewer := h.Anonymizer.Viewer(username, admin)
+		mine := viewer.Authored(&s)
+		if mine {
+			a.uploader = s.AuthorID
+		}
+		a.read = viewer.CanSee(&s)
+		a.write = mine || admin
+	case library.AttachedToProject:
+		p := library.Project{ID: id}
+		if err := h.Projects.GetProject(c.UserContext(), &p); err != nil {
+			return a, err
+		}
+		member := p.AuthorID == username || p.AdvisorID == username
+		for _, m := range p.Team {
+			member = member || m.UserID == username
+		}
+		a.read = true
+		a.write = member || admin
+	case library.AttachedToEvent:
+		e := library.Event{ID: id}
+		if err := h.Events.GetEvent(c.UserContext(), &e); err != nil {
+			return a, err
+		}
+		organizer := e.OrganizerID == username || pkg.HasRole(claims, library.RoleHaysevAdmin)
+		a.read = e.VisibleTo(username, organizer)
+		a.write = organizer
+	default:
+		return a, fiber.ErrNotFound
+	}
+	return a, nil
+}
+
+// uploadAttachment godoc
+// @Summary Upload Attachment
+// @Description Attach a PNG, JPEG, GIF or WebP image or a PDF document to a suggestion, project or event. The type is sniffed from the file; images get a thumbnail. Authors, project members, organizers and admins may attach files.
+// @Tags attachments
+// @Accept multipart/form-data
+// @Produce json
+// @Security Bearer
+// @Param kind path string true "What the file is attached to" Enums(suggestions, projects, events)
+// @Param id path string true "Suggestion, project or event ID"
+// @Param file formData file true "File"
+// @Success 200 {object} library.Attachment
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 413 {object} library.ErrorPayload
+// @Failure 415 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /attachments/{kind}/{id} [post]
+func (h *Handler) uploadAttachment(c *fiber.Ctx) error {
+	id, err := library.ParseID("id", c.Params("id"))
+	if err != nil {
+		return err
+	}
+	access, err := h.access(c, c.Params("kind"), id)
+	if err != nil {
+		return err
+	}
+	if !access.write {
+		return errCannotAttach
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		return errFileRequired
+	}
+	file, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	attachment := library.Attachment{
+		Kind:       c.Params("kind"),
+		Parent:     id,
+		Name:       header.Filename,
+		UploadedBy: access.uploader,
+	}
+	if err := h.Uploader.Upload(c.UserContext(), &attachment, file, header.Size); err != nil {
+		return err
+	}
+	return c.JSON(attachment)
+}
+
+// readable loads the attachment id if the user may see it.
+func (h *Handler) readable(c *fiber.Ctx) (library.Attachment, error) {
+	id, err := library.ParseID("id", c.Params("id"))
+	if err != nil {
+		return library.Attachment{}, err
+	}
+	attachment, err := h.Attachments.GetAttachment(c.UserContext(), id)
+	if err != nil {
+		return attachment, err
+	}
+	access, err := h.access(c, attachment.Kind, attachment.Parent)
+	if err != nil {
+		return attachment, err
+	}
+	if !access.read {
+		return attachment, errCannotRead
+	}
+	return attachment, nil
+}
+
+// send streams the file, or thumbnail, of attachment. Files are never
+// sniffed or run as documents of this origin, whatever they contain.
+func (h *Handler) send(c *fiber.Ctx, attachment library.Attachment, thumbnail bool) error {
+	file, err := h.Uploader.Open(c.UserContext(), &attachment, thumbnail)
+	if err != nil {
+		return err
+	}
+	contentType, size := attachment.ContentType, int(attachment.Size)
+	if thumbnail {
+		contentType, size = upload.ThumbnailType, -1
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("inline", map[string]string{"filename": attachment.Name}))
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderContentSecurityPolicy, "sandbox")
+	c.Set(fiber.HeaderCacheControl, "private, max-age=3600")
+	return c.SendStream(file, size)
+}
+
+// getAttachment godoc
+// @Summary Download Attachment
+// @Description Download an attached file, if the signed in user may see what it is attached to
+// @Tags attachments
+// @Produce application/octet-stream
+// @Security Bearer
+// @Param id path string true "Attachment ID"
+// @Success 200 {file} file
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /attachments/{id} [get]
+func (h *Handler) getAttachment(c *fiber.Ctx) error {
+	attachment, err := h.readable(c)
+	if err != nil {
+		return err
+	}
+	return h.send(c, attachment, false)
+}
+
+// getThumbnail godoc
+// @Summary Download Attachment Thumbnail
+// @Description Download the JPEG thumbnail of an attached image, at most 320 pixels wide and high
+// @Tags attachments
+// @Produce image/jpeg
+// @Security Bearer
+// @Param id path string true "Attachment ID"
+// @Success 200 {file} file
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /attachments/{id}/thumbnail [get]
+func (h *Handler) getThumbnail(c *fiber.Ctx) error {
+	attachment, err := h.readable(c)
+	if err != nil {
+		return err
+	}
+	return h.send(c, attachment, true)
+}
+
+// removeAttachment godoc
+// @Summary Remove Attachment
+// @Description Remove an attached file. The uploader and whoever may attach files to its parent may remove it.
+// @Tags attachments
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Attachment ID"
+// @Success 200 {object} library.Attachment
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /attachments/{id} [delete]
+func (h *Handler) removeAttachment(c *fiber.Ctx) error {
+	id, err := library.ParseID("id", c.Params("id"))
+	if err != nil {
+		return err
+	}
+	attachment, err := h.Attachments.GetAttachment(c.UserContext(), id)
+	if err != nil {
+		return err
+	}
+	access, err := h.access(c, attachment.Kind, attachment.Parent)
+	if err != nil {
+		return err
+	}
+	if !access.write && attachment.UploadedBy != access.uploader {
+		return errCannotRemove
+	}
+	if err := h.Uploader.Remove(c.UserContext(), &attachment); err != nil {
+		return err
+	}
+	return c.JSON(attachment)
+}
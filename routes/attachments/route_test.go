@@ -0,0 +1,133 @@
+package attachments_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"272-backend/config"
+	"272-backend/library"
+	"272-backend/pkg"
+	"272-backend/pkg/storage"
+	"272-backend/pkg/upload"
+	"272-backend/routes/attachments"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAttachments(t *testing.T) {
+	repos := library.NewMemoryRepositories()
+	ctx := context.Background()
+	admin := library.User{Username: "t1000000001", UserType: "teacher", Roles: []string{library.RoleAdmin}}
+	author := library.User{Username: "c2011011025", UserType: "student"}
+	reader := library.User{Username: "c2011011026", UserType: "student"}
+	s := library.Suggestion{Title: "Benches", Content: "In the garden", AuthorID: author.Username}
+	if err := repos.Suggestions.InsertToDB(ctx, &s); err != nil {
+		t.Fatal(err)
+	}
+	anonymizer, err := library.NewAnonymizer(&config.Config{JWTSecretKey: "test-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := pkg.NewFiber(&config.Config{})
+	auth := pkg.NewJWT("test-secret")
+	attachments.Register(app.Group("/attachments"), auth, &attachments.Handler{
+		Uploader:    upload.NewUploader(files, repos.Attachments, 1<<20),
+		Attachments: repos.Attachments,
+		Suggestions: repos.Suggestions,
+		Projects:    repos.Projects,
+		Events:      repos.Events,
+		Anonymizer:  anonymizer,
+	})
+	do := func(req *http.Request, u library.User) *http.Response {
+		t.Helper()
+		req.Header.Set("Authorization", "Bearer "+auth.CreateToken(jwt.MapClaims{"username": u.Username, "user_type": u.UserType, "roles": u.Roles}))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	post := func(path, name string, data []byte, u library.User) *http.Response {
+		t.Helper()
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("file", name)
+		part.Write(data)
+		form.Close()
+		req := httptest.NewRequest(http.MethodPost, path, &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		return do(req, u)
+	}
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 640, 480))); err != nil {
+		t.Fatal(err)
+	}
+	path := "/attachments/suggestions/" + s.ID.Hex()
+	if resp := post(path, "sketch.png", img.Bytes(), reader); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("upload by another student: status %d", resp.StatusCode)
+	}
+	if resp := post(path, "notes.txt", []byte("just some text"), author); resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("upload of a text file: status %d", resp.StatusCode)
+	}
+	if resp := post("/attachments/users/"+s.ID.Hex(), "sketch.png", img.Bytes(), author); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("upload to a user: status %d", resp.StatusCode)
+	}
+	resp := post(path, "sketch.png", img.Bytes(), author)
+	var sketch library.Attachment
+	if err := json.NewDecoder(resp.Body).Decode(&sketch); err != nil || resp.StatusCode != http.StatusOK || !sketch.Thumbnail {
+		t.Fatalf("upload: status %d, %+v, %v", resp.StatusCode, sketch, err)
+	}
+
+	// The suggestion is pending, so only its author and the admins see it.
+	get := func(path string, u library.User) *http.Response {
+		return do(httptest.NewRequest(http.MethodGet, path, nil), u)
+	}
+	if resp := get("/attachments/"+sketch.ID.Hex(), reader); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("download by another student: status %d", resp.StatusCode)
+	}
+	resp = get("/attachments/"+sketch.ID.Hex(), admin)
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(data, img.Bytes()) {
+		t.Fatalf("download: status %d, %d bytes", resp.StatusCode, len(data))
+	}
+	for header, want := range map[string]string{
+		"Content-Type":            "image/png",
+		"Content-Disposition":     `inline; filename=sketch.png`,
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": "sandbox",
+	} {
+		if got := resp.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	resp = get("/attachments/"+sketch.ID.Hex()+"/thumbnail", author)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != upload.ThumbnailType {
+		t.Fatalf("thumbnail: status %d, %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	remove := func(u library.User) int {
+		return do(httptest.NewRequest(http.MethodDelete, "/attachments/"+sketch.ID.Hex(), nil), u).StatusCode
+	}
+	if status := remove(reader); status != http.StatusForbidden {
+		t.Fatalf("removal by another student: status %d", status)
+	}
+	if status := remove(author); status != http.StatusOK {
+		t.Fatalf("removal: status %d", status)
+	}
+	if resp := get("/attachments/"+sketch.ID.Hex(), author); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("download of a removed file: status %d", resp.StatusCode)
+	}
+}
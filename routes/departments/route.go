@@ -0,0 +1,329 @@
+package departments
+
+import (
+	"strconv"
+
+	"272-backend/library"
+	"272-backend/pkg"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Handler struct {
+	Departments library.DepartmentRepository
+	Users       library.UserRepository
+	Suggestions library.SuggestionRepository
+	Anonymizer  *library.Anonymizer
+}
+
+func Register(router fiber.Router, auth *pkg.JWT, h *Handler) {
+	auth.Use(router)
+	router.Get("/", h.getDepartments)
+	router.Get("/:code", h.getDepartment)
+	router.Get("/:code/users", h.getDepartmentUsers)
+	router.Get("/:code/suggestions", h.getDepartmentSuggestions)
+	router.Use(pkg.RequireRole(library.RoleAdmin))
+	router.Put("/faculties/:code", h.putFaculty)
+	router.Put("/users/:id", h.putUserDepartment)
+	router.Post("/remap", h.remap)
+	router.Put("/:code", h.putDepartment)
+}
+
+func parseCode(c *fiber.Ctx) (int, error) {
+	code, err := strconv.Atoi(c.Params("code"))
+	if err != nil || code < 1 {
+		return 0, library.Validation("INVALID_CODE", "Invalid code", library.FieldError{Field: "code", Code: "min", Message: "code must be a positive number"})
+	}
+	return code, nil
+}
+
+// getDepartments godoc
+// @Summary Get departments
+// @Description Get every faculty with its departments
+// @Tags departments
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} library.FacultyTree
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /departments [get]
+func (h *Handler) getDepartments(c *fiber.Ctx) error {
+	faculties, err := h.Departments.GetFaculties(c.UserContext())
+	if err != nil {
+		return err
+	}
+	departments, err := h.Departments.GetDepartments(c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.JSON(library.BuildFacultyTree(faculties, departments))
+}
+
+// getDepartment godoc
+// @Summary Get department
+// @Description Get a department by its code
+// @Tags departments
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param code path int true "Department code"
+// @Success 200 {object} library.Department
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /departments/{code} [get]
+func (h *Handler) getDepartment(c *fiber.Ctx) error {
+	code, err := parseCode(c)
+	if err != nil {
+		return err
+	}
+	department, err := h.Departments.GetDepartment(c.UserContext(), code)
+	if err != nil {
+		return err
+	}
+	return c.JSON(department)
+}
+
+// getDepartmentUsers godoc
+// @Summary Get department users
+// @Description Get a page of the users of a department, as GET /users with department set
+// @Tags departments
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param code path int true "Department code"
+// @Param q query string false "Part of a full name"
+// @Param user_type query string false "student or teacher" Enums(student, teacher)
+// @Param page query int false "Page, from 1"
+// @Param per_page query int false "Page size, 20 by default" maximum(100)
+// @Success 200 {object} library.Page[library.UserProfile]
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /departments/{code}/users [get]
+func (h *Handler) getDepartmentUsers(c *fiber.Ctx) error {
+	code, err := parseCode(c)
+	if err != nil {
+		return err
+	}
+	var query library.UserQuery
+	if err := pkg.ParseQuery(c, &query); err != nil {
+		return err
+	}
+	claims, err := pkg.Claims(c)
+	if err != nil {
+		return err
+	}
+	viewer, err := h.Users.GetUser(c.UserContext(), claims["username"].(string))
+	if err != nil {
+		return err
+	}
+	query.Department = code
+	query.Viewer = &viewer
+	users, err := h.Users.SearchUsers(c.UserContext(), query)
+	if err != nil {
+		return err
+	}
+	return c.JSON(library.ProfilesFor(users, &viewer))
+}
+
+// getDepartmentSuggestions godoc
+// @Summary Get department suggestions
+// @Description Get the approved suggestions made by members of a department
+// @Tags departments
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param code path int true "Department code"
+// @Success 200 {array} library.SuggestionResponse
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /departments/{code}/suggestions [get]
+func (h *Handler) getDepartmentSuggestions(c *fiber.Ctx) error {
+	code, err := parseCode(c)
+	if err != nil {
+		return err
+	}
+	viewer, err := pkg.Viewer(c, h.Anonymizer)
+	if err != nil {
+		return err
+	}
+	suggestions, err := h.Suggestions.GetApprovedSuggestions(c.UserContext())
+	if err != nil {
+		return err
+	}
+	response := []library.SuggestionResponse{}
+	for _, suggestion := range suggestions {
+		// Anonymous suggestions are only listed to those who may see their
+		// department.
+		if shown := suggestion.ToResponse(viewer); shown.Department == code {
+			response = append(response, shown)
+		}
+	}
+	return c.JSON(response)
+}
+
+// putFaculty godoc
+// @Summary Put faculty
+// @Description Create or replace a faculty
+// @Tags departments
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param code path int true "Faculty code"
+// @Param body body library.Faculty true "Faculty, its code is taken from the path"
+// @Success 200 {object} library.Faculty
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /departments/faculties/{code} [put]
+func (h *Handler) putFaculty(c *fiber.Ctx) error {
+	code, err := parseCode(c)
+	if err != nil {
+		return err
+	}
+	faculty := library.Faculty{Code: code}
+	if err := pkg.ParseBody(c, &faculty); err != nil {
+		return err
+	}
+	faculty.Code = code
+	if err := h.Departments.PutFaculty(c.UserContext(), &faculty); err != nil {
+		return err
+	}
+	return c.JSON(faculty)
+}
+
+// putDepartment godoc
+// @Summary Put department
+// @Description Create or replace a department. Users are not remapped until they log in or POST /departments/remap runs.
+// @Tags departments
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param code path int true "Department code"
+// @Param body body library.Department true "Department, its code is taken from the path"
+// @Success 200 {object} library.Department
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /departments/{code} [put]
+func (h *Handler) putDepartment(c *fiber.Ctx) error {
+	code, err := parseCode(c)
+	if err != nil {
+		return err
+	}
+	department := library.Department{Code: code}
+	if err := pkg.ParseBody(c, &department); err != nil {
+		return err
+	}
+	department.Code = code
+	if err := h.Departments.PutDepartment(c.UserContext(), &department); err != nil {
+		return err
+	}
+	return c.JSON(department)
+}
+
+type userDepartmentParams struct {
+	// Department pins the user to a registered department; 0 returns them to
+	// the automatic mapping.
+	Department int `json:"department" validate:"min=0"`
+}
+
+// putUserDepartment godoc
+// @Summary Put user department
+// @Description Pin a user to a department, overriding the automatic mapping, or unpin them with department 0
+// @Tags departments
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Username"
+// @Param body body userDepartmentParams true "Department"
+// @Success 200 {object} library.User
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /departments/users/{id} [put]
+func (h *Handler) putUserDepartment(c *fiber.Ctx) error {
+	var params userDepartmentParams
+	if err := pkg.ParseBody(c, &params); err != nil {
+		return err
+	}
+	user, err := h.Users.GetUser(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return err
+	}
+	if params.Department == 0 {
+		if err := h.Users.SetDepartment(c.UserContext(), &user, user.Department, user.FacultyCode, ""); err != nil {
+			return err
+		}
+		if err := library.AssignDepartment(c.UserContext(), h.Departments, h.Users, &user); err != nil {
+			return err
+		}
+		return c.JSON(user)
+	}
+	department, err := h.Departments.GetDepartment(c.UserContext(), params.Department)
+	if err != nil {
+		return err
+	}
+	if err := h.Users.SetDepartment(c.UserContext(), &user, department.Code, department.Faculty, library.DepartmentFromAdmin); err != nil {
+		return err
+	}
+	return c.JSON(user)
+}
+
+type remapResult struct {
+	Checked int `json:"checked"`
+	Changed int `json:"changed"`
+}
+
+// remap godoc
+// @Summary Remap departments
+// @Description Map every user not pinned by an admin against the current registry
+// @Tags departments
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} remapResult
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /departments/remap [post]
+func (h *Handler) remap(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	departments, err := h.Departments.GetDepartments(ctx)
+	if err != nil {
+		return err
+	}
+	mapping := library.NewDepartmentMap(departments)
+	admin := library.User{Roles: []string{library.RoleAdmin}}
+	query := library.UserQuery{PageQuery: library.PageQuery{Page: 1, PerPage: 100}, Viewer: &admin}
+	var result remapResult
+	for {
+		page, err := h.Users.SearchUsers(ctx, query)
+		if err != nil {
+			return err
+		}
+		for i := range page.Items {
+			changed, err := mapping.Assign(ctx, h.Users, &page.Items[i])
+			if err != nil {
+				return err
+			}
+			result.Checked++
+			if changed {
+				result.Changed++
+			}
+		}
+		if len(page.Items) < query.PerPage {
+			return c.JSON(result)
+		}
+		query.Page++
+	}
+}
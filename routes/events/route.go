@@ -3,185 +3,156 @@ package events
 import (
 	"272-backend/library"
 	"272-backend/pkg"
+	"272-backend/pkg/activity"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type PostEventParams struct {
-	Title     string `json:"title"`
-	StartTime string `json:"start_time" bson:"start_time"`
+	Title string `json:"title" validate:"required,max=120"`
+	// Description is Markdown, see library.Markdown.
+	Description string `json:"description" validate:"max=5000"`
+	StartTime   string `json:"start_time" bson:"start_time" validate:"required,datetime=2006-01-02T15:04:05Z07:00" format:"date-time"`
 }
 
-func init() {
-	router := pkg.App.Group("/events")
-	pkg.UseJWT(router)
-	router.Get("/", getEvents)
-	router.Post("/", postEvent)
-	router.Use(isAdmin)
-	router.Get("/pending", getPendingEvents)
-	router.Patch("/:id", approveEvent)
-	router.Delete("/:id", deleteEvent)
+type Handler struct {
+	Events library.EventRepository
+	Users  library.UserRepository
+	// Activity follows events for their organizers and tells followers of
+	// approvals; nil records nothing.
+	Activity *activity.Recorder
 }
 
-func isAdmin(ctx *fiber.Ctx) error {
-	user := ctx.Locals("user")
-	if user == nil {
-		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "You are not logged in",
-		})
-	}
-	claims := user.(*jwt.Token).Claims.(jwt.MapClaims)
-	for _, role := range claims["roles"].([]interface{}) {
-		if role == "haysev_admin" {
-			return ctx.Next()
-		}
-	}
-	return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-		"message": "You are not authorized to access this route",
-		"error":   "NOT_PERMITTED",
-	})
+func Register(router fiber.Router, auth *pkg.JWT, h *Handler) {
+	auth.Use(router)
+	router.Get("/", h.getEvents)
+	router.Post("/", h.postEvent)
+	router.Use(pkg.RequireRole(library.RoleHaysevAdmin))
+	router.Get("/pending", h.getPendingEvents)
+	router.Patch("/:id", h.approveEvent)
+	router.Delete("/:id", h.deleteEvent)
 }
 
 // getEvents godoc
 // @Summary Get events
-// @Description Get events
+// @Description Get every event
 // @Tags events
 // @Accept json
 // @Produce json
 // @Security Bearer
+// @Success 200 {array} library.Event
 // @Failure 401 {object} library.ErrorPayload
 // @Failure 500 {object} library.ErrorPayload
 // @Router /events [get]
-func getEvents(c *fiber.Ctx) error {
-	user := c.Locals("user")
-	if user == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "You are not logged in",
-		})
+func (h *Handler) getEvents(c *fiber.Ctx) error {
+	if _, err := pkg.Claims(c); err != nil {
+		return err
 	}
-	claims := user.(*jwt.Token).Claims.(jwt.MapClaims)
-	userID := claims["username"].(string)
-	if userID == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "Authentication token is invalid or expired",
-		})
-	}
-	events, err := library.GetAllEvents()
+	events, err := h.Events.GetAllEvents(c.UserContext())
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to get events",
-		})
+		return err
 	}
 	return c.JSON(events)
 }
 
 // postEvent godoc
 // @Summary Post event
-// @Description Post event
+// @Description Post event. The description is Markdown, returned rendered to sanitized HTML too with @mentions of users and #tags linked; its tags become those of the event.
 // @Tags events
 // @Accept json
 // @Produce json
 // @Security Bearer
 // @Param body body PostEventParams true "Body"
+// @Success 200 {object} library.Event
 // @Failure 400 {object} library.ErrorPayload
 // @Failure 401 {object} library.ErrorPayload
 // @Failure 500 {object} library.ErrorPayload
 // @Router /events [post]
-func postEvent(c *fiber.Ctx) error {
+func (h *Handler) postEvent(c *fiber.Ctx) error {
 	var params PostEventParams
-	if err := c.BodyParser(&params); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"message": "Invalid request body",
-		})
+	if err := pkg.ParseBody(c, &params); err != nil {
+		return err
 	}
-	user := c.Locals("user")
-	if user == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "You are not logged in",
-		})
+	claims, err := pkg.Claims(c)
+	if err != nil {
+		return err
 	}
-	claims := user.(*jwt.Token).Claims.(jwt.MapClaims)
 	userID := claims["username"].(string)
-	if userID == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "Authentication token is invalid or expired",
-		})
-	}
 	IUser := library.User{Username: userID, UserType: "student"}
-	if err := IUser.FindUser(); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to find user",
-		})
+	if err := h.Users.FindUser(c.UserContext(), &IUser); err != nil {
+		return err
 	}
 	startTime, err := time.Parse(time.RFC3339, params.StartTime)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid start_time format",
-		})
+		return library.Validation("VALIDATION_FAILED", "Invalid start_time format", library.FieldError{Field: "start_time", Code: "datetime", Message: "start_time must be an RFC 3339 date"})
+	}
+	description, err := library.ParseMarkdown(c.UserContext(), h.Users, "description", params.Description)
+	if err != nil {
+		return err
 	}
 	event := library.Event{
-		Title:       "Köpek Besleme",
+		Title:       params.Title,
 		StartTime:   primitive.NewDateTimeFromTime(startTime),
 		Type:        "haysev",
 		OrganizerID: userID,
 		Author:      IUser.FullName,
 	}
-	if err := event.CreateEvent(); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to create event",
-		})
+	event.SetDescription(description)
+	if err := h.Events.CreateEvent(c.UserContext(), &event); err != nil {
+		return err
 	}
+	h.Activity.Follow(c.UserContext(), userID, library.SubjectEvent, event.ID.Hex())
 	return c.JSON(event)
 }
 
 // getPendingEvents godoc
 // @Summary Get pending events
-// @Description Get pending events
+// @Description Get the events waiting for approval
 // @Tags events
 // @Accept json
 // @Produce json
 // @Security Bearer
+// @Success 200 {array} library.Event
 // @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
 // @Failure 500 {object} library.ErrorPayload
 // @Router /events/pending [get]
-func getPendingEvents(c *fiber.Ctx) error {
-	events, err := library.GetPendingEvents()
+func (h *Handler) getPendingEvents(c *fiber.Ctx) error {
+	events, err := h.Events.GetPendingEvents(c.UserContext())
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to get events",
-		})
+		return err
 	}
 	return c.JSON(events)
 }
 
 // approveEvent godoc
 // @Summary Approve event
-// @Description Approve event
+// @Description Approve event and tell its followers
 // @Tags events
 // @Accept json
 // @Produce json
 // @Security Bearer
 // @Param id path string true "Event ID"
+// @Success 200 {object} library.Event
 // @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
 // @Failure 500 {object} library.ErrorPayload
 // @Router /events/{id} [patch]
-func approveEvent(c *fiber.Ctx) error {
+func (h *Handler) approveEvent(c *fiber.Ctx) error {
 	event := library.Event{}
-	if eventID, err := primitive.ObjectIDFromHex(c.Params("id")); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid suggestion ID",
-		})
+	if eventID, err := library.ParseID("id", c.Params("id")); err != nil {
+		return err
 	} else {
 		event.ID = eventID
 	}
-	if err := event.ApproveEvent(); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to approve event",
-		})
+	if err := h.Events.ApproveEvent(c.UserContext(), &event); err != nil {
+		return err
 	}
+	h.Activity.Publish(c.UserContext(), event.Activity(library.ActivityApproved))
 	return c.JSON(event)
 }
 
@@ -193,22 +164,22 @@ func approveEvent(c *fiber.Ctx) error {
 // @Produce json
 // @Security Bearer
 // @Param id path string true "Event ID"
+// @Success 200 {object} library.Event
 // @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
 // @Failure 500 {object} library.ErrorPayload
 // @Router /events/{id} [delete]
-func deleteEvent(c *fiber.Ctx) error {
+func (h *Handler) deleteEvent(c *fiber.Ctx) error {
 	event := library.Event{}
-	if eventID, err := primitive.ObjectIDFromHex(c.Params("id")); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid suggestion ID",
-		})
+	if eventID, err := library.ParseID("id", c.Params("id")); err != nil {
+		return err
 	} else {
 		event.ID = eventID
 	}
-	if err := event.RemoveEvent(); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to reject event",
-		})
+	if err := h.Events.RemoveEvent(c.UserContext(), &event); err != nil {
+		return err
 	}
 	return c.JSON(event)
 }
@@ -0,0 +1,203 @@
+package exports
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"272-backend/library"
+	"272-backend/pkg"
+	"272-backend/pkg/export"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// exportTimeout bounds an export once it has started streaming, when the
+// request context no longer applies.
+const exportTimeout = 10 * time.Minute
+
+// flushEvery records the buffered part of an export is sent to the client.
+const flushEvery = 100
+
+type Handler struct {
+	Exports library.ExportRepository
+}
+
+func Register(router fiber.Router, auth *pkg.JWT, h *Handler) {
+	auth.Use(router)
+	router.Use(pkg.RequireRole(library.RoleAdmin))
+	router.Get("/suggestions", h.getSuggestions)
+	router.Get("/events", h.getEvents)
+	router.Get("/projects", h.getProjects)
+}
+
+type query struct {
+	library.ExportQuery
+	Format string `query:"format" validate:"omitempty,oneof=csv xlsx ndjson"`
+}
+
+var suggestionColumns = []export.Column[library.SuggestionExport]{
+	{Name: "id", Value: func(s library.SuggestionExport) any { return s.ID.Hex() }},
+	{Name: "title", Value: func(s library.SuggestionExport) any { return s.Title }},
+	{Name: "content", Value: func(s library.SuggestionExport) any { return s.Content }},
+	{Name: "author", Value: func(s library.SuggestionExport) any { return s.Author }},
+	{Name: "department", Value: func(s library.SuggestionExport) any { return s.Department }},
+	{Name: "date", Value: func(s library.SuggestionExport) any { return s.Date }},
+	{Name: "status", Value: func(s library.SuggestionExport) any { return s.Status }},
+	{Name: "tags", Value: func(s library.SuggestionExport) any { return strings.Join(s.Tags, ", ") }},
+	{Name: "upvotes", Value: func(s library.SuggestionExport) any { return s.Upvotes }},
+	{Name: "downvotes", Value: func(s library.SuggestionExport) any { return s.Downvotes }},
+	{Name: "score", Value: func(s library.SuggestionExport) any { return s.Score }},
+	{Name: "stars", Value: func(s library.SuggestionExport) any { return s.Stars }},
+	{Name: "ratings", Value: func(s library.SuggestionExport) any { return s.Ratings }},
+	{Name: "decided_by", Value: func(s library.SuggestionExport) any { return s.DecidedBy }},
+	{Name: "decided_at", Value: func(s library.SuggestionExport) any { return s.DecidedAt }},
+	{Name: "rejection_reason", Value: func(s library.SuggestionExport) any { return s.RejectionReason }},
+}
+
+var eventColumns = []export.Column[library.Event]{
+	{Name: "id", Value: func(e library.Event) any { return e.ID.Hex() }},
+	{Name: "title", Value: func(e library.Event) any { return e.Title }},
+	{Name: "description", Value: func(e library.Event) any { return e.Description }},
+	{Name: "type", Value: func(e library.Event) any { return e.Type }},
+	{Name: "organizer_id", Value: func(e library.Event) any { return e.OrganizerID }},
+	{Name: "author", Value: func(e library.Event) any { return e.Author }},
+	{Name: "location", Value: func(e library.Event) any { return e.Location }},
+	{Name: "start_time", Value: func(e library.Event) any { return timestamp(e.StartTime.Time()) }},
+	{Name: "end_time", Value: func(e library.Event) any { return timestamp(e.EndTime.Time()) }},
+	{Name: "created_at", Value: func(e library.Event) any { return timestamp(e.CreatedAt.Time()) }},
+	{Name: "status", Value: func(e library.Event) any { return e.Status }},
+	{Name: "tags", Value: func(e library.Event) any { return strings.Join(e.Tags, ", ") }},
+}
+
+var projectColumns = []export.Column[library.ProjectExport]{
+	{Name: "id", Value: func(p library.ProjectExport) any { return p.ID.Hex() }},
+	{Name: "title", Value: func(p library.ProjectExport) any { return p.Title }},
+	{Name: "author", Value: func(p library.ProjectExport) any { return p.Author }},
+	{Name: "advisor", Value: func(p library.ProjectExport) any { return p.Advisor }},
+	{Name: "date", Value: func(p library.ProjectExport) any { return p.Date }},
+	{Name: "team", Value: func(p library.ProjectExport) any { return strings.Join(p.Team, ", ") }},
+	{Name: "tags", Value: func(p library.ProjectExport) any { return strings.Join(p.Tags, ", ") }},
+	{Name: "upvotes", Value: func(p library.ProjectExport) any { return p.Upvotes }},
+	{Name: "downvotes", Value: func(p library.ProjectExport) any { return p.Downvotes }},
+	{Name: "score", Value: func(p library.ProjectExport) any { return p.Score }},
+	{Name: "stars", Value: func(p library.ProjectExport) any { return p.Stars }},
+	{Name: "ratings", Value: func(p library.ProjectExport) any { return p.Ratings }},
+}
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// stream validates the query and answers with a download of the table each
+// produces. The records are read while the response is written, so the
+// status is already sent when a read fails; such failures are logged and cut
+// the download short.
+func stream[T any](c *fiber.Ctx, name string, columns []export.Column[T], each func(context.Context, library.ExportQuery, func(T) error) error) error {
+	var q query
+	if err := pkg.ParseQuery(c, &q); err != nil {
+		return err
+	}
+	if err := q.Check(); err != nil {
+		return err
+	}
+	if q.Format == "" {
+		q.Format = export.CSV
+	}
+	filename := fmt.Sprintf("%s-%s.%s", name, time.Now().UTC().Format("20060102-150405"), q.Format)
+	c.Set(fiber.HeaderContentType, export.ContentType(q.Format))
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		defer cancel()
+		table, err := export.NewTable(w, q.Format, columns)
+		if err == nil {
+			written := 0
+			err = each(ctx, q.ExportQuery, func(record T) error {
+				if err := table.Write(record); err != nil {
+					return err
+				}
+				if written++; written%flushEvery == 0 {
+					return w.Flush()
+				}
+				return nil
+			})
+			if closeErr := table.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			log.Printf("Export %s stopped: %v", filename, err)
+		}
+	})
+	return nil
+}
+
+// getSuggestions godoc
+// @Summary Export suggestions
+// @Description Download the suggestions made in the window with their votes, average stars and moderation decision, oldest first. The file is streamed; a failure part way cuts it short.
+// @Tags exports
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce application/x-ndjson
+// @Security Bearer
+// @Param format query string false "File format, csv by default" Enums(csv, xlsx, ndjson)
+// @Param from query string false "First day, YYYY-MM-DD, all time by default"
+// @Param to query string false "Last day, YYYY-MM-DD, all time by default"
+// @Param status query string false "Status" Enums(pending, approved, rejected)
+// @Success 200 {file} file
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Router /exports/suggestions [get]
+func (h *Handler) getSuggestions(c *fiber.Ctx) error {
+	return stream(c, "suggestions", suggestionColumns, h.Exports.EachSuggestion)
+}
+
+// getEvents godoc
+// @Summary Export events
+// @Description Download the events created in the window, oldest first. The file is streamed; a failure part way cuts it short.
+// @Tags exports
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce application/x-ndjson
+// @Security Bearer
+// @Param format query string false "File format, csv by default" Enums(csv, xlsx, ndjson)
+// @Param from query string false "First day, YYYY-MM-DD, all time by default"
+// @Param to query string false "Last day, YYYY-MM-DD, all time by default"
+// @Param status query string false "Status" Enums(pending, approved)
+// @Success 200 {file} file
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Router /exports/events [get]
+func (h *Handler) getEvents(c *fiber.Ctx) error {
+	return stream(c, "events", eventColumns, h.Exports.EachEvent)
+}
+
+// getProjects godoc
+// @Summary Export projects
+// @Description Download the projects started in the window with their team, votes and average stars, oldest first. The file is streamed; a failure part way cuts it short.
+// @Tags exports
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce application/x-ndjson
+// @Security Bearer
+// @Param format query string false "File format, csv by default" Enums(csv, xlsx, ndjson)
+// @Param from query string false "First day, YYYY-MM-DD, all time by default"
+// @Param to query string false "Last day, YYYY-MM-DD, all time by default"
+// @Success 200 {file} file
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Router /exports/projects [get]
+func (h *Handler) getProjects(c *fiber.Ctx) error {
+	return stream(c, "projects", projectColumns, h.Exports.EachProject)
+}
@@ -0,0 +1,71 @@
+package exports_test
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"272-backend/config"
+	"272-backend/library"
+	"272-backend/pkg"
+	"272-backend/routes/exports"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestExportSuggestions(t *testing.T) {
+	repos := library.NewMemoryRepositories()
+	ctx := context.Background()
+	for _, title := range []string{"Longer library hours", "=cmd|' /C calc'!A0"} {
+		if err := repos.Suggestions.InsertToDB(ctx, &library.Suggestion{Title: title, AuthorID: "c2011011025"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app := pkg.NewFiber(&config.Config{})
+	auth := pkg.NewJWT("test-secret")
+	exports.Register(app.Group("/exports"), auth, &exports.Handler{Exports: repos.Exports})
+	admin := auth.CreateToken(jwt.MapClaims{"username": "t1000000001", "user_type": "teacher", "roles": []string{library.RoleAdmin}})
+	student := auth.CreateToken(jwt.MapClaims{"username": "c2011011025", "user_type": "student"})
+	get := func(path, token string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := get("/exports/suggestions", student); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("student export: status %d", resp.StatusCode)
+	}
+	if resp := get("/exports/suggestions?format=pdf", admin); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("pdf export: status %d", resp.StatusCode)
+	}
+	if resp := get("/exports/suggestions?from=2024-02-01&to=2024-01-01", admin); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("backwards window: status %d", resp.StatusCode)
+	}
+
+	resp := get("/exports/suggestions?status=pending", admin)
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/csv") ||
+		!strings.HasPrefix(resp.Header.Get("Content-Disposition"), `attachment; filename="suggestions-`) {
+		t.Fatalf("csv export: status %d, headers %v", resp.StatusCode, resp.Header)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(raw), "\ufeff"))).ReadAll()
+	if err != nil || len(rows) != 3 || rows[0][1] != "title" || rows[1][1] != "Longer library hours" || rows[2][1] != "'=cmd|' /C calc'!A0" {
+		t.Fatalf("rows = %q, %v", rows, err)
+	}
+
+	resp = get("/exports/events?format=ndjson", admin)
+	if raw, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/x-ndjson" || len(raw) != 0 {
+		t.Fatalf("empty ndjson export: status %d, %q", resp.StatusCode, raw)
+	}
+}
@@ -0,0 +1,177 @@
+package feed
+
+import (
+	"272-backend/library"
+	"272-backend/pkg"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var errCannotFollow = library.Forbidden("NOT_PERMITTED", "You cannot follow this")
+
+type Handler struct {
+	Follows     library.FollowRepository
+	Suggestions library.SuggestionRepository
+	Projects    library.ProjectRepository
+	Events      library.EventRepository
+	Anonymizer  *library.Anonymizer
+}
+
+func Register(router fiber.Router, auth *pkg.JWT, h *Handler) {
+	auth.Use(router)
+	router.Get("/", h.getFeed)
+	router.Get("/follows", h.getFollows)
+	router.Put("/follows/:kind/:target", h.follow)
+	router.Delete("/follows/:kind/:target", h.unfollow)
+}
+
+// getFeed godoc
+// @Summary Get Feed
+// @Description Get a page of what happened to the suggestions, projects, events and tags the signed in user follows, and to suggestions and events mentioning them, newest first. Users follow what they create or upvote.
+// @Tags feed
+// @Produce json
+// @Security Bearer
+// @Param page query int false "Page, from 1"
+// @Param per_page query int false "Page size, at most 100"
+// @Success 200 {object} library.Page[library.Activity]
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /feed [get]
+func (h *Handler) getFeed(c *fiber.Ctx) error {
+	claims, err := pkg.Claims(c)
+	if err != nil {
+		return err
+	}
+	var q library.PageQuery
+	if err := pkg.ParseQuery(c, &q); err != nil {
+		return err
+	}
+	page, err := h.Follows.Feed(c.UserContext(), claims["username"].(string), q)
+	if err != nil {
+		return err
+	}
+	return c.JSON(page)
+}
+
+// getFollows godoc
+// @Summary Get Follows
+// @Description Get a page of what the signed in user follows, latest first
+// @Tags feed
+// @Produce json
+// @Security Bearer
+// @Param page query int false "Page, from 1"
+// @Param per_page query int false "Page size, at most 100"
+// @Success 200 {object} library.Page[library.Follow]
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /feed/follows [get]
+func (h *Handler) getFollows(c *fiber.Ctx) error {
+	claims, err := pkg.Claims(c)
+	if err != nil {
+		return err
+	}
+	var q library.PageQuery
+	if err := pkg.ParseQuery(c, &q); err != nil {
+		return err
+	}
+	page, err := h.Follows.GetFollows(c.UserContext(), claims["username"].(string), q)
+	if err != nil {
+		return err
+	}
+	return c.JSON(page)
+}
+
+// visible reports whether the user may see the suggestion, project or event
+// kind id, and so follow it, by the rules attachments are read by.
+func (h *Handler) visible(c *fiber.Ctx, kind string, id primitive.ObjectID) (bool, error) {
+	claims, err := pkg.Claims(c)
+	if err != nil {
+		return false, err
+	}
+	username := claims["username"].(string)
+	switch kind {
+	case library.SubjectSuggestion:
+		var s library.Suggestion
+		if err := h.Suggestions.WithID(c.UserContext(), &s, id.Hex()); err != nil {
+			return false, err
+		}
+		return h.Anonymizer.Viewer(username, pkg.HasRole(claims, library.RoleAdmin)).CanSee(&s), nil
+	case library.SubjectProject:
+		return true, h.Projects.GetProject(c.UserContext(), &library.Project{ID: id})
+	case library.SubjectEvent:
+		e := library.Event{ID: id}
+		if err := h.Events.GetEvent(c.UserContext(), &e); err != nil {
+			return false, err
+		}
+		return e.VisibleTo(username, pkg.HasRole(claims, library.RoleHaysevAdmin)), nil
+	}
+	return true, nil
+}
+
+// follow godoc
+// @Summary Follow
+// @Description Follow a suggestion, project or event the signed in user can see, or a tag. Following again changes nothing.
+// @Tags feed
+// @Produce json
+// @Security Bearer
+// @Param kind path string true "What to follow" Enums(suggestions, projects, events, tags)
+// @Param target path string true "Suggestion, project or event ID, or tag"
+// @Success 200 {object} library.Follow
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /feed/follows/{kind}/{target} [put]
+func (h *Handler) follow(c *fiber.Ctx) error {
+	claims, err := pkg.Claims(c)
+	if err != nil {
+		return err
+	}
+	follow := library.Follow{User: claims["username"].(string), Kind: c.Params("kind"), Target: c.Params("target")}
+	if follow.Kind != library.SubjectTag {
+		id, err := library.ParseID("target", follow.Target)
+		if err != nil {
+			return err
+		}
+		visible, err := h.visible(c, follow.Kind, id)
+		if err != nil {
+			return err
+		}
+		if !visible {
+			return errCannotFollow
+		}
+	}
+	if err := h.Follows.Follow(c.UserContext(), &follow); err != nil {
+		return err
+	}
+	return c.JSON(follow)
+}
+
+// unfollow godoc
+// @Summary Unfollow
+// @Description Stop following a suggestion, project, event or tag
+// @Tags feed
+// @Security Bearer
+// @Param kind path string true "What to unfollow" Enums(suggestions, projects, events, tags)
+// @Param target path string true "Suggestion, project or event ID, or tag"
+// @Success 204
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /feed/follows/{kind}/{target} [delete]
+func (h *Handler) unfollow(c *fiber.Ctx) error {
+	claims, err := pkg.Claims(c)
+	if err != nil {
+		return err
+	}
+	follow := library.Follow{User: claims["username"].(string), Kind: c.Params("kind"), Target: c.Params("target")}
+	if err := h.Follows.Unfollow(c.UserContext(), &follow); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
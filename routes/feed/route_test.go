@@ -0,0 +1,151 @@
+package feed_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"272-backend/config"
+	"272-backend/library"
+	"272-backend/pkg"
+	"272-backend/pkg/activity"
+	"272-backend/routes/feed"
+	"272-backend/routes/projects"
+	"272-backend/routes/suggestions"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestFeed(t *testing.T) {
+	repos := library.NewMemoryRepositories()
+	ctx := context.Background()
+	admin := library.User{Username: "t1000000001", UserType: "teacher", Roles: []string{library.RoleAdmin}}
+	author := library.User{Username: "c2011011025", UserType: "student"}
+	voter := library.User{Username: "c2011011026", UserType: "student"}
+	gardener := library.User{Username: "c2011011027", UserType: "student"}
+	for _, u := range []*library.User{&admin, &author, &voter, &gardener} {
+		if err := repos.Users.InsertToDB(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	anonymizer, err := library.NewAnonymizer(&config.Config{JWTSecretKey: "test-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := activity.NewRecorder(repos.Follows)
+	app := pkg.NewFiber(&config.Config{})
+	auth := pkg.NewJWT("test-secret")
+	suggestions.Register(app.Group("/suggestions"), auth, &suggestions.Handler{
+		Suggestions: repos.Suggestions,
+		Users:       repos.Users,
+		Anonymizer:  anonymizer,
+		Activity:    recorder,
+	})
+	projects.Register(app.Group("/projects"), auth, &projects.Handler{
+		Projects:    repos.Projects,
+		Suggestions: repos.Suggestions,
+		Users:       repos.Users,
+		Activity:    recorder,
+	})
+	feed.Register(app.Group("/feed"), auth, &feed.Handler{
+		Follows:     repos.Follows,
+		Suggestions: repos.Suggestions,
+		Projects:    repos.Projects,
+		Events:      repos.Events,
+		Anonymizer:  anonymizer,
+	})
+	do := func(method, path string, u library.User, body string, out interface{}) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+auth.CreateToken(jwt.MapClaims{"username": u.Username, "user_type": u.UserType, "roles": u.Roles}))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		if out != nil {
+			if err := json.Unmarshal(raw, out); err != nil {
+				t.Fatalf("%s %s: %v: %s", method, path, err, raw)
+			}
+		}
+		return resp.StatusCode
+	}
+	feedOf := func(u library.User) []string {
+		t.Helper()
+		var page library.Page[library.Activity]
+		if status := do(http.MethodGet, "/feed", u, "", &page); status != http.StatusOK {
+			t.Fatalf("feed of %s: status %d", u.Username, status)
+		}
+		var types []string
+		for _, a := range page.Items {
+			types = append(types, a.Kind+" "+a.Type)
+		}
+		return types
+	}
+
+	var s, hidden library.SuggestionResponse
+	do(http.MethodPost, "/suggestions", author, `{"title":"More benches","content":"In the #garden"}`, &s)
+	do(http.MethodPost, "/suggestions", author, `{"title":"Grading","content":"Unfair","anonymity":"everyone"}`, &hidden)
+	if status := do(http.MethodPut, "/feed/follows/suggestions/"+s.ID, gardener, "", nil); status != http.StatusForbidden {
+		t.Fatalf("following a pending suggestion of someone else: status %d", status)
+	}
+	var follows library.Page[library.Follow]
+	do(http.MethodPut, "/suggestions/"+s.ID+"/upvote", gardener, "", nil)
+	if do(http.MethodGet, "/feed/follows", gardener, "", &follows); follows.Total != 0 {
+		t.Fatalf("upvoting a pending suggestion of someone else follows %+v", follows)
+	}
+	if status := do(http.MethodPut, "/feed/follows/tags/Garden", gardener, "", nil); status != http.StatusOK {
+		t.Fatalf("follow a tag: status %d", status)
+	}
+	for _, id := range []string{s.ID, hidden.ID} {
+		if status := do(http.MethodPatch, "/suggestions/"+id+"/approve", admin, "", nil); status != http.StatusOK {
+			t.Fatalf("approve: status %d", status)
+		}
+	}
+	do(http.MethodPut, "/suggestions/"+s.ID+"/upvote", voter, "", nil)
+	if status := do(http.MethodPut, "/suggestions/"+hidden.ID+"/upvote", author, "", nil); status != http.StatusOK {
+		t.Fatalf("upvote own anonymous suggestion: status %d", status)
+	}
+
+	do(http.MethodGet, "/feed/follows", author, "", &follows)
+	if follows.Total != 1 || follows.Items[0].Target != s.ID {
+		t.Fatalf("author follows %+v; anonymous suggestions must not be followed", follows)
+	}
+	var project library.Project
+	if status := do(http.MethodPost, "/projects", admin, `{"suggestion":"`+s.ID+`","advisor":"`+admin.Username+`"}`, &project); status != http.StatusOK {
+		t.Fatalf("create project: status %d", status)
+	}
+
+	for _, c := range []struct {
+		user library.User
+		want string
+	}{
+		{author, "projects project,suggestions approved"},
+		{voter, "projects project,suggestions approved"},
+		{gardener, "projects project,suggestions approved"},
+		{admin, "projects project"},
+	} {
+		if got := strings.Join(feedOf(c.user), ","); got != c.want {
+			t.Errorf("feed of %s = %s, want %s", c.user.Username, got, c.want)
+		}
+	}
+	do(http.MethodGet, "/feed/follows", voter, "", &follows)
+	if follows.Total != 2 || follows.Items[0].Kind != library.SubjectProject {
+		t.Fatalf("voter follows %+v", follows)
+	}
+
+	if status := do(http.MethodDelete, "/feed/follows/tags/garden", gardener, "", nil); status != http.StatusNoContent {
+		t.Fatalf("unfollow: status %d", status)
+	}
+	if status := do(http.MethodDelete, "/feed/follows/tags/garden", gardener, "", nil); status != http.StatusNotFound {
+		t.Fatalf("unfollow twice: status %d", status)
+	}
+	if got := feedOf(gardener); len(got) != 0 {
+		t.Fatalf("feed after unfollowing = %v", got)
+	}
+}
@@ -0,0 +1,134 @@
+package imports
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+
+	"272-backend/library"
+	"272-backend/pkg"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Handler struct {
+	Events library.EventRepository
+	Users  library.UserRepository
+	Roles  library.RoleRepository
+}
+
+func Register(router fiber.Router, auth *pkg.JWT, h *Handler) {
+	auth.Use(router)
+	router.Use(pkg.RequireRole(library.RoleAdmin))
+	router.Post("/events", h.postEvents)
+	router.Post("/users", h.postUsers)
+}
+
+type ImportParams struct {
+	DryRun bool `query:"dry_run"`
+}
+
+// file returns the uploaded CSV, sent either as the "file" field of a
+// multipart form or as the request body.
+func file(c *fiber.Ctx) (io.Reader, func(), error) {
+	if !strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		return bytes.NewReader(c.Body()), func() {}, nil
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, nil, library.Validation("INVALID_REQUEST", "The form has no file field",
+			library.FieldError{Field: "file", Code: "required", Message: "file is required"})
+	}
+	f, err := header.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { f.Close() }, nil
+}
+
+// read parses the query and the uploaded rows of an import.
+func read[T any](c *fiber.Ctx) (ImportParams, []library.ImportRow[T], error) {
+	var params ImportParams
+	if err := pkg.ParseQuery(c, &params); err != nil {
+		return params, nil, err
+	}
+	r, done, err := file(c)
+	if err != nil {
+		return params, nil, err
+	}
+	defer done()
+	rows, err := library.ReadImport[T](r)
+	return params, rows, err
+}
+
+// postEvents godoc
+// @Summary Import events
+// @Description Create or update approved events from a CSV file with the columns key, title, description, start_time, end_time, location, type and tags; title, start_time and type are required, times are RFC 3339 and tags are separated by commas. Rows update the event imported earlier with the same key, or with the same title and start time when key is empty, so importing a file again changes nothing. Nothing is written unless every row is valid; dry_run only validates.
+// @Tags imports
+// @Accept text/csv
+// @Accept multipart/form-data
+// @Produce json
+// @Security Bearer
+// @Param dry_run query bool false "Only validate the rows"
+// @Param file formData file false "CSV file, or send it as the body"
+// @Success 200 {object} library.ImportReport
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /imports/events [post]
+func (h *Handler) postEvents(c *fiber.Ctx) error {
+	params, rows, err := read[library.EventRow](c)
+	if err != nil {
+		return err
+	}
+	claims, err := pkg.Claims(c)
+	if err != nil {
+		return err
+	}
+	username := claims["username"].(string)
+	organizer, err := h.Users.GetUser(c.UserContext(), username)
+	if errors.Is(err, library.ErrNotFound) {
+		organizer = library.User{Username: username}
+	} else if err != nil {
+		return err
+	}
+	report, err := library.ImportEvents(c.UserContext(), h.Events, organizer, rows, params.DryRun)
+	if err != nil {
+		return err
+	}
+	return c.JSON(report)
+}
+
+// postUsers godoc
+// @Summary Import users
+// @Description Create users before their first login from a CSV file with the columns username, user_type, full_name and roles; username and user_type are required and roles are registered role names separated by commas. Existing users keep their data: a full name replaces theirs and roles are granted, never revoked, and logged as granted by the importing admin. Nothing is written unless every row is valid; dry_run only validates.
+// @Tags imports
+// @Accept text/csv
+// @Accept multipart/form-data
+// @Produce json
+// @Security Bearer
+// @Param dry_run query bool false "Only validate the rows"
+// @Param file formData file false "CSV file, or send it as the body"
+// @Success 200 {object} library.ImportReport
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /imports/users [post]
+func (h *Handler) postUsers(c *fiber.Ctx) error {
+	claims, err := pkg.Claims(c)
+	if err != nil {
+		return err
+	}
+	params, rows, err := read[library.UserRow](c)
+	if err != nil {
+		return err
+	}
+	report, err := library.ImportUsers(c.UserContext(), h.Users, h.Roles, claims["username"].(string), rows, params.DryRun)
+	if err != nil {
+		return err
+	}
+	return c.JSON(report)
+}
@@ -0,0 +1,71 @@
+package imports_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"272-backend/config"
+	"272-backend/library"
+	"272-backend/pkg"
+	"272-backend/routes/imports"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestImportUsers(t *testing.T) {
+	repos := library.NewMemoryRepositories()
+	if err := repos.Roles.EnsureRoles(context.Background(), library.DefaultRoles()); err != nil {
+		t.Fatal(err)
+	}
+	app := pkg.NewFiber(&config.Config{})
+	auth := pkg.NewJWT("test-secret")
+	imports.Register(app.Group("/imports"), auth, &imports.Handler{Events: repos.Events, Users: repos.Users, Roles: repos.Roles})
+	token := auth.CreateToken(jwt.MapClaims{"username": "t1000000001", "user_type": "teacher", "roles": []string{library.RoleAdmin}})
+	post := func(path, contentType string, body io.Reader, out interface{}) int {
+		req := httptest.NewRequest(http.MethodPost, path, body)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		if err := json.Unmarshal(raw, out); err != nil {
+			t.Fatalf("%s: %v: %s", path, err, raw)
+		}
+		return resp.StatusCode
+	}
+	file := "username,user_type,roles\nc2011011025,student,haysev_admin\n"
+
+	var report library.ImportReport
+	if status := post("/imports/users?dry_run=true", "text/csv", strings.NewReader(file), &report); status != http.StatusOK || !report.DryRun || report.Applied || report.Rows != 1 {
+		t.Fatalf("dry run: status %d, %+v", status, report)
+	}
+	if _, err := repos.Users.GetUser(context.Background(), "c2011011025"); err == nil {
+		t.Fatal("dry run created the user")
+	}
+
+	var form bytes.Buffer
+	w := multipart.NewWriter(&form)
+	part, _ := w.CreateFormFile("file", "users.csv")
+	part.Write([]byte(file))
+	w.Close()
+	if status := post("/imports/users", w.FormDataContentType(), &form, &report); status != http.StatusOK || !report.Applied || report.Created != 1 {
+		t.Fatalf("form upload: status %d, %+v", status, report)
+	}
+	if log, err := repos.Roles.GetChanges(context.Background(), library.RoleChangeQuery{Target: "c2011011025"}); err != nil || log.Total != 1 || log.Items[0].Actor != "t1000000001" {
+		t.Fatalf("role grant of the import not logged: %+v, %v", log, err)
+	}
+
+	var errPayload library.ErrorPayload
+	if status := post("/imports/events", "text/csv", strings.NewReader("title,colour\n"), &errPayload); status != http.StatusBadRequest || errPayload.Error != "INVALID_CSV" {
+		t.Fatalf("unknown column: status %d, %+v", status, errPayload)
+	}
+}
@@ -1,116 +1,206 @@
 package portal
 
 import (
-	"272-backend/config"
+	"errors"
+	"strings"
+
+	"272-backend/library"
 	"272-backend/pkg"
-	"bytes"
-	"encoding/json"
-	"io"
-	"net/http"
+	"272-backend/pkg/bsl"
+	"272-backend/pkg/surveys"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-func init() {
-	router := pkg.App.Group("/portal")
-	pkg.UseJWT(router)
-	router.Get("/curriculum", getCurriculum)
-	router.Post("/curriculum", postCurriculum)
-	router.Post("/survey", postSurvey)
-	router.Post("/surveys", postSurveys)
+type Handler struct {
+	BSL       *bsl.Client
+	Users     library.UserRepository
+	Curricula library.CurriculumRepository
+	Grades    library.GradeScale
+	Surveys   *surveys.Runner
+	Jobs      library.SurveyJobRepository
+	Vault     *pkg.CredentialVault
+}
+
+func Register(router fiber.Router, auth *pkg.JWT, h *Handler) {
+	auth.Use(router)
+	router.Get("/curriculum", h.getCurriculum)
+	router.Post("/curriculum", h.postCurriculum)
+	router.Get("/transcript", h.getTranscript)
+	router.Post("/transcript/what-if", h.postWhatIf)
+	router.Post("/survey", h.postSurvey)
+	router.Post("/surveys", h.postSurveys)
+	router.Get("/surveys", h.getSurveys)
+	router.Get("/jobs", h.getJobs)
+	router.Get("/jobs/:id", h.getJob)
+}
+
+// currentUser loads the user the request is authenticated as.
+func (h *Handler) currentUser(c *fiber.Ctx) (library.User, error) {
+	claims, err := pkg.Claims(c)
+	if err != nil {
+		return library.User{}, err
+	}
+	userType, _ := claims["user_type"].(string)
+	user := library.User{Username: claims["username"].(string), UserType: userType}
+	err = h.Users.FindUser(c.UserContext(), &user)
+	return user, err
 }
 
 // getCurriculum godoc
 // @Summary Get curriculum
-// @Description Get curriculum
+// @Description Get the curriculum and grades stored by the last sync
 // @Tags portal
 // @Accept json
 // @Produce json
 // @Security Bearer
-// @Success 200 {object} GetResponse
+// @Success 200 {array} library.CourseData
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
 // @Router /portal/curriculum [get]
-func getCurriculum(c *fiber.Ctx) error {
-	user := c.Locals("user")
-	if user == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "You are not logged in",
-		})
+func (h *Handler) getCurriculum(c *fiber.Ctx) error {
+	user, err := h.currentUser(c)
+	if err != nil {
+		return err
 	}
-	claims := user.(*jwt.Token).Claims.(jwt.MapClaims)
-	userID := claims["username"].(string)
-	if userID == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "Authentication token is invalid or expired",
-		})
+	courses, err := h.Curricula.GetUserCurriculum(c.UserContext(), &user)
+	if err != nil {
+		return err
 	}
-
-	return c.Status(200).JSON(fiber.Map{
-		"message": "Curriculum",
-	})
+	return c.Status(200).JSON(courses)
 }
 
 // postCurriculum godoc
 // @Summary Post curriculum
-// @Description Post curriculum
+// @Description Fetch the curriculum from the portal and store what changed
 // @Tags portal
 // @Accept json
 // @Produce json
 // @Security Bearer
 // @Param body body fetchCirriculumParams true "Body"
-// @Success 200 {object} []CurriculumObject
+// @Success 200 {object} library.CurriculumSync
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Failure 503 {object} library.ErrorPayload
 // @Router /portal/curriculum [post]
-func postCurriculum(c *fiber.Ctx) error {
+func (h *Handler) postCurriculum(c *fiber.Ctx) error {
 	data := new(fetchCirriculumParams)
-	if err := c.BodyParser(data); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"message": "Invalid request",
-		})
+	defer func() { data.Password.Wipe() }()
+	if err := pkg.ParseBody(c, data); err != nil {
+		return err
 	}
-	user := c.Locals("user")
-	if user == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "You are not logged in",
-		})
+	user, err := h.currentUser(c)
+	if err != nil {
+		return err
 	}
-	claims := user.(*jwt.Token).Claims.(jwt.MapClaims)
-	userID := claims["username"].(string)
-	if userID == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "Authentication token is invalid or expired",
-		})
+	if data.Password, err = h.Vault.Password(c.UserContext(), user.Username, data.Password); err != nil {
+		return err
 	}
-	pwd := data.Password
-	postData := map[string]string{
-		"username": userID,
-		"password": pwd,
+	courses, err := h.BSL.Curriculum(c.UserContext(), user.Username, data.Password)
+	if err != nil {
+		return err
+	}
+	rows := make([]library.CourseData, 0, len(courses))
+	for _, course := range courses {
+		rows = append(rows, library.CourseData{
+			Code:       course.Code,
+			CourseID:   course.CourseID,
+			CourseCode: course.CourseCode,
+			CourseName: course.CourseName,
+			Credits:    course.Credits,
+			Grade:      course.Grade,
+			Semester:   course.Semester,
+			Year:       course.Year,
+		})
 	}
-	jsonData, err := json.Marshal(postData)
+	sync, err := h.Curricula.Sync(c.UserContext(), &user, rows)
 	if err != nil {
 		return err
 	}
-	response, err := http.Post(config.BSL_URI+"/curriculum", "application/json", bytes.NewBuffer(jsonData))
+
+	return c.Status(200).JSON(sync)
+}
+
+// curriculumPlan returns the department plan of user, or nil when it has not
+// been synced yet.
+func (h *Handler) curriculumPlan(c *fiber.Ctx, user *library.User) (*library.Cirriculum, error) {
+	plan, err := h.Curricula.GetCirriculum(c.UserContext(), user.Department, user.CirriculumName())
+	if errors.Is(err, library.ErrNotFound) {
+		return nil, nil
+	}
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to post curriculum",
-			"error":   err.Error(),
-		})
+		return nil, err
 	}
-	defer response.Body.Close()
-	body, err := io.ReadAll(response.Body)
+	return &plan, nil
+}
+
+// getTranscript godoc
+// @Summary Get transcript
+// @Description Get semester and cumulative GPA, earned and required credits and the courses left to pass, from the last curriculum sync
+// @Tags portal
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} library.Transcript
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /portal/transcript [get]
+func (h *Handler) getTranscript(c *fiber.Ctx) error {
+	user, err := h.currentUser(c)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to read response body",
-			"error":   err.Error(),
-		})
+		return err
+	}
+	courses, err := h.Curricula.GetUserCurriculum(c.UserContext(), &user)
+	if err != nil {
+		return err
 	}
-	var info []CurriculumObject
-	err = json.Unmarshal(body, &info)
+	plan, err := h.curriculumPlan(c, &user)
 	if err != nil {
 		return err
 	}
+	return c.JSON(h.Grades.Transcript(courses, plan))
+}
 
-	return c.Status(200).JSON(info)
+// postWhatIf godoc
+// @Summary What-if GPA
+// @Description Project the GPA as if the given grades had been received
+// @Tags portal
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param body body whatIfParams true "Hypothetical grades"
+// @Success 200 {object} library.WhatIf
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /portal/transcript/what-if [post]
+func (h *Handler) postWhatIf(c *fiber.Ctx) error {
+	var params whatIfParams
+	if err := pkg.ParseBody(c, &params); err != nil {
+		return err
+	}
+	user, err := h.currentUser(c)
+	if err != nil {
+		return err
+	}
+	courses, err := h.Curricula.GetUserCurriculum(c.UserContext(), &user)
+	if err != nil {
+		return err
+	}
+	plan, err := h.curriculumPlan(c, &user)
+	if err != nil {
+		return err
+	}
+	projection, err := h.Grades.WhatIf(courses, plan, params.Grades)
+	if err != nil {
+		return err
+	}
+	return c.JSON(projection)
 }
 
 // postSurvey godoc
@@ -121,53 +211,28 @@ func postCurriculum(c *fiber.Ctx) error {
 // @Produce json
 // @Security Bearer
 // @Param body body BSLparams true "Body"
-// @Success 200 {object} GetResponse
+// @Success 200 {object} bsl.SurveyResult
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Failure 503 {object} library.ErrorPayload
 // @Router /portal/survey [post]
-func postSurvey(c *fiber.Ctx) error {
+func (h *Handler) postSurvey(c *fiber.Ctx) error {
 	data := new(BSLparams)
-	if err := c.BodyParser(data); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"message": "Invalid request",
-		})
-	}
-	user := c.Locals("user")
-	if user == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "You are not logged in",
-		})
-	}
-	claims := user.(*jwt.Token).Claims.(jwt.MapClaims)
-	userID := claims["username"].(string)
-	if userID == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "Authentication token is invalid or expired",
-		})
-	}
-	postData := map[string]interface{}{
-		"username": userID,
-		"password": data.Password,
-	}
-	jsonData, err := json.Marshal(postData)
-	if err != nil {
+	defer func() { data.Password.Wipe() }()
+	if err := pkg.ParseBody(c, data); err != nil {
 		return err
 	}
-	response, err := http.Post(config.BSL_URI+"/survey", "application/json", bytes.NewBuffer(jsonData))
+	claims, err := pkg.Claims(c)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to post survey",
-			"error":   err.Error(),
-		})
+		return err
 	}
-	defer response.Body.Close()
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to read response body",
-			"error":   err.Error(),
-		})
+	userID := claims["username"].(string)
+	if data.Password, err = h.Vault.Password(c.UserContext(), userID, data.Password); err != nil {
+		return err
 	}
-	var info GetResponse
-	err = json.Unmarshal(body, &info)
+	info, err := h.BSL.Survey(c.UserContext(), userID, data.Password)
 	if err != nil {
 		return err
 	}
@@ -176,63 +241,133 @@ func postSurvey(c *fiber.Ctx) error {
 }
 
 // postSurveys godoc
-// @Summary Post surveys
-// @Description Post surveys
+// @Summary Fill in surveys
+// @Description Queue a job that fills in every pending course survey. The password may be omitted when it was remembered at login; it is kept in memory only while the job runs. A running job, or the job created with the same Idempotency-Key, is returned instead of starting another one.
 // @Tags portal
 // @Accept json
 // @Produce json
 // @Security Bearer
+// @Param Idempotency-Key header string false "Client chosen key that makes retries safe"
 // @Param body body BSLparams true "Body"
-// @Success 200 {object} GetResponse
+// @Success 200 {object} library.SurveyJob "Existing job"
+// @Success 202 {object} library.SurveyJob "Queued job"
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Failure 503 {object} library.ErrorPayload
 // @Router /portal/surveys [post]
-func postSurveys(c *fiber.Ctx) error {
+func (h *Handler) postSurveys(c *fiber.Ctx) error {
 	data := new(BSLparams)
-	if err := c.BodyParser(data); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"message": "Invalid request",
-		})
+	defer func() { data.Password.Wipe() }()
+	if err := pkg.ParseBody(c, data); err != nil {
+		return err
 	}
-	user := c.Locals("user")
-	if user == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "You are not logged in",
-		})
+	claims, err := pkg.Claims(c)
+	if err != nil {
+		return err
 	}
-	claims := user.(*jwt.Token).Claims.(jwt.MapClaims)
 	userID := claims["username"].(string)
-	if userID == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "Authentication token is invalid or expired",
-		})
+	if data.Password, err = h.Vault.Password(c.UserContext(), userID, data.Password); err != nil {
+		return err
 	}
-	postData := map[string]interface{}{
-		"username": userID,
-		"password": data.Password,
+	key := c.Get("Idempotency-Key")
+	if len(key) > 128 {
+		return library.Validation("VALIDATION_FAILED", "Request validation failed", library.FieldError{Field: "Idempotency-Key", Code: "max", Message: "Idempotency-Key must be at most 128 characters long"})
 	}
-	jsonData, err := json.Marshal(postData)
+	job, created, err := h.Surveys.Enqueue(c.UserContext(), userID, data.Password, key)
 	if err != nil {
 		return err
 	}
-	response, err := http.Post(config.BSL_URI+"/surveys", "application/json", bytes.NewBuffer(jsonData))
+	if created {
+		c.Location(strings.TrimSuffix(c.Path(), "/surveys") + "/jobs/" + job.ID.Hex())
+		return c.Status(fiber.StatusAccepted).JSON(job)
+	}
+	return c.Status(fiber.StatusOK).JSON(job)
+}
+
+// getSurveys godoc
+// @Summary Get completed surveys
+// @Description Get every survey filled in by a job, newest first
+// @Tags portal
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} library.SurveyItem
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /portal/surveys [get]
+func (h *Handler) getSurveys(c *fiber.Ctx) error {
+	claims, err := pkg.Claims(c)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to post surveys",
-			"error":   err.Error(),
-		})
+		return err
 	}
-	defer response.Body.Close()
-	body, err := io.ReadAll(response.Body)
+	jobs, err := h.Jobs.GetJobs(c.UserContext(), claims["username"].(string))
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to read response body",
-			"error":   err.Error(),
-		})
+		return err
 	}
-	var info GetResponse
-	err = json.Unmarshal(body, &info)
+	completed := []library.SurveyItem{}
+	for _, job := range jobs {
+		for i := len(job.Items) - 1; i >= 0; i-- {
+			if job.Items[i].Status == library.JobSucceeded {
+				completed = append(completed, job.Items[i])
+			}
+		}
+	}
+	return c.JSON(completed)
+}
+
+// getJobs godoc
+// @Summary Get survey jobs
+// @Description Get the survey jobs of the user, newest first
+// @Tags portal
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} library.SurveyJob
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /portal/jobs [get]
+func (h *Handler) getJobs(c *fiber.Ctx) error {
+	claims, err := pkg.Claims(c)
 	if err != nil {
 		return err
 	}
+	jobs, err := h.Jobs.GetJobs(c.UserContext(), claims["username"].(string))
+	if err != nil {
+		return err
+	}
+	return c.JSON(jobs)
+}
 
-	return c.Status(200).JSON(info)
+// getJob godoc
+// @Summary Get survey job
+// @Description Get the status of a survey job and of every survey it filled in
+// @Tags portal
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Job ID"
+// @Success 200 {object} library.SurveyJob
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /portal/jobs/{id} [get]
+func (h *Handler) getJob(c *fiber.Ctx) error {
+	claims, err := pkg.Claims(c)
+	if err != nil {
+		return err
+	}
+	jobID, err := library.ParseID("id", c.Params("id"))
+	if err != nil {
+		return err
+	}
+	job, err := h.Jobs.GetJob(c.UserContext(), jobID)
+	if err != nil {
+		return err
+	}
+	if job.UserID != claims["username"].(string) {
+		return library.NotFound("JOB_NOT_FOUND", "Job not found")
+	}
+	return c.JSON(job)
 }
@@ -0,0 +1,116 @@
+package portal_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"272-backend/config"
+	"272-backend/library"
+	"272-backend/pkg"
+	"272-backend/pkg/bsl"
+	"272-backend/pkg/bsl/bsltest"
+	"272-backend/routes/portal"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestPostCurriculum(t *testing.T) {
+	stub := bsltest.NewServer()
+	defer stub.Close()
+	stub.AddUser("c2011011025", bsltest.User{
+		Password:   "secret",
+		Curriculum: []bsl.Course{{CourseID: "272", CourseCode: "CENG 272", Grade: "BA"}},
+	})
+
+	repos := library.NewMemoryRepositories()
+	if err := repos.Users.InsertToDB(context.Background(), &library.User{Username: "c2011011025", UserType: "student"}); err != nil {
+		t.Fatal(err)
+	}
+	app := pkg.NewFiber(&config.Config{})
+	auth := pkg.NewJWT("test-secret")
+	portal.Register(app.Group("/portal"), auth, &portal.Handler{
+		BSL:       bsl.New(stub.URL, bsl.Options{Backoff: time.Millisecond}),
+		Users:     repos.Users,
+		Curricula: repos.Curricula,
+	})
+	token := auth.CreateToken(jwt.MapClaims{"username": "c2011011025", "user_type": "student", "roles": []string{}})
+
+	get := func() []library.CourseData {
+		req := httptest.NewRequest(http.MethodGet, "/portal/curriculum", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var courses []library.CourseData
+		if err := json.NewDecoder(resp.Body).Decode(&courses); err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /portal/curriculum: status %d, %v", resp.StatusCode, err)
+		}
+		return courses
+	}
+	post := func(body string) (*http.Response, library.ErrorPayload) {
+		req := httptest.NewRequest(http.MethodPost, "/portal/curriculum", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var payload library.ErrorPayload
+		if resp.StatusCode != http.StatusOK {
+			json.NewDecoder(resp.Body).Decode(&payload)
+		}
+		return resp, payload
+	}
+
+	if courses := get(); len(courses) != 0 {
+		t.Fatalf("curriculum before the first sync: %+v", courses)
+	}
+	resp, _ := post(`{"password":"secret"}`)
+	var sync library.CurriculumSync
+	if err := json.NewDecoder(resp.Body).Decode(&sync); err != nil || sync.Added != 1 || sync.Courses[0].Grade != "BA" {
+		t.Fatalf("status %d, sync %+v, %v", resp.StatusCode, sync, err)
+	}
+
+	stub.AddUser("c2011011025", bsltest.User{
+		Password:   "secret",
+		Curriculum: []bsl.Course{{CourseID: "272", CourseCode: "CENG 272", Grade: "AA"}},
+	})
+	resp, _ = post(`{"password":"secret"}`)
+	sync = library.CurriculumSync{}
+	if err := json.NewDecoder(resp.Body).Decode(&sync); err != nil || len(sync.GradeChanges) != 1 || sync.GradeChanges[0].NewGrade != "AA" {
+		t.Fatalf("re-sync: status %d, sync %+v, %v", resp.StatusCode, sync, err)
+	}
+	if courses := get(); len(courses) != 1 || courses[0].Grade != "AA" {
+		t.Fatalf("stored curriculum: %+v", courses)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		fail   int
+		status int
+		code   string
+	}{
+		{"missing password", `{}`, 0, http.StatusBadRequest, "PORTAL_PASSWORD_REQUIRED"},
+		{"password too long", `{"password":"` + strings.Repeat("x", 257) + `"}`, 0, http.StatusBadRequest, "VALIDATION_FAILED"},
+		{"wrong password", `{"password":"nope"}`, 0, http.StatusUnauthorized, "PORTAL_INVALID_CREDENTIALS"},
+		{"portal down", `{"password":"secret"}`, http.StatusInternalServerError, http.StatusServiceUnavailable, "PORTAL_UNAVAILABLE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.fail != 0 {
+				stub.FailNext(1, tt.fail)
+			}
+			resp, payload := post(tt.body)
+			if resp.StatusCode != tt.status || payload.Error != tt.code {
+				t.Fatalf("got %d %s, want %d %s", resp.StatusCode, payload.Error, tt.status, tt.code)
+			}
+		})
+	}
+}
@@ -1,5 +1,126 @@
 package projects
 
-func init() {
+import (
+	"272-backend/library"
+	"272-backend/pkg"
+	"272-backend/pkg/activity"
 
+	"github.com/gofiber/fiber/v2"
+)
+
+type CreateProjectParams struct {
+	// Suggestion is the approved suggestion the project grows out of; the
+	// project keeps its ID.
+	Suggestion string `json:"suggestion" validate:"required,objectid"`
+	// Advisor is the username of the teacher advising the project.
+	Advisor string `json:"advisor" validate:"required,max=64"`
+}
+
+type Handler struct {
+	Projects    library.ProjectRepository
+	Suggestions library.SuggestionRepository
+	Users       library.UserRepository
+	// Activity carries the followers of a suggestion over to its project;
+	// nil records nothing.
+	Activity *activity.Recorder
+}
+
+func Register(router fiber.Router, auth *pkg.JWT, h *Handler) {
+	auth.Use(router)
+	router.Get("/", h.getProjects)
+	router.Get("/:id", h.getProject)
+	router.Use(pkg.RequireRole(library.RoleAdmin))
+	router.Post("/", h.createProject)
+}
+
+// getProjects godoc
+// @Summary Get Projects
+// @Description Get every project
+// @Tags projects
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} library.Project
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /projects [get]
+func (h *Handler) getProjects(c *fiber.Ctx) error {
+	projects, err := h.Projects.GetAllProjects(c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.JSON(projects)
+}
+
+// getProject godoc
+// @Summary Get Project
+// @Description Get a project by its ID, which is that of its suggestion
+// @Tags projects
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Project ID"
+// @Success 200 {object} library.Project
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /projects/{id} [get]
+func (h *Handler) getProject(c *fiber.Ctx) error {
+	id, err := library.ParseID("id", c.Params("id"))
+	if err != nil {
+		return err
+	}
+	project := library.Project{ID: id}
+	if err := h.Projects.GetProject(c.UserContext(), &project); err != nil {
+		return err
+	}
+	return c.JSON(project)
+}
+
+// createProject godoc
+// @Summary Create Project
+// @Description Turn an approved suggestion into a project advised by a teacher. The followers of the suggestion follow the project, as do its advisor and team, and hear that it became one.
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param project body CreateProjectParams true "Project"
+// @Success 200 {object} library.Project
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 409 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /projects [post]
+func (h *Handler) createProject(c *fiber.Ctx) error {
+	var params CreateProjectParams
+	if err := pkg.ParseBody(c, &params); err != nil {
+		return err
+	}
+	var suggestion library.Suggestion
+	if err := h.Suggestions.WithID(c.UserContext(), &suggestion, params.Suggestion); err != nil {
+		return err
+	}
+	advisor, err := h.Users.GetUser(c.UserContext(), params.Advisor)
+	if err != nil {
+		return err
+	}
+	if advisor.UserType != "teacher" {
+		return library.Validation("INVALID_ADVISOR", "Projects are advised by teachers", library.FieldError{Field: "advisor", Code: "teacher", Message: "advisor must be a teacher"})
+	}
+	project := library.Project{AdvisorID: advisor.Username}
+	if err := h.Projects.CreateFrom(c.UserContext(), &project, suggestion); err != nil {
+		return err
+	}
+
+	id := project.ID.Hex()
+	h.Activity.Carry(c.UserContext(),
+		library.Follow{Kind: library.SubjectSuggestion, Target: id},
+		library.Follow{Kind: library.SubjectProject, Target: id})
+	h.Activity.Follow(c.UserContext(), project.AdvisorID, library.SubjectProject, id)
+	for _, member := range project.Team {
+		h.Activity.Follow(c.UserContext(), member.UserID, library.SubjectProject, id)
+	}
+	h.Activity.Publish(c.UserContext(), project.Activity(library.ActivityProject))
+	return c.JSON(project)
 }
@@ -0,0 +1,178 @@
+package roles
+
+import (
+	"272-backend/library"
+	"272-backend/pkg"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Handler struct {
+	Roles library.RoleRepository
+	Users library.UserRepository
+}
+
+func Register(router fiber.Router, auth *pkg.JWT, h *Handler) {
+	auth.Use(router)
+	router.Use(pkg.RequireRole(library.RoleAdmin))
+	router.Get("/", h.getRoles)
+	router.Get("/changes", h.getChanges)
+	router.Patch("/users/:id", h.patchUserRoles)
+	router.Put("/:name", h.putRole)
+	router.Put("/:name/users/:id", h.grantRole)
+	router.Delete("/:name/users/:id", h.revokeRole)
+}
+
+// getRoles godoc
+// @Summary Get roles
+// @Description Get the roles admins may grant
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} library.Role
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /roles [get]
+func (h *Handler) getRoles(c *fiber.Ctx) error {
+	roles, err := h.Roles.GetRoles(c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.JSON(roles)
+}
+
+// putRole godoc
+// @Summary Put role
+// @Description Register a role so it can be granted, or change its description. student and teacher are reserved.
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param name path string true "Role name"
+// @Param body body library.Role true "Role, its name is taken from the path"
+// @Success 200 {object} library.Role
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /roles/{name} [put]
+func (h *Handler) putRole(c *fiber.Ctx) error {
+	var role library.Role
+	if err := pkg.ParseBody(c, &role); err != nil {
+		return err
+	}
+	role.Name = c.Params("name")
+	if err := h.Roles.PutRole(c.UserContext(), &role); err != nil {
+		return err
+	}
+	return c.JSON(role)
+}
+
+// getChanges godoc
+// @Summary Get role changes
+// @Description Get a page of the audit log of role changes, newest first
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param target query string false "Username whose roles changed"
+// @Param actor query string false "Username of the admin who changed them"
+// @Param page query int false "Page, from 1"
+// @Param per_page query int false "Page size, 20 by default" maximum(100)
+// @Success 200 {object} library.Page[library.RoleChange]
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /roles/changes [get]
+func (h *Handler) getChanges(c *fiber.Ctx) error {
+	var query library.RoleChangeQuery
+	if err := pkg.ParseQuery(c, &query); err != nil {
+		return err
+	}
+	changes, err := h.Roles.GetChanges(c.UserContext(), query)
+	if err != nil {
+		return err
+	}
+	return c.JSON(changes)
+}
+
+// change applies update to the user in the path on behalf of the signed in
+// admin.
+func (h *Handler) change(c *fiber.Ctx, update library.RoleUpdate) error {
+	claims, err := pkg.Claims(c)
+	if err != nil {
+		return err
+	}
+	user, err := library.ChangeRoles(c.UserContext(), h.Roles, h.Users, claims["username"].(string), c.Params("id"), update)
+	if err != nil {
+		return err
+	}
+	return c.JSON(user)
+}
+
+// patchUserRoles godoc
+// @Summary Change user roles
+// @Description Grant and revoke registered roles of a user at once. Granting a held role or revoking a missing one changes nothing; only real changes are logged. The change applies to the user's current sessions immediately.
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Username"
+// @Param body body library.RoleUpdate true "Roles to grant and revoke"
+// @Success 200 {object} library.User
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /roles/users/{id} [patch]
+func (h *Handler) patchUserRoles(c *fiber.Ctx) error {
+	var update library.RoleUpdate
+	if err := pkg.ParseBody(c, &update); err != nil {
+		return err
+	}
+	return h.change(c, update)
+}
+
+// grantRole godoc
+// @Summary Grant role
+// @Description Grant a registered role to a user, as PATCH /roles/users/{id} with grant
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param name path string true "Role name"
+// @Param id path string true "Username"
+// @Success 200 {object} library.User
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /roles/{name}/users/{id} [put]
+func (h *Handler) grantRole(c *fiber.Ctx) error {
+	return h.change(c, library.RoleUpdate{Grant: []string{c.Params("name")}})
+}
+
+// revokeRole godoc
+// @Summary Revoke role
+// @Description Revoke a registered role from a user, as PATCH /roles/users/{id} with revoke
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param name path string true "Role name"
+// @Param id path string true "Username"
+// @Success 200 {object} library.User
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /roles/{name}/users/{id} [delete]
+func (h *Handler) revokeRole(c *fiber.Ctx) error {
+	return h.change(c, library.RoleUpdate{Revoke: []string{c.Params("name")}})
+}
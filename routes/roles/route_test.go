@@ -0,0 +1,94 @@
+package roles_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"272-backend/config"
+	"272-backend/library"
+	"272-backend/pkg"
+	"272-backend/routes/roles"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRoleChangesApplyToIssuedTokens(t *testing.T) {
+	repos := library.NewMemoryRepositories()
+	ctx := context.Background()
+	if err := repos.Roles.EnsureRoles(ctx, library.DefaultRoles()); err != nil {
+		t.Fatal(err)
+	}
+	admin := library.User{Username: "t1000000001", UserType: "teacher", Roles: []string{library.RoleAdmin}}
+	student := library.User{Username: "c2011011025", UserType: "student"}
+	for _, u := range []*library.User{&admin, &student} {
+		if err := repos.Users.InsertToDB(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app := pkg.NewFiber(&config.Config{})
+	auth := pkg.NewJWT("test-secret").WithUsers(repos.Users)
+	roles.Register(app.Group("/roles"), auth, &roles.Handler{Roles: repos.Roles, Users: repos.Users})
+	// Both tokens carry the roles of the moment they were issued.
+	tokenOf := func(u library.User) string {
+		return auth.CreateToken(jwt.MapClaims{"username": u.Username, "user_type": u.UserType, "roles": u.Roles})
+	}
+	adminToken, studentToken := tokenOf(admin), tokenOf(student)
+	do := func(method, path, token, body string, out interface{}) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		if out != nil {
+			if err := json.Unmarshal(raw, out); err != nil {
+				t.Fatalf("%s %s: %v: %s", method, path, err, raw)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	if status := do(http.MethodGet, "/roles", studentToken, "", nil); status != http.StatusForbidden {
+		t.Fatalf("student lists roles: status %d", status)
+	}
+	var user library.User
+	if status := do(http.MethodPut, "/roles/admin/users/c2011011025", adminToken, "", &user); status != http.StatusOK || !user.HasRole(library.RoleAdmin) {
+		t.Fatalf("grant: status %d, %+v", status, user)
+	}
+	var registered []library.Role
+	if status := do(http.MethodGet, "/roles", studentToken, "", &registered); status != http.StatusOK || len(registered) != 2 {
+		t.Fatalf("new admin lists roles with their old token: status %d, %+v", status, registered)
+	}
+
+	var errPayload library.ErrorPayload
+	if status := do(http.MethodPatch, "/roles/users/c2011011025", studentToken, `{"revoke":["admin"]}`, &errPayload); status != http.StatusForbidden || errPayload.Error != "ROLE_SELF_REVOKE" {
+		t.Fatalf("self revoke: status %d, %+v", status, errPayload)
+	}
+	if status := do(http.MethodPut, "/roles/root/users/c2011011025", adminToken, "", &errPayload); status != http.StatusBadRequest || errPayload.Error != "INVALID_ROLES" {
+		t.Fatalf("unregistered role: status %d, %+v", status, errPayload)
+	}
+	if status := do(http.MethodPut, "/roles/student", adminToken, `{"description":"x"}`, &errPayload); status != http.StatusBadRequest || errPayload.Error != "ROLE_RESERVED" {
+		t.Fatalf("reserved role: status %d, %+v", status, errPayload)
+	}
+	if status := do(http.MethodDelete, "/roles/admin/users/c2011011025", adminToken, "", nil); status != http.StatusOK {
+		t.Fatalf("revoke: status %d", status)
+	}
+	if status := do(http.MethodGet, "/roles", studentToken, "", nil); status != http.StatusForbidden {
+		t.Fatalf("revoked admin lists roles: status %d", status)
+	}
+
+	var log library.Page[library.RoleChange]
+	if status := do(http.MethodGet, "/roles/changes?target=c2011011025", adminToken, "", &log); status != http.StatusOK || log.Total != 2 {
+		t.Fatalf("audit log: status %d, %+v", status, log)
+	}
+	if latest := log.Items[0]; latest.Actor != admin.Username || len(latest.Revoked) != 1 || latest.Revoked[0] != library.RoleAdmin {
+		t.Fatalf("latest change = %+v", latest)
+	}
+}
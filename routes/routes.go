@@ -1,9 +1,155 @@
 package routes
 
 import (
-	_ "272-backend/routes/events"
-	_ "272-backend/routes/portal"
-	_ "272-backend/routes/session"
-	_ "272-backend/routes/suggestions"
-	_ "272-backend/routes/users"
+	"strings"
+
+	"272-backend/config"
+	"272-backend/library"
+	"272-backend/pkg"
+	"272-backend/pkg/activity"
+	"272-backend/pkg/bsl"
+	"272-backend/pkg/profiles"
+	"272-backend/pkg/ratelimit"
+	"272-backend/pkg/surveys"
+	"272-backend/pkg/upload"
+	"272-backend/routes/attachments"
+	"272-backend/routes/departments"
+	"272-backend/routes/events"
+	"272-backend/routes/exports"
+	"272-backend/routes/feed"
+	"272-backend/routes/imports"
+	"272-backend/routes/portal"
+	"272-backend/routes/projects"
+	"272-backend/routes/roles"
+	"272-backend/routes/session"
+	"272-backend/routes/stats"
+	"272-backend/routes/suggestions"
+	"272-backend/routes/users"
+
+	"github.com/gofiber/fiber/v2"
 )
+
+// Deps carries everything the route groups are built from.
+type Deps struct {
+	Config *config.Config
+	BSL    *bsl.Client
+	Grades library.GradeScale
+	// Surveys runs survey auto-fill jobs; its lifecycle belongs to the caller.
+	Surveys *surveys.Runner
+	// Profiles refreshes portal profiles in the background; its lifecycle
+	// belongs to the caller too.
+	Profiles *profiles.Refresher
+	// JWT should look up current roles, see pkg.JWT.WithUsers.
+	JWT   *pkg.JWT
+	Redis *pkg.RedisInstance
+	// Vault is nil when passwords are not remembered.
+	Vault *pkg.CredentialVault
+	// Anonymizer hides the authors of anonymous suggestions.
+	Anonymizer *library.Anonymizer
+	Repos      *library.Repositories
+	// Limiter and Lockout are nil when nothing is throttled.
+	Limiter *ratelimit.Limiter
+	Lockout *ratelimit.Lockout
+	// Uploader keeps the files attached to suggestions, projects and events.
+	Uploader *upload.Uploader
+}
+
+// BasePath prefixes every route. It changes with incompatible releases of the
+// API, and with it the @BasePath in main.go.
+const BasePath = "/v1"
+
+// Register mounts every route group under BasePath, and redirects the
+// unversioned paths of earlier releases there.
+func Register(app *fiber.App, d Deps) {
+	router := app.Group(BasePath)
+	router.Use(d.Limiter.Handler(ratelimit.Policy{Name: "api", Rate: d.Config.RateLimitAPI, Key: ratelimit.ByIP}))
+	recorder := activity.NewRecorder(d.Repos.Follows)
+	events.Register(router.Group("/events"), d.JWT, &events.Handler{
+		Events:   d.Repos.Events,
+		Users:    d.Repos.Users,
+		Activity: recorder,
+	})
+	portal.Register(router.Group("/portal"), d.JWT, &portal.Handler{
+		BSL:       d.BSL,
+		Users:     d.Repos.Users,
+		Curricula: d.Repos.Curricula,
+		Grades:    d.Grades,
+		Surveys:   d.Surveys,
+		Jobs:      d.Repos.SurveyJobs,
+		Vault:     d.Vault,
+	})
+	login := d.Limiter.Handler(ratelimit.Policy{Name: "login", Rate: d.Config.RateLimitLogin, Key: ratelimit.ByIP, Methods: []string{fiber.MethodPost}})
+	session.Register(router.Group("/session", login), &session.Handler{
+		Auth:     library.NewAuth(d.Config, d.Repos.Users, d.Repos.Departments, d.BSL),
+		Users:    d.Repos.Users,
+		JWT:      d.JWT,
+		Redis:    d.Redis,
+		Vault:    d.Vault,
+		Profiles: d.Profiles,
+		Lockout:  d.Lockout,
+	})
+	suggestions.Register(router.Group("/suggestions"), d.JWT, &suggestions.Handler{
+		Suggestions: d.Repos.Suggestions,
+		Users:       d.Repos.Users,
+		Anonymizer:  d.Anonymizer,
+		Activity:    recorder,
+	}, d.Limiter.Handler(ratelimit.Policy{Name: "suggestions", Rate: d.Config.RateLimitSuggestions, Key: ratelimit.ByUser, Methods: []string{fiber.MethodPost}}))
+	departments.Register(router.Group("/departments"), d.JWT, &departments.Handler{
+		Departments: d.Repos.Departments,
+		Users:       d.Repos.Users,
+		Suggestions: d.Repos.Suggestions,
+		Anonymizer:  d.Anonymizer,
+	})
+	roles.Register(router.Group("/roles"), d.JWT, &roles.Handler{
+		Roles: d.Repos.Roles,
+		Users: d.Repos.Users,
+	})
+	stats.Register(router.Group("/stats"), d.JWT, &stats.Handler{
+		Stats: d.Repos.Stats,
+	})
+	exports.Register(router.Group("/exports"), d.JWT, &exports.Handler{
+		Exports: d.Repos.Exports,
+	})
+	imports.Register(router.Group("/imports"), d.JWT, &imports.Handler{
+		Events: d.Repos.Events,
+		Users:  d.Repos.Users,
+		Roles:  d.Repos.Roles,
+	})
+	attachments.Register(router.Group("/attachments"), d.JWT, &attachments.Handler{
+		Uploader:    d.Uploader,
+		Attachments: d.Repos.Attachments,
+		Suggestions: d.Repos.Suggestions,
+		Projects:    d.Repos.Projects,
+		Events:      d.Repos.Events,
+		Anonymizer:  d.Anonymizer,
+	})
+	projects.Register(router.Group("/projects"), d.JWT, &projects.Handler{
+		Projects:    d.Repos.Projects,
+		Suggestions: d.Repos.Suggestions,
+		Users:       d.Repos.Users,
+		Activity:    recorder,
+	})
+	feed.Register(router.Group("/feed"), d.JWT, &feed.Handler{
+		Follows:     d.Repos.Follows,
+		Suggestions: d.Repos.Suggestions,
+		Projects:    d.Repos.Projects,
+		Events:      d.Repos.Events,
+		Anonymizer:  d.Anonymizer,
+	})
+	users.Register(router.Group("/users"), d.JWT, &users.Handler{
+		Users:    d.Repos.Users,
+		Profiles: d.Profiles,
+		Vault:    d.Vault,
+	})
+	app.Use(unversioned)
+}
+
+// unversioned permanently redirects requests outside BasePath into it,
+// keeping their method and body, for clients built before the API was
+// versioned.
+func unversioned(c *fiber.Ctx) error {
+	if c.Path() == BasePath || strings.HasPrefix(c.Path(), BasePath+"/") {
+		return c.Next()
+	}
+	return c.Redirect(BasePath+c.OriginalURL(), fiber.StatusPermanentRedirect)
+}
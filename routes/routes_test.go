@@ -0,0 +1,117 @@
+package routes_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"272-backend/config"
+	"272-backend/library"
+	"272-backend/pkg"
+	"272-backend/pkg/openapi"
+	"272-backend/pkg/openapi/docgen"
+	"272-backend/routes"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// spec builds the OpenAPI 3 document from the handler annotations the way
+// go generate does for the docs package.
+func spec(t *testing.T) *openapi3.T {
+	t.Helper()
+	dir := t.TempDir()
+	if err := docgen.Build("..", dir, "json"); err != nil {
+		t.Fatal(err)
+	}
+	swagger2, err := os.ReadFile(filepath.Join(dir, "swagger.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := openapi.Convert(swagger2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestDocsUpToDate(t *testing.T) {
+	dir := t.TempDir()
+	if err := docgen.Build("..", dir, "go", "json", "yaml"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"docs.go", "swagger.json", "swagger.yaml"} {
+		want, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join("..", "docs", name))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("docs/%s is out of date with the annotations, run go generate: %v", name, err)
+		}
+	}
+}
+
+var param = regexp.MustCompile(`:(\w+)`)
+
+func TestSpecCoversRoutes(t *testing.T) {
+	doc := spec(t)
+	for _, name := range []string{"library.SuggestionResponse", "library.Event", "library.User", "library.ErrorPayload"} {
+		if doc.Components.Schemas[name] == nil {
+			t.Errorf("no %s schema", name)
+		}
+	}
+	if scheme := doc.Components.SecuritySchemes[openapi.SecurityScheme]; scheme == nil || scheme.Value.Scheme != "bearer" {
+		t.Errorf("security scheme %+v", scheme)
+	}
+	if len(doc.Servers) != 1 || doc.Servers[0].URL != routes.BasePath {
+		t.Fatalf("servers %+v", doc.Servers)
+	}
+
+	app := pkg.NewFiber(&config.Config{})
+	routes.Register(app, routes.Deps{
+		Config: &config.Config{},
+		JWT:    pkg.NewJWT("test-secret"),
+		Repos:  library.NewMemoryRepositories(),
+	})
+	registered := map[string]bool{}
+	for _, r := range app.GetRoutes(true) {
+		if r.Method == http.MethodHead || r.Path == "/openapi.json" || r.Path == "/swagger/*" {
+			continue
+		}
+		path, ok := strings.CutPrefix(r.Path, routes.BasePath)
+		if !ok {
+			t.Errorf("%s %s is outside %s", r.Method, r.Path, routes.BasePath)
+			continue
+		}
+		path = param.ReplaceAllString(strings.TrimSuffix(path, "/"), "{$1}")
+		registered[r.Method+" "+path] = true
+		if item := doc.Paths.Find(path); item == nil || item.GetOperation(r.Method) == nil {
+			t.Errorf("%s %s is missing from the spec", r.Method, r.Path)
+		}
+	}
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			if !registered[method+" "+path] {
+				t.Errorf("%s %s is in the spec but not registered", method, path)
+			}
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/suggestions?sort=new", nil)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusPermanentRedirect || resp.Header.Get("Location") != "/v1/suggestions?sort=new" {
+		t.Errorf("unversioned path: status %d, location %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+}
@@ -3,6 +3,9 @@ package session
 import (
 	"272-backend/library"
 	"272-backend/pkg"
+	"272-backend/pkg/profiles"
+	"272-backend/pkg/ratelimit"
+	"errors"
 	"log"
 	"strings"
 
@@ -10,12 +13,49 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func init() {
-	sessionRoutes := pkg.App.Group("/session")
-	sessionRoutes.Post("/", login)
-	pkg.UseJWT(sessionRoutes)
-	sessionRoutes.Get("/", getSession)
-	sessionRoutes.Delete("/", logout)
+type Handler struct {
+	Auth  *library.Auth
+	Users library.UserRepository
+	JWT   *pkg.JWT
+	Redis *pkg.RedisInstance
+	Vault *pkg.CredentialVault
+	// Profiles refreshes stale portal profiles after login.
+	Profiles *profiles.Refresher
+	// Lockout locks accounts after repeated failed logins.
+	Lockout *ratelimit.Lockout
+}
+
+// SessionUser is the signed in user.
+type SessionUser struct {
+	Username   string   `json:"username"`
+	UserType   string   `json:"user_type" enums:"student,teacher"`
+	FullName   string   `json:"full_name,omitempty"`
+	Department int      `json:"department"`
+	Roles      []string `json:"roles"`
+}
+
+func newSessionUser(u *library.User) SessionUser {
+	return SessionUser{Username: u.Username, UserType: u.UserType, FullName: u.FullName, Department: u.Department, Roles: u.Roles}
+}
+
+// SessionResponse is the answer to GET /session.
+type SessionResponse struct {
+	User SessionUser `json:"user"`
+}
+
+// LoginResponse is the answer to POST /session. PasswordRemembered tells
+// whether portal actions may leave the password out for a few minutes.
+type LoginResponse struct {
+	User               SessionUser `json:"user"`
+	Token              string      `json:"token"`
+	PasswordRemembered bool        `json:"password_remembered"`
+}
+
+func Register(sessionRoutes fiber.Router, h *Handler) {
+	sessionRoutes.Post("/", h.login)
+	h.JWT.Use(sessionRoutes)
+	sessionRoutes.Get("/", h.getSession)
+	sessionRoutes.Delete("/", h.logout)
 }
 
 // getSession godoc
@@ -25,108 +65,101 @@ func init() {
 // @Accept json
 // @Produce json
 // @Security Bearer
-// @Success 200 {array} library.User
+// @Success 200 {object} SessionResponse
 // @Failure 401 {object} library.ErrorPayload
 // @Failure 500 {object} library.ErrorPayload
 // @Router /session [get]
-func getSession(c *fiber.Ctx) error {
-	auth := c.Locals("user")
-	if auth == nil {
-		return c.Status(401).JSON(fiber.Map{
-			"message": "You are not logged in",
-		})
+func (h *Handler) getSession(c *fiber.Ctx) error {
+	claims, err := pkg.Claims(c)
+	if err != nil {
+		return err
 	}
-	claims := auth.(*jwt.Token).Claims.(jwt.MapClaims)
-	if claims["username"] == nil || claims["user_type"] == nil || claims["roles"] == nil {
-		return c.Status(401).JSON(fiber.Map{
-			"message": "Authentication token is invalid or expired",
-		})
+	if claims["user_type"] == nil || claims["roles"] == nil {
+		return library.Unauthorized("INVALID_TOKEN", "Authentication token is invalid or expired")
 	}
 	user := library.User{
 		Username: claims["username"].(string),
 		UserType: claims["user_type"].(string),
 	}
-	if err := user.FindUser(); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to get user",
-			"error":   err.Error(),
-		})
+	if err := h.Users.FindUser(c.UserContext(), &user); err != nil {
+		return err
 	}
-	return c.Status(200).JSON(fiber.Map{
-		"user": fiber.Map{
-			"username":   user.Username,
-			"user_type":  user.UserType,
-			"roles":      user.Roles,
-			"department": user.GetDepartmentID(),
-		},
-	})
+	return c.JSON(SessionResponse{User: newSessionUser(&user)})
 }
 
 type loginForm struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-	UserType string `json:"user_type"`
+	Username string         `json:"username" validate:"required,max=254,startsnotwith=@"`
+	Password library.Secret `json:"password" validate:"required,max=256" swaggertype:"string" format:"password"`
+	UserType string         `json:"user_type" validate:"required,oneof=student teacher"`
+	// RememberPassword keeps the password, encrypted, for the portal actions
+	// of the next few minutes when the server has a credential vault.
+	RememberPassword bool `json:"remember_password"`
 }
 
 // login godoc
 // @Summary Login
-// @Description Login
+// @Description Sign in with the university mail credentials. With remember_password the password is kept encrypted for a few minutes so portal actions can omit it. Repeated failures lock the account for a growing time, answered with 429 and Retry-After.
 // @Tags session
 // @Accept json
 // @Produce json
 // @Param body body loginForm true "Login Form"
-// @Success 200 {object} library.User
+// @Success 200 {object} LoginResponse
 // @Failure 400 {object} library.ErrorPayload
 // @Failure 401 {object} library.ErrorPayload
+// @Failure 429 {object} library.ErrorPayload
 // @Failure 500 {object} library.ErrorPayload
 // @Router /session [post]
-func login(c *fiber.Ctx) error {
+func (h *Handler) login(c *fiber.Ctx) error {
 	var form loginForm
-	if err := c.BodyParser(&form); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"message": "Invalid request",
-		})
+	defer func() { form.Password.Wipe() }()
+	if err := pkg.ParseBody(c, &form); err != nil {
+		return err
 	}
 	user := library.User{
 		Username: strings.Split(form.Username, "@")[0],
 		UserType: form.UserType,
 	}
-
-	if err := user.LoginByEmail(form.Password); err != nil {
-		return c.Status(401).JSON(fiber.Map{
-			"message": "Unauthorized",
-			"error":   err.Error(),
-		})
+	if err := h.Lockout.Check(c, user.Username); err != nil {
+		return err
+	}
+	if err := h.Auth.LoginByEmail(c.UserContext(), &user, form.Password); err != nil {
+		if errors.Is(err, library.ErrUnauthorized) {
+			h.Lockout.Fail(c.UserContext(), user.Username)
+		}
+		return err
+	}
+	h.Lockout.Reset(c.UserContext(), user.Username)
+	if h.Profiles.Stale(&user) {
+		if _, err := h.Profiles.Enqueue(user.Username, form.Password); err != nil {
+			log.Printf("Profile refresh of %s not queued: %v", user.Username, err)
+		}
+	}
+	if form.RememberPassword {
+		if err := h.Vault.Put(c.UserContext(), user.Username, form.Password); err != nil {
+			return err
+		}
 	}
 
-	token := pkg.CreateToken(jwt.MapClaims{
+	token := h.JWT.CreateToken(jwt.MapClaims{
 		"username":  user.Username,
 		"user_type": user.UserType,
 		"roles":     user.Roles,
 	})
 
-	if err := pkg.Redis.Set(token, user.Stringify()); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to save token to redis",
-			"error":   err.Error(),
-		})
+	if err := h.Redis.Set(token, user.Stringify()); err != nil {
+		return err
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"user": fiber.Map{
-			"id":         user.Username,
-			"user_type":  user.UserType,
-			"department": user.GetDepartmentID(),
-			"full_name":  user.FullName,
-			"roles":      user.Roles,
-		},
-		"token": token,
+	return c.JSON(LoginResponse{
+		User:               newSessionUser(&user),
+		Token:              token,
+		PasswordRemembered: form.RememberPassword && h.Vault.Enabled(),
 	})
 }
 
 // logout godoc
 // @Summary Logout
-// @Description Logout
+// @Description Sign out and forget a remembered portal password
 // @Tags session
 // @Accept json
 // @Produce json
@@ -135,20 +168,19 @@ func login(c *fiber.Ctx) error {
 // @Failure 401 {object} library.ErrorPayload
 // @Failure 500 {object} library.ErrorPayload
 // @Router /session [delete]
-func logout(c *fiber.Ctx) error {
-	auth := c.Locals("user")
-	if auth == nil {
-		return c.Status(401).JSON(fiber.Map{
-			"message": "You are not logged in",
-		})
+func (h *Handler) logout(c *fiber.Ctx) error {
+	auth, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return library.Unauthorized("NOT_LOGGED_IN", "You are not logged in")
+	}
+	if err := h.Redis.Del(auth.Raw); err != nil {
+		return err
 	}
-	claims := auth.(*jwt.Token).Raw
-	log.Println(claims)
-	if err := pkg.Redis.Del(claims); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to delete token from redis",
-			"error":   err.Error(),
-		})
+	if claims, ok := auth.Claims.(jwt.MapClaims); ok {
+		username, _ := claims["username"].(string)
+		if err := h.Vault.Delete(c.UserContext(), username); err != nil {
+			return err
+		}
 	}
 	return c.SendStatus(204)
 }
@@ -0,0 +1,198 @@
+package stats
+
+import (
+	"272-backend/library"
+	"272-backend/pkg"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Handler struct {
+	Stats library.StatsRepository
+}
+
+func Register(router fiber.Router, auth *pkg.JWT, h *Handler) {
+	auth.Use(router)
+	router.Use(pkg.RequireRole(library.RoleAdmin))
+	router.Get("/suggestions/timeline", h.getTimeline)
+	router.Get("/suggestions/decisions", h.getDecisions)
+	router.Get("/suggestions/departments", h.getDepartments)
+	router.Get("/suggestions/authors", h.getAuthors)
+	router.Get("/suggestions/top", h.getTopSuggestions)
+	router.Get("/events", h.getEvents)
+}
+
+// query parses the window every statistic takes.
+func query(c *fiber.Ctx) (library.StatsQuery, error) {
+	var q library.StatsQuery
+	err := pkg.ParseQuery(c, &q)
+	return q, err
+}
+
+// getTimeline godoc
+// @Summary Suggestion timeline
+// @Description Count the suggestions made in each period of the window by their current status. Periods without suggestions are included.
+// @Tags stats
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param from query string false "First day, YYYY-MM-DD, 30 days before to by default"
+// @Param to query string false "Last day, YYYY-MM-DD, today by default"
+// @Param interval query string false "Period length" Enums(day, week, month)
+// @Success 200 {array} library.TimelinePoint
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /stats/suggestions/timeline [get]
+func (h *Handler) getTimeline(c *fiber.Ctx) error {
+	q, err := query(c)
+	if err != nil {
+		return err
+	}
+	timeline, err := h.Stats.SuggestionTimeline(c.UserContext(), q)
+	if err != nil {
+		return err
+	}
+	return c.JSON(timeline)
+}
+
+// getDecisions godoc
+// @Summary Time to decision
+// @Description Median hours from a suggestion being made to its approval or rejection, for the suggestions made in the window
+// @Tags stats
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param from query string false "First day, YYYY-MM-DD, 30 days before to by default"
+// @Param to query string false "Last day, YYYY-MM-DD, today by default"
+// @Success 200 {object} library.DecisionStats
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /stats/suggestions/decisions [get]
+func (h *Handler) getDecisions(c *fiber.Ctx) error {
+	q, err := query(c)
+	if err != nil {
+		return err
+	}
+	decisions, err := h.Stats.DecisionTimes(c.UserContext(), q)
+	if err != nil {
+		return err
+	}
+	return c.JSON(decisions)
+}
+
+// getDepartments godoc
+// @Summary Top departments
+// @Description The departments whose members made the most suggestions in the window
+// @Tags stats
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param from query string false "First day, YYYY-MM-DD, 30 days before to by default"
+// @Param to query string false "Last day, YYYY-MM-DD, today by default"
+// @Param limit query int false "How many, 10 by default" maximum(100)
+// @Success 200 {array} library.DepartmentCount
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /stats/suggestions/departments [get]
+func (h *Handler) getDepartments(c *fiber.Ctx) error {
+	q, err := query(c)
+	if err != nil {
+		return err
+	}
+	departments, err := h.Stats.TopDepartments(c.UserContext(), q)
+	if err != nil {
+		return err
+	}
+	return c.JSON(departments)
+}
+
+// getAuthors godoc
+// @Summary Top authors
+// @Description The users who made the most suggestions in the window
+// @Tags stats
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param from query string false "First day, YYYY-MM-DD, 30 days before to by default"
+// @Param to query string false "Last day, YYYY-MM-DD, today by default"
+// @Param limit query int false "How many, 10 by default" maximum(100)
+// @Success 200 {array} library.AuthorCount
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /stats/suggestions/authors [get]
+func (h *Handler) getAuthors(c *fiber.Ctx) error {
+	q, err := query(c)
+	if err != nil {
+		return err
+	}
+	authors, err := h.Stats.TopAuthors(c.UserContext(), q)
+	if err != nil {
+		return err
+	}
+	return c.JSON(authors)
+}
+
+// getTopSuggestions godoc
+// @Summary Top suggestions
+// @Description The most upvoted or highest rated suggestions made in the window
+// @Tags stats
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param from query string false "First day, YYYY-MM-DD, 30 days before to by default"
+// @Param to query string false "Last day, YYYY-MM-DD, today by default"
+// @Param by query string false "Order, upvotes by default" Enums(upvotes, stars)
+// @Param limit query int false "How many, 10 by default" maximum(100)
+// @Success 200 {array} library.TopSuggestion
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /stats/suggestions/top [get]
+func (h *Handler) getTopSuggestions(c *fiber.Ctx) error {
+	q, err := query(c)
+	if err != nil {
+		return err
+	}
+	top, err := h.Stats.TopSuggestions(c.UserContext(), q)
+	if err != nil {
+		return err
+	}
+	return c.JSON(top)
+}
+
+// getEvents godoc
+// @Summary Event statistics
+// @Description Count the events created in the window by type and by organizer
+// @Tags stats
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param from query string false "First day, YYYY-MM-DD, 30 days before to by default"
+// @Param to query string false "Last day, YYYY-MM-DD, today by default"
+// @Param limit query int false "How many types and organizers, 10 by default" maximum(100)
+// @Success 200 {object} library.EventStats
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /stats/events [get]
+func (h *Handler) getEvents(c *fiber.Ctx) error {
+	q, err := query(c)
+	if err != nil {
+		return err
+	}
+	events, err := h.Stats.EventStats(c.UserContext(), q)
+	if err != nil {
+		return err
+	}
+	return c.JSON(events)
+}
@@ -3,79 +3,80 @@ package suggestions
 import (
 	"272-backend/library"
 	"272-backend/pkg"
+	"272-backend/pkg/activity"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func init() {
-	route := pkg.App.Group("/suggestions")
-	pkg.UseJWT(route)
-	route.Get("/", getApprovedSuggestions)
-	route.Get("/:id", getSuggestion)
-	route.Post("/", createSuggestion)
-	route.Put("/:id/upvote", upvoteSuggestion)
-	route.Get("/rejected", getRejectedSuggestions)
-	route.Use(isAdmin)
-	route.Get("/pending", getPendingSuggestions)
-	route.Get("/reported", getReportedSuggestions)
-	route.Put("/:id/star", starSuggestion)
-	route.Patch("/:id/approve", approveSuggestion)
-	route.Patch("/:id/reject", rejectSuggestion)
-	route.Patch("/:id/report", reportSuggestion)
+type Handler struct {
+	Suggestions library.SuggestionRepository
+	Users       library.UserRepository
+	Anonymizer  *library.Anonymizer
+	// Activity follows suggestions for their authors and upvoters and tells
+	// followers of decisions; nil records nothing.
+	Activity *activity.Recorder
 }
 
-func isAdmin(ctx *fiber.Ctx) error {
-	user := ctx.Locals("user")
-	if user == nil {
-		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "You are not logged in",
-		})
-	}
-	claims := user.(*jwt.Token).Claims.(jwt.MapClaims)
-	for _, role := range claims["roles"].([]interface{}) {
-		if role == "admin" {
-			return ctx.Next()
-		}
-	}
-	return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-		"message": "You are not authorized to access this route",
-		"error":   "NOT_PERMITTED",
-	})
+// Register mounts the suggestion routes; limits run after authentication, so
+// they may count requests per user.
+func Register(route fiber.Router, auth *pkg.JWT, h *Handler, limits ...fiber.Handler) {
+	auth.Use(route)
+	for _, limit := range limits {
+		route.Use(limit)
+	}
+	route.Get("/", h.getApprovedSuggestions)
+	route.Get("/mine", h.getMySuggestions)
+	route.Get("/:id", h.getSuggestion)
+	route.Post("/", h.createSuggestion)
+	route.Patch("/:id", h.editSuggestion)
+	route.Put("/:id/upvote", h.upvoteSuggestion)
+	route.Delete("/:id/upvote", h.removeUpvote)
+	route.Put("/:id/downvote", h.downvoteSuggestion)
+	route.Delete("/:id/downvote", h.removeDownvote)
+	route.Get("/rejected", h.getRejectedSuggestions)
+	route.Use(pkg.RequireRole(library.RoleAdmin))
+	route.Get("/pending", h.getPendingSuggestions)
+	route.Get("/reported", h.getReportedSuggestions)
+	route.Get("/deanonymizations", h.getDeanonymizations)
+	route.Get("/:id/voters", h.getVoters)
+	route.Put("/:id/star", h.starSuggestion)
+	route.Patch("/:id/approve", h.approveSuggestion)
+	route.Patch("/:id/reject", h.rejectSuggestion)
+	route.Patch("/:id/report", h.reportSuggestion)
+	route.Patch("/:id/deanonymize", h.deanonymizeSuggestion)
 }
 
 // getApprovedSuggestions godoc
 // @Summary Get Approved Suggestions
-// @Description Get Approved suggestions
+// @Description Get approved suggestions, hot ones first by default. Hot ranks votes and stars decayed by age, top ranks by net score and new lists the newest first. A window keeps the suggestions made this week, month or semester.
 // @Tags suggestions
 // @Accept json
 // @Produce json
 // @Security Bearer
+// @Param sort query string false "Order, hot by default" Enums(hot, top, new)
+// @Param window query string false "Made within, all by default" Enums(all, week, month, semester)
+// @Param tag query string false "Tagged with"
 // @Success 200 {array} library.SuggestionResponse
+// @Failure 400 {object} library.ErrorPayload
 // @Failure 401 {object} library.ErrorPayload
 // @Failure 500 {object} library.ErrorPayload
 // @Router /suggestions [get]
-func getApprovedSuggestions(c *fiber.Ctx) error {
-	user := c.Locals("user")
-	if user == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "You are not logged in",
-		})
+func (h *Handler) getApprovedSuggestions(c *fiber.Ctx) error {
+	viewer, err := pkg.Viewer(c, h.Anonymizer)
+	if err != nil {
+		return err
 	}
-	claims := user.(*jwt.Token).Claims.(jwt.MapClaims)
-	userID := claims["username"].(string)
-	/* userType := claims["user_type"].(string) */
-	suggestions, err := library.GetApprovedSuggestions()
+	var q library.RankingQuery
+	if err := pkg.ParseQuery(c, &q); err != nil {
+		return err
+	}
+	suggestions, err := h.Suggestions.GetRankedSuggestions(c.UserContext(), q)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to get suggestions",
-			"error":   err.Error(),
-		})
+		return err
 	}
-	var response []library.SuggestionResponse
+	response := []library.SuggestionResponse{}
 	for _, suggestion := range suggestions {
-		response = append(response, suggestion.ToResponse(userID))
+		response = append(response, suggestion.ToResponse(viewer))
 	}
 	return c.JSON(response)
 }
@@ -89,27 +90,21 @@ func getApprovedSuggestions(c *fiber.Ctx) error {
 // @Security Bearer
 // @Success 200 {array} library.SuggestionResponse
 // @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
 // @Failure 500 {object} library.ErrorPayload
 // @Router /suggestions/pending [get]
-func getPendingSuggestions(c *fiber.Ctx) error {
-	user := c.Locals("user")
-	if user == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "You are not logged in",
-		})
+func (h *Handler) getPendingSuggestions(c *fiber.Ctx) error {
+	viewer, err := pkg.Viewer(c, h.Anonymizer)
+	if err != nil {
+		return err
 	}
-	claims := user.(*jwt.Token).Claims.(jwt.MapClaims)
-	userID := claims["username"].(string)
-	suggestions, err := library.GetPendingSuggestions()
+	suggestions, err := h.Suggestions.GetPendingSuggestions(c.UserContext())
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to get suggestions",
-			"error":   err.Error(),
-		})
+		return err
 	}
-	var response []library.SuggestionResponse
+	response := []library.SuggestionResponse{}
 	for _, suggestion := range suggestions {
-		response = append(response, suggestion.ToResponse(userID))
+		response = append(response, suggestion.ToResponse(viewer))
 	}
 	return c.JSON(response)
 }
@@ -123,27 +118,21 @@ func getPendingSuggestions(c *fiber.Ctx) error {
 // @Security Bearer
 // @Success 200 {array} library.SuggestionResponse
 // @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
 // @Failure 500 {object} library.ErrorPayload
 // @Router /suggestions/reported [get]
-func getReportedSuggestions(c *fiber.Ctx) error {
-	user := c.Locals("user")
-	if user == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "You are not logged in",
-		})
+func (h *Handler) getReportedSuggestions(c *fiber.Ctx) error {
+	viewer, err := pkg.Viewer(c, h.Anonymizer)
+	if err != nil {
+		return err
 	}
-	claims := user.(*jwt.Token).Claims.(jwt.MapClaims)
-	userID := claims["username"].(string)
-	suggestions, err := library.GetReportedSuggestions()
+	suggestions, err := h.Suggestions.GetReportedSuggestions(c.UserContext())
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to get suggestions",
-			"error":   err.Error(),
-		})
+		return err
 	}
-	var response []library.SuggestionResponse
+	response := []library.SuggestionResponse{}
 	for _, suggestion := range suggestions {
-		response = append(response, suggestion.ToResponse(userID))
+		response = append(response, suggestion.ToResponse(viewer))
 	}
 	return c.JSON(response)
 }
@@ -158,75 +147,151 @@ func getReportedSuggestions(c *fiber.Ctx) error {
 // @Param id path string true "Suggestion ID"
 // @Success 200 {object} library.SuggestionResponse
 // @Failure 401 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
 // @Failure 500 {object} library.ErrorPayload
 // @Router /suggestions/{id} [get]
-func getSuggestion(c *fiber.Ctx) error {
-	user := c.Locals("user")
-	if user == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "You are not logged in",
-		})
+func (h *Handler) getSuggestion(c *fiber.Ctx) error {
+	viewer, err := pkg.Viewer(c, h.Anonymizer)
+	if err != nil {
+		return err
 	}
-	claims := user.(*jwt.Token).Claims.(jwt.MapClaims)
-	userID := claims["username"].(string)
 	suggestion := library.Suggestion{}
-	if c.Params("id") == "pending" || c.Params("id") == "reported" || c.Params("id") == "rejected" {
+	if c.Params("id") == "pending" || c.Params("id") == "reported" || c.Params("id") == "rejected" || c.Params("id") == "deanonymizations" {
 		return c.Next()
 	}
-	if err := suggestion.WithID(c.Params("id")); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to get suggestion",
-			"error":   err.Error(),
-		})
+	if err := h.Suggestions.WithID(c.UserContext(), &suggestion, c.Params("id")); err != nil {
+		return err
 	}
-	response := suggestion.ToResponse(userID)
+	response := suggestion.ToResponse(viewer)
 	return c.JSON(response)
 }
 
 // createSuggestion godoc
 // @Summary Create Suggestion
-// @Description Create a suggestion
+// @Description Create a suggestion. The content is Markdown: it is returned rendered to sanitized HTML too, with @mentions of users and #tags linked, and its tags become those of the suggestion. With anonymity "students" the author is hidden from other students, with "everyone" from admins too; only an audited de-anonymization reveals them then.
 // @Tags suggestions
 // @Accept json
 // @Produce json
 // @Security Bearer
 // @Param suggestion body library.CreateSuggestionParams true "Suggestion"
 // @Success 200 {object} library.SuggestionResponse
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
 // @Router /suggestions [post]
-func createSuggestion(c *fiber.Ctx) error {
-	user := c.Locals("user")
-	claims := user.(*jwt.Token).Claims.(jwt.MapClaims)
+func (h *Handler) createSuggestion(c *fiber.Ctx) error {
+	claims, err := pkg.Claims(c)
+	if err != nil {
+		return err
+	}
 	userID := claims["username"].(string)
 	userType := claims["user_type"].(string)
 	if userType != "student" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "You are not authorized to create a suggestion",
-		})
+		return library.Forbidden("NOT_PERMITTED", "You are not authorized to create a suggestion")
 	}
-	var suggestion library.Suggestion
-	if err := c.BodyParser(&suggestion); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid request",
-		})
+	var params library.CreateSuggestionParams
+	if err := pkg.ParseBody(c, &params); err != nil {
+		return err
 	}
-	suggestion.AuthorID = userID // TODO: change to user.ID
-	if suggestion.Title == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Title is required",
-		})
+	author, err := h.Users.GetUser(c.UserContext(), userID)
+	if err != nil {
+		return err
 	}
-	if suggestion.Content == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Content is required",
-		})
+	content, err := library.ParseMarkdown(c.UserContext(), h.Users, "content", params.Content)
+	if err != nil {
+		return err
 	}
-	if err := suggestion.InsertToDB(); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to create suggestion",
-			"error":   err.Error(),
-		})
+	suggestion := library.Suggestion{
+		Title:      params.Title,
+		AuthorID:   userID, // TODO: change to user.ID
+		Department: author.Department,
+	}
+	suggestion.SetContent(content)
+	if err := h.Anonymizer.Anonymize(&suggestion, params.Anonymity); err != nil {
+		return err
+	}
+	if err := h.Suggestions.InsertToDB(c.UserContext(), &suggestion); err != nil {
+		return err
 	}
-	return c.JSON(suggestion.ToResponse(userID))
+	// Following would tie anonymous authors to their suggestions.
+	if suggestion.Anonymity == library.AnonymityNone {
+		h.Activity.Follow(c.UserContext(), userID, library.SubjectSuggestion, suggestion.ID.Hex())
+	}
+	return c.JSON(suggestion.ToResponse(h.Anonymizer.Viewer(userID, pkg.HasRole(claims, library.RoleAdmin))))
+}
+
+// getMySuggestions godoc
+// @Summary Get My Suggestions
+// @Description Get the suggestions of the signed in user, anonymous ones included, newest first and whatever their status
+// @Tags suggestions
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} library.SuggestionResponse
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /suggestions/mine [get]
+func (h *Handler) getMySuggestions(c *fiber.Ctx) error {
+	viewer, err := pkg.Viewer(c, h.Anonymizer)
+	if err != nil {
+		return err
+	}
+	suggestions, err := h.Suggestions.GetAuthorSuggestions(c.UserContext(), viewer.Authors())
+	if err != nil {
+		return err
+	}
+	response := []library.SuggestionResponse{}
+	for _, suggestion := range suggestions {
+		response = append(response, suggestion.ToResponse(viewer))
+	}
+	return c.JSON(response)
+}
+
+// editSuggestion godoc
+// @Summary Edit Suggestion
+// @Description Edit the title and Markdown content of your own suggestion while it is pending. The tags are those of the new content.
+// @Tags suggestions
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Suggestion ID"
+// @Param suggestion body library.EditSuggestionParams true "Suggestion"
+// @Success 200 {object} library.SuggestionResponse
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 409 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /suggestions/{id} [patch]
+func (h *Handler) editSuggestion(c *fiber.Ctx) error {
+	viewer, err := pkg.Viewer(c, h.Anonymizer)
+	if err != nil {
+		return err
+	}
+	var params library.EditSuggestionParams
+	if err := pkg.ParseBody(c, &params); err != nil {
+		return err
+	}
+	if _, err := library.ParseID("id", c.Params("id")); err != nil {
+		return err
+	}
+	suggestion := library.Suggestion{}
+	if err := h.Suggestions.WithID(c.UserContext(), &suggestion, c.Params("id")); err != nil {
+		return err
+	}
+	if !viewer.Authored(&suggestion) {
+		return library.Forbidden("NOT_AUTHOR", "You can only edit your own suggestions")
+	}
+	content, err := library.ParseMarkdown(c.UserContext(), h.Users, "content", params.Content)
+	if err != nil {
+		return err
+	}
+	if err := h.Suggestions.Edit(c.UserContext(), &suggestion, params.Title, content); err != nil {
+		return err
+	}
+	return c.JSON(suggestion.ToResponse(viewer))
 }
 
 // getRejectedSuggestions godoc
@@ -240,32 +305,25 @@ func createSuggestion(c *fiber.Ctx) error {
 // @Failure 401 {object} library.ErrorPayload
 // @Failure 500 {object} library.ErrorPayload
 // @Router /suggestions/rejected [get]
-func getRejectedSuggestions(c *fiber.Ctx) error {
-	user := c.Locals("user")
-	if user == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "You are not logged in",
-		})
+func (h *Handler) getRejectedSuggestions(c *fiber.Ctx) error {
+	viewer, err := pkg.Viewer(c, h.Anonymizer)
+	if err != nil {
+		return err
 	}
-	claims := user.(*jwt.Token).Claims.(jwt.MapClaims)
-	userID := claims["username"].(string)
-	suggestions, err := library.GetRejectedSuggestions()
+	suggestions, err := h.Suggestions.GetRejectedSuggestions(c.UserContext())
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to get suggestions",
-			"error":   err.Error(),
-		})
+		return err
 	}
-	var response []library.SuggestionResponse
+	response := []library.SuggestionResponse{}
 	for _, suggestion := range suggestions {
-		response = append(response, suggestion.ToResponse(userID))
+		response = append(response, suggestion.ToResponse(viewer))
 	}
 	return c.JSON(response)
 }
 
 // upvoteSuggestion godoc
 // @Summary Upvote Suggestion
-// @Description Upvote a suggestion
+// @Description Upvote a suggestion, replacing a downvote. Upvoting again changes nothing.
 // @Tags suggestions
 // @Accept json
 // @Produce json
@@ -273,27 +331,122 @@ func getRejectedSuggestions(c *fiber.Ctx) error {
 // @Param id path string true "Suggestion ID"
 // @Success 200 {object} library.SuggestionResponse
 // @Failure 400 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
 // @Failure 500 {object} library.ErrorPayload
 // @Router /suggestions/{id}/upvote [put]
-func upvoteSuggestion(c *fiber.Ctx) error {
-	user := c.Locals("user")
-	claims := user.(*jwt.Token).Claims.(jwt.MapClaims)
-	userID := claims["username"].(string)
+func (h *Handler) upvoteSuggestion(c *fiber.Ctx) error {
+	return h.vote(c, library.Upvote, false)
+}
+
+// removeUpvote godoc
+// @Summary Remove Upvote
+// @Description Take back your upvote of a suggestion. Without one nothing changes.
+// @Tags suggestions
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Suggestion ID"
+// @Success 200 {object} library.SuggestionResponse
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /suggestions/{id}/upvote [delete]
+func (h *Handler) removeUpvote(c *fiber.Ctx) error {
+	return h.vote(c, library.Upvote, true)
+}
+
+// downvoteSuggestion godoc
+// @Summary Downvote Suggestion
+// @Description Downvote a suggestion, replacing an upvote. Downvoting again changes nothing.
+// @Tags suggestions
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Suggestion ID"
+// @Success 200 {object} library.SuggestionResponse
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /suggestions/{id}/downvote [put]
+func (h *Handler) downvoteSuggestion(c *fiber.Ctx) error {
+	return h.vote(c, library.Downvote, false)
+}
+
+// removeDownvote godoc
+// @Summary Remove Downvote
+// @Description Take back your downvote of a suggestion. Without one nothing changes.
+// @Tags suggestions
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Suggestion ID"
+// @Success 200 {object} library.SuggestionResponse
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /suggestions/{id}/downvote [delete]
+func (h *Handler) removeDownvote(c *fiber.Ctx) error {
+	return h.vote(c, library.Downvote, true)
+}
+
+// vote casts or retracts the vote of kind by the signed in user.
+func (h *Handler) vote(c *fiber.Ctx, kind library.VoteKind, retract bool) error {
+	viewer, err := pkg.Viewer(c, h.Anonymizer)
+	if err != nil {
+		return err
+	}
 	suggestion := library.Suggestion{}
-	if suggestionID, err := primitive.ObjectIDFromHex(c.Params("id")); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid suggestion ID",
-		})
+	if suggestion.ID, err = library.ParseID("id", c.Params("id")); err != nil {
+		return err
+	}
+	if retract {
+		err = h.Suggestions.Unvote(c.UserContext(), &suggestion, viewer.Username, kind)
 	} else {
-		suggestion.ID = suggestionID
+		err = h.Suggestions.Vote(c.UserContext(), &suggestion, viewer.Username, kind)
 	}
-	if err := suggestion.GiveUpvote(userID); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to upvote suggestion",
-			"error":   err.Error(),
-		})
+	if err != nil {
+		return err
+	}
+	// Following would tie anonymous authors to their suggestions.
+	anonymous := suggestion.Anonymity != library.AnonymityNone && viewer.Authored(&suggestion)
+	if kind == library.Upvote && !retract && viewer.CanSee(&suggestion) && !anonymous {
+		h.Activity.Follow(c.UserContext(), viewer.Username, library.SubjectSuggestion, suggestion.ID.Hex())
+	}
+	return c.JSON(suggestion.ToResponse(viewer))
+}
+
+// getVoters godoc
+// @Summary Get Voters
+// @Description Get a page of the users who voted on a suggestion, ordered by username
+// @Tags suggestions
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Suggestion ID"
+// @Param vote query string false "Only upvotes or downvotes" Enums(upvote, downvote)
+// @Param page query int false "Page, from 1"
+// @Param per_page query int false "Page size, at most 100"
+// @Success 200 {object} library.Page[library.Voter]
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /suggestions/{id}/voters [get]
+func (h *Handler) getVoters(c *fiber.Ctx) error {
+	id, err := library.ParseID("id", c.Params("id"))
+	if err != nil {
+		return err
+	}
+	var q library.VoterQuery
+	if err := pkg.ParseQuery(c, &q); err != nil {
+		return err
+	}
+	voters, err := h.Suggestions.GetVoters(c.UserContext(), id, q)
+	if err != nil {
+		return err
 	}
-	return c.JSON(suggestion.ToResponse(userID))
+	return c.JSON(voters)
 }
 
 // starSuggestion godoc
@@ -307,43 +460,36 @@ func upvoteSuggestion(c *fiber.Ctx) error {
 // @Param star body library.StarSuggestionParams true "Star"
 // @Success 200 {object} library.SuggestionResponse
 // @Failure 400 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
 // @Failure 500 {object} library.ErrorPayload
 // @Router /suggestions/{id}/star [put]
-func starSuggestion(c *fiber.Ctx) error {
-	type Params struct {
-		Star int `json:"star"`
+func (h *Handler) starSuggestion(c *fiber.Ctx) error {
+	viewer, err := pkg.Viewer(c, h.Anonymizer)
+	if err != nil {
+		return err
 	}
-	user := c.Locals("user")
-	claims := user.(*jwt.Token).Claims.(jwt.MapClaims)
-	userID := claims["username"].(string)
 	/* userType := claims["user_type"].(string)
 	if userType == "student" {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": "You are not authorized to star a suggestion",
 		})
 	} */
-	var params Params
-	if err := c.BodyParser(&params); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid request",
-		})
+	var params library.StarSuggestionParams
+	if err := pkg.ParseBody(c, &params); err != nil {
+		return err
 	}
 	suggestion := library.Suggestion{}
-	if suggestionID, err := primitive.ObjectIDFromHex(c.Params("id")); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid suggestion ID",
-		})
+	if suggestionID, err := library.ParseID("id", c.Params("id")); err != nil {
+		return err
 	} else {
 		suggestion.ID = suggestionID
 	}
-	if err := suggestion.GiveStar(userID, params.Star); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to star suggestion",
-			"error":   err.Error(),
-		})
+	if err := h.Suggestions.GiveStar(c.UserContext(), &suggestion, viewer.Username, params.Star); err != nil {
+		return err
 	}
 
-	return c.Status(fiber.StatusOK).JSON(suggestion.ToResponse(userID))
+	return c.Status(fiber.StatusOK).JSON(suggestion.ToResponse(viewer))
 }
 
 // approveSuggestion godoc
@@ -356,27 +502,27 @@ func starSuggestion(c *fiber.Ctx) error {
 // @Param id path string true "Suggestion ID"
 // @Success 200 {object} library.SuggestionResponse
 // @Failure 400 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 409 {object} library.ErrorPayload
 // @Failure 500 {object} library.ErrorPayload
 // @Router /suggestions/{id}/approve [patch]
-func approveSuggestion(c *fiber.Ctx) error {
-	user := c.Locals("user")
-	claims := user.(*jwt.Token).Claims.(jwt.MapClaims)
-	userID := claims["username"].(string)
+func (h *Handler) approveSuggestion(c *fiber.Ctx) error {
+	viewer, err := pkg.Viewer(c, h.Anonymizer)
+	if err != nil {
+		return err
+	}
 	suggestion := library.Suggestion{}
-	if suggestionID, err := primitive.ObjectIDFromHex(c.Params("id")); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid suggestion ID",
-		})
+	if suggestionID, err := library.ParseID("id", c.Params("id")); err != nil {
+		return err
 	} else {
 		suggestion.ID = suggestionID
 	}
-	if err := suggestion.Approve(userID); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to approve suggestion",
-			"error":   err.Error(),
-		})
+	if err := h.Suggestions.Approve(c.UserContext(), &suggestion, viewer.Username); err != nil {
+		return err
 	}
-	return c.JSON(suggestion.ToResponse(userID))
+	h.Activity.Publish(c.UserContext(), suggestion.Activity(library.ActivityApproved))
+	return c.JSON(suggestion.ToResponse(viewer))
 }
 
 // rejectSuggestion godoc
@@ -390,40 +536,31 @@ func approveSuggestion(c *fiber.Ctx) error {
 // @Param reason body library.WithReasonParams true "Reason"
 // @Success 200 {object} library.SuggestionResponse
 // @Failure 400 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 409 {object} library.ErrorPayload
 // @Failure 500 {object} library.ErrorPayload
 // @Router /suggestions/{id}/reject [patch]
-func rejectSuggestion(c *fiber.Ctx) error {
-	user := c.Locals("user")
-	claims := user.(*jwt.Token).Claims.(jwt.MapClaims)
-	userID := claims["username"].(string)
-	suggestion := library.Suggestion{}
-	var params struct {
-		Reason string `json:"reason"`
-	}
-	if err := c.BodyParser(&params); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid request",
-		})
+func (h *Handler) rejectSuggestion(c *fiber.Ctx) error {
+	viewer, err := pkg.Viewer(c, h.Anonymizer)
+	if err != nil {
+		return err
 	}
-	if params.Reason == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Reason is required",
-		})
+	suggestion := library.Suggestion{}
+	var params library.WithReasonParams
+	if err := pkg.ParseBody(c, &params); err != nil {
+		return err
 	}
-	if suggestionID, err := primitive.ObjectIDFromHex(c.Params("id")); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid suggestion ID",
-		})
+	if suggestionID, err := library.ParseID("id", c.Params("id")); err != nil {
+		return err
 	} else {
 		suggestion.ID = suggestionID
 	}
-	if err := suggestion.Reject(userID, params.Reason); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to reject suggestion",
-			"error":   err.Error(),
-		})
+	if err := h.Suggestions.Reject(c.UserContext(), &suggestion, viewer.Username, params.Reason); err != nil {
+		return err
 	}
-	return c.JSON(suggestion.ToResponse(userID))
+	h.Activity.Publish(c.UserContext(), suggestion.Activity(library.ActivityRejected))
+	return c.JSON(suggestion.ToResponse(viewer))
 }
 
 // reportSuggestion godoc
@@ -436,25 +573,91 @@ func rejectSuggestion(c *fiber.Ctx) error {
 // @Param id path string true "Suggestion ID"
 // @Success 200 {object} library.SuggestionResponse
 // @Failure 400 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 409 {object} library.ErrorPayload
 // @Failure 500 {object} library.ErrorPayload
 // @Router /suggestions/{id}/report [patch]
-func reportSuggestion(c *fiber.Ctx) error {
-	user := c.Locals("user")
-	claims := user.(*jwt.Token).Claims.(jwt.MapClaims)
-	userID := claims["username"].(string)
+func (h *Handler) reportSuggestion(c *fiber.Ctx) error {
+	viewer, err := pkg.Viewer(c, h.Anonymizer)
+	if err != nil {
+		return err
+	}
 	suggestion := library.Suggestion{}
-	if suggestionID, err := primitive.ObjectIDFromHex(c.Params("id")); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid suggestion ID",
-		})
+	if suggestionID, err := library.ParseID("id", c.Params("id")); err != nil {
+		return err
 	} else {
 		suggestion.ID = suggestionID
 	}
-	if err := suggestion.Report(userID); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to report suggestion",
-			"error":   err.Error(),
-		})
+	if err := h.Suggestions.Report(c.UserContext(), &suggestion, viewer.Username); err != nil {
+		return err
+	}
+	return c.JSON(suggestion.ToResponse(viewer))
+}
+
+// deanonymizeSuggestion godoc
+// @Summary De-anonymize Suggestion
+// @Description Reveal the author of an anonymous suggestion. The reason is written to the audit log, together with who asked, before the author is returned.
+// @Tags suggestions
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Suggestion ID"
+// @Param reason body library.WithReasonParams true "Reason"
+// @Success 200 {object} library.Deanonymization
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 409 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Failure 503 {object} library.ErrorPayload
+// @Router /suggestions/{id}/deanonymize [patch]
+func (h *Handler) deanonymizeSuggestion(c *fiber.Ctx) error {
+	viewer, err := pkg.Viewer(c, h.Anonymizer)
+	if err != nil {
+		return err
+	}
+	var params library.WithReasonParams
+	if err := pkg.ParseBody(c, &params); err != nil {
+		return err
+	}
+	if _, err := library.ParseID("id", c.Params("id")); err != nil {
+		return err
+	}
+	suggestion := library.Suggestion{}
+	if err := h.Suggestions.WithID(c.UserContext(), &suggestion, c.Params("id")); err != nil {
+		return err
+	}
+	d, err := h.Anonymizer.Deanonymize(c.UserContext(), h.Suggestions, &suggestion, viewer.Username, params.Reason)
+	if err != nil {
+		return err
+	}
+	return c.JSON(d)
+}
+
+// getDeanonymizations godoc
+// @Summary Get De-anonymizations
+// @Description Get a page of the audit log of revealed authors, newest first
+// @Tags suggestions
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param page query int false "Page, from 1"
+// @Param per_page query int false "Page size, at most 100"
+// @Success 200 {object} library.Page[library.Deanonymization]
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 403 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /suggestions/deanonymizations [get]
+func (h *Handler) getDeanonymizations(c *fiber.Ctx) error {
+	var q library.PageQuery
+	if err := pkg.ParseQuery(c, &q); err != nil {
+		return err
+	}
+	log, err := h.Suggestions.GetDeanonymizations(c.UserContext(), q)
+	if err != nil {
+		return err
 	}
-	return c.JSON(suggestion.ToResponse(userID))
+	return c.JSON(log)
 }
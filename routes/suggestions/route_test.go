@@ -0,0 +1,227 @@
+package suggestions_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"272-backend/config"
+	"272-backend/library"
+	"272-backend/pkg"
+	"272-backend/routes/suggestions"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type fixture struct {
+	admin, author, reader library.User
+	anonymizer            *library.Anonymizer
+	do                    func(method, path string, u library.User, body string, out interface{}) int
+}
+
+func newFixture(t *testing.T) fixture {
+	repos := library.NewMemoryRepositories()
+	ctx := context.Background()
+	f := fixture{
+		admin:  library.User{Username: "t1000000001", UserType: "teacher", Roles: []string{library.RoleAdmin}},
+		author: library.User{Username: "c2011011025", UserType: "student"},
+		reader: library.User{Username: "c2011011026", UserType: "student"},
+	}
+	for _, u := range []*library.User{&f.admin, &f.author, &f.reader} {
+		if err := repos.Users.InsertToDB(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var err error
+	if f.anonymizer, err = library.NewAnonymizer(&config.Config{JWTSecretKey: "test-secret"}); err != nil {
+		t.Fatal(err)
+	}
+	app := pkg.NewFiber(&config.Config{})
+	auth := pkg.NewJWT("test-secret")
+	suggestions.Register(app.Group("/suggestions"), auth, &suggestions.Handler{
+		Suggestions: repos.Suggestions,
+		Users:       repos.Users,
+		Anonymizer:  f.anonymizer,
+	})
+	f.do = func(method, path string, u library.User, body string, out interface{}) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+auth.CreateToken(jwt.MapClaims{"username": u.Username, "user_type": u.UserType, "roles": u.Roles}))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		if out != nil {
+			if err := json.Unmarshal(raw, out); err != nil {
+				t.Fatalf("%s %s: %v: %s", method, path, err, raw)
+			}
+		}
+		return resp.StatusCode
+	}
+	return f
+}
+
+func TestAnonymousSuggestions(t *testing.T) {
+	f := newFixture(t)
+	admin, author, reader, do := f.admin, f.author, f.reader, f.do
+
+	var hidden, shy library.SuggestionResponse
+	if status := do(http.MethodPost, "/suggestions", author, `{"title":"Grading in CS101","content":"Exams are graded unfairly","anonymity":"everyone"}`, &hidden); status != http.StatusOK || hidden.Author != author.Username || !hidden.Mine {
+		t.Fatalf("anonymous suggestion: status %d, %+v", status, hidden)
+	}
+	if status := do(http.MethodPost, "/suggestions", author, `{"title":"Quiet rooms","content":"The library needs them","anonymity":"students"}`, &shy); status != http.StatusOK {
+		t.Fatalf("suggestion hidden from students: status %d", status)
+	}
+	if status := do(http.MethodPost, "/suggestions", author, `{"title":"Quiet rooms","content":"Again","anonymity":"nobody"}`, nil); status != http.StatusBadRequest {
+		t.Fatalf("unknown anonymity: status %d", status)
+	}
+
+	var seen library.SuggestionResponse
+	for _, viewer := range []struct {
+		name       string
+		user       library.User
+		id         string
+		author     string
+		department int
+	}{
+		{"student", reader, hidden.ID, "", 0},
+		{"student", reader, shy.ID, "", 0},
+		{"admin", admin, hidden.ID, f.anonymizer.Pseudonym(author.Username), 0},
+		{"admin", admin, shy.ID, author.Username, 11011},
+		{"author", author, hidden.ID, author.Username, 0},
+	} {
+		seen = library.SuggestionResponse{}
+		if status := do(http.MethodGet, "/suggestions/"+viewer.id, viewer.user, "", &seen); status != http.StatusOK || seen.Author != viewer.author || seen.Department != viewer.department || seen.Anonymity == "" {
+			t.Fatalf("%s sees %s: status %d, %+v, want author %q", viewer.name, viewer.id, status, seen, viewer.author)
+		}
+	}
+
+	var mine []library.SuggestionResponse
+	if status := do(http.MethodGet, "/suggestions/mine", author, "", &mine); status != http.StatusOK || len(mine) != 2 || mine[0].ID != shy.ID {
+		t.Fatalf("author's suggestions: status %d, %+v", status, mine)
+	}
+	if status := do(http.MethodGet, "/suggestions/mine", reader, "", &mine); status != http.StatusOK || len(mine) != 0 {
+		t.Fatalf("reader's suggestions: status %d, %+v", status, mine)
+	}
+
+	edit := `{"title":"Grading in CS 101","content":"Exams are graded unfairly"}`
+	if status := do(http.MethodPatch, "/suggestions/"+hidden.ID, reader, edit, nil); status != http.StatusForbidden {
+		t.Fatalf("reader edits: status %d", status)
+	}
+	if status := do(http.MethodPatch, "/suggestions/"+hidden.ID, author, edit, &seen); status != http.StatusOK || seen.Title != "Grading in CS 101" {
+		t.Fatalf("author edits: status %d, %+v", status, seen)
+	}
+
+	reason := `{"reason":"Threats against a lecturer"}`
+	if status := do(http.MethodPatch, "/suggestions/"+hidden.ID+"/deanonymize", reader, reason, nil); status != http.StatusForbidden {
+		t.Fatalf("student de-anonymizes: status %d", status)
+	}
+	if status := do(http.MethodPatch, "/suggestions/"+hidden.ID+"/deanonymize", admin, `{}`, nil); status != http.StatusBadRequest {
+		t.Fatalf("de-anonymization without a reason: status %d", status)
+	}
+	var revealed library.Deanonymization
+	if status := do(http.MethodPatch, "/suggestions/"+hidden.ID+"/deanonymize", admin, reason, &revealed); status != http.StatusOK || revealed.Author != author.Username || revealed.Actor != admin.Username {
+		t.Fatalf("de-anonymization: status %d, %+v", status, revealed)
+	}
+	var log library.Page[library.Deanonymization]
+	if status := do(http.MethodGet, "/suggestions/deanonymizations", admin, "", &log); status != http.StatusOK || log.Total != 1 || log.Items[0].Reason != "Threats against a lecturer" || log.Items[0].Suggestion.Hex() != hidden.ID {
+		t.Fatalf("audit log: status %d, %+v", status, log)
+	}
+}
+
+func TestVotes(t *testing.T) {
+	f := newFixture(t)
+	var s library.SuggestionResponse
+	if status := f.do(http.MethodPost, "/suggestions", f.author, `{"title":"More benches","content":"In the garden"}`, &s); status != http.StatusOK || s.Score != 0 {
+		t.Fatalf("create: status %d, %+v", status, s)
+	}
+	path := "/suggestions/" + s.ID
+	for _, step := range []struct {
+		method, path string
+		voter        library.User
+		upvotes      int
+		downvotes    int
+		vote         int
+	}{
+		{http.MethodPut, path + "/upvote", f.reader, 1, 0, 1},
+		{http.MethodPut, path + "/upvote", f.reader, 1, 0, 1},
+		{http.MethodPut, path + "/downvote", f.reader, 0, 1, -1},
+		{http.MethodDelete, path + "/upvote", f.reader, 0, 1, -1},
+		{http.MethodPut, path + "/upvote", f.author, 1, 1, 1},
+		{http.MethodDelete, path + "/downvote", f.reader, 1, 0, 0},
+		{http.MethodDelete, path + "/downvote", f.reader, 1, 0, 0},
+	} {
+		if status := f.do(step.method, step.path, step.voter, "", &s); status != http.StatusOK || s.Upvotes != step.upvotes || s.Downvotes != step.downvotes || s.Score != step.upvotes-step.downvotes || s.Vote != step.vote {
+			t.Fatalf("%s %s by %s: status %d, %+v", step.method, step.path, step.voter.Username, status, s)
+		}
+	}
+	f.do(http.MethodPut, path+"/downvote", f.reader, "", nil)
+
+	if status := f.do(http.MethodGet, path+"/voters", f.reader, "", nil); status != http.StatusForbidden {
+		t.Fatalf("student lists voters: status %d", status)
+	}
+	var voters library.Page[library.Voter]
+	if status := f.do(http.MethodGet, path+"/voters?vote=downvote", f.admin, "", &voters); status != http.StatusOK || voters.Total != 1 || voters.Items[0] != (library.Voter{Username: f.reader.Username, Vote: library.Downvote}) {
+		t.Fatalf("downvoters: status %d, %+v", status, voters)
+	}
+	if status := f.do(http.MethodGet, path+"/voters?vote=sideways", f.admin, "", nil); status != http.StatusBadRequest {
+		t.Fatalf("unknown vote: status %d", status)
+	}
+}
+
+func TestMarkdownContent(t *testing.T) {
+	f := newFixture(t)
+	var s library.SuggestionResponse
+	body := `{"title":"More benches","content":"Ask @c2011011026 about #Garden <script>alert(1)</script>"}`
+	if status := f.do(http.MethodPost, "/suggestions", f.author, body, &s); status != http.StatusOK {
+		t.Fatalf("create: status %d", status)
+	}
+	if s.Content != "Ask @c2011011026 about #Garden <script>alert(1)</script>" || strings.Contains(s.ContentHTML, "<script") ||
+		!strings.Contains(s.ContentHTML, `<a href="/users/c2011011026" class="mention"`) ||
+		len(s.Mentions) != 1 || s.Mentions[0] != f.reader.Username || len(s.Tags) != 1 || s.Tags[0] != "garden" {
+		t.Fatalf("created %+v", s)
+	}
+	if status := f.do(http.MethodPatch, "/suggestions/"+s.ID, f.author, `{"title":"More benches","content":"Plain now"}`, &s); status != http.StatusOK || len(s.Mentions) != 0 || len(s.Tags) != 0 {
+		t.Fatalf("edit: status %d, %+v", status, s)
+	}
+	if status := f.do(http.MethodPatch, "/suggestions/"+s.ID, f.author, `{"title":"More benches","content":"`+strings.Repeat(">", 40)+`"}`, nil); status != http.StatusBadRequest {
+		t.Fatalf("edit with deep nesting: status %d", status)
+	}
+
+	var other library.SuggestionResponse
+	f.do(http.MethodPost, "/suggestions", f.author, `{"title":"Garden lights","content":"For the #garden"}`, &other)
+	for _, id := range []string{s.ID, other.ID} {
+		if status := f.do(http.MethodPatch, "/suggestions/"+id+"/approve", f.admin, "", nil); status != http.StatusOK {
+			t.Fatalf("approve: status %d", status)
+		}
+	}
+	var tagged []library.SuggestionResponse
+	if status := f.do(http.MethodGet, "/suggestions?tag=Garden", f.reader, "", &tagged); status != http.StatusOK || len(tagged) != 1 || tagged[0].ID != other.ID {
+		t.Fatalf("tagged suggestions: status %d, %+v", status, tagged)
+	}
+}
+
+func TestEmptyListsAreArrays(t *testing.T) {
+	f := newFixture(t)
+	for _, c := range []struct {
+		path string
+		user library.User
+	}{
+		{"/suggestions", f.reader},
+		{"/suggestions/mine", f.reader},
+		{"/suggestions/pending", f.admin},
+		{"/suggestions/rejected", f.admin},
+		{"/suggestions/reported", f.admin},
+	} {
+		var raw json.RawMessage
+		if status := f.do(http.MethodGet, c.path, c.user, "", &raw); status != http.StatusOK || string(raw) != "[]" {
+			t.Errorf("%s: status %d, %s", c.path, status, raw)
+		}
+	}
+}
@@ -3,36 +3,197 @@ package users
 import (
 	"272-backend/library"
 	"272-backend/pkg"
+	"272-backend/pkg/profiles"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func init() {
-	userRoutes := pkg.App.Group("/users")
-	pkg.UseJWT(userRoutes)
-	userRoutes.Get("/", getUsers)
-	userRoutes.Get("/:id", getUser)
+type Handler struct {
+	Users    library.UserRepository
+	Profiles *profiles.Refresher
+	Vault    *pkg.CredentialVault
+}
+
+func Register(userRoutes fiber.Router, auth *pkg.JWT, h *Handler) {
+	auth.Use(userRoutes)
+	userRoutes.Get("/", h.getUsers)
+	userRoutes.Get("/me", h.getMe)
+	userRoutes.Patch("/me", h.patchMe)
+	userRoutes.Post("/me/refresh", h.refreshMe)
+	userRoutes.Get("/:id", h.getUser)
 	// userRoutes.Post("/", register)
 }
 
-func getUsers(c *fiber.Ctx) error {
-	users, err := library.GetUsers()
+// viewer loads the user the request is authenticated as.
+func (h *Handler) viewer(c *fiber.Ctx) (library.User, error) {
+	claims, err := pkg.Claims(c)
+	if err != nil {
+		return library.User{}, err
+	}
+	return h.Users.GetUser(c.UserContext(), claims["username"].(string))
+}
+
+// getUsers godoc
+// @Summary Search users
+// @Description Search the user directory. q matches part of a full name; fields hidden by a user's privacy settings are left out.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param q query string false "Part of a full name"
+// @Param department query int false "Department ID"
+// @Param faculty query string false "Faculty name as the portal reports it"
+// @Param faculty_code query int false "Registered faculty code"
+// @Param user_type query string false "student or teacher" Enums(student, teacher)
+// @Param page query int false "Page, from 1"
+// @Param per_page query int false "Page size, 20 by default" maximum(100)
+// @Success 200 {object} library.Page[library.UserProfile]
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /users [get]
+func (h *Handler) getUsers(c *fiber.Ctx) error {
+	var query library.UserQuery
+	if err := pkg.ParseQuery(c, &query); err != nil {
+		return err
+	}
+	viewer, err := h.viewer(c)
+	if err != nil {
+		return err
+	}
+	query.Viewer = &viewer
+	users, err := h.Users.SearchUsers(c.UserContext(), query)
+	if err != nil {
+		return err
+	}
+	return c.JSON(library.ProfilesFor(users, &viewer))
+}
+
+// getUser godoc
+// @Summary Get user
+// @Description Get the profile of a user, without the fields their privacy settings hide
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Username"
+// @Success 200 {object} library.UserProfile
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /users/{id} [get]
+func (h *Handler) getUser(c *fiber.Ctx) error {
+	viewer, err := h.viewer(c)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to get users",
-		})
+		return err
 	}
+	user, err := h.Users.GetUser(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(user.ProfileFor(&viewer))
+}
+
+// me is the signed in user's own record with every privacy setting spelled
+// out.
+type me struct {
+	library.User
+	Privacy library.Privacy `json:"privacy"`
+}
 
-	return c.JSON(users)
+func newMe(u library.User) me {
+	return me{User: u, Privacy: u.Privacy.Effective()}
 }
 
-func getUser(c *fiber.Ctx) error {
-	id := c.Params("id")
-	user, err := library.GetUser(id)
+// getMe godoc
+// @Summary Get own profile
+// @Description Get the full profile of the signed in user with their privacy settings
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} me
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /users/me [get]
+func (h *Handler) getMe(c *fiber.Ctx) error {
+	user, err := h.viewer(c)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"message": "Failed to get user",
-		})
+		return err
+	}
+	return c.JSON(newMe(user))
+}
+
+type patchMeParams struct {
+	Privacy library.Privacy `json:"privacy"`
+}
+
+// patchMe godoc
+// @Summary Update own profile
+// @Description Change privacy settings. Fields left out keep their current setting. The profile itself comes from the portal and cannot be edited.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param body body patchMeParams true "Settings to change"
+// @Success 200 {object} me
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 404 {object} library.ErrorPayload
+// @Failure 500 {object} library.ErrorPayload
+// @Router /users/me [patch]
+func (h *Handler) patchMe(c *fiber.Ctx) error {
+	var params patchMeParams
+	if err := pkg.ParseBody(c, &params); err != nil {
+		return err
+	}
+	user, err := h.viewer(c)
+	if err != nil {
+		return err
+	}
+	if err := h.Users.UpdatePrivacy(c.UserContext(), &user, user.Privacy.Merge(params.Privacy)); err != nil {
+		return err
+	}
+	return c.JSON(newMe(user))
+}
+
+type refreshParams struct {
+	Password library.Secret `json:"password,omitempty" validate:"omitempty,max=256" swaggertype:"string" format:"password"`
+}
+
+// refreshMe godoc
+// @Summary Refresh own profile
+// @Description Queue a refresh of the profile from the portal. The password may be omitted when it was remembered at login.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param body body refreshParams false "Portal password"
+// @Success 202
+// @Failure 400 {object} library.ErrorPayload
+// @Failure 401 {object} library.ErrorPayload
+// @Failure 503 {object} library.ErrorPayload
+// @Router /users/me/refresh [post]
+func (h *Handler) refreshMe(c *fiber.Ctx) error {
+	var params refreshParams
+	defer func() { params.Password.Wipe() }()
+	if len(c.Body()) > 0 {
+		if err := pkg.ParseBody(c, &params); err != nil {
+			return err
+		}
+	}
+	claims, err := pkg.Claims(c)
+	if err != nil {
+		return err
+	}
+	username := claims["username"].(string)
+	if params.Password, err = h.Vault.Password(c.UserContext(), username, params.Password); err != nil {
+		return err
+	}
+	// A refresh already waiting for the user answers this request as well.
+	if _, err := h.Profiles.Enqueue(username, params.Password); err != nil {
+		return err
 	}
-	return c.JSON(user)
+	return c.SendStatus(fiber.StatusAccepted)
 }
@@ -0,0 +1,102 @@
+package users_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"272-backend/config"
+	"272-backend/library"
+	"272-backend/pkg"
+	"272-backend/routes/users"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestDirectoryRespectsPrivacy(t *testing.T) {
+	repos := library.NewMemoryRepositories()
+	ctx := context.Background()
+	for _, u := range []library.User{
+		{Username: "c2011011025", UserType: "student"},
+		{Username: "c2012011001", UserType: "student"},
+	} {
+		if err := repos.Users.InsertToDB(ctx, &u); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.Users.UpdateProfile(ctx, &u, library.PersonalInfo{FullName: "Ada " + u.Username, Rank: "1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app := pkg.NewFiber(&config.Config{})
+	auth := pkg.NewJWT("test-secret")
+	users.Register(app.Group("/users"), auth, &users.Handler{Users: repos.Users})
+	tokenOf := func(username string) string {
+		return auth.CreateToken(jwt.MapClaims{"username": username, "user_type": "student", "roles": []string{"student"}})
+	}
+	do := func(method, path, token, body string, out interface{}) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		if out != nil {
+			if err := json.Unmarshal(raw, out); err != nil {
+				t.Fatalf("%s %s: %v: %s", method, path, err, raw)
+			}
+		}
+		return resp.StatusCode
+	}
+	ada, other := tokenOf("c2011011025"), tokenOf("c2012011001")
+
+	var page library.Page[library.UserProfile]
+	if status := do(http.MethodGet, "/users?q=ada&per_page=1&page=2", other, "", &page); status != http.StatusOK {
+		t.Fatalf("search: status %d", status)
+	}
+	if page.Total != 2 || page.PerPage != 1 || len(page.Items) != 1 || page.Items[0].Username != "c2012011001" {
+		t.Fatalf("second page = %+v", page)
+	}
+	var errPayload library.ErrorPayload
+	if status := do(http.MethodGet, "/users?per_page=500", other, "", &errPayload); status != http.StatusBadRequest || errPayload.Fields[0].Field != "per_page" {
+		t.Fatalf("per_page=500: status %d, %+v", status, errPayload)
+	}
+
+	var profile library.UserProfile
+	do(http.MethodGet, "/users/c2011011025", other, "", &profile)
+	if profile.FullName != "Ada c2011011025" || profile.Rank != "" {
+		t.Fatalf("profile seen by another department = %+v", profile)
+	}
+
+	var me struct {
+		Username string          `json:"id"`
+		Privacy  library.Privacy `json:"privacy"`
+	}
+	if status := do(http.MethodPatch, "/users/me", ada, `{"privacy":{"full_name":"private"}}`, &me); status != http.StatusOK {
+		t.Fatalf("PATCH /users/me: status %d", status)
+	}
+	if me.Privacy.FullName != library.VisibilityPrivate || me.Privacy.Rank != library.VisibilityPrivate || me.Privacy.Year != library.VisibilityDepartment {
+		t.Fatalf("privacy after PATCH = %+v", me.Privacy)
+	}
+	if status := do(http.MethodPatch, "/users/me", ada, `{"privacy":{"rank":"everyone"}}`, &errPayload); status != http.StatusBadRequest || errPayload.Fields[0].Field != "privacy.rank" {
+		t.Fatalf("invalid visibility: status %d, %+v", status, errPayload)
+	}
+
+	profile = library.UserProfile{}
+	do(http.MethodGet, "/users/c2011011025", other, "", &profile)
+	if profile.FullName != "" {
+		t.Fatalf("private name shown: %+v", profile)
+	}
+	if do(http.MethodGet, "/users?q=ada", other, "", &page); page.Total != 1 {
+		t.Fatalf("search matched a private name: %+v", page)
+	}
+	do(http.MethodGet, "/users/me", ada, "", &me)
+	if me.Username != "c2011011025" || me.Privacy.FullName != library.VisibilityPrivate {
+		t.Fatalf("GET /users/me = %+v", me)
+	}
+}